@@ -0,0 +1,382 @@
+// Package catalog describes the examples in a machine-readable form,
+// written by update-examples to examples/examples.json for tools (such
+// as editors and galleries) that would otherwise scrape the READMEs.
+// The format is described by the JSON Schema in
+// examples/examples.schema.json.
+package catalog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+// Schema is the catalog's "$schema", relative to the catalog.
+const Schema = "examples.schema.json"
+
+// Catalog lists the examples in order.
+type Catalog struct {
+	Schema   string     `json:"$schema"`
+	Examples []*Example `json:"examples"`
+}
+
+// Example is one example directory. All paths in the catalog are
+// relative to the root of the repo and use forward slashes.
+type Example struct {
+	Name      string    `json:"name"` // such as "001-sphere"
+	Number    int       `json:"number"`
+	Path      string    `json:"path"`
+	Readme    string    `json:"readme,omitempty"`
+	Thumbnail string    `json:"thumbnail,omitempty"` // a path or URL
+	Shaders   []*Shader `json:"shaders"`
+	// Files are the example's other files (such as #included shaders),
+	// not counting images, READMEs, and Go sources.
+	Files []*File `json:"files,omitempty"`
+}
+
+// Shader is one IRMF file of an example, described by its header.
+type Shader struct {
+	File
+	Title     string    `json:"title,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	License   string    `json:"license,omitempty"`
+	Date      string    `json:"date,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	Language  string    `json:"language"`
+	Encoding  string    `json:"encoding,omitempty"`
+	Materials []string  `json:"materials"`
+	Units     string    `json:"units"`
+	Min       []float64 `json:"min"`
+	Max       []float64 `json:"max"`
+	// Twin is the same model in the other shader language, if any.
+	Twin      string `json:"twin,omitempty"`
+	Thumbnail string `json:"thumbnail,omitempty"` // a path or URL
+	// Artifacts are the files generated from the shader, such as STL and
+	// sliced files, named after it.
+	Artifacts []*File `json:"artifacts,omitempty"`
+
+	// Fingerprint is the shader's semantic fingerprint as recorded in
+	// examples/fingerprints.txt (see cmd/irmf-fingerprint).
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Usage is the estimated material usage (see update-examples -usage).
+	// It is only estimated for the shaders with a section in their README
+	// that compile offline, so it is missing for WGSL twins, other
+	// variants, and shaders that need network #includes.
+	Usage []*Usage `json:"usage,omitempty"`
+}
+
+// File is a file with its size in bytes and hex SHA-256.
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Usage is the estimated amount of one material used by a shader.
+type Usage struct {
+	Material  string  `json:"material"`
+	Volume    float64 `json:"volume"` // in cubic units of the shader
+	VolumeErr float64 `json:"volumeErr"`
+	Mass      float64 `json:"mass,omitempty"` // in grams, if the density is known
+	MassErr   float64 `json:"massErr,omitempty"`
+}
+
+var (
+	exampleRE = regexp.MustCompile(`^(\d{3})-[a-z0-9-]+$`)
+	imageRE   = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)\)`)
+
+	// artifactExts are the extensions of the files generated from
+	// shaders.
+	artifactExts = map[string]bool{".stl": true, ".cbddlp": true, ".photon": true, ".obj": true, ".3mf": true, ".zip": true}
+)
+
+// Build catalogs the examples of the repo at root. Directories without
+// IRMF files (such as the stubs left by renumber-examples) are skipped.
+func Build(root string) (*Catalog, error) {
+	fingerprints, err := irmf.ReadFingerprints(filepath.Join(root, "examples", "fingerprints.txt"))
+	if err != nil {
+		return nil, err
+	}
+	thumbnails, err := readmeImages(root, "README.md", "")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "examples"))
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalog{Schema: Schema}
+	for _, e := range entries {
+		m := exampleRE.FindStringSubmatch(e.Name())
+		if !e.IsDir() || m == nil {
+			continue
+		}
+		ex, err := buildExample(root, e.Name(), fingerprints)
+		if err != nil {
+			return nil, err
+		}
+		if len(ex.Shaders) == 0 {
+			continue
+		}
+		ex.Number, _ = strconv.Atoi(m[1])
+		ex.Thumbnail = thumbnails[ex.Path]
+		if ex.Thumbnail == "" {
+			for _, s := range ex.Shaders {
+				if s.Thumbnail != "" {
+					ex.Thumbnail = s.Thumbnail
+					break
+				}
+			}
+		}
+		c.Examples = append(c.Examples, ex)
+	}
+	return c, nil
+}
+
+func buildExample(root, name string, fingerprints map[string]string) (*Example, error) {
+	dir := "examples/" + name
+	ex := &Example{Name: name, Path: dir}
+	entries, err := os.ReadDir(filepath.Join(root, dir))
+	if err != nil {
+		return nil, err
+	}
+	var thumbnails map[string]string
+	if _, err := os.Stat(filepath.Join(root, dir, "README.md")); err == nil {
+		ex.Readme = dir + "/README.md"
+		if thumbnails, err = readmeImages(root, ex.Readme, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	names := map[string]bool{}
+	for _, e := range entries {
+		names[e.Name()] = true
+	}
+	var others []string
+	for _, e := range entries {
+		switch ext := filepath.Ext(e.Name()); {
+		case e.IsDir(), e.Name() == "README.md", ext == ".png", ext == ".go":
+		case ext == ".irmf":
+			s, err := buildShader(root, dir, e.Name(), names)
+			if err != nil {
+				return nil, err
+			}
+			s.Fingerprint = fingerprints[s.Path]
+			if t, ok := thumbnails[s.Path]; ok {
+				s.Thumbnail = t
+			}
+			ex.Shaders = append(ex.Shaders, s)
+		default:
+			others = append(others, e.Name())
+		}
+	}
+
+	for _, name := range others {
+		f, err := readFile(root, dir+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+		if s := artifactOf(ex.Shaders, name); s != nil {
+			s.Artifacts = append(s.Artifacts, f)
+		} else {
+			ex.Files = append(ex.Files, f)
+		}
+	}
+	return ex, nil
+}
+
+func buildShader(root, dir, name string, names map[string]bool) (*Shader, error) {
+	f, err := readFile(root, dir+"/"+name)
+	if err != nil {
+		return nil, err
+	}
+	m, err := irmf.ReadFile(filepath.Join(root, dir, name))
+	if err != nil {
+		return nil, err
+	}
+	s := &Shader{
+		File:      *f,
+		Title:     m.Title,
+		Author:    m.Author,
+		License:   m.License,
+		Date:      m.Date,
+		Notes:     m.Notes,
+		Language:  m.Lang(),
+		Encoding:  m.Encoding,
+		Materials: m.Materials,
+		Units:     m.Units,
+		Min:       m.Min,
+		Max:       m.Max,
+	}
+	stem := strings.TrimSuffix(name, ".irmf")
+	base := strings.TrimSuffix(strings.TrimSuffix(stem, "-glsl"), "-wgsl")
+	for _, twin := range []string{base + ".irmf", base + "-glsl.irmf", base + "-wgsl.irmf"} {
+		if twin != name && names[twin] {
+			s.Twin = dir + "/" + twin
+			break
+		}
+	}
+	for _, png := range []string{stem + ".png", base + ".png"} {
+		if names[png] {
+			s.Thumbnail = dir + "/" + png
+			break
+		}
+	}
+	return s, nil
+}
+
+// artifactOf returns the shader with the longest name that the file is
+// named after, if the file is an artifact.
+func artifactOf(shaders []*Shader, name string) *Shader {
+	if !artifactExts[filepath.Ext(name)] {
+		return nil
+	}
+	var best *Shader
+	var bestLen int
+	for _, s := range shaders {
+		stem := strings.TrimSuffix(filepath.Base(s.Path), ".irmf")
+		if (strings.HasPrefix(name, stem+"-") || strings.HasPrefix(name, stem+".")) && len(stem) > bestLen {
+			best, bestLen = s, len(stem)
+		}
+	}
+	return best
+}
+
+func readFile(root, path string) (*File, error) {
+	buf, err := os.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(buf)
+	return &File{Path: path, Size: int64(len(buf)), SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+// readmeImages returns the first image of each "## file.irmf" section of
+// the README (or, for the root README, of each "* [example]" entry) by
+// the path of the file or example. Relative image paths are made
+// relative to the root.
+func readmeImages(root, readme, dir string) (map[string]string, error) {
+	buf, err := os.ReadFile(filepath.Join(root, readme))
+	if err != nil {
+		return nil, err
+	}
+	images := map[string]string{}
+	prefix, entry := "## ", `^(\S+\.irmf)`
+	if dir == "" {
+		prefix, entry = "* [", `^[^\]]*\]\((examples/[^)]+)\)`
+	}
+	entryRE := regexp.MustCompile(entry)
+	sections := strings.Split("\n"+string(buf), "\n"+prefix)
+	for _, section := range sections[1:] {
+		m := entryRE.FindStringSubmatch(section)
+		img := imageRE.FindStringSubmatch(section)
+		if m == nil || img == nil {
+			continue
+		}
+		path, src := m[1], img[1]
+		if dir != "" {
+			path = dir + "/" + path
+		}
+		if !strings.Contains(src, "://") {
+			src = filepath.ToSlash(filepath.Join(dir, src))
+		}
+		images[path] = src
+	}
+	return images, nil
+}
+
+// UsageOf converts usage estimates (see irmf.Model.Usage), keeping 4
+// significant digits.
+func UsageOf(usage []irmf.Usage) []*Usage {
+	round := func(v float64) float64 {
+		r, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 4, 64), 64)
+		return r
+	}
+	var out []*Usage
+	for _, u := range usage {
+		out = append(out, &Usage{
+			Material:  u.Name,
+			Volume:    round(u.Volume),
+			VolumeErr: round(u.StdErr),
+			Mass:      round(u.Mass),
+			MassErr:   round(u.MassErr),
+		})
+	}
+	return out
+}
+
+// KeepUsage copies the usage estimates of the shaders in old that have
+// not changed since (and have no new estimates) to c.
+func (c *Catalog) KeepUsage(old *Catalog) {
+	prev := map[string]*Shader{}
+	for _, ex := range old.Examples {
+		for _, s := range ex.Shaders {
+			prev[s.Path] = s
+		}
+	}
+	for _, ex := range c.Examples {
+		for _, s := range ex.Shaders {
+			if p, ok := prev[s.Path]; ok && s.Usage == nil && p.SHA256 == s.SHA256 {
+				s.Usage = p.Usage
+			}
+		}
+	}
+}
+
+// Shader returns the shader with the given path, or nil.
+func (c *Catalog) Shader(path string) *Shader {
+	for _, ex := range c.Examples {
+		for _, s := range ex.Shaders {
+			if s.Path == path {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// Read reads a catalog. A missing file is an empty catalog.
+func Read(filename string) (*Catalog, error) {
+	buf, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &Catalog{Schema: Schema}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalog{}
+	if err := json.Unmarshal(buf, c); err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return c, nil
+}
+
+// Marshal returns the catalog as indented JSON, with the examples in
+// order.
+func (c *Catalog) Marshal() ([]byte, error) {
+	sort.Slice(c.Examples, func(i, j int) bool { return c.Examples[i].Name < c.Examples[j].Name })
+	buf, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, '\n'), nil
+}
+
+// Write writes the catalog as indented JSON (see Marshal).
+func (c *Catalog) Write(filename string) error {
+	buf, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf, 0644)
+}
@@ -0,0 +1,81 @@
+// irmf-assemble combines several IRMF models into one multi-material
+// model (see irmf.Compose), as described by a JSON assembly file
+// (see irmf.Assembly) such as:
+//
+//	{
+//	  "title": "Sphere on a cube",
+//	  "materials": ["PLA", "copper"],
+//	  "parts": [
+//	    {"file": "examples/002-cube/cube-1.irmf"},
+//	    {"file": "examples/001-sphere/sphere-1.irmf", "translate": [0, 0, 10],
+//	     "materials": {"AISI 1018 steel": "copper"}, "priority": 1}
+//	  ]
+//	}
+//
+// Each part is scaled, rotated, and translated as with irmf-transform,
+// its material names are mapped to the assembly's, and its top-level
+// names are prefixed with "pN_" so that the parts cannot collide. Where
+// parts overlap, the part with the highest priority wins. Assemblies that
+// need more than the 4 material channels of mainModel4 are rejected
+// unless their "overflow" is "priority", in which case the materials of
+// the parts with the lowest priority are left out.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-assemble -o sphere-on-cube.irmf sphere-on-cube.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+var (
+	outFile = flag.String("o", "", "Output file (default: the assembly file with an .irmf suffix)")
+	offline = flag.Bool("offline", false, "Do not fetch #include files from the network")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 || (*outFile != "" && flag.NArg() > 1) {
+		log.Fatal("usage: irmf-assemble [flags] assembly.json ... (-o allows only one file)")
+	}
+	for _, arg := range flag.Args() {
+		out := *outFile
+		if out == "" {
+			out = strings.TrimSuffix(arg, filepath.Ext(arg)) + ".irmf"
+		}
+		if err := assemble(arg, out); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func assemble(filename, outFilename string) error {
+	a, err := irmf.ReadAssembly(filename)
+	if err != nil {
+		return err
+	}
+	fetch := irmf.HTTPFetch
+	if *offline {
+		fetch = nil
+	}
+	buf, warnings, err := irmf.Compose(a, filepath.Dir(filename), fetch)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	for _, w := range warnings {
+		log.Printf("%v: warning: %v", filename, w)
+	}
+	if err := os.WriteFile(outFilename, buf, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%v: wrote %v\n", filename, outFilename)
+	return nil
+}
@@ -0,0 +1,168 @@
+// irmf-bounds checks how well the bounding box in an IRMF header fits
+// the model.
+//
+// It samples the shader on a lattice covering the declared box plus a
+// border around it (see -grow) and reports:
+//
+//   - material beyond a face of the box, which a slicer would clip
+//     (models that rely on the box to cut them, like
+//     examples/002-cube/cube-1.irmf, are reported too),
+//   - material covering part of a face (rather than just grazing it),
+//     which may mean that the shader itself cuts the model off there,
+//   - the extents actually occupied compared to the declared ones, and
+//   - bounding box constants in the shader body (such as MIN_BOUND and
+//     MAX_BOUND) that disagree with the header.
+//
+// The reported extents are only as precise as the lattice spacing, so
+// use a larger -n for small features. The shader is evaluated about
+// (1.5n)³ times with the default -grow, so doubling -n makes a check
+// eight times slower: the default takes well under a second for most
+// examples but several minutes per CPU for large shaders such as
+// examples/037-stanford-bunny/bunny.irmf.
+//
+// With -w, the header "min" and "max" are rewritten to a tight box
+// (grown by one lattice step plus -margin, but never more than -margin
+// past a declared face) unless the box clips the model, and the header
+// is written in canonical form (as by irmf-fmt). Constants in the body
+// are left for the author to update since they are part of the model
+// itself.
+//
+// The exit status is 1 if any box clips its model or disagrees with the
+// constants in its body.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-bounds examples/013-torus/torus-1.irmf
+//	go run ./cmd/irmf-bounds -n 128 -margin 0.5 -w examples/001-sphere/sphere-1.irmf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+var (
+	numCells = flag.Int("n", 32, "Number of lattice cells along the longest side of the bounding box (the cost grows with its cube)")
+	grow     = flag.Float64("grow", 0.25, "Fraction of the box size searched for material outside each face")
+	iso      = flag.Float64("iso", 0.5, "Material values at or above this level count as material")
+	margin   = flag.Float64("margin", 0, "Extra space (in model units) added to each side of the tight box for -w")
+	write    = flag.Bool("w", false, "Rewrite each header with a tight bounding box")
+	parallel = flag.Int("parallel", 0, "Number of goroutines used to evaluate the shader (0 = one per CPU)")
+	offline  = flag.Bool("offline", false, "Do not fetch #include files from the network")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: irmf-bounds [flags] file.irmf ...")
+	}
+	problems := 0
+	for _, arg := range flag.Args() {
+		n, err := check(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		problems += n
+	}
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
+
+// check reports on one file and returns the number of problems found.
+func check(filename string) (int, error) {
+	m, err := irmf.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	consts := m.BoundConstants() // before any includes are inserted
+	fetch := irmf.HTTPFetch
+	if *offline {
+		fetch = nil
+	}
+	if err := m.ExpandIncludes(filename, fetch); err != nil {
+		return 0, err
+	}
+	p, err := m.Compile()
+	if err != nil {
+		return 0, fmt.Errorf("%v: %v", filename, err)
+	}
+	b, err := irmf.CheckBounds(p, m, *numCells, *grow, *iso, *parallel)
+	if err != nil {
+		return 0, fmt.Errorf("%v: %v", filename, err)
+	}
+
+	fmt.Printf("%v:\n", filename)
+	problems := 0
+	if b.Empty {
+		fmt.Printf("  no material found (iso level %v)\n", *iso)
+	} else {
+		fmt.Printf("  %-9v %-32v %-32v %v\n", "axis", "declared", "occupied (±step)", "unused")
+		for a, axis := range "xyz" {
+			size := m.Max[a] - m.Min[a]
+			unused := 100 * (size - (b.Max[a] - b.Min[a])) / size
+			fmt.Printf("  %-9c %-32v %-32v %.0f%%\n", axis,
+				fmt.Sprintf("[%.4g, %.4g]", m.Min[a], m.Max[a]),
+				fmt.Sprintf("[%.4g, %.4g] (±%.2g)", b.Min[a], b.Max[a], b.Step[a]),
+				math.Max(0, unused))
+		}
+		if clipped := faces(b.Clipped); clipped != "" {
+			problems++
+			fmt.Printf("  CLIPPED: material beyond the %v face(s) of the box\n", clipped)
+		}
+		if touching := faces(b.Touching); touching != "" {
+			fmt.Printf("  note: material covers part of the %v face(s) of the box; make sure the model is not cut off there\n", touching)
+		}
+	}
+
+	for _, c := range consts {
+		declared := m.Min
+		if c.IsMax {
+			declared = m.Max
+		}
+		for a := range c.Value {
+			if math.Abs(c.Value[a]-declared[a]) > 1e-6*math.Max(1, math.Abs(declared[a])) {
+				problems++
+				fmt.Printf("  MISMATCH: %v on line %v is %v but the header has %v\n", c.Name, c.Line, c.Value, declared)
+				break
+			}
+		}
+	}
+
+	switch {
+	case !*write || b.Empty:
+	case faces(b.Clipped) != "":
+		fmt.Println("  not rewriting the header since the box clips the model")
+	default:
+		min, max := b.Tight(*margin)
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return problems, err
+		}
+		out, err := irmf.SetBounds(src, min, max)
+		if err != nil {
+			return problems, fmt.Errorf("%v: %v", filename, err)
+		}
+		if err := os.WriteFile(filename, out, 0644); err != nil {
+			return problems, err
+		}
+		fmt.Printf("  wrote min %v, max %v\n", min, max)
+	}
+	return problems, nil
+}
+
+func faces(set [6]bool) string {
+	var names []string
+	for i, face := range irmf.Faces {
+		if set[i] {
+			names = append(names, face)
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,190 @@
+// irmf-diff shows where two IRMF models disagree, such as consecutive
+// steps of examples/015-soapdish or the GLSL and WGSL versions of a
+// model.
+//
+// It samples both shaders on a lattice covering the union of their
+// bounding boxes (see irmf.Compare) and reports, for each material, its
+// volume in each model and the volumes added and removed going from the
+// first model to the second. Materials are matched by their position in
+// the headers.
+//
+// With -stl, it writes the added and removed regions of each material as
+// meshes named "<out>-matNN-<name>-added.stl" and "-removed.stl". With
+// -slices, it writes that many PNG images of evenly spaced slices
+// perpendicular to Z named "<out>-matNN-<name>-zNNN.png", in which
+// material kept is gray, added is green, and removed is red. <out>
+// defaults to "<first>-vs-<second>" next to the first file.
+//
+// The exit status is 1 if the models differ.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-diff examples/015-soapdish/soapdish-step-0{4,5}.irmf
+//	go run ./cmd/irmf-diff -stl -slices 8 examples/015-soapdish/soapdish-step-0{4,5}.irmf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+	"github.com/gmlewis/irmf-examples/mesh"
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+var (
+	res      = flag.Float64("res", 0, "Lattice spacing in model units (overrides -n)")
+	numCells = flag.Int("n", 128, "Number of lattice cells along the longest side of the combined bounding box (when -res is 0)")
+	stl      = flag.Bool("stl", false, "Write the added and removed regions as STL files")
+	slices   = flag.Int("slices", 0, "Number of Z slice images to write per material")
+	out      = flag.String("o", "", "Prefix of the output files (default \"<first>-vs-<second>\")")
+	parallel = flag.Int("parallel", 0, "Number of goroutines used to evaluate the shaders (0 = one per CPU)")
+	offline  = flag.Bool("offline", false, "Do not fetch #include files from the network")
+)
+
+var (
+	keptColor    = color.RGBA{160, 160, 160, 255}
+	addedColor   = color.RGBA{0, 170, 0, 255}
+	removedColor = color.RGBA{220, 0, 0, 255}
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 2 {
+		log.Fatal("usage: irmf-diff [flags] first.irmf second.irmf")
+	}
+	a, pa, err := load(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, pb, err := load(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	step := *res
+	if step <= 0 {
+		if *numCells <= 0 {
+			log.Fatalf("-n (%v) must be positive", *numCells)
+		}
+		var longest float64
+		for i := range a.Min {
+			longest = math.Max(longest, math.Max(a.Max[i], b.Max[i])-math.Min(a.Min[i], b.Min[i]))
+		}
+		step = longest / float64(*numCells)
+	}
+	d, err := irmf.Compare(pa, a, pb, b, step, *parallel)
+	if err != nil {
+		log.Fatalf("%v vs %v: %v", flag.Arg(0), flag.Arg(1), err)
+	}
+
+	base := *out
+	if base == "" {
+		base = strings.TrimSuffix(flag.Arg(0), ".irmf") + "-vs-" + filepath.Base(strings.TrimSuffix(flag.Arg(1), ".irmf"))
+	}
+
+	fmt.Printf("%v vs %v (%.3g %v lattice, volumes in cubic %v):\n", flag.Arg(0), flag.Arg(1), step, a.Units, a.Units)
+	fmt.Printf("  %-16v %12v %12v %12v %12v\n", "material", "first", "second", "added", "removed")
+	differ := false
+	for n := range d.Added {
+		added, removed, both := d.Volumes(n)
+		m := a
+		if n >= len(a.Materials) {
+			m = b
+		}
+		name := m.Materials[n]
+		if n < len(a.Materials) && n < len(b.Materials) && a.Materials[n] != b.Materials[n] {
+			name += " / " + b.Materials[n]
+		}
+		fmt.Printf("  %-16v %12.4g %12.4g %12.4g %12.4g\n", name, removed+both, added+both, added, removed)
+		if added == 0 && removed == 0 {
+			continue
+		}
+		differ = true
+
+		if *stl {
+			for _, r := range []struct {
+				suffix string
+				values []float32
+			}{{"-added.stl", d.Added[n]}, {"-removed.stl", d.Removed[n]}} {
+				f := &mesh.Field{Min: d.Grid.Min, Step: d.Grid.Step, N: d.Grid.N, Values: r.values}
+				msh := mesh.Extract(f, 0.5, *parallel)
+				if len(msh.Tris) == 0 {
+					continue
+				}
+				filename := m.OutputName(base, n+1, r.suffix)
+				log.Printf("Writing %v (%v triangles)", filename, len(msh.Tris))
+				if err := msh.WriteSTL(filename); err != nil {
+					log.Fatalf("WriteSTL(%q): %v", filename, err)
+				}
+			}
+		}
+		for s := 0; s < *slices; s++ {
+			k := int((float64(s) + 0.5) * float64(d.Grid.N[2]) / float64(*slices))
+			filename := m.OutputName(base, n+1, fmt.Sprintf("-z%03d.png", k))
+			if err := writeSlice(filename, d, n, k); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if differ {
+		os.Exit(1)
+	}
+}
+
+func load(filename string) (*irmf.Model, *shader.Program, error) {
+	m, err := irmf.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	fetch := irmf.HTTPFetch
+	if *offline {
+		fetch = nil
+	}
+	if err := m.ExpandIncludes(filename, fetch); err != nil {
+		return nil, nil, err
+	}
+	p, err := m.Compile()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return m, p, nil
+}
+
+// writeSlice writes slice k of material n as a PNG image with +Y up.
+func writeSlice(filename string, d *irmf.Diff, n, k int) error {
+	g := d.Grid
+	img := image.NewRGBA(image.Rect(0, 0, g.N[0], g.N[1]))
+	for j := 0; j < g.N[1]; j++ {
+		for i := 0; i < g.N[0]; i++ {
+			c := color.RGBA{255, 255, 255, 255}
+			switch idx := g.Index(i, j, k); {
+			case d.Both[n][idx] > 0.5:
+				c = keptColor
+			case d.Added[n][idx] > 0.5:
+				c = addedColor
+			case d.Removed[n][idx] > 0.5:
+				c = removedColor
+			}
+			img.SetRGBA(i, g.N[1]-1-j, c)
+		}
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	log.Printf("Writing %v", filename)
+	return f.Close()
+}
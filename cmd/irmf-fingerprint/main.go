@@ -0,0 +1,185 @@
+// irmf-fingerprint computes a semantic fingerprint of each IRMF model
+// (see irmf.ComputeFingerprint): a hash of its quantized material values
+// at fixed pseudo-random points in its bounding box. Unlike a diff of the
+// file, the fingerprint changes only when the model evaluates
+// differently, so it separates formatting edits from geometry changes.
+//
+// By default it prints the fingerprint of each file. With -check, it
+// compares them to those recorded in a file (examples/fingerprints.txt
+// records the examples) and exits with status 1 if any changed; -w
+// records them instead. With -twins, it also reports the GLSL and WGSL
+// versions of a model (such as foo.irmf and foo-wgsl.irmf) that evaluate
+// differently. Directories are searched for .irmf files; the default is
+// the examples directory.
+//
+// Models whose #includes cannot be read (for example, with -offline) are
+// skipped with a warning.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-fingerprint examples/037-stanford-bunny
+//	go run ./cmd/irmf-fingerprint -check examples/fingerprints.txt
+//	go run ./cmd/irmf-fingerprint -w examples/fingerprints.txt examples/001-sphere
+//	go run ./cmd/irmf-fingerprint -twins
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+var (
+	numPoints = flag.Int("n", 2048, "Number of points at which each model is evaluated")
+	quantum   = flag.Float64("q", 1.0/64, "Material values are rounded to multiples of this")
+	check     = flag.String("check", "", "Compare the fingerprints to those recorded in this file")
+	write     = flag.String("w", "", "Record the fingerprints in this file, keeping the entries of other files")
+	twins     = flag.Bool("twins", false, "Report GLSL and WGSL versions of a model that evaluate differently")
+	parallel  = flag.Int("parallel", 0, "Number of goroutines used to evaluate the shader (0 = one per CPU)")
+	offline   = flag.Bool("offline", false, "Do not fetch #include files from the network")
+)
+
+func main() {
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"examples"}
+	}
+	if *check != "" && *write != "" {
+		log.Fatal("-check and -w cannot be used together")
+	}
+	var recorded map[string]string
+	if record := *check + *write; record != "" {
+		var err error
+		if recorded, err = irmf.ReadFingerprints(record); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	prints := map[string]*irmf.Fingerprint{}
+	var files []string
+	for _, arg := range args {
+		if err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || (path != arg && !strings.HasSuffix(path, ".irmf")) {
+				return err
+			}
+			fp, err := fingerprint(path)
+			if err != nil {
+				log.Printf("Skipping %v", err)
+				return nil
+			}
+			path = filepath.ToSlash(path)
+			prints[path] = fp
+			files = append(files, path)
+			return nil
+		}); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	problems := 0
+	for _, path := range files {
+		hash := prints[path].Hash
+		switch was, ok := recorded[path]; {
+		case *write != "":
+			recorded[path] = hash
+		case *check == "":
+			fmt.Printf("%v  %v\n", hash, path)
+		case !ok:
+			problems++
+			fmt.Printf("%v: not recorded in %v\n", path, *check)
+		case was != hash:
+			problems++
+			fmt.Printf("%v: CHANGED (was %v, now %v)\n", path, was, hash)
+		}
+	}
+	if *write != "" {
+		if err := writeFingerprints(*write, recorded); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *twins {
+		problems += reportTwins(prints)
+	}
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
+
+func fingerprint(filename string) (*irmf.Fingerprint, error) {
+	m, err := irmf.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	fetch := irmf.HTTPFetch
+	if *offline {
+		fetch = nil
+	}
+	if err := m.ExpandIncludes(filename, fetch); err != nil {
+		return nil, err
+	}
+	p, err := m.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	fp, err := irmf.ComputeFingerprint(p, m, *numPoints, *quantum, *parallel)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return fp, nil
+}
+
+// reportTwins prints the twins whose fingerprints differ and returns
+// their number. Twins are files in the same directory whose names differ
+// only by a "-glsl" or "-wgsl" suffix.
+func reportTwins(prints map[string]*irmf.Fingerprint) int {
+	groups := map[string][]string{}
+	for path := range prints {
+		stem := strings.TrimSuffix(path, ".irmf")
+		stem = strings.TrimSuffix(strings.TrimSuffix(stem, "-glsl"), "-wgsl")
+		groups[stem] = append(groups[stem], path)
+	}
+	var stems []string
+	for stem, paths := range groups {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			stems = append(stems, stem)
+		}
+	}
+	sort.Strings(stems)
+
+	problems := 0
+	for _, stem := range stems {
+		paths := groups[stem]
+		for _, other := range paths[1:] {
+			if n := prints[paths[0]].Differences(prints[other]); n > 0 {
+				problems++
+				fmt.Printf("%v and %v differ at %v of %v points\n", paths[0], other, n, *numPoints)
+			}
+		}
+	}
+	return problems
+}
+
+func writeFingerprints(filename string, recorded map[string]string) error {
+	var paths []string
+	for path := range recorded {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	lines := []string{
+		"# Semantic fingerprints of the examples; see cmd/irmf-fingerprint.",
+		fmt.Sprintf("# Computed with -n %v -q %v.", *numPoints, *quantum),
+	}
+	for _, path := range paths {
+		lines = append(lines, recorded[path]+"  "+path)
+	}
+	return os.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
@@ -0,0 +1,106 @@
+// irmf-flatten writes a self-contained copy of an IRMF file with all of
+// its #include directives resolved, so that the result can be checked,
+// sliced, or shared without network access.
+//
+// Includes are searched for in the directories given with -I (which may
+// be a lygia checkout or a directory holding one), in $IRMF_INCLUDE_PATH,
+// and in any third_party directory above the file, e.g. a vendored copy
+// of lygia made with:
+//
+//	git clone https://github.com/patriciogonzalezvivo/lygia third_party/lygia
+//
+// lygia's include guards are followed, so functions that the shader
+// provides itself (such as saturate after "#define FNC_SATURATE") are
+// left out. The flattened shader starts with a comment recording where
+// each include was read from. Encoded shaders are written decoded.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-flatten examples/028-lygia/lygia-01.irmf
+//	go run ./cmd/irmf-flatten -I ~/src/lygia -o /tmp/lygia-01.irmf examples/028-lygia/lygia-01.irmf
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+var (
+	outFile = flag.String("o", "", "Output file (default: the input with a -flat.irmf suffix)")
+	fetch   = flag.Bool("fetch", false, "Fetch includes that are not found locally from the network")
+	check   = flag.Bool("check", true, "Make sure the flattened shader compiles for CPU evaluation")
+
+	includePath []string
+
+	encodingRE = regexp.MustCompile(`(?m)^[ \t]*"?encoding"?\s*:\s*"[^"]*",?[ \t]*\n`)
+)
+
+func main() {
+	flag.Func("I", "Directory to search for includes (may be repeated)", func(dir string) error {
+		includePath = append(includePath, dir)
+		return nil
+	})
+	flag.Parse()
+	if flag.NArg() == 0 || (*outFile != "" && flag.NArg() > 1) {
+		log.Fatal("usage: irmf-flatten [flags] file.irmf ... (-o allows only one file)")
+	}
+	for _, arg := range flag.Args() {
+		out := *outFile
+		if out == "" {
+			out = strings.TrimSuffix(arg, ".irmf") + "-flat.irmf"
+		}
+		if err := flatten(arg, out); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func flatten(filename, outFilename string) error {
+	m, err := irmf.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	inc := &irmf.Includer{
+		Dir:  filepath.Dir(filename),
+		Path: append(includePath, irmf.DefaultIncludePath()...),
+	}
+	if *fetch {
+		inc.Fetch = irmf.HTTPFetch
+	}
+	shader, err := inc.Expand(m.Shader)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "/*%v*/\n", encodingRE.ReplaceAllString(m.Header, ""))
+	fmt.Fprintf(&buf, "// Flattened from %v by irmf-flatten.\n", filepath.Base(filename))
+	for _, i := range inc.Included {
+		fmt.Fprintf(&buf, "// #include %q read from %v\n", i.Path, filepath.ToSlash(i.Source))
+	}
+	buf.WriteString("\n")
+	buf.WriteString(strings.TrimRight(shader, "\n") + "\n")
+
+	flat, err := irmf.Parse(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("%v: flattened file is invalid: %v", filename, err)
+	}
+	if *check {
+		if _, err := flat.Compile(); err != nil {
+			return fmt.Errorf("%v: flattened shader: %v", filename, err)
+		}
+	}
+	if err := os.WriteFile(outFilename, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%v: %v includes, wrote %v\n", filename, len(inc.Included), outFilename)
+	return nil
+}
@@ -0,0 +1,117 @@
+// irmf-fmt formats IRMF files canonically (see irmf.Format): header keys
+// in a fixed order and consistent formatting, and shader bodies indented
+// consistently, so that diffs between similar files (such as the GLSL
+// and WGSL twins or the soapdish steps) show only real differences.
+//
+// Like gofmt, it prints the formatted files by default; -l lists the
+// files whose formatting differs, -d prints diffs (using diff -u), and
+// -w rewrites the files. Directories are searched for .irmf files. With
+// -l or -d, the exit status is 1 if any file needs formatting.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-fmt -l examples
+//	go run ./cmd/irmf-fmt -d examples/037-stanford-bunny/bunny.irmf
+//	go run ./cmd/irmf-fmt -w examples
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+var (
+	list  = flag.Bool("l", false, "List files whose formatting differs from irmf-fmt's")
+	diffs = flag.Bool("d", false, "Display diffs instead of rewriting files")
+	write = flag.Bool("w", false, "Write the result to (source) files instead of stdout")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: irmf-fmt [-l] [-d] [-w] path ...")
+	}
+	changed := 0
+	for _, arg := range flag.Args() {
+		if err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || (path != arg && !strings.HasSuffix(path, ".irmf")) {
+				return err
+			}
+			n, err := process(path)
+			changed += n
+			return err
+		}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if changed > 0 && (*list || *diffs) {
+		os.Exit(1)
+	}
+}
+
+// process formats one file and returns 1 if its formatting changed.
+func process(filename string) (int, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	res, err := irmf.Format(src)
+	if err != nil {
+		return 0, fmt.Errorf("%v: %v", filename, err)
+	}
+	if !*list && !*diffs && !*write {
+		_, err := os.Stdout.Write(res)
+		return 0, err
+	}
+	if bytes.Equal(src, res) {
+		return 0, nil
+	}
+	if *list {
+		fmt.Println(filename)
+	}
+	if *diffs {
+		out, err := diff(filename, src, res)
+		if err != nil {
+			return 0, fmt.Errorf("computing diff: %v", err)
+		}
+		os.Stdout.Write(out)
+	}
+	if *write {
+		if err := os.WriteFile(filename, res, 0644); err != nil {
+			return 0, err
+		}
+	}
+	return 1, nil
+}
+
+// diff returns the output of diff -u between the original and formatted
+// sources, labeled like gofmt -d.
+func diff(filename string, b1, b2 []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "irmf-fmt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	f1, f2 := filepath.Join(dir, "orig"), filepath.Join(dir, "formatted")
+	if err := os.WriteFile(f1, b1, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(f2, b2, 0644); err != nil {
+		return nil, err
+	}
+	out, err := exec.Command("diff", "-u", "--label", filename+".orig", "--label", filename, f1, f2).Output()
+	if len(out) > 0 {
+		// diff exits with a non-zero status when the files differ.
+		err = nil
+	}
+	return out, err
+}
@@ -0,0 +1,70 @@
+// irmf-infill rewrites solid IRMF models to keep a solid shell and fill
+// the inside with a lattice (see irmf.AddInfill), saving material and
+// print time. The lattices are like the ones in examples/023-infill and
+// examples/025-patterns:
+//
+//   - gyroid: the gyroid surface, as in examples/023-infill/gyroid-1.irmf
+//   - schwarz-p: the Schwarz P surface
+//   - cubic: struts along the edges of cubic cells
+//   - spheres: hollow spheres, one per cell, touching their neighbors
+//
+// Sizes are in the model's units. The shell is found by probing the
+// model, so it works even for shaders that return only 0 or 1 rather
+// than distances. Use irmf-volume to see how much material is saved.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-infill -lattice gyroid -shell 1 -cell 4 -wall 0.8 examples/001-sphere/sphere-1.irmf
+//	go run ./cmd/irmf-infill -lattice cubic -cell 10 -wall 2 -o bracket-light.irmf bracket.irmf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+var (
+	lattice = flag.String("lattice", "gyroid", "Lattice: "+strings.Join(irmf.Lattices, ", "))
+	shell   = flag.Float64("shell", 1, "Thickness of the solid shell (0 for none)")
+	cell    = flag.Float64("cell", 5, "Size of the lattice's cells")
+	wall    = flag.Float64("wall", 0.8, "Thickness of the lattice's walls or struts")
+	outFile = flag.String("o", "", "Output file (default: the input with a -infill.irmf suffix)")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 || (*outFile != "" && flag.NArg() > 1) {
+		log.Fatal("usage: irmf-infill [flags] file.irmf ... (-o allows only one file)")
+	}
+	f := irmf.Infill{Lattice: *lattice, Shell: *shell, Cell: *cell, Wall: *wall}
+	for _, arg := range flag.Args() {
+		out := *outFile
+		if out == "" {
+			out = strings.TrimSuffix(arg, ".irmf") + "-infill.irmf"
+		}
+		if err := infill(arg, out, f); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func infill(filename, outFilename string, f irmf.Infill) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	buf, err := irmf.AddInfill(src, f)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	if err := os.WriteFile(outFilename, buf, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%v: wrote %v\n", filename, outFilename)
+	return nil
+}
@@ -0,0 +1,59 @@
+// irmf-inline regenerates the copies of shared library files kept
+// inside IRMF files between "//irmf:inline library" and "//irmf:end"
+// lines (see irmf.Inline), so that they cannot drift from the library.
+//
+// By default it lists the files that are out of date and exits with
+// status 1 if there are any; -w rewrites them instead.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-inline                # checks the examples directory
+//	go run ./cmd/irmf-inline -w examples/012-bifilar-electromagnet
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+var write = flag.Bool("w", false, "Rewrite out-of-date files instead of listing them")
+
+func main() {
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"examples"}
+	}
+	stale := 0
+	for _, arg := range args {
+		if err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".irmf") {
+				return err
+			}
+			got, want, libs, err := irmf.InlineFile(path)
+			if err != nil || bytes.Equal(got, want) {
+				return err
+			}
+			if !*write {
+				stale++
+				fmt.Printf("%v: out of date with %v\n", path, strings.Join(libs, ", "))
+				return nil
+			}
+			fmt.Printf("updating %v\n", path)
+			return os.WriteFile(path, want, 0644)
+		}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if stale > 0 {
+		os.Exit(1)
+	}
+}
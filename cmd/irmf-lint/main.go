@@ -0,0 +1,178 @@
+// irmf-lint checks IRMF files for common problems.
+//
+// Currently it checks that every material named in a header is known to
+// the material registry (see package materials) or is a placeholder such
+// as "material0" or "Red", and that it is spelled either exactly as the
+// canonical name or one of its aliases, optionally followed by an
+// instance number ("PLA1") or a channel suffix ("PLA.H"). Across all the
+// files checked, each material must also be spelled the same way: uses
+// of a less common spelling are reported with the most common one.
+//
+// Each problem is reported as "filename: message" and the exit status
+// is 1 if any were found.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-lint                  # lints the examples directory
+//	go run ./cmd/irmf-lint examples/012-bifilar-electromagnet
+//	go run ./cmd/irmf-lint -materials my-materials.json file.irmf
+//	go run ./cmd/irmf-lint -list            # prints the material registry
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+	"github.com/gmlewis/irmf-examples/materials"
+)
+
+var (
+	extraMaterials = flag.String("materials", "", "JSON file of additional materials (an array of {name, aliases, density, resistivity, color})")
+	list           = flag.Bool("list", false, "Print the material registry and exit")
+)
+
+func main() {
+	flag.Parse()
+	reg := materials.Default
+	if *extraMaterials != "" {
+		if err := reg.LoadFile(*extraMaterials); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *list {
+		printRegistry(reg)
+		return
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"examples"}
+	}
+	var files []string
+	for _, arg := range args {
+		if err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(path, ".irmf") {
+				files = append(files, path)
+			}
+			return nil
+		}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	sort.Strings(files)
+
+	var problems []string
+	models := map[string]*irmf.Model{}
+	for _, filename := range files {
+		m, err := irmf.ReadFile(filename)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		models[filename] = m
+		for _, msg := range lintMaterials(reg, m) {
+			problems = append(problems, fmt.Sprintf("%v: %v", filename, msg))
+		}
+	}
+	problems = append(problems, lintSpellings(reg, files, models)...)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+// lintMaterials returns the problems with the model's material names.
+func lintMaterials(reg *materials.Registry, m *irmf.Model) []string {
+	var problems []string
+	for i, name := range m.Materials {
+		mat, base, ok := reg.Resolve(name)
+		if !ok && materials.IsPlaceholder(name) {
+			continue
+		}
+		if !ok {
+			problems = append(problems, fmt.Sprintf("material %v %q is not in the material registry", i+1, name))
+			continue
+		}
+		if base == mat.Name {
+			continue
+		}
+		known := false
+		for _, alias := range mat.Aliases {
+			if base == alias {
+				known = true
+				break
+			}
+		}
+		if !known {
+			problems = append(problems, fmt.Sprintf("material %v %q should be spelled %q", i+1, name, strings.Replace(name, base, mat.Name, 1)))
+		}
+	}
+	return problems
+}
+
+// lintSpellings returns the uses of a material whose spelling differs
+// from the one most commonly used for it in the given files.
+func lintSpellings(reg *materials.Registry, files []string, models map[string]*irmf.Model) []string {
+	type use struct {
+		filename string
+		i        int
+		name     string
+		base     string
+	}
+	uses := map[*materials.Material][]use{}
+	for _, filename := range files {
+		m := models[filename]
+		if m == nil {
+			continue
+		}
+		for i, name := range m.Materials {
+			if mat, base, ok := reg.Resolve(name); ok {
+				uses[mat] = append(uses[mat], use{filename: filename, i: i, name: name, base: base})
+			}
+		}
+	}
+
+	var problems []string
+	for _, us := range uses {
+		count := map[string]int{}
+		for _, u := range us {
+			count[u.base]++
+		}
+		if len(count) < 2 {
+			continue
+		}
+		// Ties go to the spelling that sorts first.
+		var best string
+		for base, n := range count {
+			if n > count[best] || n == count[best] && base < best {
+				best = base
+			}
+		}
+		for _, u := range us {
+			if u.base != best {
+				problems = append(problems, fmt.Sprintf("%v: material %v %q is spelled %q in %v other places", u.filename, u.i+1, u.name, best, count[best]))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func printRegistry(reg *materials.Registry) {
+	fmt.Printf("%-16v %-12v %-14v %-8v %v\n", "NAME", "DENSITY", "RESISTIVITY", "COLOR", "ALIASES")
+	for _, m := range reg.Materials() {
+		fmt.Printf("%-16v %-12v %-14v %-8v %v\n", m.Name, fmt.Sprintf("%v g/cm³", m.Density), fmt.Sprintf("%.3g Ω·m", m.Resistivity), m.Color, strings.Join(m.Aliases, ", "))
+	}
+}
@@ -0,0 +1,184 @@
+// irmf-to-dlp slices IRMF shaders into ChiTuBox .cbddlp files (which
+// are identical to AnyCubic .photon files) without a GPU.
+//
+// Like "irmf-slicer -dlp", it writes one file per material named with
+// the "-matNN-<name>.cbddlp" convention next to the .irmf file, but the
+// shader is evaluated on the CPU so the files can be regenerated
+// reproducibly on any machine. Each pixel of each layer is exposed when
+// the material's value at the center of the voxel exceeds 0.5, and the
+// model is centered on the screen.
+//
+// The defaults match irmf-slicer (an AnyCubic Photon: 2560x1440 pixels
+// of 47.25 microns and 50 micron layers). Models are scaled from their
+// declared units to millimeters, so a model in inches prints at its real
+// size.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-to-dlp examples/001-sphere/sphere-1.irmf
+//	go run ./cmd/irmf-to-dlp -layer 25 -exposure 8 -ext .photon examples/013-torus/torus-1.irmf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+	"github.com/gmlewis/irmf-examples/photon"
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+var (
+	screen         = flag.String("screen", "2560x1440", "Printer screen size in pixels (width x height)")
+	pixel          = flag.Float64("pixel", 47.25, "Pixel size in microns")
+	layer          = flag.Float64("layer", 50, "Layer height in microns")
+	plateZ         = flag.Float64("plate_z", 150, "Build height in millimeters")
+	exposure       = flag.Float64("exposure", 6, "Normal exposure time in seconds")
+	bottomExposure = flag.Float64("bottom_exposure", 50, "Bottom layer exposure time in seconds")
+	bottomLayers   = flag.Int("bottom_layers", 8, "Number of bottom layers")
+	offTime        = flag.Float64("off_time", 0, "Light-off time between layers in seconds")
+	ext            = flag.String("ext", ".cbddlp", "Output file extension: .cbddlp or .photon (the formats are identical)")
+
+	parallel = flag.Int("parallel", runtime.NumCPU(), "Number of layers to evaluate concurrently")
+	offline  = flag.Bool("offline", false, "Do not fetch #include files from the network")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: irmf-to-dlp [flags] file.irmf ...")
+	}
+	s := photon.DefaultSettings()
+	if _, err := fmt.Sscanf(*screen, "%dx%d", &s.ScreenWidth, &s.ScreenHeight); err != nil {
+		log.Fatalf("invalid -screen %q: %v", *screen, err)
+	}
+	s.PixelSize = *pixel / 1000
+	s.LayerHeight = *layer / 1000
+	s.PlateZ = *plateZ
+	s.NormalExposure = *exposure
+	s.BottomExposure = *bottomExposure
+	s.BottomLayers = *bottomLayers
+	s.OffTime = *offTime
+	if err := s.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *ext != ".cbddlp" && *ext != ".photon" {
+		log.Fatalf("-ext must be .cbddlp or .photon, not %q", *ext)
+	}
+	if *parallel < 1 {
+		*parallel = 1
+	}
+
+	for _, arg := range flag.Args() {
+		if err := slice(arg, s); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("Done.")
+}
+
+func slice(filename string, s photon.Settings) error {
+	m, err := irmf.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	fetch := irmf.HTTPFetch
+	if *offline {
+		fetch = nil
+	}
+	if err := m.ExpandIncludes(filename, fetch); err != nil {
+		return err
+	}
+	p, err := m.Compile()
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+
+	mm, err := irmf.UnitLength(m.Units)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	// The pixel size and layer height in model units.
+	pixelSize, layerHeight := s.PixelSize/mm, s.LayerHeight/mm
+
+	nx := int(math.Ceil((m.Max[0] - m.Min[0]) / pixelSize))
+	ny := int(math.Ceil((m.Max[1] - m.Min[1]) / pixelSize))
+	nz := int(math.Ceil((m.Max[2] - m.Min[2]) / layerHeight))
+	if nx > s.ScreenWidth || ny > s.ScreenHeight {
+		return fmt.Errorf("%v: model needs %vx%v pixels but the screen is only %vx%v", filename, nx, ny, s.ScreenWidth, s.ScreenHeight)
+	}
+	if h := float64(nz) * s.LayerHeight; h > s.PlateZ {
+		return fmt.Errorf("%v: model is %v mm tall but the build height is only %v mm", filename, h, s.PlateZ)
+	}
+	log.Printf("%v: slicing %v materials into %v layers of %vx%v pixels...", filename, len(m.Materials), nz, nx, ny)
+
+	files := make([]*photon.File, len(m.Materials))
+	for i := range files {
+		files[i] = photon.New(s)
+	}
+	start := time.Now()
+	// Evaluate batches of layers concurrently, then add them in order.
+	for z0 := 0; z0 < nz; z0 += *parallel {
+		batch := make([][]*image.Gray, min(*parallel, nz-z0))
+		var wg sync.WaitGroup
+		for i := range batch {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				batch[i] = sampleLayer(p, m, pixelSize, layerHeight, nx, ny, z0+i)
+			}(i)
+		}
+		wg.Wait()
+		for _, imgs := range batch {
+			for i, img := range imgs {
+				if err := files[i].AddLayer(img); err != nil {
+					return fmt.Errorf("%v: %v", filename, err)
+				}
+			}
+		}
+	}
+	log.Printf("%v: sliced in %v", filename, time.Since(start).Round(time.Millisecond))
+
+	base := strings.TrimSuffix(filename, ".irmf")
+	for i, f := range files {
+		out := m.OutputName(base, i+1, *ext)
+		log.Printf("Writing %v", out)
+		if err := f.WriteFile(out); err != nil {
+			return fmt.Errorf("WriteFile(%q): %v", out, err)
+		}
+	}
+	return nil
+}
+
+// sampleLayer evaluates layer k at the center of every voxel and returns
+// one bitmap per material. The pixel size and layer height are in model
+// units.
+func sampleLayer(p *shader.Program, m *irmf.Model, pixelSize, layerHeight float64, nx, ny, k int) []*image.Gray {
+	e := p.NewEvaluator()
+	out := make([]float64, p.NumMaterials())
+	imgs := make([]*image.Gray, len(m.Materials))
+	for i := range imgs {
+		imgs[i] = image.NewGray(image.Rect(0, 0, nx, ny))
+	}
+	z := m.Min[2] + (float64(k)+0.5)*layerHeight
+	for j := 0; j < ny; j++ {
+		y := m.Min[1] + (float64(j)+0.5)*pixelSize
+		for i := 0; i < nx; i++ {
+			x := m.Min[0] + (float64(i)+0.5)*pixelSize
+			e.Eval(x, y, z, out)
+			for n, img := range imgs {
+				if out[n] > 0.5 {
+					img.Pix[j*img.Stride+i] = 0xff
+				}
+			}
+		}
+	}
+	return imgs
+}
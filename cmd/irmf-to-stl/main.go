@@ -0,0 +1,110 @@
+// irmf-to-stl converts IRMF shaders to STL files without a GPU.
+//
+// Unlike irmf-slicer (which renders the shader with OpenGL), it
+// evaluates the shader on the CPU at every point of a regular grid
+// covering the header's "min" and "max" bounds and then extracts one
+// watertight surface per material with marching tetrahedra (a variant of
+// marching cubes that never produces holes). Each material is written
+// to its own file using the same "-matNN-<name>.stl" naming convention
+// as irmf-slicer, next to the .irmf file.
+//
+// The grid spacing is set with -res (in the model's units) or, if -res
+// is 0, by dividing the longest side of the bounding box into -n cells.
+// Material values are clamped to [0,1] and a point is inside a material
+// when its value exceeds 0.5.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-to-stl examples/001-sphere/sphere-1.irmf
+//	go run ./cmd/irmf-to-stl -res 0.25 -check examples/013-torus/*.irmf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+	"github.com/gmlewis/irmf-examples/mesh"
+)
+
+var (
+	res      = flag.Float64("res", 0, "Grid spacing in model units (overrides -n)")
+	numCells = flag.Int("n", 128, "Number of grid cells along the longest side of the bounding box (when -res is 0)")
+	parallel = flag.Int("parallel", 0, "Number of goroutines used to evaluate the shader (0 = one per CPU)")
+	offline  = flag.Bool("offline", false, "Do not fetch #include files from the network")
+	check    = flag.Bool("check", false, "Verify that every mesh is closed and consistently oriented")
+)
+
+const isoLevel = 0.5
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: irmf-to-stl [flags] file.irmf ...")
+	}
+	for _, arg := range flag.Args() {
+		if err := convert(arg); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("Done.")
+}
+
+func convert(filename string) error {
+	m, err := irmf.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	fetch := irmf.HTTPFetch
+	if *offline {
+		fetch = nil
+	}
+	if err := m.ExpandIncludes(filename, fetch); err != nil {
+		return err
+	}
+	p, err := m.Compile()
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+
+	step := *res
+	if step <= 0 {
+		if *numCells <= 0 {
+			return fmt.Errorf("-n (%v) must be positive", *numCells)
+		}
+		longest := math.Max(m.Max[0]-m.Min[0], math.Max(m.Max[1]-m.Min[1], m.Max[2]-m.Min[2]))
+		step = longest / float64(*numCells)
+	}
+	g := m.Grid(step)
+	log.Printf("%v: sampling %v materials on a %vx%vx%v grid (%v %v spacing)...",
+		filename, len(m.Materials), g.N[0], g.N[1], g.N[2], step, m.Units)
+	start := time.Now()
+	fields := irmf.Sample(p, g, len(m.Materials), *parallel)
+	log.Printf("%v: sampled in %v", filename, time.Since(start).Round(time.Millisecond))
+
+	base := strings.TrimSuffix(filename, ".irmf")
+	for i, values := range fields {
+		materialNum := i + 1
+		f := &mesh.Field{Min: g.Min, Step: g.Step, N: g.N, Values: values}
+		msh := mesh.Extract(f, isoLevel, *parallel)
+		if len(msh.Tris) == 0 {
+			log.Printf("%v: material %v (%v) is empty; skipping", filename, materialNum, m.Materials[i])
+			continue
+		}
+		if *check {
+			if err := msh.Check(); err != nil {
+				return fmt.Errorf("%v: material %v (%v): %v", filename, materialNum, m.Materials[i], err)
+			}
+		}
+		out := m.OutputName(base, materialNum, ".stl")
+		log.Printf("Writing %v (%v triangles)", out, len(msh.Tris))
+		if err := msh.WriteSTL(out); err != nil {
+			return fmt.Errorf("WriteSTL(%q): %v", out, err)
+		}
+	}
+	return nil
+}
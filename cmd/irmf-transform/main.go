@@ -0,0 +1,192 @@
+// irmf-transform writes a rotated, scaled, and/or translated copy of an
+// IRMF model (see irmf.Transform) without editing its shader by hand.
+//
+// The transform is applied in this order: -scale (one factor or one per
+// axis), then the rotation, then -translate. The rotation is given as
+// Euler angles in degrees with -rotate (about X, then Y, then Z), as
+// -axis and -angle, or as a row-major 3x3 -matrix (which may also scale
+// or shear); these options cannot be combined. Rotations by multiples of
+// 90 degrees are exact.
+//
+// The header's bounding box is replaced by the bounding box of the
+// transformed box. Unless -check=false, the result is compared with the
+// original using the CPU evaluator (see irmf.CheckTransform) before it
+// is written.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-transform -rotate 0,90,0 -o horiz.irmf examples/012-bifilar-electromagnet/first-print-attempt-vert.irmf
+//	go run ./cmd/irmf-transform -axis 1,1,0 -angle 45 -translate 0,0,10 examples/013-torus/torus-1.irmf
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+var (
+	rotate    = flag.String("rotate", "", "Euler angles in degrees about X, then Y, then Z, e.g. 0,90,0")
+	axis      = flag.String("axis", "", "Axis of rotation for -angle, e.g. 1,1,0")
+	angle     = flag.Float64("angle", 0, "Angle of rotation about -axis in degrees (counterclockwise looking towards the origin)")
+	matrix    = flag.String("matrix", "", "Row-major 3x3 matrix, e.g. 0,0,1,0,1,0,-1,0,0")
+	scale     = flag.String("scale", "", "Scale factor, or one per axis, e.g. 2 or 1,1,0.5")
+	translate = flag.String("translate", "", "Translation, e.g. 0,0,10")
+	outFile   = flag.String("o", "", "Output file (default: the input with a -transformed.irmf suffix)")
+	check     = flag.Bool("check", true, "Compare the transformed model with the original")
+	numCells  = flag.Int("n", 32, "Number of lattice cells along the longest side of the bounding box for -check")
+	parallel  = flag.Int("parallel", 0, "Number of goroutines used to evaluate the shaders (0 = one per CPU)")
+	offline   = flag.Bool("offline", false, "Do not fetch #include files from the network")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 || (*outFile != "" && flag.NArg() > 1) {
+		log.Fatal("usage: irmf-transform [flags] file.irmf ... (-o allows only one file)")
+	}
+	a, err := transform()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, arg := range flag.Args() {
+		out := *outFile
+		if out == "" {
+			out = strings.TrimSuffix(arg, ".irmf") + "-transformed.irmf"
+		}
+		if err := apply(arg, out, a); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// transform builds the transform from the flags.
+func transform() (irmf.Affine, error) {
+	a := irmf.Identity
+	if *scale != "" {
+		s, err := parseFloats("-scale", *scale, 1, 3)
+		if err != nil {
+			return a, err
+		}
+		if len(s) == 1 {
+			s = []float64{s[0], s[0], s[0]}
+		}
+		a = irmf.Scaling([3]float64(s))
+	}
+
+	rotations := 0
+	for _, s := range []string{*rotate, *axis, *matrix} {
+		if s != "" {
+			rotations++
+		}
+	}
+	if rotations > 1 {
+		return a, errors.New("only one of -rotate, -axis, and -matrix may be used")
+	}
+	switch {
+	case *rotate != "":
+		r, err := parseFloats("-rotate", *rotate, 3)
+		if err != nil {
+			return a, err
+		}
+		a = a.Then(irmf.EulerRotation(r[0], r[1], r[2]))
+	case *axis != "":
+		v, err := parseFloats("-axis", *axis, 3)
+		if err != nil {
+			return a, err
+		}
+		r, err := irmf.Rotation([3]float64(v), *angle)
+		if err != nil {
+			return a, err
+		}
+		a = a.Then(r)
+	case *matrix != "":
+		v, err := parseFloats("-matrix", *matrix, 9)
+		if err != nil {
+			return a, err
+		}
+		var r irmf.Affine
+		for i := range r.M {
+			r.M[i] = [3]float64(v[3*i : 3*i+3])
+		}
+		a = a.Then(r)
+	case *angle != 0:
+		return a, errors.New("-angle requires -axis")
+	}
+
+	if *translate != "" {
+		t, err := parseFloats("-translate", *translate, 3)
+		if err != nil {
+			return a, err
+		}
+		a = a.Then(irmf.Translation([3]float64(t)))
+	}
+	if _, err := a.Inverse(); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+// parseFloats parses a comma-separated list with one of the given
+// numbers of values.
+func parseFloats(name, s string, counts ...int) ([]float64, error) {
+	var v []float64
+	for _, f := range strings.Split(s, ",") {
+		x, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+		v = append(v, x)
+	}
+	for _, n := range counts {
+		if len(v) == n {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("%v: want %v values, got %v", name, counts, len(v))
+}
+
+func apply(filename, outFilename string, a irmf.Affine) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	buf, err := irmf.Transform(src, a)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	if *check {
+		if err := compare(filename, buf, src, a); err != nil {
+			return fmt.Errorf("%v: %v", filename, err)
+		}
+	}
+	if err := os.WriteFile(outFilename, buf, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%v: wrote %v\n", filename, outFilename)
+	return nil
+}
+
+func compare(filename string, transformed, original []byte, a irmf.Affine) error {
+	fetch := irmf.HTTPFetch
+	if *offline {
+		fetch = nil
+	}
+	var models [2]*irmf.Model
+	for i, src := range [][]byte{transformed, original} {
+		m, err := irmf.Parse(src)
+		if err != nil {
+			return err
+		}
+		if err := m.ExpandIncludes(filename, fetch); err != nil {
+			return err
+		}
+		models[i] = m
+	}
+	return irmf.CheckTransform(models[0], models[1], a, *numCells, *parallel)
+}
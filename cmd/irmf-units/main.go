@@ -0,0 +1,92 @@
+// irmf-units converts IRMF models to other units (see irmf.ConvertUnits),
+// such as "mm", "cm", "m", "in", or "ft".
+//
+// The header's "min", "max", and "units" are rewritten and the shader's
+// entry point is wrapped so that it receives coordinates in its original
+// units; the rest of the shader is left untouched. Unless -check=false,
+// the converted model is compared with the original using the CPU
+// evaluator (see irmf.CheckConversion) before it is written.
+//
+// Usage:
+//
+//	go run ./cmd/irmf-units -to in examples/001-sphere/sphere-1.irmf
+//	go run ./cmd/irmf-units -to mm -o bracket-mm.irmf bracket-in.irmf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+var (
+	units    = flag.String("to", "", "Units to convert to (mm, cm, m, in, or ft)")
+	outFile  = flag.String("o", "", "Output file (default: the input with a -<units>.irmf suffix)")
+	check    = flag.Bool("check", true, "Compare the converted model with the original")
+	numCells = flag.Int("n", 32, "Number of lattice cells along the longest side of the bounding box for -check")
+	parallel = flag.Int("parallel", 0, "Number of goroutines used to evaluate the shaders (0 = one per CPU)")
+	offline  = flag.Bool("offline", false, "Do not fetch #include files from the network")
+)
+
+func main() {
+	flag.Parse()
+	if *units == "" || flag.NArg() == 0 || (*outFile != "" && flag.NArg() > 1) {
+		log.Fatal("usage: irmf-units -to units [flags] file.irmf ... (-o allows only one file)")
+	}
+	if _, err := irmf.UnitLength(*units); err != nil {
+		log.Fatal(err)
+	}
+	for _, arg := range flag.Args() {
+		out := *outFile
+		if out == "" {
+			out = strings.TrimSuffix(arg, ".irmf") + "-" + *units + ".irmf"
+		}
+		if err := convert(arg, out); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func convert(filename, outFilename string) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	buf, err := irmf.ConvertUnits(src, *units)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	if *check {
+		if err := compare(filename, buf, src); err != nil {
+			return fmt.Errorf("%v: %v", filename, err)
+		}
+	}
+	if err := os.WriteFile(outFilename, buf, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%v: wrote %v\n", filename, outFilename)
+	return nil
+}
+
+func compare(filename string, converted, original []byte) error {
+	fetch := irmf.HTTPFetch
+	if *offline {
+		fetch = nil
+	}
+	var models [2]*irmf.Model
+	for i, src := range [][]byte{converted, original} {
+		m, err := irmf.Parse(src)
+		if err != nil {
+			return err
+		}
+		if err := m.ExpandIncludes(filename, fetch); err != nil {
+			return err
+		}
+		models[i] = m
+	}
+	return irmf.CheckConversion(models[0], models[1], *numCells, *parallel)
+}
@@ -0,0 +1,80 @@
+// irmf-volume estimates how much of each material an IRMF model uses.
+//
+// Each material channel of the shader (clamped to [0,1]) is integrated
+// over the header's bounding box by jittered Monte Carlo sampling (see
+// -n and -passes) and reported with its standard error as a volume in
+// the header's units and as a mass using the densities in the material
+// registry (see package materials and -materials).
+//
+// Usage:
+//
+//	go run ./cmd/irmf-volume examples/012-bifilar-electromagnet/bifilar-electromagnet-1.irmf
+//	go run ./cmd/irmf-volume -n 128 -passes 8 examples/001-sphere/*.irmf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+	"github.com/gmlewis/irmf-examples/materials"
+)
+
+var (
+	numCells       = flag.Int("n", 64, "Number of sampling cells along the longest side of the bounding box")
+	passes         = flag.Int("passes", 4, "Number of independent sampling passes (at least 2) used to estimate the error")
+	seed           = flag.Uint64("seed", 1, "Random seed (the results are reproducible for a given seed)")
+	parallel       = flag.Int("parallel", 0, "Number of goroutines used to evaluate the shader (0 = one per CPU)")
+	offline        = flag.Bool("offline", false, "Do not fetch #include files from the network")
+	extraMaterials = flag.String("materials", "", "JSON file of additional materials (see irmf-lint -list)")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: irmf-volume [flags] file.irmf ...")
+	}
+	reg := materials.Default
+	if *extraMaterials != "" {
+		if err := reg.LoadFile(*extraMaterials); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, arg := range flag.Args() {
+		if err := report(arg, reg); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func report(filename string, reg *materials.Registry) error {
+	m, err := irmf.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	fetch := irmf.HTTPFetch
+	if *offline {
+		fetch = nil
+	}
+	if err := m.ExpandIncludes(filename, fetch); err != nil {
+		return err
+	}
+	p, err := m.Compile()
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	est, err := irmf.EstimateVolumes(p, m, *numCells, *passes, *seed, *parallel)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	usage, err := m.Usage(est, reg)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	fmt.Printf("%v:\n", filename)
+	for _, u := range usage {
+		fmt.Printf("  %v\n", u)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// make-gallery generates a static web site for browsing the examples
+// (see package gallery): an index page that can be searched and filtered
+// by material, units, and shader language, and one page per example with
+// its README, syntax-highlighted GLSL and WGSL sources, and download
+// links. The site works offline and can be published as is, such as
+// with GitHub Pages.
+//
+// The output directory is replaced on each run, but only if it is empty
+// or holds a previously generated gallery.
+//
+// Usage:
+//
+//	go run ./cmd/make-gallery
+//	go run ./cmd/make-gallery -o /tmp/gallery && open /tmp/gallery/index.html
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/gmlewis/irmf-examples/gallery"
+)
+
+var (
+	out       = flag.String("o", "docs", "Output directory")
+	root      = flag.String("root", ".", "Root directory of the repo")
+	maxSource = flag.Int("max_source", 65536, "Show at most this many bytes of each shader (0 for all)")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 0 {
+		log.Fatal("usage: make-gallery [-o docs] [-root .] [-max_source n]")
+	}
+	if err := gallery.Write(*root, *out, gallery.Options{MaxSource: *maxSource}); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote the gallery to %v", *out)
+}
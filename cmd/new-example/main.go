@@ -0,0 +1,382 @@
+// new-example creates a new example directory with the next free number
+// (or -number; see renumber-examples -insert to make room for it):
+// a GLSL model, its WGSL twin with a matching header, and a README in the
+// layout update-examples expects, and lists it in the root README.
+//
+// The model is a placeholder sphere filling the bounding box, ready to be
+// replaced. The README's snippet is already up to date, and the material
+// names are checked against the material registry as irmf-lint does, so
+// both tools pass on the new example as is. A screenshot named after the
+// model (e.g. gear-1.png) is expected to be added to the directory.
+//
+// The author (in the headers and the README's license) defaults to the
+// git user.name of the repo and must be given with -author if that is
+// not set.
+//
+// Usage:
+//
+//	go run ./cmd/new-example -title "Spur gear" -materials PLA -min -10,-10,0 -max 10,10,5 gear
+//	go run ./cmd/new-example -author "Jane Doe" -materials copper,PLA -units in -file coil-1 coil
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+	"github.com/gmlewis/irmf-examples/materials"
+)
+
+var (
+	author    = flag.String("author", "", "Author of the model (default: git config user.name)")
+	license   = flag.String("license", "Apache-2.0", "License of the model")
+	title     = flag.String("title", "", "Title of the model (default: from the name)")
+	notes     = flag.String("notes", "", "Notes for the header")
+	materialz = flag.String("materials", "PLA", "Comma-separated materials, e.g. copper,PLA")
+	units     = flag.String("units", "mm", "Units of the model (mm, cm, m, in, or ft)")
+	minFlag   = flag.String("min", "-5,-5,-5", "Minimum corner of the bounding box")
+	maxFlag   = flag.String("max", "5,5,5", "Maximum corner of the bounding box")
+	file      = flag.String("file", "", "Base name of the model files (default: the name with a -1 suffix)")
+	number    = flag.Int("number", 0, "Number of the example (default: after the highest existing example)")
+	root      = flag.String("root", ".", "Root directory of the repo")
+
+	nameRE    = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	exampleRE = regexp.MustCompile(`^(\d{3})-`)
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 || !nameRE.MatchString(flag.Arg(0)) {
+		log.Fatal("usage: new-example [flags] name (lowercase words separated by dashes, e.g. spur-gear)")
+	}
+	name := flag.Arg(0)
+	if *author == "" {
+		*author = gitUserName(*root)
+	}
+	if *author == "" {
+		log.Fatal("-author is required since git config user.name is not set")
+	}
+	if *file == "" {
+		*file = name + "-1"
+	}
+	if *title == "" {
+		*title = strings.ToUpper(name[:1]) + strings.ReplaceAll(name[1:], "-", " ")
+	}
+	if err := create(name); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// gitUserName returns the user.name git uses in dir, or "".
+func gitUserName(dir string) string {
+	cmd := exec.Command("git", "config", "user.name")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func create(name string) error {
+	mats, err := parseMaterials(*materialz)
+	if err != nil {
+		return err
+	}
+	if _, err := irmf.UnitLength(*units); err != nil {
+		return err
+	}
+	min, err := parseVector("-min", *minFlag)
+	if err != nil {
+		return err
+	}
+	max, err := parseVector("-max", *maxFlag)
+	if err != nil {
+		return err
+	}
+	for i := range min {
+		if min[i] >= max[i] {
+			return fmt.Errorf("-min %v must be less than -max %v on every axis", *minFlag, *maxFlag)
+		}
+	}
+
+	dirName, err := nextExample(name)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(*root, "examples", dirName)
+
+	files := map[string]string{}
+	for _, lang := range []string{"glsl", "wgsl"} {
+		filename := *file + ".irmf"
+		if lang == "wgsl" {
+			filename = *file + "-wgsl.irmf"
+		}
+		src := header(lang, mats, min, max) + placeholder(lang, min, max)
+		m, err := irmf.Parse([]byte(src))
+		if err == nil {
+			_, err = m.Compile()
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %v", filename, err) // a bug in this command
+		}
+		files[filename] = src
+	}
+	files["README.md"] = readme(dirName, mats, min, max, files[*file+".irmf"])
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	for _, filename := range []string{*file + ".irmf", *file + "-wgsl.irmf", "README.md"} {
+		path := filepath.Join(dir, filename)
+		if err := os.WriteFile(path, []byte(files[filename]), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %v\n", path)
+	}
+	if err := addToRootReadme(dirName); err != nil {
+		return err
+	}
+	fmt.Printf("Next, replace the placeholder sphere in both shaders, add %v.png, and run update-examples.\n", *file)
+	return nil
+}
+
+// parseMaterials parses the material names, which must be spelled as in
+// the material registry (see irmf-lint).
+func parseMaterials(s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		mat, base, ok := materials.Default.Resolve(name)
+		if !ok {
+			return nil, fmt.Errorf("material %q is not in the material registry (see irmf-lint -list)", name)
+		}
+		known := base == mat.Name
+		for _, alias := range mat.Aliases {
+			known = known || base == alias
+		}
+		if !known {
+			return nil, fmt.Errorf("material %q should be spelled %q", name, strings.Replace(name, base, mat.Name, 1))
+		}
+		names = append(names, name)
+	}
+	if len(names) > 4 {
+		return nil, fmt.Errorf("the placeholder model supports up to 4 materials, not %v", len(names))
+	}
+	return names, nil
+}
+
+func parseVector(flagName, s string) ([3]float64, error) {
+	var v [3]float64
+	fields := strings.Split(s, ",")
+	if len(fields) != 3 {
+		return v, fmt.Errorf("%v: want 3 values, got %v", flagName, len(fields))
+	}
+	for i, f := range fields {
+		x, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return v, fmt.Errorf("%v: %v", flagName, err)
+		}
+		v[i] = x
+	}
+	return v, nil
+}
+
+// nextExample returns the directory name of the new example, numbered
+// -number or after the highest existing example.
+func nextExample(name string) (string, error) {
+	entries, err := os.ReadDir(filepath.Join(*root, "examples"))
+	if err != nil {
+		return "", err
+	}
+	last := 0
+	used := map[int]string{}
+	for _, e := range entries {
+		if m := exampleRE.FindStringSubmatch(e.Name()); e.IsDir() && m != nil && !isStub(e.Name()) {
+			n, _ := strconv.Atoi(m[1])
+			if e.Name()[4:] == name {
+				return "", fmt.Errorf("example %v already exists", e.Name())
+			}
+			used[n] = e.Name()
+			last = max(last, n)
+		}
+	}
+	if *number == 0 {
+		return fmt.Sprintf("%03d-%v", last+1, name), nil
+	}
+	if *number < 0 || *number > 999 {
+		return "", fmt.Errorf("invalid -number %v", *number)
+	}
+	if other, ok := used[*number]; ok {
+		return "", fmt.Errorf("number %v is taken by %v (see renumber-examples -insert)", *number, other)
+	}
+	return fmt.Sprintf("%03d-%v", *number, name), nil
+}
+
+// isStub reports whether the example directory only holds a README left
+// by renumber-examples -stubs.
+func isStub(dirName string) bool {
+	buf, err := os.ReadFile(filepath.Join(*root, "examples", dirName, "README.md"))
+	return err == nil && strings.Contains(string(buf), "<!-- renumber-examples stub -->")
+}
+
+func header(lang string, mats []string, min, max [3]float64) string {
+	quoted := make([]string, len(mats))
+	for i, name := range mats {
+		quoted[i] = strconv.Quote(name)
+	}
+	lines := []string{
+		`  "author": ` + strconv.Quote(*author),
+		`  "license": ` + strconv.Quote(*license),
+		`  "date": "` + time.Now().Format("2006-01-02") + `"`,
+		`  "irmf": "1.0"`,
+		`  "language": "` + lang + `"`,
+		`  "materials": [` + strings.Join(quoted, ",") + `]`,
+		`  "max": ` + formatVector(max),
+		`  "min": ` + formatVector(min),
+		`  "notes": ` + strconv.Quote(*notes),
+		`  "options": {}`,
+		`  "title": ` + strconv.Quote(*title),
+		`  "units": ` + strconv.Quote(*units),
+		`  "version": "1.0"`,
+	}
+	return "/*{\n" + strings.Join(lines, ",\n") + "\n}*/\n\n"
+}
+
+// placeholder returns a shader of a sphere of the first material
+// filling the bounding box.
+func placeholder(lang string, min, max [3]float64) string {
+	var center [3]string
+	radius := math.Inf(1)
+	for i := range center {
+		center[i] = shaderFloat((min[i] + max[i]) / 2)
+		radius = math.Min(radius, (max[i]-min[i])/2)
+	}
+	if lang == "wgsl" {
+		return fmt.Sprintf(`fn mainModel4(xyz: vec3f) -> vec4f {
+  // Replace this placeholder sphere with the model.
+  let radius = %v;
+  let r = length(xyz - vec3f(%v));
+  var materials = vec4f(0.0);
+  materials[0] = select(0.0, 1.0, r <= radius);
+  return materials;
+}
+`, shaderFloat(radius), strings.Join(center[:], ", "))
+	}
+	return fmt.Sprintf(`void mainModel4(out vec4 materials, in vec3 xyz) {
+  // Replace this placeholder sphere with the model.
+  const float radius = %v;
+  float r = length(xyz - vec3(%v));
+  materials[0] = r <= radius ? 1.0 : 0.0;
+}
+`, shaderFloat(radius), strings.Join(center[:], ", "))
+}
+
+// readme returns the example's README with the snippet written as
+// update-examples would write it.
+func readme(dirName string, mats []string, min, max [3]float64, glsl string) string {
+	quoted := make([]string, len(mats))
+	for i, name := range mats {
+		quoted[i] = strconv.Quote(name)
+	}
+	snippet := fmt.Sprintf("/*{\n  irmf: \"1.0\",\n  materials: [%v],\n  max: %v,\n  min: %v,\n  units: %q,\n}*/\n",
+		strings.Join(quoted, ","), formatVector(max), formatVector(min), *units)
+	snippet += glsl[strings.Index(glsl, "\n}*/\n")+5:]
+	filename := *file + ".irmf"
+	description := *notes
+	if description == "" {
+		description = *title + "."
+	}
+	return fmt.Sprintf("# %v\n\n%v\n\n## %v\n\n![%v.png](%v.png)\n\n```glsl\n%v```\n\n"+
+		"* Try loading [%v](https://gmlewis.github.io/irmf-editor/?s=github.com/gmlewis/irmf-examples/blob/master/examples/%v/%v) now in the experimental IRMF editor!\n\n"+
+		"* Use [irmf-slicer](https://github.com/gmlewis/irmf-slicer) to generate an STL or voxel approximation.\n\n%v",
+		dirName, description, filename, *file, *file, snippet, filename, dirName, filename, licenseText())
+}
+
+func licenseText() string {
+	return fmt.Sprintf(`----------------------------------------------------------------------
+
+# License
+
+Copyright %v %v. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+`, time.Now().Year(), *author)
+}
+
+// addToRootReadme lists the example in the root README, before the
+// first example with a higher number or after the last one.
+func addToRootReadme(dirName string) error {
+	path := filepath.Join(*root, "README.md")
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s := string(buf)
+	last := strings.LastIndex(s, "\n* [0")
+	if last < 0 {
+		return fmt.Errorf("%v: unable to find the list of examples", path)
+	}
+	// Skip the last entry and its image.
+	at := last + 1
+	for _, line := range strings.SplitAfter(s[last+1:], "\n") {
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "* [0") && !strings.HasPrefix(line, "[![0") {
+			break
+		}
+		at += len(line)
+	}
+	for i := strings.Index(s, "\n* [0"); i >= 0 && i <= last; {
+		if s[i+4:] > dirName {
+			at = i + 1
+			break
+		}
+		j := strings.Index(s[i+1:], "\n* [0")
+		if j < 0 {
+			break
+		}
+		i += j + 1
+	}
+	entry := fmt.Sprintf("* [%v](examples/%v)\n\n[![%v](examples/%v/%v.png)](examples/%v)\n\n", dirName, dirName, dirName, dirName, *file, dirName)
+	s = s[:at] + entry + s[at:]
+	if err := os.WriteFile(path, []byte(s), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %v\n", path)
+	return nil
+}
+
+func formatVector(v [3]float64) string {
+	s := make([]string, len(v))
+	for i, f := range v {
+		s[i] = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return "[" + strings.Join(s, ",") + "]"
+}
+
+// shaderFloat formats v as a float literal for GLSL or WGSL.
+func shaderFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,354 @@
+// renumber-examples moves an example to another number, shifting the
+// examples in between, or makes room for a new example (see new-example
+// -number) by shifting an example and all later ones up by one.
+//
+// The target of a move is a number, which keeps the example's name, or a
+// new directory name such as 005-text-glyphs, which also renames it.
+//
+// Every reference to a renamed example in the repo's text files is
+// rewritten: links and image references in the READMEs, editor and
+// github.com/gmlewis/irmf-examples URLs (including #include paths),
+// fingerprints.txt, and the examples/NNN-name paths in Go sources (other
+// names in Go sources, such as the ones in this usage, are only
+// samples). URLs into other repos are left alone. With -stubs, a README
+// pointing to the new location is left at each old path.
+//
+// Usage:
+//
+//	go run ./cmd/renumber-examples 016-text 5
+//	go run ./cmd/renumber-examples -stubs 016-text 005-text-glyphs
+//	go run ./cmd/renumber-examples -insert 12
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	insert = flag.Int("insert", 0, "Shift the example with this number and all later ones up by one")
+	stubs  = flag.Bool("stubs", false, "Leave a README pointing to the new location at each old path")
+	dryRun = flag.Bool("n", false, "Print the renames without making them")
+	root   = flag.String("root", ".", "Root directory of the repo")
+
+	exampleRE = regexp.MustCompile(`^(\d{3})-([a-z0-9]+(?:-[a-z0-9]+)*)$`)
+	nameRE    = regexp.MustCompile(`[0-9]{3}-[a-z0-9]+(?:-[a-z0-9]+)*`)
+
+	// textExts are the files in which references are rewritten.
+	textExts = map[string]bool{".md": true, ".irmf": true, ".go": true, ".json": true, ".txt": true, ".glsl": true, ".wgsl": true, ".html": true, ".js": true, ".css": true}
+)
+
+// stubMarker identifies the READMEs left by -stubs.
+const stubMarker = "<!-- renumber-examples stub -->"
+
+func main() {
+	flag.Parse()
+	if *insert > 0 && flag.NArg() != 0 || *insert == 0 && flag.NArg() != 2 {
+		log.Fatal("usage: renumber-examples [flags] NNN-name (number | NNN-new-name), or renumber-examples [flags] -insert number")
+	}
+	examples, err := readExamples()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var renames map[string]string
+	if *insert > 0 {
+		renames, err = insertAt(examples, *insert)
+	} else {
+		renames, err = move(examples, flag.Arg(0), flag.Arg(1))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(renames) == 0 {
+		log.Fatal("nothing to do")
+	}
+
+	olds := make([]string, 0, len(renames))
+	for old := range renames {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+	for _, old := range olds {
+		fmt.Printf("%v -> %v\n", old, renames[old])
+	}
+	if *dryRun {
+		return
+	}
+	if err := apply(olds, renames); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// apply renames the example directories and rewrites the references to
+// them.
+func apply(olds []string, renames map[string]string) error {
+	if err := rename(renames); err != nil {
+		return err
+	}
+	if err := rewriteReferences(renames); err != nil {
+		return err
+	}
+	if err := sortRootReadme(); err != nil {
+		return err
+	}
+	if *stubs {
+		return writeStubs(olds, renames)
+	}
+	return nil
+}
+
+// readExamples returns the example directory names (not stubs) by
+// number.
+func readExamples() (map[int]string, error) {
+	entries, err := os.ReadDir(filepath.Join(*root, "examples"))
+	if err != nil {
+		return nil, err
+	}
+	examples := map[int]string{}
+	for _, e := range entries {
+		m := exampleRE.FindStringSubmatch(e.Name())
+		if !e.IsDir() || m == nil || isStub(e.Name()) {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		if other, ok := examples[n]; ok {
+			return nil, fmt.Errorf("examples %v and %v have the same number", other, e.Name())
+		}
+		examples[n] = e.Name()
+	}
+	return examples, nil
+}
+
+func isStub(dirName string) bool {
+	buf, err := os.ReadFile(filepath.Join(*root, "examples", dirName, "README.md"))
+	return err == nil && strings.Contains(string(buf), stubMarker)
+}
+
+// insertAt returns the renames that shift the examples numbered n and
+// up by one.
+func insertAt(examples map[int]string, n int) (map[string]string, error) {
+	if n > 999 {
+		return nil, fmt.Errorf("invalid number %v", n)
+	}
+	renames := map[string]string{}
+	for number, dirName := range examples {
+		if number >= n {
+			if number == 999 {
+				return nil, fmt.Errorf("cannot shift %v past 999", dirName)
+			}
+			renames[dirName] = withNumber(dirName, number+1)
+		}
+	}
+	return renames, nil
+}
+
+// move returns the renames that move the example from to the target (a
+// number or a directory name), shifting the examples in between.
+func move(examples map[int]string, from, target string) (map[string]string, error) {
+	m := exampleRE.FindStringSubmatch(from)
+	if m == nil {
+		return nil, fmt.Errorf("invalid example %q", from)
+	}
+	src, _ := strconv.Atoi(m[1])
+	if examples[src] != from {
+		return nil, fmt.Errorf("example %v not found", from)
+	}
+	to := from
+	if t := exampleRE.FindStringSubmatch(target); t != nil {
+		to = target
+	} else if n, err := strconv.Atoi(target); err == nil && n > 0 && n <= 999 {
+		to = withNumber(from, n)
+	} else {
+		return nil, fmt.Errorf("invalid target %q (want a number or a name like 005-text)", target)
+	}
+	dst, _ := strconv.Atoi(to[:3])
+
+	renames := map[string]string{}
+	for number, dirName := range examples {
+		switch {
+		case number == src:
+		case dst < src && number >= dst && number < src:
+			renames[dirName] = withNumber(dirName, number+1)
+		case dst > src && number > src && number <= dst:
+			renames[dirName] = withNumber(dirName, number-1)
+		}
+	}
+	if to != from {
+		renames[from] = to
+	}
+	// The new names must not collide with examples that stay.
+	taken := map[string]bool{}
+	for _, dirName := range examples {
+		if _, ok := renames[dirName]; !ok {
+			taken[dirName[4:]] = true
+		}
+	}
+	if taken[to[4:]] {
+		return nil, fmt.Errorf("an example named %v already exists", to[4:])
+	}
+	return renames, nil
+}
+
+func withNumber(dirName string, n int) string {
+	return fmt.Sprintf("%03d%v", n, dirName[3:])
+}
+
+// rename renames the directories in two steps so that none is
+// overwritten. Stubs in the way are removed.
+func rename(renames map[string]string) error {
+	dir := filepath.Join(*root, "examples")
+	for old := range renames {
+		if err := os.Rename(filepath.Join(dir, old), filepath.Join(dir, ".renumber-"+old)); err != nil {
+			return err
+		}
+	}
+	for old, new := range renames {
+		if isStub(new) {
+			if err := os.RemoveAll(filepath.Join(dir, new)); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(filepath.Join(dir, ".renumber-"+old), filepath.Join(dir, new)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteReferences rewrites the references to the renamed examples in
+// all text files.
+func rewriteReferences(renames map[string]string) error {
+	return filepath.WalkDir(*root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !textExts[filepath.Ext(path)] {
+			return nil
+		}
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		s, n := rewrite(string(buf), renames, filepath.Ext(path) == ".go")
+		if n == 0 {
+			return nil
+		}
+		if err := os.WriteFile(path, []byte(s), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("%v: rewrote %v references\n", path, n)
+		return nil
+	})
+}
+
+// rewrite returns s with the renamed examples replaced where they are
+// not part of a longer name or of a URL into another repo (and, if
+// pathsOnly, where they follow "examples/"), and the number of
+// replacements.
+func rewrite(s string, renames map[string]string, pathsOnly bool) (string, int) {
+	var sb strings.Builder
+	var n, last int
+	for _, loc := range nameRE.FindAllStringIndex(s, -1) {
+		new, ok := renames[s[loc[0]:loc[1]]]
+		if !ok || (loc[0] > 0 && isNameChar(s[loc[0]-1])) {
+			continue
+		}
+		if pathsOnly && !strings.HasSuffix(s[:loc[0]], "examples/") {
+			continue
+		}
+		if token := tokenBefore(s, loc[0]); (strings.Contains(token, "://") || strings.Contains(token, ".com/") || strings.Contains(token, ".io/")) &&
+			!strings.Contains(token, "gmlewis/irmf-examples/") {
+			continue
+		}
+		sb.WriteString(s[last:loc[0]])
+		sb.WriteString(new)
+		last = loc[1]
+		n++
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), n
+}
+
+func isNameChar(c byte) bool {
+	return c == '-' || c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// tokenBefore returns the part of the path or URL before s[i].
+func tokenBefore(s string, i int) string {
+	j := strings.LastIndexAny(s[:i], " \t\n\"'`()<>[]")
+	return s[j+1 : i]
+}
+
+// sortRootReadme sorts the list of examples in the root README, each of
+// which is a "* [NNN-name](...)" line followed by an image.
+func sortRootReadme() error {
+	path := filepath.Join(*root, "README.md")
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s := string(buf)
+	start := strings.Index(s, "\n* [0")
+	last := strings.LastIndex(s, "\n* [0")
+	if start < 0 {
+		return nil
+	}
+	end := last + 1
+	for _, line := range strings.SplitAfter(s[last+1:], "\n") {
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "* [0") && !strings.HasPrefix(line, "[![0") {
+			break
+		}
+		end += len(line)
+	}
+	var blocks []string
+	for _, e := range strings.Split(s[start+1:end], "\n* [") {
+		if !strings.HasPrefix(e, "* [") {
+			e = "* [" + e
+		}
+		blocks = append(blocks, strings.TrimRight(e, "\n")+"\n\n")
+	}
+	sorted := append([]string(nil), blocks...)
+	sort.Strings(sorted)
+	if strings.Join(sorted, "") == strings.Join(blocks, "") {
+		return nil
+	}
+	s = s[:start+1] + strings.Join(sorted, "") + s[end:]
+	if err := os.WriteFile(path, []byte(s), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%v: sorted the list of examples\n", path)
+	return nil
+}
+
+func writeStubs(olds []string, renames map[string]string) error {
+	for _, old := range olds {
+		new := renames[old]
+		dir := filepath.Join(*root, "examples", old)
+		if _, err := os.Stat(dir); err == nil {
+			continue // taken by another example
+		}
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return err
+		}
+		readme := fmt.Sprintf("# %v\n\n%v\nThis example has moved to [%v](../%v).\n", old, stubMarker, new, new)
+		if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte(readme), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %v\n", filepath.Join(dir, "README.md"))
+	}
+	return nil
+}
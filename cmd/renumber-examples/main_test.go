@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const editorURL = "https://gmlewis.github.io/irmf-editor/?s=github.com/gmlewis/irmf-examples/blob/master/examples/"
+
+func TestRenumber(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"README.md": `# Examples
+
+* [001-a](examples/001-a)
+
+[![001-a](examples/001-a/a.png)](examples/001-a)
+
+* [002-b](examples/002-b)
+
+[![002-b](examples/002-b/b.png)](examples/002-b)
+
+* [003-c](examples/003-c)
+
+[![003-c](examples/003-c/c.png)](examples/003-c)
+
+## Tools
+`,
+		"examples/001-a/README.md": "Load [a.irmf](" + editorURL + "001-a/a.irmf). See also [002-b](../002-b) and https://github.com/other/repo/tree/master/001-a.\n",
+		"examples/001-a/a.irmf":    "#include \"github.com/gmlewis/irmf-examples/blob/master/examples/002-b/b.glsl\"\n",
+		"examples/002-b/README.md": "Load [b.irmf](" + editorURL + "002-b/b.irmf). Not 002-bb or x002-b.\n",
+		"examples/002-b/b.glsl":    "// 002-b\n",
+		"examples/003-c/README.md": "Load [c.irmf](" + editorURL + "003-c/c.irmf).\n",
+		"examples/fingerprints.txt": `43a79d77199832dd  examples/001-a/a.irmf
+0123456789abcdef  examples/003-c/c.irmf
+`,
+		"cmd/tool/main.go": `// tool reads examples/001-a/a.irmf.
+//
+// Usage:
+//
+//	go run ./cmd/renumber-examples 001-a 5
+package main
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldRoot, oldStubs := *root, *stubs
+	defer func() { *root, *stubs = oldRoot, oldStubs }()
+	*root, *stubs = dir, true
+
+	examples, err := readExamples()
+	if err != nil {
+		t.Fatal(err)
+	}
+	renames, err := move(examples, "003-c", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"001-a": "002-a", "002-b": "003-b", "003-c": "001-c"}
+	if len(renames) != len(want) {
+		t.Fatalf("renames = %v, want %v", renames, want)
+	}
+	for old, new := range want {
+		if renames[old] != new {
+			t.Fatalf("renames = %v, want %v", renames, want)
+		}
+	}
+	olds := make([]string, 0, len(renames))
+	for old := range renames {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+	if err := apply(olds, renames); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		buf, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf)
+	}
+	tests := []struct {
+		file          string
+		want, notWant []string
+	}{
+		{
+			file: "README.md",
+			want: []string{`# Examples
+
+* [001-c](examples/001-c)
+
+[![001-c](examples/001-c/c.png)](examples/001-c)
+
+* [002-a](examples/002-a)
+
+[![002-a](examples/002-a/a.png)](examples/002-a)
+
+* [003-b](examples/003-b)
+
+[![003-b](examples/003-b/b.png)](examples/003-b)
+
+## Tools
+`},
+		},
+		{
+			file:    "examples/002-a/README.md",
+			want:    []string{editorURL + "002-a/a.irmf", "[003-b](../003-b)", "https://github.com/other/repo/tree/master/001-a"},
+			notWant: []string{"../002-b", editorURL + "001-a"},
+		},
+		{
+			file: "examples/002-a/a.irmf",
+			want: []string{`#include "github.com/gmlewis/irmf-examples/blob/master/examples/003-b/b.glsl"`},
+		},
+		{
+			file: "examples/003-b/README.md",
+			want: []string{editorURL + "003-b/b.irmf", "Not 002-bb or x002-b."},
+		},
+		{
+			file: "examples/fingerprints.txt",
+			want: []string{"43a79d77199832dd  examples/002-a/a.irmf\n", "0123456789abcdef  examples/001-c/c.irmf\n"},
+		},
+		{
+			file:    "cmd/tool/main.go",
+			want:    []string{"// tool reads examples/002-a/a.irmf.", "renumber-examples 001-a 5"},
+			notWant: []string{"002-a 5"},
+		},
+		{file: "examples/001-a/README.md", want: []string{stubMarker, "[002-a](../002-a)"}},
+		{file: "examples/002-b/README.md", want: []string{stubMarker, "[003-b](../003-b)"}},
+		{file: "examples/003-c/README.md", want: []string{stubMarker, "[001-c](../001-c)"}},
+	}
+	for _, tt := range tests {
+		got := read(tt.file)
+		for _, w := range tt.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%v = %q, want %q", tt.file, got, w)
+			}
+		}
+		for _, w := range tt.notWant {
+			if strings.Contains(got, w) {
+				t.Errorf("%v = %q, want no %q", tt.file, got, w)
+			}
+		}
+	}
+
+	// The stubs are not examples, and a later move replaces them.
+	examples, err = readExamples()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(examples) != 3 || examples[1] != "001-c" || examples[2] != "002-a" || examples[3] != "003-b" {
+		t.Errorf("examples after the move = %v", examples)
+	}
+	renames, err = move(examples, "002-a", "004-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	*stubs = false
+	if err := apply([]string{"002-a", "003-b"}, renames); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if got := read("examples/004-a/a.irmf"); !strings.Contains(got, "examples/002-b/b.glsl") {
+		t.Errorf("examples/004-a/a.irmf = %q, want the include of examples/002-b", got)
+	}
+	if got := read("examples/002-b/README.md"); strings.Contains(got, stubMarker) {
+		t.Errorf("the stub at examples/002-b was not replaced: %q", got)
+	}
+}
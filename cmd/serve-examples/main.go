@@ -0,0 +1,250 @@
+// serve-examples serves the examples directory over HTTP so that models
+// can be tried in the IRMF editor before they are pushed to GitHub.
+//
+// Responses allow cross-origin requests (so the editor, loaded from
+// another origin, can fetch the shaders) and are not cached. Directories
+// are listed with a link to open each IRMF file in the editor, the
+// README.md files have their "Try loading" links rewritten to load the
+// local files into the -editor instead of the ones on GitHub, and
+// /examples/examples.json is the catalog of the examples as they are on
+// disk (see package catalog).
+//
+// Usage:
+//
+//	go run ./cmd/serve-examples
+//	go run ./cmd/serve-examples -addr :8080 -editor http://localhost:8000/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gmlewis/irmf-examples/catalog"
+)
+
+var (
+	addr   = flag.String("addr", "localhost:8080", "Address to listen on")
+	root   = flag.String("root", ".", "Root directory of the repo")
+	editor = flag.String("editor", "https://gmlewis.github.io/irmf-editor/", "URL of the IRMF editor that loads shaders with ?s=")
+	origin = flag.String("origin", "*", "Value of the Access-Control-Allow-Origin header")
+
+	// editorLinkRE matches the links to this repo's shaders written by
+	// update-examples (see tryMessage).
+	editorLinkRE = regexp.MustCompile(`https://gmlewis\.github\.io/irmf-editor/\?s=github\.com/gmlewis/irmf-examples/blob/master/(examples/[^)\s"]+)`)
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 0 {
+		log.Fatal("usage: serve-examples [-addr host:port] [-root dir] [-editor url] [-origin origin]")
+	}
+	if _, err := os.Stat(filepath.Join(*root, "examples")); err != nil {
+		log.Fatal(err)
+	}
+	for _, ext := range []string{".irmf", ".glsl", ".wgsl", ".scl"} {
+		mime.AddExtensionType(ext, "text/plain; charset=utf-8")
+	}
+	mime.AddExtensionType(".md", "text/markdown; charset=utf-8")
+
+	s := &server{root: *root, editor: *editor}
+	log.Printf("Serving %v on http://%v/examples/ (editor: %v)", filepath.Join(*root, "examples"), *addr, *editor)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
+
+type server struct {
+	root   string
+	editor string
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%v %v", r.Method, r.URL.Path)
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", *origin)
+	h.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", "*")
+	h.Set("Cache-Control", "no-cache")
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodGet, http.MethodHead:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := path.Clean(r.URL.Path)
+	switch {
+	case p == "/":
+		http.Redirect(w, r, "/examples/", http.StatusFound)
+		return
+	case p == "/examples/examples.json":
+		s.serveCatalog(w, r)
+		return
+	case p != "/examples" && !strings.HasPrefix(p, "/examples/"):
+		http.NotFound(w, r)
+		return
+	}
+
+	filename := filepath.Join(s.root, filepath.FromSlash(p))
+	fi, err := os.Stat(filename)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if fi.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, p+"/", http.StatusMovedPermanently)
+			return
+		}
+		s.serveDir(w, r, p, filename)
+		return
+	}
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if fi.Name() == "README.md" {
+		buf = []byte(s.rewriteLinks(r, string(buf)))
+	}
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), bytes.NewReader(buf))
+}
+
+// baseURL returns the URL of the server as seen by the client.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// editorURL returns the URL that opens the file at p (such as
+// "/examples/001-sphere/sphere-1.irmf") in the editor.
+func (s *server) editorURL(r *http.Request, p string) string {
+	sep := "?"
+	if strings.Contains(s.editor, "?") {
+		sep = "&"
+	}
+	return s.editor + sep + "s=" + url.QueryEscape(baseURL(r)+p)
+}
+
+// rewriteLinks points the editor links in the README at this server.
+func (s *server) rewriteLinks(r *http.Request, readme string) string {
+	return editorLinkRE.ReplaceAllStringFunc(readme, func(link string) string {
+		return s.editorURL(r, "/"+editorLinkRE.FindStringSubmatch(link)[1])
+	})
+}
+
+// serveCatalog serves the catalog of the examples on disk, keeping the
+// usage estimates of the unchanged shaders from the committed catalog.
+func (s *server) serveCatalog(w http.ResponseWriter, r *http.Request) {
+	c, err := catalog.Build(s.root)
+	if err == nil {
+		var old *catalog.Catalog
+		if old, err = catalog.Read(filepath.Join(s.root, "examples", "examples.json")); err == nil {
+			c.KeepUsage(old)
+		}
+	}
+	if err != nil {
+		log.Printf("catalog: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf, err := c.Marshal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeContent(w, r, "examples.json", time.Now(), bytes.NewReader(buf))
+}
+
+type dirEntry struct {
+	Name    string
+	Href    string
+	Size    int64
+	ModTime string
+	Editor  string // for IRMF files
+	IsDir   bool
+}
+
+func (s *server) serveDir(w http.ResponseWriter, r *http.Request, p, dirname string) {
+	entries, err := os.ReadDir(dirname)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var list []*dirEntry
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		d := &dirEntry{
+			Name:    e.Name(),
+			Href:    url.PathEscape(e.Name()),
+			Size:    fi.Size(),
+			ModTime: fi.ModTime().Format("2006-01-02 15:04"),
+			IsDir:   e.IsDir(),
+		}
+		if d.IsDir {
+			d.Name += "/"
+			d.Href += "/"
+		}
+		if filepath.Ext(e.Name()) == ".irmf" {
+			d.Editor = s.editorURL(r, path.Join(p, e.Name()))
+		}
+		list = append(list, d)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].IsDir && !list[j].IsDir })
+
+	var buf bytes.Buffer
+	data := struct {
+		Path    string
+		Parent  bool
+		Entries []*dirEntry
+	}{Path: p + "/", Parent: p != "/examples", Entries: list}
+	if err := dirTemplate.Execute(&buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+var dirTemplate = template.Must(template.New("dir").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Path}}</title>
+<style>
+body { font: 15px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 1rem 2rem; }
+td { padding: 0.1rem 1rem 0.1rem 0; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{.Path}}</h1>
+<p>Catalog: <a href="/examples/examples.json">examples.json</a></p>
+<table>
+{{if .Parent}}<tr><td><a href="../">../</a></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}</a></td><td class="size">{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{.ModTime}}</td><td>{{if .Editor}}<a href="{{.Editor}}">open in editor</a>{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
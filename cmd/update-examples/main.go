@@ -2,9 +2,22 @@
 // and updates the code snippets with minimal versions of the shaders
 // since there is not a good way to embed files into README.md files
 // on GitHub.
+//
+// Shaders longer than -minify_over bytes, and those in sections that
+// contain a "<!-- minify -->" comment, are embedded minified (see
+// irmf.Model.Minify) with a link to the full source. Minified shaders
+// are checked to evaluate identically to the originals.
+//
+// With -usage, it also estimates the volume and mass of each material
+// (see cmd/irmf-volume) and adds them to each model's section.
+//
+// Finally, it writes the catalog of all examples (see package catalog)
+// to -catalog, keeping the usage estimates of unchanged shaders from the
+// previous catalog when -usage is not given.
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -12,13 +25,32 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+
+	"github.com/gmlewis/irmf-examples/catalog"
+	"github.com/gmlewis/irmf-examples/irmf"
+	"github.com/gmlewis/irmf-examples/materials"
 )
 
 var (
 	h2RE = regexp.MustCompile(`\n##\s+`)
+
+	addUsage = flag.Bool("usage", false, "Add estimated material volumes and masses to each section (slow)")
+	usageN   = flag.Int("usage_n", 32, "Number of sampling cells along the longest side for -usage")
+
+	minifyOver = flag.Int("minify_over", 16384, "Minify shaders longer than this many bytes (0 to only minify marked sections)")
+	minifyN    = flag.Int("minify_n", 16, "Number of sampling cells along the longest side when checking minified shaders")
+
+	catalogFile = flag.String("catalog", "examples/examples.json", "Catalog file to write (empty to skip)")
+
+	// usageByFile records the estimates made with -usage for the catalog.
+	usageByFile = map[string][]irmf.Usage{}
 )
 
+// minifyMarker requests a minified shader in a README section.
+const minifyMarker = "<!-- minify -->"
+
 func main() {
+	flag.Parse()
 	readmeByPath := map[string]string{}
 	irmfByPath := map[string]map[string]string{}
 	stlFileSizesByPath := map[string]map[string]int64{}
@@ -70,6 +102,31 @@ func main() {
 	for k, v := range readmeByPath {
 		processReadme(k, v, irmfByPath[k], stlFileSizesByPath[k], dlpFileSizesByPath[k])
 	}
+
+	if *catalogFile != "" {
+		if err := writeCatalog(*catalogFile); err != nil {
+			log.Fatalf("writeCatalog: %v", err)
+		}
+	}
+}
+
+func writeCatalog(filename string) error {
+	c, err := catalog.Build(".")
+	if err != nil {
+		return err
+	}
+	for path, usage := range usageByFile {
+		if s := c.Shader(filepath.ToSlash(path)); s != nil {
+			s.Usage = catalog.UsageOf(usage)
+		}
+	}
+	old, err := catalog.Read(filename)
+	if err != nil {
+		return err
+	}
+	c.KeepUsage(old)
+	log.Printf("Writing %v with %v examples...", filename, len(c.Examples))
+	return c.Write(filename)
 }
 
 func removeExtraFields(s string) string {
@@ -112,6 +169,11 @@ func processReadme(path, buf string, irmfs map[string]string, stlFileSizes map[s
 
 	parts := h2RE.Split(buf, -1)
 	log.Printf("Found %v ## sections...", len(parts))
+	if len(parts) == 1 {
+		// Such as the stubs left by renumber-examples.
+		log.Printf("No ## sections in %v/README.md; leaving it as is", path)
+		return
+	}
 	for i, v := range parts {
 		if i == 0 {
 			continue
@@ -122,20 +184,36 @@ func processReadme(path, buf string, irmfs map[string]string, stlFileSizes map[s
 		if !ok {
 			log.Fatalf("Could not find file %v, path=%q", filename, path)
 		}
+		if j := strings.Index(v, "-----"); j >= 0 {
+			licenseText = v[j:] // Preserve year of original license text.
+			v = strings.TrimRight(v[:j], "\n") + "\n"
+		}
+
 		glslIndex := strings.Index(v, "```glsl")
 		if glslIndex < 0 {
-			log.Fatalf("Unable to find ```glsl...``` in %v", v)
+			// Large models (such as the encoded ones) have no snippet.
+			log.Printf("No ```glsl...``` snippet for %v; leaving its section as is", filename)
+			parts[i] = "## " + v
+			continue
 		}
 
-		if j := strings.Index(v, "-----"); j >= 0 {
-			licenseText = v[j:] // Preserve year of original license text.
+		var minifiedMessage string
+		if strings.Contains(v[:glslIndex], minifyMarker) || (*minifyOver > 0 && len(glsl) > *minifyOver) {
+			if s, ok := minifyShader(filepath.Join(path, filename), glsl); ok {
+				glsl = s
+				minifiedMessage = fmt.Sprintf("* The shader above is minified; see [%v](%v) for the full source.\n", filename, filename)
+			}
 		}
 
-		parts[i] = "## " + v[0:glslIndex+8] + glsl + "```\n\n" + tryMessage(path, filename) + addSlicerMessage()
+		parts[i] = "## " + v[0:glslIndex+8] + glsl + "```\n\n" + minifiedMessage + tryMessage(path, filename) + addSlicerMessage()
 
 		if len(dlpFileSizes) > 0 {
 			parts[i] += addDLPs(filename, dlpFileSizes)
 		}
+
+		if *addUsage {
+			parts[i] += addMaterialUsage(filepath.Join(path, filename))
+		}
 	}
 	parts = append(parts, licenseText)
 
@@ -174,6 +252,64 @@ func addDLPs(filename string, dlpFileSizes map[string]int64) string {
 	return "\n" + header + ":\n" + strings.Join(lines, "\n") + "\n"
 }
 
+func addMaterialUsage(filename string) string {
+	m, err := irmf.ReadFile(filename)
+	if err == nil {
+		// Network includes are not fetched, so such models are skipped.
+		err = m.ExpandIncludes(filename, nil)
+	}
+	if err != nil {
+		log.Printf("Skipping material usage of %v: %v", filename, err)
+		return ""
+	}
+	prog, err := m.Compile()
+	if err != nil {
+		log.Printf("Skipping material usage of %v: %v", filename, err)
+		return ""
+	}
+	est, err := irmf.EstimateVolumes(prog, m, *usageN, 4, 1, 0)
+	if err != nil {
+		log.Fatalf("EstimateVolumes(%q): %v", filename, err)
+	}
+	usage, err := m.Usage(est, materials.Default)
+	if err != nil {
+		log.Printf("Skipping material usage of %v: %v", filename, err)
+		return ""
+	}
+
+	usageByFile[filename] = usage
+
+	lines := []string{"\n* Estimated material usage (Monte Carlo, ±1σ):"}
+	for _, u := range usage {
+		lines = append(lines, "  - "+u.String())
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// minifyShader replaces the body of the snippet (as returned by
+// removeExtraFields) with the minified shader of the file.
+func minifyShader(filename, snippet string) (string, bool) {
+	end := strings.Index(snippet, "\n}*/")
+	if end < 0 {
+		return "", false
+	}
+	m, err := irmf.ReadFile(filename)
+	if err == nil {
+		// Network includes are not fetched, so such models are skipped.
+		err = m.ExpandIncludes(filename, nil)
+	}
+	var small string
+	if err == nil {
+		small, err = m.Minify(*minifyN, 100, 0)
+	}
+	if err != nil {
+		log.Printf("Not minifying %v: %v", filename, err)
+		return "", false
+	}
+	log.Printf("Minified %v from %v to %v bytes", filename, len(m.Shader), len(small))
+	return snippet[:end+4] + "\n\n" + small, true
+}
+
 func tryMessage(path, filename string) string {
 	return fmt.Sprintf(`* Try loading [%v](https://gmlewis.github.io/irmf-editor/?s=github.com/gmlewis/irmf-examples/blob/master/%v/%v) now in the experimental IRMF editor!`+"\n", filename, path, filename)
 }
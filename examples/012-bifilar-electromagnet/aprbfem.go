@@ -1,4 +1,4 @@
-// -*- compile-command: "go run aprbfem.go"; -*-
+// -*- compile-command: "go run ."; -*-
 
 // aprbfem creates an axial-plus-radial-bi-filar-electro-magnet
 // STL file using Go. It is based on 30x30x132mm-vert.irmf.
@@ -7,17 +7,52 @@
 // file representing a dielectric (or support material) surrounding
 // the metal (with suffic "-dielectric.stl" instead of ".stl".
 //
+// The output format is determined by the extension of -out:
+// ".stl" files are streamed triangle-by-triangle to keep memory use
+// low, while ".obj", ".ply", and ".3mf" files are built in memory as
+// indexed meshes with coincident vertices welded together (within
+// -weld_tol). Use -check to build the indexed mesh and report any
+// holes or non-manifold edges (even for ".stl" output).
+//
+// The coil is built along +Z. Use -axis and/or -matrix to rotate it
+// into the desired print orientation (like the "-horiz" and "-vert"
+// IRMF variants) and -place to rest it on the build plate or center it.
+// The same transform is applied to both the metal and dielectric.
+//
+// Use -cut_plane or -cut_wedge to cut away part of the model (with the
+// cut faces capped) to reveal the internal wire layout, and -section
+// to write a 2D cross-section as an SVG file. Both are specified in the
+// coil's own coordinate system where the coil is built along +Z.
+// Capping a cut requires a watertight mesh, so a cutaway stops with an
+// error (rather than writing open caps) if either mesh has holes; the
+// dielectric currently does (see -check), so use -section to view it.
+//
 // Usage:
 //
-//	go run aprbfem.go -h
-//	go run aprbfem.go -out aprbfem.stl
+//	go run . -h
+//	go run . -out aprbfem.stl
+//	go run . -out aprbfem.3mf -check
+//	go run . -out aprbfem-horiz.stl -axis x -place plate
+//	go run . -out section.stl -section x=0
+//
+// The coils are generated concurrently (see -parallel) and written
+// out in a fixed order, so the output is the same as a serial run.
+//
+// The parameter sets in update-examples.sh are regression-tested
+// against the golden summaries in testdata/. After an intentional
+// change to the geometry, regenerate them with:
+//
+//	go test . -update
 package main
 
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math"
+	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/gmlewis/go3d/vec3"
@@ -36,6 +71,19 @@ var (
 	rodThick = flag.Float64("rod_thick", 2.4, "Outer long rod (cantilever connector) thickness in millimeters")
 	wireGap  = flag.Float64("wire_gap", 0.3, "Gap between wires in millimeters")
 	wireSize = flag.Float64("wire_size", 1.2, "Width of (square) wire in millimeters")
+
+	checkMesh = flag.Bool("check", false, "Build indexed meshes and check them for holes and non-manifold edges")
+	weldTol   = flag.Float64("weld_tol", 1e-4, "Distance in millimeters within which vertices are welded in indexed meshes")
+
+	axis   = flag.String("axis", "z", "Axis (x, y, or z) along which the coil is built")
+	matrix = flag.String("matrix", "", "Optional 3x3 rotation matrix (9 comma-separated values, row-major) applied after -axis")
+	place  = flag.String("place", "none", "Placement of the model: none, plate (rest on z=0, centered in XY), or center")
+
+	parallel = flag.Int("parallel", runtime.NumCPU(), "Number of coils to generate concurrently (1 = serial); the output is identical either way")
+
+	cutPlaneSpec = flag.String("cut_plane", "", "Cutaway: remove the half-space n.p > d given as nx,ny,nz,d")
+	cutWedgeSpec = flag.String("cut_wedge", "", "Cutaway: remove the wedge about the coil axis from angle a0 to a1 (degrees, counterclockwise) given as a0,a1")
+	section      = flag.String("section", "", "Write an SVG cross-section of the metal and dielectric at an axis-aligned plane (e.g. x=0 or z=30)")
 )
 
 // TriWriter is a writer that writes STL triangles to a file.
@@ -46,22 +94,53 @@ type TriWriter interface {
 func main() {
 	flag.Parse()
 
+	if *numPairs < 2 {
+		log.Fatalf("-num_pairs (%v) must be at least 2", *numPairs)
+	}
 	if *dielGap*2 >= *wireGap {
 		log.Fatalf("-diel_gap (%v) must be less than half the -wire_gap (%v)", *dielGap, *wireGap)
 	}
 
-	w1, err := stl.New(*filename)
+	ext := filepath.Ext(*filename)
+	dielFilename := strings.TrimSuffix(*filename, ext) + "-dielectric" + ext
+
+	o, err := newOrientation(*axis, *matrix, *place)
 	if err != nil {
-		log.Fatalf("stl.New: %v", err)
+		log.Fatal(err)
 	}
 
-	dielFilename := strings.TrimSuffix(*filename, ".stl") + "-dielectric.stl"
-	w2, err := stl.New(dielFilename)
+	var c *cutter
+	switch {
+	case *cutPlaneSpec != "" && *cutWedgeSpec != "":
+		log.Fatal("only one of -cut_plane or -cut_wedge may be specified")
+	case *cutPlaneSpec != "":
+		c, err = newHalfSpaceCutter(*cutPlaneSpec)
+	case *cutWedgeSpec != "":
+		c, err = newWedgeCutter(*cutWedgeSpec)
+	}
 	if err != nil {
-		log.Fatalf("stl.New: %v", err)
+		log.Fatal(err)
+	}
+
+	var sp *sectionPlane
+	if *section != "" {
+		if sp, err = parseSectionPlane(*section); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	m := &arBifilarElectromagnet{
+	m := newARBifilarElectromagnet()
+	if strings.EqualFold(ext, ".stl") && !*checkMesh && c == nil && sp == nil {
+		renderSTL(m, o, *filename, dielFilename)
+	} else {
+		renderIndexed(m, o, c, sp, *filename, dielFilename)
+	}
+
+	log.Printf("Done.")
+}
+
+func newARBifilarElectromagnet() *arBifilarElectromagnet {
+	return &arBifilarElectromagnet{
 		numPairs:    *numPairs,
 		innerRadius: *innerR,
 		leadLen:     *leadLen,
@@ -69,12 +148,43 @@ func main() {
 		singleGap:   *wireGap,
 		numTurns:    *numTurns,
 		rodThick:    *rodThick,
-		w1:          &triWrapper{w: w1},
-		w2:          &triWrapper{w: w2},
 
-		lowerConnectors: map[string]*connector{},
+		dielBackEnds: &dielBackEnds{},
+	}
+}
+
+// oriented wraps w so that the orientation o is applied to all of its
+// triangles.
+func oriented(o *orientation, w triHelper) triHelper {
+	if o.isIdentity() {
+		return w
+	}
+	return &orientedTris{o: o, w: w}
+}
+
+// renderSTL streams the triangles directly to the two STL files.
+func renderSTL(m *arBifilarElectromagnet, o *orientation, filename, dielFilename string) {
+	if *place != "none" {
+		// Make a first pass to measure the oriented model, then place it.
+		b := newBoundsTris()
+		pre := newARBifilarElectromagnet()
+		pre.w1 = &orientedTris{o: o, w: b}
+		pre.w2 = pre.w1
+		pre.render()
+		o.place(*place, b.min, b.max)
 	}
 
+	w1, err := stl.New(filename)
+	if err != nil {
+		log.Fatalf("stl.New: %v", err)
+	}
+	w2, err := stl.New(dielFilename)
+	if err != nil {
+		log.Fatalf("stl.New: %v", err)
+	}
+
+	m.w1 = oriented(o, &triWrapper{w: w1})
+	m.w2 = oriented(o, &triWrapper{w: w2})
 	m.render()
 
 	if err := w1.Close(); err != nil {
@@ -83,8 +193,63 @@ func main() {
 	if err := w2.Close(); err != nil {
 		log.Fatalf("w2.Close: %v", err)
 	}
+}
 
-	log.Printf("Done.")
+// renderIndexed builds the metal and dielectric meshes in memory,
+// welding coincident vertices, then writes them in the format implied
+// by the filename extension. Cross-sections and cutaways are computed
+// in the coil's own coordinate system (before orientation).
+func renderIndexed(m *arBifilarElectromagnet, o *orientation, c *cutter, sp *sectionPlane, filename, dielFilename string) {
+	mb1 := newMeshBuilder(*weldTol)
+	mb2 := newMeshBuilder(*weldTol)
+	m.w1 = mb1
+	m.w2 = mb2
+	m.render()
+
+	if sp != nil {
+		svgFilename := fmt.Sprintf("%v-section-%v%v.svg", strings.TrimSuffix(filename, filepath.Ext(filename)), sp.axis, sp.plane.d)
+		layers := []*sectionLayer{
+			{name: "dielectric", fill: "#9ecae1", rings: sp.polygons(mb2)},
+			{name: "metal", fill: "#b87333", rings: sp.polygons(mb1)},
+		}
+		if err := writeBuffered(svgFilename, func(w io.Writer) error { return writeSectionSVG(w, sp, layers) }); err != nil {
+			log.Fatalf("writeSectionSVG(%q): %v", svgFilename, err)
+		}
+	}
+
+	if c != nil {
+		var err error
+		if mb1, err = c.cut(mb1); err != nil {
+			log.Fatalf("cutaway of %v: %v", filename, err)
+		}
+		if mb2, err = c.cut(mb2); err != nil {
+			log.Fatalf("cutaway of %v: %v", dielFilename, err)
+		}
+	}
+
+	if !o.isIdentity() || *place != "none" {
+		// Rotate first, then measure the rotated meshes to place them.
+		mb1.transform(&orientation{rot: o.rot})
+		mb2.transform(&orientation{rot: o.rot})
+		min1, max1 := mb1.bounds()
+		min2, max2 := mb2.bounds()
+		p := &orientation{rot: identityRot}
+		p.place(*place, vec3.Min(&min1, &min2), vec3.Max(&max1, &max2))
+		mb1.transform(p)
+		mb2.transform(p)
+	}
+
+	if *checkMesh {
+		mb1.logCheck(filename)
+		mb2.logCheck(dielFilename)
+	}
+
+	if err := mb1.writeFile(filename); err != nil {
+		log.Fatalf("writeFile(%q): %v", filename, err)
+	}
+	if err := mb2.writeFile(dielFilename); err != nil {
+		log.Fatalf("writeFile(%q): %v", dielFilename, err)
+	}
 }
 
 type arBifilarElectromagnet struct {
@@ -106,29 +271,12 @@ type arBifilarElectromagnet struct {
 	dielFrontZ      float32
 	dielBackZ       float32
 
-	// used for collision detection
-	coil2slope      float64
-	coil2yIntercept float64
-
 	// used to render top dielectric end cap
-	debotP3uo *vec3.T
-	debotP3ui *vec3.T
-	debotP2uo *vec3.T
-	debotP2ui *vec3.T
-	debotP0uo *vec3.T
-	debotP0ui *vec3.T
-	debotP1uo *vec3.T
-	debotP1ui *vec3.T
-
-	lowerConnectors map[string]*connector
-
-	// used to handle special case:
-	conP1do *vec3.T
-	conP1uo *vec3.T
-	conP0do *vec3.T
-	conP0uo *vec3.T
-	extP0do *vec3.T
-	extP0uo *vec3.T
+	*dielBackEnds
+
+	// values passed between coils (including the collision detection
+	// line and the exit wire special case)
+	deps *coilDeps
 }
 
 type connector struct {
@@ -146,10 +294,7 @@ func (m *arBifilarElectromagnet) render() {
 	m.dielFrontZ = float32(z0 - 0.5*m.size - *dielGap - *dielPad)
 	m.dielBackZ = m.height + float32(adjz1+0.5*m.size+*dielGap+*dielPad)
 
-	for i := 1; i <= m.numPairs; i++ {
-		m.coilPlusConnectorWires(1, i)
-		m.coilPlusConnectorWires(2, i)
-	}
+	m.renderCoils()
 
 	m.dielectricFrontEndAndWalls()
 	m.dielectricBackEnd()
@@ -593,11 +738,13 @@ func (m *arBifilarElectromagnet) firstCoilWireSegment(wireNum, coilNum int, orig
 
 	// Check for possible wire intersection at one of the closest locations between coil 2 and coil 3
 	if coilNum == 3 && wireNum == 1 {
-		denom := math.Sqrt(m.coil2slope*m.coil2slope + 1)
+		coil2Line := m.deps.coil2Line.wait()
+		coil2slope, coil2yIntercept := coil2Line[0], coil2Line[1]
+		denom := math.Sqrt(coil2slope*coil2slope + 1)
 		if denom == 0 {
 			log.Fatal("-inner_radius too small for other params; wires would cross")
 		}
-		d := (m.coil2slope*float64(extP0uo[0]) - float64(extP0uo[1]) + m.coil2yIntercept) / denom
+		d := (coil2slope*float64(extP0uo[0]) - float64(extP0uo[1]) + coil2yIntercept) / denom
 		if d >= 0 {
 			log.Fatal("-inner_radius too small for other params; wires would cross")
 		}
@@ -606,8 +753,9 @@ func (m *arBifilarElectromagnet) firstCoilWireSegment(wireNum, coilNum int, orig
 		}
 	}
 	if coilNum == 2 && wireNum == 1 {
-		m.coil2slope = float64(botP1ui[1]-conP1uo[1]) / float64(botP1ui[0]-conP1uo[0])
-		m.coil2yIntercept = float64(botP1ui[1]) - m.coil2slope*float64(botP1ui[0])
+		coil2slope := float64(botP1ui[1]-conP1uo[1]) / float64(botP1ui[0]-conP1uo[0])
+		coil2yIntercept := float64(botP1ui[1]) - coil2slope*float64(botP1ui[0])
+		m.deps.coil2Line.resolve([2]float64{coil2slope, coil2yIntercept})
 	}
 
 	if coilNum == 1 && wireNum == 2 {
@@ -617,12 +765,14 @@ func (m *arBifilarElectromagnet) firstCoilWireSegment(wireNum, coilNum int, orig
 		// log.Printf("conP1do=%#v, conP1uo=%#v", conP1do, conP1uo)
 		// log.Printf("extP0do=%#v, extP0uo=%#v", extP0do, extP0uo)
 		// log.Printf("extP1do=%#v, extP1uo=%#v", extP1do, extP1uo)
-		m.conP1do = conP1do
-		m.conP1uo = conP1uo
-		m.conP0do = conP0do
-		m.conP0uo = conP0uo
-		m.extP0do = extP0do
-		m.extP0uo = extP0uo
+		m.deps.exitWire.resolve(&exitWireConnector{
+			conP1do: conP1do,
+			conP1uo: conP1uo,
+			conP0do: conP0do,
+			conP0uo: conP0uo,
+			extP0do: extP0do,
+			extP0uo: extP0uo,
+		})
 		m.metalQuad(conP0do, conP1do, extP1do, extP0do) // downward (connector-side) connector
 		m.metalQuad(conP1do, conP1uo, extP1uo, extP1do) // backface (radial) connector
 		m.metalQuad(extP0do, extP1do, extP1uo, extP0uo) // end-cap (end-of-spiral) connector
@@ -644,8 +794,7 @@ func (m *arBifilarElectromagnet) firstCoilWireSegment(wireNum, coilNum int, orig
 	m.dielQuad(deconP1do, deconP1uo, deextP1uo, deextP1do) // backface connector
 	m.dielQuad(deextP0do, deextP1do, deextP1uo, deextP0uo) // end-cap connector
 
-	key := fmt.Sprintf("%v,%v", 3-wireNum, coilNum-1)
-	if lc, ok := m.lowerConnectors[key]; ok {
+	if lc := m.deps.lowerConnector(3-wireNum, coilNum-1); lc != nil {
 		// these are the "lower" (closest to external) connectors from the coil to the radial risers.
 		m.metalQuad(conP0uo, extP0uo, lc.p1, lc.p2)
 		m.metalQuad(extP1uo, conP1uo, lc.p3, lc.p4)
@@ -687,13 +836,14 @@ func (m *arBifilarElectromagnet) coilWireSegment(wireNum, coilNum int, origA1, o
 		// extP1do=&vec3.T{-17.931267, -5.8912435, 59.23642}, extP1uo=&vec3.T{-17.931267, -5.8912435, 58.03642}
 		// conP1do=&vec3.T{-19.082619, -6.229455, 59.23642}, conP1uo=&vec3.T{-19.082619, -6.229455, 58.03642}  WRONG!!!
 		// p2di=&vec3.T{-18.284712, -4.7832294, 59.222164}, p2ui=&vec3.T{-18.284712, -4.7832294, 58.022167}
-		p2di = m.extP0do
-		p2ui = m.extP0uo
+		exitWire := m.deps.exitWire.wait()
+		p2di = exitWire.extP0do
+		p2ui = exitWire.extP0uo
 
 		// conP0do=&vec3.T{-19.42005, -5.080756, 59.23642}, conP0uo=&vec3.T{-19.42005, -5.080756, 58.03642}
 		// p2do=&vec3.T{-19.445646, -5.0869265, 59.222164}, p2uo=&vec3.T{-19.445646, -5.0869265, 58.022167}
-		p2do = m.conP0do
-		p2uo = m.conP0uo
+		p2do = exitWire.conP0do
+		p2uo = exitWire.conP0uo
 	}
 
 	m.metalQuad(p1uo, p2uo, p2do, p1do) // outer-facing
@@ -824,7 +974,6 @@ func (m *arBifilarElectromagnet) lastCoilWireSegment(wireNum, coilNum int, origA
 	m.dielQuad(dep2ui, dep2di, dep3di, dep3ui) // inner
 	m.dielQuad(dep3ui, dep3uo, dep2uo, dep2ui) // upward
 
-	key := fmt.Sprintf("%v,%v", wireNum, coilNum)
 	lc := &connector{
 		p1: p2di,
 		p2: p2do,
@@ -836,7 +985,7 @@ func (m *arBifilarElectromagnet) lastCoilWireSegment(wireNum, coilNum int, origA
 		dep3: dep3do,
 		dep4: dep3di,
 	}
-	m.lowerConnectors[key] = lc
+	m.deps.lowerConnectors[coilKey(wireNum, coilNum)].resolve(lc)
 }
 
 func (m *arBifilarElectromagnet) calcWallParams() (z0, adjz1 float64) {
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gmlewis/go3d/vec3"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata/")
+
+// meshSummary is the golden summary of a generated mesh.
+type meshSummary struct {
+	NumTris int        `json:"numTris"`
+	Min     [3]float64 `json:"min"`
+	Max     [3]float64 `json:"max"`
+	Volume  float64    `json:"volume"`
+	Hash    string     `json:"hash"`
+}
+
+type goldenSummary struct {
+	Args       []string     `json:"args"`
+	Metal      *meshSummary `json:"metal"`
+	Dielectric *meshSummary `json:"dielectric"`
+}
+
+// collectTris is a triHelper that records every triangle.
+type collectTris struct {
+	tris [][3]vec3.T
+}
+
+func (c *collectTris) writeTri(normal, v1, v2, v3 *vec3.T) {
+	c.tris = append(c.tris, [3]vec3.T{*v1, *v2, *v3})
+}
+
+// Coordinates are quantized to this many millimeters before hashing so
+// that insignificant floating-point differences do not change the hash.
+const hashQuantum = 1e-3
+
+// summarize computes the golden summary of the triangles.
+// The hash is independent of triangle order and of which vertex each
+// triangle starts with (but not of its winding).
+func (c *collectTris) summarize() *meshSummary {
+	s := &meshSummary{
+		NumTris: len(c.tris),
+		Min:     [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)},
+		Max:     [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)},
+	}
+	keys := make([]string, 0, len(c.tris))
+	for _, t := range c.tris {
+		var q [3][3]int64
+		for i, v := range t {
+			for j := 0; j < 3; j++ {
+				s.Min[j] = math.Min(s.Min[j], float64(v[j]))
+				s.Max[j] = math.Max(s.Max[j], float64(v[j]))
+				q[i][j] = int64(math.Round(float64(v[j]) / hashQuantum))
+			}
+		}
+		a, b, d := toVec3d(&t[0]), toVec3d(&t[1]), toVec3d(&t[2])
+		s.Volume += a.dot(b.cross(d)) / 6
+
+		// Rotate the vertices so the smallest comes first, keeping the winding.
+		first := 0
+		for i := 1; i < 3; i++ {
+			if lessQ(q[i], q[first]) {
+				first = i
+			}
+		}
+		keys = append(keys, fmt.Sprint(q[first], q[(first+1)%3], q[(first+2)%3]))
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintln(h, k)
+	}
+	s.Hash = fmt.Sprintf("%x", h.Sum(nil))
+
+	for j := 0; j < 3; j++ {
+		s.Min[j] = round3(s.Min[j])
+		s.Max[j] = round3(s.Max[j])
+	}
+	s.Volume = round3(s.Volume)
+	return s
+}
+
+func lessQ(a, b [3]int64) bool {
+	for i := 0; i < 3; i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// round3 rounds v to 3 decimal places (matching hashQuantum) such that
+// it is also printed that way in the golden files.
+func round3(v float64) float64 {
+	r, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'f', 3, 64), 64)
+	return r
+}
+
+// presets returns the parameter sets from update-examples.sh keyed by
+// the base name of their -out file.
+func presets(t *testing.T) map[string][]string {
+	t.Helper()
+	f, err := os.Open("update-examples.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	result := map[string][]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] != "go" || fields[1] != "run" {
+			continue
+		}
+		var name string
+		var args []string
+		for i := 3; i+1 < len(fields); i += 2 {
+			if fields[i] == "-out" {
+				name = strings.TrimSuffix(fields[i+1], filepath.Ext(fields[i+1]))
+				continue
+			}
+			args = append(args, fields[i], fields[i+1])
+		}
+		if name == "" {
+			t.Fatalf("missing -out in update-examples.sh line: %v", scanner.Text())
+		}
+		result[name] = args
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) == 0 {
+		t.Fatal("no presets found in update-examples.sh")
+	}
+	return result
+}
+
+// setFlags sets the flags from args (pairs of "-name value") and returns
+// a func that restores their defaults.
+func setFlags(t *testing.T, args []string) func() {
+	t.Helper()
+	var names []string
+	for i := 0; i+1 < len(args); i += 2 {
+		name := strings.TrimPrefix(args[i], "-")
+		if err := flag.Set(name, args[i+1]); err != nil {
+			t.Fatalf("flag.Set(%q, %q): %v", name, args[i+1], err)
+		}
+		names = append(names, name)
+	}
+	return func() {
+		for _, name := range names {
+			flag.Set(name, flag.Lookup(name).DefValue)
+		}
+	}
+}
+
+func TestGolden(t *testing.T) {
+	for name, args := range presets(t) {
+		t.Run(name, func(t *testing.T) {
+			defer setFlags(t, args)()
+
+			metal, diel := &collectTris{}, &collectTris{}
+			m := newARBifilarElectromagnet()
+			m.w1 = metal
+			m.w2 = diel
+			m.render()
+
+			got := &goldenSummary{
+				Args:       args,
+				Metal:      metal.summarize(),
+				Dielectric: diel.summarize(),
+			}
+			gotJSON, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON = append(gotJSON, '\n')
+
+			goldenFile := filepath.Join("testdata", name+".golden.json")
+			if *update {
+				if err := os.MkdirAll("testdata", 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(goldenFile, gotJSON, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			wantJSON, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatalf("ReadFile: %v (run 'go test -update' to create it)", err)
+			}
+			want := &goldenSummary{}
+			if err := json.Unmarshal(wantJSON, want); err != nil {
+				t.Fatalf("Unmarshal(%v): %v", goldenFile, err)
+			}
+			compareSummary(t, "metal", got.Metal, want.Metal)
+			compareSummary(t, "dielectric", got.Dielectric, want.Dielectric)
+		})
+	}
+}
+
+func compareSummary(t *testing.T, label string, got, want *meshSummary) {
+	t.Helper()
+	if want == nil {
+		t.Fatalf("%v: missing from golden file", label)
+	}
+	if got.NumTris != want.NumTris {
+		t.Errorf("%v: numTris = %v, want %v", label, got.NumTris, want.NumTris)
+	}
+	if got.Min != want.Min || got.Max != want.Max {
+		t.Errorf("%v: bounds = %v-%v, want %v-%v", label, got.Min, got.Max, want.Min, want.Max)
+	}
+	if math.Abs(got.Volume-want.Volume) > 1e-2 {
+		t.Errorf("%v: volume = %v, want %v", label, got.Volume, want.Volume)
+	}
+	if got.Hash != want.Hash {
+		t.Errorf("%v: hash = %v, want %v", label, got.Hash, want.Hash)
+	}
+}
+
+func TestParallelMatchesSerial(t *testing.T) {
+	render := func(parallelism string) (metal, diel *triBuffer) {
+		defer setFlags(t, []string{"-num_turns", "3", "-parallel", parallelism})()
+		metal, diel = &triBuffer{}, &triBuffer{}
+		m := newARBifilarElectromagnet()
+		m.w1 = metal
+		m.w2 = diel
+		m.render()
+		return metal, diel
+	}
+
+	serialMetal, serialDiel := render("1")
+	parallelMetal, parallelDiel := render("8")
+	if !reflect.DeepEqual(serialMetal.tris, parallelMetal.tris) {
+		t.Errorf("metal triangles differ between serial (%v) and parallel (%v) rendering", len(serialMetal.tris), len(parallelMetal.tris))
+	}
+	if !reflect.DeepEqual(serialDiel.tris, parallelDiel.tris) {
+		t.Errorf("dielectric triangles differ between serial (%v) and parallel (%v) rendering", len(serialDiel.tris), len(parallelDiel.tris))
+	}
+}
+
+// renderMeshes builds the indexed metal and dielectric meshes for args.
+func renderMeshes(t *testing.T, args []string) (metal, diel *meshBuilder) {
+	t.Helper()
+	defer setFlags(t, args)()
+	metal, diel = newMeshBuilder(*weldTol), newMeshBuilder(*weldTol)
+	m := newARBifilarElectromagnet()
+	m.w1 = metal
+	m.w2 = diel
+	m.render()
+	return metal, diel
+}
+
+// addBox adds the closed, outward-facing box from lo to hi to mb.
+func addBox(mb *meshBuilder, lo, hi vec3.T) {
+	corner := func(i int) *vec3.T {
+		v := lo
+		for j := 0; j < 3; j++ {
+			if i&(1<<j) != 0 {
+				v[j] = hi[j]
+			}
+		}
+		return &v
+	}
+	for _, q := range [][4]int{{0, 2, 3, 1}, {4, 5, 7, 6}, {0, 1, 5, 4}, {2, 6, 7, 3}, {0, 4, 6, 2}, {1, 3, 7, 5}} {
+		mb.writeTri(nil, corner(q[0]), corner(q[1]), corner(q[2]))
+		mb.writeTri(nil, corner(q[0]), corner(q[2]), corner(q[3]))
+	}
+}
+
+// volume returns the volume enclosed by the (closed) mesh.
+func (mb *meshBuilder) volume() float64 {
+	var sum float64
+	for _, f := range mb.faces {
+		a, b, c := toVec3d(&mb.verts[f[0]]), toVec3d(&mb.verts[f[1]]), toVec3d(&mb.verts[f[2]])
+		sum += a.dot(b.cross(c)) / 6
+	}
+	return sum
+}
+
+func TestCutIsWatertight(t *testing.T) {
+	metal, _ := renderMeshes(t, []string{"-num_turns", "3"})
+	if r := metal.check(); !r.watertight() {
+		t.Fatalf("uncut metal: %v", r)
+	}
+	// The coil does not reach the Z axis, so two stacked boxes around the
+	// axis (with a volume of 64) exercise the joining of wedge caps along it.
+	boxes := newMeshBuilder(*weldTol)
+	addBox(boxes, vec3.T{-2, -2, 0}, vec3.T{2, 2, 3})
+	addBox(boxes, vec3.T{-2, -2, 4}, vec3.T{2, 2, 5})
+
+	tests := []struct {
+		plane, wedge string
+		boxesVolume  float64
+	}{
+		{plane: "1,0,0,0", boxesVolume: 32},
+		{plane: "0,0,1,5", boxesVolume: 64},
+		{plane: "1,1,0,3", boxesVolume: 62},
+		{wedge: "0,90", boxesVolume: 48},
+		{wedge: "0,270", boxesVolume: 16},
+		{wedge: "90,0", boxesVolume: 16},
+		{wedge: "300,10", boxesVolume: 51.208188},
+	}
+	for _, tt := range tests {
+		c, err := newHalfSpaceCutter(tt.plane)
+		if tt.wedge != "" {
+			c, err = newWedgeCutter(tt.wedge)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, in := range []struct {
+			name       string
+			mb         *meshBuilder
+			wantVolume float64 // 0 if unknown
+		}{{"metal", metal, 0}, {"boxes", boxes, tt.boxesVolume}} {
+			out, err := c.cut(in.mb)
+			if err != nil {
+				t.Errorf("plane %q wedge %q: cut(%v): %v", tt.plane, tt.wedge, in.name, err)
+				continue
+			}
+			if r := out.check(); r.boundaryEdges != 0 || r.nonManifoldEdges != 0 || r.flippedEdges != 0 {
+				t.Errorf("plane %q wedge %q: cut(%v) = %v, want watertight", tt.plane, tt.wedge, in.name, r)
+			}
+			got := out.volume()
+			if in.wantVolume != 0 && math.Abs(got-in.wantVolume) > 1e-3 || got <= 0 || got > in.mb.volume()+1e-3 {
+				t.Errorf("plane %q wedge %q: cut(%v) volume = %v, want %v (uncut %v)", tt.plane, tt.wedge, in.name, got, in.wantVolume, in.mb.volume())
+			}
+		}
+	}
+}
+
+func TestCutRejectsOpenMesh(t *testing.T) {
+	mb := newMeshBuilder(*weldTol)
+	addBox(mb, vec3.T{-2, -2, 0}, vec3.T{2, 2, 3})
+	mb.faces = mb.faces[1:]
+	c, err := newWedgeCutter("0,90")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.cut(mb); err == nil || !strings.Contains(err.Error(), "not watertight") {
+		t.Errorf("cut of an open box: err = %v, want not watertight", err)
+	}
+}
+
+func TestSectionGolden(t *testing.T) {
+	metal, diel := renderMeshes(t, []string{"-num_turns", "1"})
+	sp, err := parseSectionPlane("x=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers := []*sectionLayer{
+		{name: "dielectric", fill: "#9ecae1", rings: sp.polygons(diel)},
+		{name: "metal", fill: "#b87333", rings: sp.polygons(metal)},
+	}
+	for _, layer := range layers {
+		if len(layer.rings) == 0 {
+			t.Errorf("%v: no section outlines", layer.name)
+		}
+	}
+	var buf bytes.Buffer
+	if err := writeSectionSVG(&buf, sp, layers); err != nil {
+		t.Fatalf("writeSectionSVG: %v", err)
+	}
+
+	goldenFile := filepath.Join("testdata", "aprbfem-11-1-section-x0.golden.svg")
+	if *update {
+		if err := os.WriteFile(goldenFile, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatalf("ReadFile: %v (run 'go test -update' to create it)", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("section SVG differs from %v (run 'go test -update' after an intentional change)", goldenFile)
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gmlewis/go3d/vec3"
+)
+
+type vec3d [3]float64
+
+func (a vec3d) dot(b vec3d) float64 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+
+func (a vec3d) cross(b vec3d) vec3d {
+	return vec3d{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func toVec3d(v *vec3.T) vec3d { return vec3d{float64(v[0]), float64(v[1]), float64(v[2])} }
+
+func (a vec3d) vec3() *vec3.T { return &vec3.T{float32(a[0]), float32(a[1]), float32(a[2])} }
+
+// cutPlane is one of the planes bounding the region removed by a cutter.
+type cutPlane struct {
+	n vec3d // unit normal pointing toward the removed side
+	d float64
+
+	// u is the direction (within the plane) in which the cap lies.
+	// For half-space cuts, the cap covers the whole plane and u is an
+	// arbitrary in-plane direction. For wedge cuts, the cap is the
+	// half-plane starting at the Z axis and extending along u.
+	u         vec3d
+	halfPlane bool
+}
+
+func (p *cutPlane) dist(v vec3d) float64 { return p.n.dot(v) - p.d }
+
+// to2D projects v onto the plane's (u, v) basis, where u x v = n so that
+// loops that are counterclockwise when viewed from +n have positive area.
+func (p *cutPlane) to2D(v vec3d) (float64, float64) {
+	return p.u.dot(v), p.n.cross(p.u).dot(v)
+}
+
+// cutter removes a region (a half-space or a wedge about the Z axis)
+// from a mesh and caps the exposed cut faces.
+type cutter struct {
+	planes  []*cutPlane
+	removed func(c vec3d) bool
+}
+
+// newHalfSpaceCutter parses "nx,ny,nz,d" and removes all points p
+// where n.p > d.
+func newHalfSpaceCutter(spec string) (*cutter, error) {
+	vals, err := parseFloats(spec, 4)
+	if err != nil {
+		return nil, fmt.Errorf("-cut_plane: %v", err)
+	}
+	n := vec3d{vals[0], vals[1], vals[2]}
+	nLen := math.Sqrt(n.dot(n))
+	if nLen == 0 {
+		return nil, fmt.Errorf("-cut_plane normal must be non-zero")
+	}
+	p := &cutPlane{
+		n: vec3d{n[0] / nLen, n[1] / nLen, n[2] / nLen},
+		d: vals[3] / nLen,
+	}
+	p.u = perpendicular(p.n)
+	return &cutter{
+		planes:  []*cutPlane{p},
+		removed: func(c vec3d) bool { return p.dist(c) > 0 },
+	}, nil
+}
+
+// newWedgeCutter parses "a0,a1" (in degrees) and removes all points
+// whose angle about the Z axis lies counterclockwise between a0 and a1.
+func newWedgeCutter(spec string) (*cutter, error) {
+	vals, err := parseFloats(spec, 2)
+	if err != nil {
+		return nil, fmt.Errorf("-cut_wedge: %v", err)
+	}
+	a0 := vals[0] * math.Pi / 180
+	a1 := vals[1] * math.Pi / 180
+	span := math.Mod(a1-a0, 2*math.Pi)
+	if span < 0 {
+		span += 2 * math.Pi
+	}
+	if span == 0 {
+		return nil, fmt.Errorf("-cut_wedge angles must differ; got %q", spec)
+	}
+
+	r0 := vec3d{math.Cos(a0), math.Sin(a0), 0}
+	r1 := vec3d{math.Cos(a1), math.Sin(a1), 0}
+	p0 := &cutPlane{n: vec3d{-r0[1], r0[0], 0}, u: r0, halfPlane: true}
+	p1 := &cutPlane{n: vec3d{r1[1], -r1[0], 0}, u: r1, halfPlane: true}
+	return &cutter{
+		planes: []*cutPlane{p0, p1},
+		removed: func(c vec3d) bool {
+			a := math.Mod(math.Atan2(c[1], c[0])-a0, 2*math.Pi)
+			if a < 0 {
+				a += 2 * math.Pi
+			}
+			return a < span
+		},
+	}, nil
+}
+
+func parseFloats(spec string, want int) ([]float64, error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) != want {
+		return nil, fmt.Errorf("want %v comma-separated values; got %q", want, spec)
+	}
+	vals := make([]float64, want)
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("value %q: %v", p, err)
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// perpendicular returns a unit vector perpendicular to the unit vector n.
+func perpendicular(n vec3d) vec3d {
+	a := vec3d{1, 0, 0}
+	if math.Abs(n[0]) > 0.9 {
+		a = vec3d{0, 1, 0}
+	}
+	u := n.cross(a)
+	l := math.Sqrt(u.dot(u))
+	return vec3d{u[0] / l, u[1] / l, u[2] / l}
+}
+
+// cut returns a new mesh with the removed region cut away and the
+// exposed faces capped. The caps can only be closed if mb is watertight,
+// so any other mesh is rejected rather than returned half-capped.
+func (c *cutter) cut(mb *meshBuilder) (*meshBuilder, error) {
+	if r := mb.check(); !r.watertight() {
+		return nil, fmt.Errorf("cannot cap the cut faces of a mesh that is not watertight: %v", r)
+	}
+	eps := 2 * float64(mb.weldTol)
+	out := c.cutWithoutCaps(mb)
+
+	boundary := out.boundaryEdges()
+	var caps [][3]int
+	for _, p := range c.planes {
+		loops, chains := capLoops(out, p, boundary, eps)
+		if len(chains) > 0 {
+			if !p.halfPlane {
+				return nil, fmt.Errorf("%v cap chains are not closed", len(chains))
+			}
+			closed, err := closeChains(out, p, chains, eps)
+			if err != nil {
+				return nil, err
+			}
+			loops = append(loops, closed...)
+		}
+		for _, polygon := range groupLoops(out, p, loops) {
+			caps = append(caps, triangulateCap(out, p, polygon)...)
+		}
+	}
+	out.faces = append(out.faces, caps...)
+	return out, nil
+}
+
+// cutWithoutCaps returns a new mesh with the removed region cut away,
+// leaving the cut faces open.
+func (c *cutter) cutWithoutCaps(mb *meshBuilder) *meshBuilder {
+	eps := 2 * float64(mb.weldTol)
+
+	faces := make([][3]vec3d, 0, len(mb.faces))
+	for _, f := range mb.faces {
+		faces = append(faces, [3]vec3d{toVec3d(&mb.verts[f[0]]), toVec3d(&mb.verts[f[1]]), toVec3d(&mb.verts[f[2]])})
+	}
+	for _, p := range c.planes {
+		faces = splitFaces(faces, p, eps)
+	}
+
+	out := newMeshBuilder(float64(mb.weldTol))
+	for _, f := range faces {
+		centroid := vec3d{
+			(f[0][0] + f[1][0] + f[2][0]) / 3,
+			(f[0][1] + f[1][1] + f[2][1]) / 3,
+			(f[0][2] + f[1][2] + f[2][2]) / 3,
+		}
+		if !c.removed(centroid) {
+			out.writeTri(nil, f[0].vec3(), f[1].vec3(), f[2].vec3())
+		}
+	}
+	return out
+}
+
+// splitFaces splits every face that straddles the plane into faces that
+// lie entirely on one side of it (or on it).
+func splitFaces(faces [][3]vec3d, p *cutPlane, eps float64) [][3]vec3d {
+	var out [][3]vec3d
+	for _, f := range faces {
+		var side [3]int
+		var dist [3]float64
+		var pos, neg bool
+		for i, v := range f {
+			dist[i] = p.dist(v)
+			switch {
+			case dist[i] > eps:
+				side[i], pos = 1, true
+			case dist[i] < -eps:
+				side[i], neg = -1, true
+			}
+		}
+		if !pos || !neg {
+			out = append(out, f)
+			continue
+		}
+
+		// Walk the triangle edges, building the polygons on each side.
+		var above, below []vec3d
+		for i := 0; i < 3; i++ {
+			j := (i + 1) % 3
+			if side[i] >= 0 {
+				above = append(above, f[i])
+			}
+			if side[i] <= 0 {
+				below = append(below, f[i])
+			}
+			if side[i]*side[j] < 0 {
+				x := edgeIntersection(f[i], f[j], dist[i], dist[j])
+				above = append(above, x)
+				below = append(below, x)
+			}
+		}
+		for _, poly := range [][]vec3d{above, below} {
+			for k := 1; k+1 < len(poly); k++ {
+				out = append(out, [3]vec3d{poly[0], poly[k], poly[k+1]})
+			}
+		}
+	}
+	return out
+}
+
+// edgeIntersection returns the point where edge ab crosses the plane.
+// The endpoints are ordered canonically so that the two faces sharing
+// an edge compute exactly the same point.
+func edgeIntersection(a, b vec3d, da, db float64) vec3d {
+	if b[0] < a[0] || (b[0] == a[0] && (b[1] < a[1] || (b[1] == a[1] && b[2] < a[2]))) {
+		a, b, da, db = b, a, db, da
+	}
+	t := da / (da - db)
+	return vec3d{a[0] + t*(b[0]-a[0]), a[1] + t*(b[1]-a[1]), a[2] + t*(b[2]-a[2])}
+}
+
+// boundaryEdges returns the directed edges that are used by exactly one
+// face and whose reverse is not used by any face.
+func (mb *meshBuilder) boundaryEdges() [][2]int {
+	directed := map[[2]int]int{}
+	for _, f := range mb.faces {
+		for i := 0; i < 3; i++ {
+			directed[[2]int{f[i], f[(i+1)%3]}]++
+		}
+	}
+	var result [][2]int
+	for _, f := range mb.faces {
+		for i := 0; i < 3; i++ {
+			e := [2]int{f[i], f[(i+1)%3]}
+			if directed[e] == 1 && directed[[2]int{e[1], e[0]}] == 0 {
+				result = append(result, e)
+			}
+		}
+	}
+	return result
+}
+
+// capLoops returns the closed loops (as vertex indices) that bound the
+// cap on plane p, followed by the open chains that still need to be
+// joined. The loops are counterclockwise when viewed from +p.n.
+func capLoops(mb *meshBuilder, p *cutPlane, boundary [][2]int, eps float64) (loops, chains [][]int) {
+	onCap := func(i int) bool {
+		v := toVec3d(&mb.verts[i])
+		return math.Abs(p.dist(v)) <= eps && (!p.halfPlane || p.u.dot(v) >= -eps)
+	}
+
+	// The cap edges run opposite to the boundary edges of the cut mesh.
+	next := map[int][]int{}
+	hasPrev := map[int]bool{}
+	numEdges := 0
+	for _, e := range boundary {
+		if onCap(e[0]) && onCap(e[1]) {
+			next[e[1]] = append(next[e[1]], e[0])
+			hasPrev[e[0]] = true
+			numEdges++
+		}
+	}
+	if numEdges == 0 {
+		return nil, nil
+	}
+
+	walk := func(start int) []int {
+		chain := []int{start}
+		for v := start; len(next[v]) > 0; {
+			n := next[v][0]
+			next[v] = next[v][1:]
+			if n == start {
+				break
+			}
+			chain = append(chain, n)
+			v = n
+		}
+		return chain
+	}
+
+	// First collect the open chains (which only occur on wedge half-planes
+	// or meshes that are not watertight), then the closed loops.
+	var starts []int
+	for v := range next {
+		if !hasPrev[v] {
+			starts = append(starts, v)
+		}
+	}
+	sort.Ints(starts)
+	for _, v := range starts {
+		chains = append(chains, walk(v))
+	}
+	var rest []int
+	for v := range next {
+		rest = append(rest, v)
+	}
+	sort.Ints(rest)
+	for _, v := range rest {
+		for len(next[v]) > 0 {
+			loops = append(loops, walk(v))
+		}
+	}
+	return loops, chains
+}
+
+// closeChains joins open chains whose ends lie on the Z axis (the edge
+// of a wedge half-plane) by running along the axis in the -v direction
+// from the end of one chain to the start of the next. Every chain must
+// start and end on the axis, and going down the axis the endpoints must
+// alternate between chain ends and chain starts.
+func closeChains(mb *meshBuilder, p *cutPlane, chains [][]int, eps float64) ([][]int, error) {
+	type endpoint struct {
+		v     float64
+		chain int
+		isEnd bool
+	}
+	var pts []endpoint
+	for i, c := range chains {
+		for _, pt := range []endpoint{{chain: i}, {chain: i, isEnd: true}} {
+			vi := c[0]
+			if pt.isEnd {
+				vi = c[len(c)-1]
+			}
+			u, v := p.to2D(toVec3d(&mb.verts[vi]))
+			if math.Abs(u) > eps {
+				return nil, fmt.Errorf("cap chain ends at %v, which is not on the Z axis", mb.verts[vi])
+			}
+			pt.v = v
+			pts = append(pts, pt)
+		}
+	}
+	// When an end and a start meet at the same point on the axis, the
+	// end comes first so that the two chains are joined there.
+	sort.SliceStable(pts, func(a, b int) bool {
+		if pts[a].v != pts[b].v {
+			return pts[a].v > pts[b].v
+		}
+		return pts[a].isEnd && !pts[b].isEnd
+	})
+
+	// link[i] is the chain that follows chain i.
+	link := map[int]int{}
+	for i := 0; i < len(pts); i += 2 {
+		if !pts[i].isEnd || pts[i+1].isEnd {
+			return nil, fmt.Errorf("cap chain endpoints along the Z axis at %.4f and %.4f cannot be paired", pts[i].v, pts[i+1].v)
+		}
+		link[pts[i].chain] = pts[i+1].chain
+	}
+
+	var loops [][]int
+	used := map[int]bool{}
+	for i := range chains {
+		if used[i] {
+			continue
+		}
+		var loop []int
+		for j := i; !used[j]; j = link[j] {
+			used[j] = true
+			loop = append(loop, chains[j]...)
+		}
+		loops = append(loops, loop)
+	}
+	return loops, nil
+}
+
+// groupLoops groups the loops into polygons: each outer
+// (counterclockwise) loop is followed by the holes that it contains.
+func groupLoops(mb *meshBuilder, p *cutPlane, loops [][]int) [][][]int {
+	type ring struct {
+		idx  []int
+		pts  [][2]float64
+		area float64
+	}
+	var outers, holes []*ring
+	for _, l := range loops {
+		if len(l) < 3 {
+			continue
+		}
+		r := &ring{idx: l}
+		for _, i := range l {
+			x, y := p.to2D(toVec3d(&mb.verts[i]))
+			r.pts = append(r.pts, [2]float64{x, y})
+		}
+		r.area = ringArea(r.pts)
+		switch {
+		case r.area > 0:
+			outers = append(outers, r)
+		case r.area < 0:
+			holes = append(holes, r)
+		}
+	}
+
+	children := make([][]*ring, len(outers))
+	for _, h := range holes {
+		best := -1
+		for i, o := range outers {
+			if pointInRing(h.pts[0], o.pts) && (best < 0 || o.area < outers[best].area) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			children[best] = append(children[best], h)
+		}
+	}
+
+	var result [][][]int
+	for i, o := range outers {
+		polygon := [][]int{o.idx}
+		for _, h := range children[i] {
+			polygon = append(polygon, h.idx)
+		}
+		result = append(result, polygon)
+	}
+	return result
+}
+
+func ringArea(pts [][2]float64) float64 {
+	var sum float64
+	for i, j := 0, len(pts)-1; i < len(pts); j, i = i, i+1 {
+		sum += pts[j][0]*pts[i][1] - pts[i][0]*pts[j][1]
+	}
+	return 0.5 * sum
+}
+
+func pointInRing(pt [2]float64, pts [][2]float64) bool {
+	inside := false
+	for i, j := 0, len(pts)-1; i < len(pts); j, i = i, i+1 {
+		if (pts[i][1] > pt[1]) != (pts[j][1] > pt[1]) &&
+			pt[0] < (pts[j][0]-pts[i][0])*(pt[1]-pts[i][1])/(pts[j][1]-pts[i][1])+pts[i][0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// triangulateCap triangulates a polygon (outer loop followed by holes)
+// lying on plane p, returning faces that face toward +p.n.
+func triangulateCap(mb *meshBuilder, p *cutPlane, polygon [][]int) [][3]int {
+	var data []float64
+	var idx []int
+	var holeIndices []int
+	for i, loop := range polygon {
+		if i > 0 {
+			holeIndices = append(holeIndices, len(idx))
+		}
+		for _, vi := range loop {
+			x, y := p.to2D(toVec3d(&mb.verts[vi]))
+			data = append(data, x, y)
+			idx = append(idx, vi)
+		}
+	}
+
+	tris := earcut(data, holeIndices)
+	var faces [][3]int
+	for k := 0; k+2 < len(tris); k += 3 {
+		a, b, c := tris[k], tris[k+1], tris[k+2]
+		area := (data[2*b]-data[2*a])*(data[2*c+1]-data[2*a+1]) - (data[2*c]-data[2*a])*(data[2*b+1]-data[2*a+1])
+		if area < 0 {
+			b, c = c, b
+		}
+		faces = append(faces, [3]int{idx[a], idx[b], idx[c]})
+	}
+	return faces
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// earcut triangulates a polygon with holes using ear clipping.
+// It is a port of the core of github.com/mapbox/earcut (without the
+// z-order curve acceleration which is unnecessary for cap polygons).
+//
+// data holds the flattened 2D coordinates (x0, y0, x1, y1, ...) of the
+// outer ring followed by each hole, and holeIndices holds the starting
+// vertex index of each hole. It returns the vertex indices of the
+// triangles.
+func earcut(data []float64, holeIndices []int) []int {
+	outerLen := len(data)
+	if len(holeIndices) > 0 {
+		outerLen = holeIndices[0] * 2
+	}
+	outerNode := ecLinkedList(data, 0, outerLen, true)
+	if outerNode == nil || outerNode.next == outerNode.prev {
+		return nil
+	}
+	if len(holeIndices) > 0 {
+		outerNode = ecEliminateHoles(data, holeIndices, outerNode)
+	}
+
+	var triangles []int
+	ecEarcutLinked(outerNode, &triangles, 0)
+	return triangles
+}
+
+type ecNode struct {
+	i          int
+	x, y       float64
+	prev, next *ecNode
+	steiner    bool
+}
+
+func ecLinkedList(data []float64, start, end int, clockwise bool) *ecNode {
+	var last *ecNode
+	if clockwise == (ecSignedArea(data, start, end) > 0) {
+		for i := start; i < end; i += 2 {
+			last = ecInsertNode(i/2, data[i], data[i+1], last)
+		}
+	} else {
+		for i := end - 2; i >= start; i -= 2 {
+			last = ecInsertNode(i/2, data[i], data[i+1], last)
+		}
+	}
+	if last != nil && ecEquals(last, last.next) {
+		ecRemoveNode(last)
+		last = last.next
+	}
+	return last
+}
+
+// ecFilterPoints eliminates colinear or duplicate points.
+func ecFilterPoints(start, end *ecNode) *ecNode {
+	if start == nil {
+		return start
+	}
+	if end == nil {
+		end = start
+	}
+	p := start
+	for {
+		again := false
+		if !p.steiner && (ecEquals(p, p.next) || ecArea(p.prev, p, p.next) == 0) {
+			ecRemoveNode(p)
+			p = p.prev
+			end = p
+			if p == p.next {
+				break
+			}
+			again = true
+		} else {
+			p = p.next
+		}
+		if !again && p == end {
+			break
+		}
+	}
+	return end
+}
+
+// ecEarcutLinked is the main ear slicing loop which triangulates a
+// polygon (given as a linked list).
+func ecEarcutLinked(ear *ecNode, triangles *[]int, pass int) {
+	if ear == nil {
+		return
+	}
+	stop := ear
+	for ear.prev != ear.next {
+		prev, next := ear.prev, ear.next
+		if ecIsEar(ear) {
+			*triangles = append(*triangles, prev.i, ear.i, next.i)
+			ecRemoveNode(ear)
+			ear = next.next
+			stop = next.next
+			continue
+		}
+
+		ear = next
+		if ear == stop {
+			// If we looped through the whole remaining polygon and can't
+			// find any more ears, try filtering points, then curing local
+			// self-intersections, then splitting the polygon.
+			switch pass {
+			case 0:
+				ecEarcutLinked(ecFilterPoints(ear, nil), triangles, 1)
+			case 1:
+				ear = ecCureLocalIntersections(ecFilterPoints(ear, nil), triangles)
+				ecEarcutLinked(ear, triangles, 2)
+			case 2:
+				ecSplitEarcut(ear, triangles)
+			}
+			break
+		}
+	}
+}
+
+// ecIsEar checks whether a polygon node forms a valid ear with
+// adjacent nodes.
+func ecIsEar(ear *ecNode) bool {
+	a, b, c := ear.prev, ear, ear.next
+	if ecArea(a, b, c) >= 0 {
+		return false // reflex, can't be an ear
+	}
+	for p := c.next; p != a; p = p.next {
+		if (p.x != a.x || p.y != a.y) &&
+			ecPointInTriangle(a.x, a.y, b.x, b.y, c.x, c.y, p.x, p.y) &&
+			ecArea(p.prev, p, p.next) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ecCureLocalIntersections goes through all polygon nodes and cures
+// small local self-intersections.
+func ecCureLocalIntersections(start *ecNode, triangles *[]int) *ecNode {
+	p := start
+	for {
+		a, b := p.prev, p.next.next
+		if !ecEquals(a, b) && ecIntersects(a, p, p.next, b) && ecLocallyInside(a, b) && ecLocallyInside(b, a) {
+			*triangles = append(*triangles, a.i, p.i, b.i)
+			ecRemoveNode(p)
+			ecRemoveNode(p.next)
+			p = b
+			start = b
+		}
+		p = p.next
+		if p == start {
+			break
+		}
+	}
+	return ecFilterPoints(p, nil)
+}
+
+// ecSplitEarcut tries splitting the polygon into two and triangulating
+// them independently.
+func ecSplitEarcut(start *ecNode, triangles *[]int) {
+	a := start
+	for {
+		for b := a.next.next; b != a.prev; b = b.next {
+			if a.i != b.i && ecIsValidDiagonal(a, b) {
+				c := ecSplitPolygon(a, b)
+				a = ecFilterPoints(a, a.next)
+				c = ecFilterPoints(c, c.next)
+				ecEarcutLinked(a, triangles, 0)
+				ecEarcutLinked(c, triangles, 0)
+				return
+			}
+		}
+		a = a.next
+		if a == start {
+			return
+		}
+	}
+}
+
+// ecEliminateHoles links every hole into the outer loop, producing a
+// single-ring polygon without holes.
+func ecEliminateHoles(data []float64, holeIndices []int, outerNode *ecNode) *ecNode {
+	var queue []*ecNode
+	for i, hi := range holeIndices {
+		start := hi * 2
+		end := len(data)
+		if i < len(holeIndices)-1 {
+			end = holeIndices[i+1] * 2
+		}
+		list := ecLinkedList(data, start, end, false)
+		if list == nil {
+			continue
+		}
+		if list == list.next {
+			list.steiner = true
+		}
+		queue = append(queue, ecGetLeftmost(list))
+	}
+	sort.SliceStable(queue, func(a, b int) bool {
+		if queue[a].x != queue[b].x {
+			return queue[a].x < queue[b].x
+		}
+		return queue[a].y < queue[b].y
+	})
+	for _, hole := range queue {
+		outerNode = ecEliminateHole(hole, outerNode)
+	}
+	return outerNode
+}
+
+func ecEliminateHole(hole, outerNode *ecNode) *ecNode {
+	bridge := ecFindHoleBridge(hole, outerNode)
+	if bridge == nil {
+		return outerNode
+	}
+	bridgeReverse := ecSplitPolygon(bridge, hole)
+	ecFilterPoints(bridgeReverse, bridgeReverse.next)
+	return ecFilterPoints(bridge, bridge.next)
+}
+
+// ecFindHoleBridge uses David Eberly's algorithm for finding a bridge
+// between a hole and the outer polygon.
+func ecFindHoleBridge(hole, outerNode *ecNode) *ecNode {
+	hx, hy := hole.x, hole.y
+	qx := math.Inf(-1)
+	var m *ecNode
+
+	// Find a segment intersected by a ray from the hole's leftmost point
+	// to the left; the segment's endpoint with lesser x will be a
+	// potential connection point.
+	p := outerNode
+	for {
+		if hy <= p.y && hy >= p.next.y && p.next.y != p.y {
+			x := p.x + (hy-p.y)*(p.next.x-p.x)/(p.next.y-p.y)
+			if x <= hx && x > qx {
+				qx = x
+				m = p
+				if p.next.x < p.x {
+					m = p.next
+				}
+				if x == hx {
+					return m // hole touches outer segment; pick leftmost endpoint
+				}
+			}
+		}
+		p = p.next
+		if p == outerNode {
+			break
+		}
+	}
+	if m == nil {
+		return nil
+	}
+
+	// Look for points inside the triangle of hole point, segment
+	// intersection and endpoint; if there are no points found, we have a
+	// valid connection; otherwise choose the point of the minimum angle
+	// with the ray as the connection point.
+	stop := m
+	mx, my := m.x, m.y
+	tanMin := math.Inf(1)
+	p = m
+	for {
+		ax, cx := qx, hx
+		if hy < my {
+			ax, cx = hx, qx
+		}
+		if hx >= p.x && p.x >= mx && hx != p.x && ecPointInTriangle(ax, hy, mx, my, cx, hy, p.x, p.y) {
+			tan := math.Abs(hy-p.y) / (hx - p.x)
+			if ecLocallyInside(p, hole) &&
+				(tan < tanMin || (tan == tanMin && (p.x > m.x || (p.x == m.x && ecSectorContainsSector(m, p))))) {
+				m = p
+				tanMin = tan
+			}
+		}
+		p = p.next
+		if p == stop {
+			break
+		}
+	}
+	return m
+}
+
+func ecSectorContainsSector(m, p *ecNode) bool {
+	return ecArea(m.prev, m, p.prev) < 0 && ecArea(p.next, m, m.next) < 0
+}
+
+func ecGetLeftmost(start *ecNode) *ecNode {
+	p, leftmost := start, start
+	for {
+		if p.x < leftmost.x || (p.x == leftmost.x && p.y < leftmost.y) {
+			leftmost = p
+		}
+		p = p.next
+		if p == start {
+			return leftmost
+		}
+	}
+}
+
+func ecPointInTriangle(ax, ay, bx, by, cx, cy, px, py float64) bool {
+	return (cx-px)*(ay-py) >= (ax-px)*(cy-py) &&
+		(ax-px)*(by-py) >= (bx-px)*(ay-py) &&
+		(bx-px)*(cy-py) >= (cx-px)*(by-py)
+}
+
+func ecIsValidDiagonal(a, b *ecNode) bool {
+	return a.next.i != b.i && a.prev.i != b.i && !ecIntersectsPolygon(a, b) &&
+		((ecLocallyInside(a, b) && ecLocallyInside(b, a) && ecMiddleInside(a, b) &&
+			(ecArea(a.prev, a, b.prev) != 0 || ecArea(a, b.prev, b) != 0)) ||
+			(ecEquals(a, b) && ecArea(a.prev, a, a.next) > 0 && ecArea(b.prev, b, b.next) > 0))
+}
+
+func ecArea(p, q, r *ecNode) float64 {
+	return (q.y-p.y)*(r.x-q.x) - (q.x-p.x)*(r.y-q.y)
+}
+
+func ecEquals(p1, p2 *ecNode) bool {
+	return p1.x == p2.x && p1.y == p2.y
+}
+
+func ecSign(v float64) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+func ecIntersects(p1, q1, p2, q2 *ecNode) bool {
+	o1 := ecSign(ecArea(p1, q1, p2))
+	o2 := ecSign(ecArea(p1, q1, q2))
+	o3 := ecSign(ecArea(p2, q2, p1))
+	o4 := ecSign(ecArea(p2, q2, q1))
+	if o1 != o2 && o3 != o4 {
+		return true
+	}
+	return (o1 == 0 && ecOnSegment(p1, p2, q1)) ||
+		(o2 == 0 && ecOnSegment(p1, q2, q1)) ||
+		(o3 == 0 && ecOnSegment(p2, p1, q2)) ||
+		(o4 == 0 && ecOnSegment(p2, q1, q2))
+}
+
+// ecOnSegment reports whether q lies on segment pr (given colinearity).
+func ecOnSegment(p, q, r *ecNode) bool {
+	return q.x <= math.Max(p.x, r.x) && q.x >= math.Min(p.x, r.x) &&
+		q.y <= math.Max(p.y, r.y) && q.y >= math.Min(p.y, r.y)
+}
+
+func ecIntersectsPolygon(a, b *ecNode) bool {
+	p := a
+	for {
+		if p.i != a.i && p.next.i != a.i && p.i != b.i && p.next.i != b.i && ecIntersects(p, p.next, a, b) {
+			return true
+		}
+		p = p.next
+		if p == a {
+			return false
+		}
+	}
+}
+
+func ecLocallyInside(a, b *ecNode) bool {
+	if ecArea(a.prev, a, a.next) < 0 {
+		return ecArea(a, b, a.next) >= 0 && ecArea(a, a.prev, b) >= 0
+	}
+	return ecArea(a, b, a.prev) < 0 || ecArea(a, a.next, b) < 0
+}
+
+func ecMiddleInside(a, b *ecNode) bool {
+	p := a
+	inside := false
+	px, py := 0.5*(a.x+b.x), 0.5*(a.y+b.y)
+	for {
+		if (p.y > py) != (p.next.y > py) && p.next.y != p.y &&
+			px < (p.next.x-p.x)*(py-p.y)/(p.next.y-p.y)+p.x {
+			inside = !inside
+		}
+		p = p.next
+		if p == a {
+			return inside
+		}
+	}
+}
+
+// ecSplitPolygon links two polygon vertices with a bridge; if the
+// vertices belong to the same ring, it splits the polygon into two.
+func ecSplitPolygon(a, b *ecNode) *ecNode {
+	a2 := &ecNode{i: a.i, x: a.x, y: a.y}
+	b2 := &ecNode{i: b.i, x: b.x, y: b.y}
+	an, bp := a.next, b.prev
+
+	a.next = b
+	b.prev = a
+
+	a2.next = an
+	an.prev = a2
+
+	b2.next = a2
+	a2.prev = b2
+
+	bp.next = b2
+	b2.prev = bp
+
+	return b2
+}
+
+func ecInsertNode(i int, x, y float64, last *ecNode) *ecNode {
+	p := &ecNode{i: i, x: x, y: y}
+	if last == nil {
+		p.prev = p
+		p.next = p
+	} else {
+		p.next = last.next
+		p.prev = last
+		last.next.prev = p
+		last.next = p
+	}
+	return p
+}
+
+func ecRemoveNode(p *ecNode) {
+	p.next.prev = p.prev
+	p.prev.next = p.next
+}
+
+func ecSignedArea(data []float64, start, end int) float64 {
+	var sum float64
+	for i, j := start, end-2; i < end; i += 2 {
+		sum += (data[j] - data[i]) * (data[i+1] + data[j+1])
+		j = i
+	}
+	return sum
+}
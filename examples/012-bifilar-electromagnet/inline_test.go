@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+)
+
+// TestInlinedLibraries makes sure that the copies of primitives.wgsl and
+// rotation.wgsl in the .irmf files match the libraries.
+func TestInlinedLibraries(t *testing.T) {
+	files, err := filepath.Glob("*.irmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range files {
+		got, want, libs, err := irmf.InlineFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%v is out of date with %v; run: go run ./cmd/irmf-inline -w", filename, libs)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gmlewis/go3d/vec3"
+	"github.com/gmlewis/irmf-slicer/v3/stl"
+)
+
+// meshBuilder is an in-memory indexed mesh that implements triHelper.
+// Vertices that are within weldTol of each other are merged into a
+// single vertex so that the resulting mesh can be written to compact
+// indexed formats (OBJ, PLY, 3MF) and checked for defects.
+type meshBuilder struct {
+	weldTol float32
+
+	verts []vec3.T
+	faces [][3]int
+	grid  map[[3]int64][]int
+
+	// numDegenerate counts the triangles that collapsed after welding.
+	numDegenerate int
+}
+
+func newMeshBuilder(weldTol float64) *meshBuilder {
+	if weldTol <= 0 {
+		weldTol = 1e-6
+	}
+	return &meshBuilder{
+		weldTol: float32(weldTol),
+		grid:    map[[3]int64][]int{},
+	}
+}
+
+// writeTri adds a triangle to the mesh. The normal is ignored since it
+// is recomputed from the (welded) vertices on output.
+func (mb *meshBuilder) writeTri(normal, v1, v2, v3 *vec3.T) {
+	i1, i2, i3 := mb.vertex(v1), mb.vertex(v2), mb.vertex(v3)
+	if i1 == i2 || i2 == i3 || i1 == i3 {
+		mb.numDegenerate++
+		return
+	}
+	mb.faces = append(mb.faces, [3]int{i1, i2, i3})
+}
+
+func (mb *meshBuilder) cell(v *vec3.T) [3]int64 {
+	return [3]int64{
+		int64(math.Floor(float64(v[0] / mb.weldTol))),
+		int64(math.Floor(float64(v[1] / mb.weldTol))),
+		int64(math.Floor(float64(v[2] / mb.weldTol))),
+	}
+}
+
+// vertex returns the index of the vertex that is within weldTol of v,
+// adding v as a new vertex if none exists.
+func (mb *meshBuilder) vertex(v *vec3.T) int {
+	c := mb.cell(v)
+	tol2 := mb.weldTol * mb.weldTol
+	for dx := int64(-1); dx <= 1; dx++ {
+		for dy := int64(-1); dy <= 1; dy++ {
+			for dz := int64(-1); dz <= 1; dz++ {
+				for _, i := range mb.grid[[3]int64{c[0] + dx, c[1] + dy, c[2] + dz}] {
+					if vec3.SquareDistance(&mb.verts[i], v) <= tol2 {
+						return i
+					}
+				}
+			}
+		}
+	}
+	i := len(mb.verts)
+	mb.verts = append(mb.verts, *v)
+	mb.grid[c] = append(mb.grid[c], i)
+	return i
+}
+
+func (mb *meshBuilder) normal(f [3]int) vec3.T {
+	v1, v2, v3 := &mb.verts[f[0]], &mb.verts[f[1]], &mb.verts[f[2]]
+	n := vec3.Cross(cp(v2).Sub(v1), cp(v3).Sub(v1))
+	n.Normalize()
+	return n
+}
+
+// transform applies the orientation to every vertex of the mesh.
+func (mb *meshBuilder) transform(o *orientation) {
+	for i := range mb.verts {
+		mb.verts[i] = *o.apply(&mb.verts[i])
+	}
+}
+
+// bounds returns the bounding box of the mesh.
+func (mb *meshBuilder) bounds() (min, max vec3.T) {
+	min, max = vec3.MaxVal, vec3.MinVal
+	for i := range mb.verts {
+		min = vec3.Min(&min, &mb.verts[i])
+		max = vec3.Max(&max, &mb.verts[i])
+	}
+	return min, max
+}
+
+// writeFile writes the mesh to filename using the format implied by
+// its extension.
+func (mb *meshBuilder) writeFile(filename string) error {
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".stl":
+		return mb.writeSTL(filename)
+	case ".obj":
+		return writeBuffered(filename, mb.writeOBJ)
+	case ".ply":
+		return writeBuffered(filename, mb.writePLY)
+	case ".3mf":
+		return mb.write3MF(filename)
+	default:
+		return fmt.Errorf("unsupported output format %q", ext)
+	}
+}
+
+func writeBuffered(filename string, fn func(w io.Writer) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := fn(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (mb *meshBuilder) writeSTL(filename string) error {
+	w, err := stl.New(filename)
+	if err != nil {
+		return err
+	}
+	tw := &triWrapper{w: w}
+	for _, f := range mb.faces {
+		n := mb.normal(f)
+		tw.writeTri(&n, &mb.verts[f[0]], &mb.verts[f[1]], &mb.verts[f[2]])
+	}
+	return w.Close()
+}
+
+func (mb *meshBuilder) writeOBJ(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# aprbfem: %v vertices, %v faces\n", len(mb.verts), len(mb.faces)); err != nil {
+		return err
+	}
+	for _, v := range mb.verts {
+		if _, err := fmt.Fprintf(w, "v %v %v %v\n", v[0], v[1], v[2]); err != nil {
+			return err
+		}
+	}
+	for _, f := range mb.faces {
+		// OBJ indices are 1-based.
+		if _, err := fmt.Fprintf(w, "f %v %v %v\n", f[0]+1, f[1]+1, f[2]+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mb *meshBuilder) writePLY(w io.Writer) error {
+	header := fmt.Sprintf(`ply
+format ascii 1.0
+comment aprbfem
+element vertex %v
+property float x
+property float y
+property float z
+element face %v
+property list uchar int vertex_indices
+end_header
+`, len(mb.verts), len(mb.faces))
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	for _, v := range mb.verts {
+		if _, err := fmt.Fprintf(w, "%v %v %v\n", v[0], v[1], v[2]); err != nil {
+			return err
+		}
+	}
+	for _, f := range mb.faces {
+		if _, err := fmt.Fprintf(w, "3 %v %v %v\n", f[0], f[1], f[2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	contentTypes3MF = `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+  <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+  <Default Extension="model" ContentType="application/vnd.ms-package.3dmanufacturing-3dmodel+xml"/>
+</Types>
+`
+	rels3MF = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Target="/3D/3dmodel.model" Id="rel0" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/>
+</Relationships>
+`
+)
+
+func (mb *meshBuilder) write3MF(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	for _, part := range []struct {
+		name string
+		fn   func(w io.Writer) error
+	}{
+		{"[Content_Types].xml", func(w io.Writer) error { _, err := io.WriteString(w, contentTypes3MF); return err }},
+		{"_rels/.rels", func(w io.Writer) error { _, err := io.WriteString(w, rels3MF); return err }},
+		{"3D/3dmodel.model", mb.write3MFModel},
+	} {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		bw := bufio.NewWriter(w)
+		if err := part.fn(bw); err != nil {
+			f.Close()
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (mb *meshBuilder) write3MFModel(w io.Writer) error {
+	if _, err := io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<model unit="millimeter" xml:lang="en-US" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02">
+  <resources>
+    <object id="1" type="model">
+      <mesh>
+        <vertices>
+`); err != nil {
+		return err
+	}
+	for _, v := range mb.verts {
+		if _, err := fmt.Fprintf(w, "          <vertex x=\"%v\" y=\"%v\" z=\"%v\"/>\n", v[0], v[1], v[2]); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, "        </vertices>\n        <triangles>\n"); err != nil {
+		return err
+	}
+	for _, f := range mb.faces {
+		if _, err := fmt.Fprintf(w, "          <triangle v1=\"%v\" v2=\"%v\" v3=\"%v\"/>\n", f[0], f[1], f[2]); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, `        </triangles>
+      </mesh>
+    </object>
+  </resources>
+  <build>
+    <item objectid="1"/>
+  </build>
+</model>
+`)
+	return err
+}
+
+// meshReport summarizes the results of checking a mesh for defects.
+type meshReport struct {
+	numVerts, numFaces int
+	numDegenerate      int // triangles dropped because they collapsed after welding
+	boundaryEdges      int // edges used by only one triangle (holes)
+	nonManifoldEdges   int // edges used by more than two triangles
+	flippedEdges       int // edges traversed in the same direction by two triangles
+}
+
+func (r *meshReport) String() string {
+	return fmt.Sprintf("%v vertices, %v faces, %v degenerate, %v boundary edges, %v non-manifold edges, %v inconsistently-oriented edges",
+		r.numVerts, r.numFaces, r.numDegenerate, r.boundaryEdges, r.nonManifoldEdges, r.flippedEdges)
+}
+
+// watertight reports whether every edge is shared by exactly two
+// consistently-oriented triangles.
+func (r *meshReport) watertight() bool {
+	return r.boundaryEdges == 0 && r.nonManifoldEdges == 0 && r.flippedEdges == 0
+}
+
+// check analyzes the topology of the mesh.
+func (mb *meshBuilder) check() *meshReport {
+	type edge struct{ a, b int }
+	// directed counts how many times each directed edge is used.
+	directed := map[edge]int{}
+	for _, f := range mb.faces {
+		for i := 0; i < 3; i++ {
+			directed[edge{f[i], f[(i+1)%3]}]++
+		}
+	}
+
+	r := &meshReport{
+		numVerts:      len(mb.verts),
+		numFaces:      len(mb.faces),
+		numDegenerate: mb.numDegenerate,
+	}
+	for e, n := range directed {
+		if e.a > e.b {
+			if _, ok := directed[edge{e.b, e.a}]; ok {
+				continue // counted from the other direction
+			}
+		}
+		rev := directed[edge{e.b, e.a}]
+		switch total := n + rev; {
+		case total == 1:
+			r.boundaryEdges++
+		case total > 2:
+			r.nonManifoldEdges++
+		case n == 2 || rev == 2:
+			r.flippedEdges++
+		}
+	}
+	return r
+}
+
+// logCheck logs the mesh report for the named mesh.
+func (mb *meshBuilder) logCheck(name string) {
+	r := mb.check()
+	if r.watertight() {
+		log.Printf("%v: watertight: %v", name, r)
+		return
+	}
+	log.Printf("WARNING: %v: NOT watertight: %v", name, r)
+}
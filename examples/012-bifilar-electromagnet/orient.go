@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gmlewis/go3d/vec3"
+)
+
+// orientation is a rigid transform (rotation followed by translation)
+// that is applied to every vertex written by the model.
+type orientation struct {
+	rot   [3][3]float64
+	trans [3]float64
+}
+
+var identityRot = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+// axisRotations map the +Z build axis of the coil onto the requested axis.
+var axisRotations = map[string][3][3]float64{
+	"x": {{0, 0, 1}, {0, 1, 0}, {-1, 0, 0}}, // +90 degrees about Y
+	"y": {{1, 0, 0}, {0, 0, 1}, {0, -1, 0}}, // -90 degrees about X
+	"z": identityRot,
+}
+
+// placements lists the valid -place flag values.
+var placements = map[string]bool{"none": true, "plate": true, "center": true}
+
+// newOrientation returns the rotation built from the -axis and -matrix
+// flag values. The matrix (if any) is applied after the axis rotation.
+// The placement mode is only validated here; see place.
+func newOrientation(axis, matrix, placement string) (*orientation, error) {
+	if !placements[placement] {
+		return nil, fmt.Errorf("-place must be one of none, plate, or center; got %q", placement)
+	}
+	rot, ok := axisRotations[strings.ToLower(axis)]
+	if !ok {
+		return nil, fmt.Errorf("-axis must be one of x, y, or z; got %q", axis)
+	}
+	o := &orientation{rot: rot}
+	if matrix == "" {
+		return o, nil
+	}
+
+	user, err := parseMatrix(matrix)
+	if err != nil {
+		return nil, err
+	}
+	o.rot = mulMat3(user, rot)
+	return o, nil
+}
+
+// parseMatrix parses 9 comma-separated values (row-major) into a 3x3
+// rotation matrix, verifying that it is orthonormal with determinant 1.
+func parseMatrix(s string) ([3][3]float64, error) {
+	var m [3][3]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != 9 {
+		return m, fmt.Errorf("-matrix must have 9 comma-separated values; got %v", len(parts))
+	}
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return m, fmt.Errorf("-matrix value %q: %v", p, err)
+		}
+		m[i/3][i%3] = v
+	}
+
+	const epsilon = 1e-4
+	mmt := mulMat3(m, transposeMat3(m))
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(mmt[i][j]-identityRot[i][j]) > epsilon {
+				return m, fmt.Errorf("-matrix %q is not orthonormal", s)
+			}
+		}
+	}
+	if det := detMat3(m); math.Abs(det-1) > epsilon {
+		return m, fmt.Errorf("-matrix %q is not a rotation (determinant=%v)", s, det)
+	}
+	return m, nil
+}
+
+func mulMat3(a, b [3][3]float64) (r [3][3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = a[i][0]*b[0][j] + a[i][1]*b[1][j] + a[i][2]*b[2][j]
+		}
+	}
+	return r
+}
+
+func transposeMat3(a [3][3]float64) (r [3][3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = a[j][i]
+		}
+	}
+	return r
+}
+
+func detMat3(a [3][3]float64) float64 {
+	return a[0][0]*(a[1][1]*a[2][2]-a[1][2]*a[2][1]) -
+		a[0][1]*(a[1][0]*a[2][2]-a[1][2]*a[2][0]) +
+		a[0][2]*(a[1][0]*a[2][1]-a[1][1]*a[2][0])
+}
+
+func (o *orientation) isIdentity() bool {
+	return o.rot == identityRot && o.trans == [3]float64{}
+}
+
+func (o *orientation) rotate(v *vec3.T) *vec3.T {
+	x, y, z := float64(v[0]), float64(v[1]), float64(v[2])
+	r := &o.rot
+	return &vec3.T{
+		float32(r[0][0]*x + r[0][1]*y + r[0][2]*z),
+		float32(r[1][0]*x + r[1][1]*y + r[1][2]*z),
+		float32(r[2][0]*x + r[2][1]*y + r[2][2]*z),
+	}
+}
+
+func (o *orientation) apply(v *vec3.T) *vec3.T {
+	r := o.rotate(v)
+	r[0] += float32(o.trans[0])
+	r[1] += float32(o.trans[1])
+	r[2] += float32(o.trans[2])
+	return r
+}
+
+// place sets the translation so that the rotated bounding box
+// (min, max) sits according to the -place flag value:
+// "none" leaves the model where it is,
+// "plate" centers it in XY and rests it on the build plate at z=0, and
+// "center" centers the bounding box on the origin.
+func (o *orientation) place(mode string, min, max vec3.T) {
+	cx := 0.5 * (float64(min[0]) + float64(max[0]))
+	cy := 0.5 * (float64(min[1]) + float64(max[1]))
+	cz := 0.5 * (float64(min[2]) + float64(max[2]))
+	switch mode {
+	case "plate":
+		o.trans = [3]float64{-cx, -cy, -float64(min[2])}
+	case "center":
+		o.trans = [3]float64{-cx, -cy, -cz}
+	default:
+		o.trans = [3]float64{}
+	}
+}
+
+// orientedTris is a triHelper that applies an orientation to every
+// triangle before passing it along to the wrapped triHelper.
+type orientedTris struct {
+	o *orientation
+	w triHelper
+}
+
+func (t *orientedTris) writeTri(normal, v1, v2, v3 *vec3.T) {
+	t.w.writeTri(t.o.rotate(normal), t.o.apply(v1), t.o.apply(v2), t.o.apply(v3))
+}
+
+// boundsTris is a triHelper that only records the bounding box of all
+// the vertices it sees.
+type boundsTris struct {
+	min, max vec3.T
+}
+
+func newBoundsTris() *boundsTris {
+	return &boundsTris{min: vec3.MaxVal, max: vec3.MinVal}
+}
+
+func (b *boundsTris) writeTri(normal, v1, v2, v3 *vec3.T) {
+	for _, v := range []*vec3.T{v1, v2, v3} {
+		b.min = vec3.Min(&b.min, v)
+		b.max = vec3.Max(&b.max, v)
+	}
+}
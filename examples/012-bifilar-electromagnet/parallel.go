@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gmlewis/go3d/vec3"
+)
+
+// promise is a value computed while rendering one coil that is needed
+// while rendering another.
+type promise[T any] struct {
+	once sync.Once
+	done chan struct{}
+	v    T
+}
+
+func newPromise[T any]() *promise[T] {
+	return &promise[T]{done: make(chan struct{})}
+}
+
+// resolve sets the value of the promise. Only the first call has any effect.
+func (p *promise[T]) resolve(v T) {
+	p.once.Do(func() {
+		p.v = v
+		close(p.done)
+	})
+}
+
+// wait blocks until the promise is resolved and returns its value.
+func (p *promise[T]) wait() T {
+	<-p.done
+	return p.v
+}
+
+// exitWireConnector holds the points of the connector of coil 1, wire 2
+// that the top spiral of the last coil (wire 1) connects to.
+type exitWireConnector struct {
+	conP1do *vec3.T
+	conP1uo *vec3.T
+	conP0do *vec3.T
+	conP0uo *vec3.T
+	extP0do *vec3.T
+	extP0uo *vec3.T
+}
+
+// dielBackEnds holds the exit wire points used to render the top
+// dielectric end cap after all the coils are rendered.
+type dielBackEnds struct {
+	debotP3uo *vec3.T
+	debotP3ui *vec3.T
+	debotP2uo *vec3.T
+	debotP2ui *vec3.T
+	debotP0uo *vec3.T
+	debotP0ui *vec3.T
+	debotP1uo *vec3.T
+	debotP1ui *vec3.T
+}
+
+// coilDeps holds the values that are passed between coils.
+//
+// Every dependency is on a coil that comes earlier in the serial
+// rendering order, so coils started in that order can always make
+// progress no matter how many of them run at once.
+type coilDeps struct {
+	// lowerConnectors are keyed by "wireNum,coilNum" and are resolved
+	// (possibly to nil) when that coil is finished.
+	lowerConnectors map[string]*promise[*connector]
+
+	// exitWire is resolved by coil 1, wire 2.
+	exitWire *promise[*exitWireConnector]
+
+	// coil2Line is the (slope, yIntercept) used for collision detection
+	// and is resolved by coil 2, wire 1.
+	coil2Line *promise[[2]float64]
+}
+
+func newCoilDeps(numPairs int) *coilDeps {
+	d := &coilDeps{
+		lowerConnectors: map[string]*promise[*connector]{},
+		exitWire:        newPromise[*exitWireConnector](),
+		coil2Line:       newPromise[[2]float64](),
+	}
+	for coilNum := 1; coilNum <= numPairs; coilNum++ {
+		for wireNum := 1; wireNum <= 2; wireNum++ {
+			d.lowerConnectors[coilKey(wireNum, coilNum)] = newPromise[*connector]()
+		}
+	}
+	return d
+}
+
+func coilKey(wireNum, coilNum int) string { return fmt.Sprintf("%v,%v", wireNum, coilNum) }
+
+// lowerConnector returns the lower connector of the given coil, waiting
+// for it to be rendered if necessary. It returns nil if there is none.
+func (d *coilDeps) lowerConnector(wireNum, coilNum int) *connector {
+	p, ok := d.lowerConnectors[coilKey(wireNum, coilNum)]
+	if !ok {
+		return nil
+	}
+	return p.wait()
+}
+
+// finish resolves any of the coil's promises that were not resolved
+// while rendering it so that no other coil waits forever.
+func (d *coilDeps) finish(wireNum, coilNum int) {
+	d.lowerConnectors[coilKey(wireNum, coilNum)].resolve(nil)
+}
+
+// triBuffer is a triHelper that records triangles so that they can be
+// replayed (in order) to another triHelper.
+type triBuffer struct {
+	tris [][4]vec3.T
+}
+
+func (b *triBuffer) writeTri(normal, v1, v2, v3 *vec3.T) {
+	b.tris = append(b.tris, [4]vec3.T{*normal, *v1, *v2, *v3})
+}
+
+func (b *triBuffer) replay(w triHelper) {
+	for i := range b.tris {
+		t := &b.tris[i]
+		w.writeTri(&t[0], &t[1], &t[2], &t[3])
+	}
+	b.tris = nil
+}
+
+// renderCoils renders every coil (both wires of every pair). With
+// -parallel greater than 1, the coils are rendered concurrently, each
+// into its own buffer, and the buffers are then written out in the same
+// order as the serial path so that the output is byte-identical.
+func (m *arBifilarElectromagnet) renderCoils() {
+	m.deps = newCoilDeps(m.numPairs)
+
+	type job struct {
+		wireNum, coilNum int
+		metal, diel      *triBuffer
+		done             chan struct{}
+	}
+	var jobs []*job
+	for i := 1; i <= m.numPairs; i++ {
+		jobs = append(jobs,
+			&job{wireNum: 1, coilNum: i},
+			&job{wireNum: 2, coilNum: i})
+	}
+
+	if *parallel <= 1 {
+		for _, j := range jobs {
+			m.coilPlusConnectorWires(j.wireNum, j.coilNum)
+			m.deps.finish(j.wireNum, j.coilNum)
+		}
+		return
+	}
+
+	sem := make(chan struct{}, *parallel)
+	for _, j := range jobs {
+		j.metal, j.diel = &triBuffer{}, &triBuffer{}
+		j.done = make(chan struct{})
+	}
+	go func() {
+		// Start the coils in serial order so that dependencies can always be met.
+		for _, j := range jobs {
+			sem <- struct{}{}
+			go func(j *job) {
+				cm := *m
+				cm.w1, cm.w2 = j.metal, j.diel
+				cm.coilPlusConnectorWires(j.wireNum, j.coilNum)
+				m.deps.finish(j.wireNum, j.coilNum)
+				<-sem
+				close(j.done)
+			}(j)
+		}
+	}()
+
+	for _, j := range jobs {
+		<-j.done
+		j.metal.replay(m.w1)
+		j.diel.replay(m.w2)
+	}
+}
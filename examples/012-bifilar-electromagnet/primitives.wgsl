@@ -1,5 +1,8 @@
 // primitives.wgsl
 // Copyright 2022 Glenn M. Lewis. All Rights Reserved.
+//
+// WGSL has no #include, so this file is copied into the -wgsl.irmf files
+// in this directory. Run "go run ./cmd/irmf-inline -w" after editing it.
 
 fn box_prim(start: vec3f, end: vec3f, size: f32, xyz: vec3f) -> f32 {
   let ll = min(start, end) - vec3f(0.5 * size);
@@ -8,12 +11,6 @@ fn box_prim(start: vec3f, end: vec3f, size: f32, xyz: vec3f) -> f32 {
   return 1.0;
 }
 
-// Note: wire requires rotZ which is in rotation.wgsl
-// If including both, ensure no naming conflicts.
-// Since WGSL doesn't have a standard #include that works everywhere,
-// it might be better to just inline these in the IRMF files.
-// But for now, let's keep them separate if the user wants them.
-
 fn cylinder(radius: f32, height: f32, xyz: vec3f) -> f32 {
   // First, trivial reject on the two ends of the cylinder.
   if (xyz.z < 0.0 || xyz.z > height) { return 0.0; }
@@ -1,5 +1,8 @@
 // rotation.wgsl
 // Copyright 2022 Glenn M. Lewis. All Rights Reserved.
+//
+// WGSL has no #include, so this file is copied into the -wgsl.irmf files
+// in this directory. Run "go run ./cmd/irmf-inline -w" after editing it.
 
 fn rotAxis(axis: vec3f, a: f32) -> mat3x3f {
   let s = sin(a);
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sectionPlane is an axis-aligned plane such as "x=0" or "z=30" along
+// with the 2D axes used to draw the cross-section.
+type sectionPlane struct {
+	plane  *cutPlane
+	axis   string
+	hx, hy int // indices of the horizontal and vertical drawing axes
+}
+
+var sectionAxes = map[string]struct {
+	n      vec3d
+	hx, hy int
+}{
+	"x": {n: vec3d{1, 0, 0}, hx: 1, hy: 2},
+	"y": {n: vec3d{0, 1, 0}, hx: 0, hy: 2},
+	"z": {n: vec3d{0, 0, 1}, hx: 0, hy: 1},
+}
+
+// parseSectionPlane parses a -section flag value like "x=0" or "z=30".
+func parseSectionPlane(spec string) (*sectionPlane, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("-section must look like x=0, y=0, or z=30; got %q", spec)
+	}
+	axis := strings.ToLower(strings.TrimSpace(parts[0]))
+	a, ok := sectionAxes[axis]
+	if !ok {
+		return nil, fmt.Errorf("-section axis must be x, y, or z; got %q", parts[0])
+	}
+	d, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("-section value %q: %v", parts[1], err)
+	}
+	p := &cutPlane{n: a.n, d: d}
+	p.u = perpendicular(p.n)
+	return &sectionPlane{plane: p, axis: axis, hx: a.hx, hy: a.hy}, nil
+}
+
+// polygons returns the cross-section of the mesh as closed rings of
+// points in the drawing axes.
+func (sp *sectionPlane) polygons(mb *meshBuilder) [][][2]float64 {
+	c := &cutter{
+		planes:  []*cutPlane{sp.plane},
+		removed: func(c vec3d) bool { return sp.plane.dist(c) > 0 },
+	}
+	kept := c.cutWithoutCaps(mb)
+	eps := 2 * float64(mb.weldTol)
+
+	loops, chains := capLoops(kept, sp.plane, kept.boundaryEdges(), eps)
+	if len(chains) > 0 {
+		log.Printf("WARNING: section %v=%v: leaving out %v unclosed outlines (mesh is not watertight)", sp.axis, sp.plane.d, len(chains))
+	}
+	var rings [][][2]float64
+	for _, loop := range loops {
+		if len(loop) < 3 {
+			continue
+		}
+		var ring [][2]float64
+		for _, i := range loop {
+			v := kept.verts[i]
+			ring = append(ring, [2]float64{float64(v[sp.hx]), float64(v[sp.hy])})
+		}
+		rings = append(rings, ring)
+	}
+	return rings
+}
+
+// sectionLayer is one material drawn in a cross-section.
+type sectionLayer struct {
+	name  string
+	fill  string
+	rings [][][2]float64
+}
+
+// writeSectionSVG writes the layers (in order, so later layers are drawn
+// on top) as filled even-odd paths. The drawing is in millimeters with
+// the vertical axis pointing up.
+func writeSectionSVG(w io.Writer, sp *sectionPlane, layers []*sectionLayer) error {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, layer := range layers {
+		for _, ring := range layer.rings {
+			for _, pt := range ring {
+				minX, maxX = math.Min(minX, pt[0]), math.Max(maxX, pt[0])
+				minY, maxY = math.Min(minY, pt[1]), math.Max(maxY, pt[1])
+			}
+		}
+	}
+	if minX > maxX {
+		return fmt.Errorf("section %v=%v does not intersect the model", sp.axis, sp.plane.d)
+	}
+	const margin = 1
+	minX, minY, maxX, maxY = minX-margin, minY-margin, maxX+margin, maxY+margin
+	width, height := maxX-minX, maxY-minY
+
+	axisNames := "xyz"
+	if _, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%.3fmm" height="%.3fmm" viewBox="%.4f %.4f %.4f %.4f">
+<title>aprbfem section %v=%v (horizontal: %c, vertical: %c)</title>
+<g transform="scale(1,-1)">
+`, width, height, minX, -maxY, width, height, sp.axis, sp.plane.d, axisNames[sp.hx], axisNames[sp.hy]); err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		var d strings.Builder
+		for _, ring := range layer.rings {
+			for i, pt := range ring {
+				cmd := "L"
+				if i == 0 {
+					cmd = "M"
+				}
+				fmt.Fprintf(&d, "%v%.4f %.4f ", cmd, pt[0], pt[1])
+			}
+			d.WriteString("Z ")
+		}
+		if _, err := fmt.Fprintf(w, "<path id=%q fill=%q fill-rule=\"evenodd\" stroke=\"black\" stroke-width=\"0.02\" d=%q/>\n",
+			layer.name, layer.fill, strings.TrimSpace(d.String())); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</g>\n</svg>\n")
+	return err
+}
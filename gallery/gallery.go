@@ -0,0 +1,547 @@
+// Package gallery generates a static web site for browsing the examples:
+// an index page with search and filters, and one page per example with
+// its README, syntax-highlighted GLSL and WGSL sources, material and unit
+// tags, and download links.
+//
+// The site is self-contained: the example files are copied next to the
+// pages, and the styles and scripts are local, so it works offline and
+// from any static host (such as GitHub Pages). Images that the READMEs
+// load from other sites are replaced by a local placeholder that links
+// to the original.
+package gallery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/catalog"
+	"github.com/gmlewis/irmf-examples/irmf"
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+// repoURL is where files that are not copied into the site are linked.
+const repoURL = "https://github.com/gmlewis/irmf-examples/blob/master/"
+
+var (
+	errNoExamples = errors.New("no examples found")
+
+	// minifiedRE matches the note that update-examples adds below a
+	// minified snippet.
+	minifiedRE = regexp.MustCompile(`(?m)^\* The shader above is minified.*\n`)
+)
+
+// maxSummary is the length of the summaries on the index page.
+const maxSummary = 200
+
+// generator marks the pages of a gallery so that Write only replaces a
+// directory that holds one.
+const generator = `<meta name="generator" content="irmf-examples gallery">`
+
+// Options control the generated site.
+type Options struct {
+	// MaxSource is the number of bytes of each shader shown on its page
+	// (0 for all). Longer shaders, such as the decoded sources of the
+	// encoded ones, are cut off with a link to the full file.
+	MaxSource int
+}
+
+// Write generates the gallery of the examples of the repo at root (see
+// catalog.Build) in the directory out, replacing any previous gallery
+// there. It refuses to replace a non-empty directory that does not hold
+// a gallery.
+func Write(root, out string, opts Options) error {
+	c, err := catalog.Build(root)
+	if err != nil {
+		return err
+	}
+	if len(c.Examples) == 0 {
+		return errNoExamples
+	}
+	if err := clean(out); err != nil {
+		return err
+	}
+
+	s := &site{root: root, out: out, opts: opts, catalog: c, copied: map[string]bool{}, names: map[string]bool{}}
+	for _, ex := range c.Examples {
+		s.names[ex.Name] = true
+	}
+	for _, ex := range c.Examples {
+		if err := s.copyFiles(ex); err != nil {
+			return err
+		}
+	}
+
+	var cards []*card
+	for _, ex := range c.Examples {
+		p, err := s.examplePage(ex)
+		if err != nil {
+			return err
+		}
+		if err := s.execute(filepath.Join(ex.Name, "index.html"), "example", p); err != nil {
+			return err
+		}
+		cards = append(cards, p.card())
+	}
+
+	idx := &indexPage{Cards: cards}
+	seen := map[string]bool{}
+	for _, cd := range cards {
+		for _, t := range cd.Tags {
+			key := t.Kind + ":" + t.Value
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			switch t.Kind {
+			case "material":
+				idx.Materials = append(idx.Materials, t.Value)
+			case "units":
+				idx.Units = append(idx.Units, t.Value)
+			case "language":
+				idx.Languages = append(idx.Languages, t.Value)
+			}
+		}
+	}
+	sort.Slice(idx.Materials, func(i, j int) bool {
+		return strings.ToLower(idx.Materials[i]) < strings.ToLower(idx.Materials[j])
+	})
+	sort.Strings(idx.Units)
+	sort.Strings(idx.Languages)
+	if err := s.execute("index.html", "index", idx); err != nil {
+		return err
+	}
+
+	for name, body := range map[string]string{"gallery.css": css, "gallery.js": js, offlineImageName: offlineImage, ".nojekyll": ""} {
+		if err := os.WriteFile(filepath.Join(out, name), []byte(body), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clean removes the previous gallery in out, if any.
+func clean(out string) error {
+	entries, err := os.ReadDir(out)
+	if os.IsNotExist(err) || (err == nil && len(entries) == 0) {
+		return os.MkdirAll(out, 0755)
+	}
+	if err != nil {
+		return err
+	}
+	buf, err := os.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !bytes.Contains(buf, []byte(generator)) {
+		return fmt.Errorf("%v is not empty and does not hold a gallery; not replacing it", out)
+	}
+	if err := os.RemoveAll(out); err != nil {
+		return err
+	}
+	return os.MkdirAll(out, 0755)
+}
+
+type site struct {
+	root, out string
+	opts      Options
+	catalog   *catalog.Catalog
+
+	// copied holds the repo paths of the files copied into the site.
+	copied map[string]bool
+	// names holds the names of the examples.
+	names map[string]bool
+}
+
+// copyFiles copies the shaders, generated files, other files, and images
+// of the example into the site.
+func (s *site) copyFiles(ex *catalog.Example) error {
+	var paths []string
+	for _, sh := range ex.Shaders {
+		paths = append(paths, sh.Path)
+		for _, f := range sh.Artifacts {
+			paths = append(paths, f.Path)
+		}
+	}
+	for _, f := range ex.Files {
+		paths = append(paths, f.Path)
+	}
+	images, err := filepath.Glob(filepath.Join(s.root, ex.Path, "*.png"))
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		paths = append(paths, ex.Path+"/"+filepath.Base(img))
+	}
+
+	if err := os.MkdirAll(filepath.Join(s.out, ex.Name), 0755); err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := copyFile(filepath.Join(s.out, ex.Name, path.Base(p)), filepath.Join(s.root, p)); err != nil {
+			return err
+		}
+		s.copied[p] = true
+	}
+	return nil
+}
+
+func copyFile(dst, src string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// resolver returns the resolver of the Markdown in dir (relative to the
+// root of the repo) for the page at pageDir in the site (an example name,
+// or "" for the index).
+func (s *site) resolver(dir, pageDir string) *resolver {
+	placeholder := offlineImageName
+	if pageDir != "" {
+		placeholder = "../" + placeholder
+	}
+	return &resolver{
+		link: func(target string) string {
+			if strings.Contains(target, "://") || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "mailto:") {
+				return target
+			}
+			return s.href(path.Clean(path.Join(dir, target)), pageDir)
+		},
+		placeholder: placeholder,
+	}
+}
+
+// href returns the URL of the file or directory p (relative to the root
+// of the repo) from the page at pageDir in the site: the copy in the
+// site if there is one, else the file on GitHub.
+func (s *site) href(p, pageDir string) string {
+	up := ""
+	if pageDir != "" {
+		up = "../"
+	}
+	if rest, ok := strings.CutPrefix(p, "examples/"); ok {
+		name, file, _ := strings.Cut(rest, "/")
+		switch {
+		case s.names[name] && (file == "" || file == "README.md"):
+			if name == pageDir {
+				return "./"
+			}
+			return up + name + "/"
+		case s.copied[p]:
+			if name == pageDir {
+				return file
+			}
+			return up + rest
+		}
+	}
+	return repoURL + p
+}
+
+func (s *site) execute(name, tmpl string, data any) error {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, tmpl, data); err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	return os.WriteFile(filepath.Join(s.out, name), buf.Bytes(), 0644)
+}
+
+type tag struct {
+	Kind, Value string
+}
+
+type download struct {
+	Name string
+	Href string
+	Size int64
+}
+
+type tab struct {
+	Label string // "GLSL" or "WGSL"
+	Code  template.HTML
+	// Shown is the number of bytes shown if the source was cut off (see
+	// Options.MaxSource), else 0.
+	Shown int
+	Size  int
+	File  string
+}
+
+type section struct {
+	ID        string
+	Heading   string
+	Before    template.HTML // the README text before the snippet
+	After     template.HTML // and after it
+	Tabs      []*tab
+	Downloads []*download
+}
+
+type examplePage struct {
+	Example  *catalog.Example
+	Title    string
+	Summary  string
+	Tags     []tag
+	Intro    template.HTML
+	Sections []*section
+	Files    []*download
+	Source   string // the example's directory on GitHub
+}
+
+type card struct {
+	Name      string
+	Title     string
+	Summary   string
+	Thumbnail string
+	Tags      []tag
+	Search    string // lowercase text matched by the search box
+	Materials string // "|"-separated, for the filters
+	Units     string
+	Languages string
+}
+
+type indexPage struct {
+	Cards     []*card
+	Materials []string
+	Units     []string
+	Languages []string
+}
+
+func (p *examplePage) card() *card {
+	ex := p.Example
+	// Titles such as "001-sphere (ball bearing)" repeat the name.
+	title := strings.TrimSpace(strings.TrimPrefix(p.Title, ex.Name))
+	if strings.HasPrefix(title, "(") && strings.HasSuffix(title, ")") {
+		title = title[1 : len(title)-1]
+	}
+	cd := &card{Name: ex.Name, Title: title, Summary: p.Summary, Tags: p.Tags}
+	if ex.Thumbnail != "" {
+		if strings.Contains(ex.Thumbnail, "://") {
+			cd.Thumbnail = offlineImageName
+		} else {
+			cd.Thumbnail = strings.TrimPrefix(ex.Thumbnail, "examples/")
+		}
+	}
+	words := []string{ex.Name, p.Title, p.Summary}
+	var materials, units, langs []string
+	for _, t := range p.Tags {
+		words = append(words, t.Value)
+		switch t.Kind {
+		case "material":
+			materials = append(materials, t.Value)
+		case "units":
+			units = append(units, t.Value)
+		case "language":
+			langs = append(langs, t.Value)
+		}
+	}
+	for _, sh := range ex.Shaders {
+		words = append(words, sh.Title, sh.Notes, path.Base(sh.Path))
+	}
+	cd.Search = strings.ToLower(strings.Join(words, " "))
+	cd.Materials = strings.Join(materials, "|")
+	cd.Units = strings.Join(units, "|")
+	cd.Languages = strings.Join(langs, "|")
+	return cd
+}
+
+// examplePage lays out the example's README: its title and intro, then
+// one section per "## file.irmf" section, with the README's snippet
+// replaced by the full sources of the shader and its twin. Shaders that
+// the README does not mention get sections of their own.
+func (s *site) examplePage(ex *catalog.Example) (*examplePage, error) {
+	p := &examplePage{Example: ex, Title: ex.Name, Source: strings.Replace(repoURL, "/blob/", "/tree/", 1) + ex.Path}
+	resolve := s.resolver(ex.Path, ex.Name)
+
+	var readme string
+	if ex.Readme != "" {
+		buf, err := os.ReadFile(filepath.Join(s.root, ex.Readme))
+		if err != nil {
+			return nil, err
+		}
+		readme = string(buf)
+		// The license is on every README; the site links to the repo instead.
+		if i := strings.Index(readme, "\n-----"); i >= 0 {
+			readme = readme[:i]
+		}
+	}
+	parts := strings.Split("\n"+readme, "\n## ")
+	intro := strings.TrimSpace(parts[0])
+	if strings.HasPrefix(intro, "# ") {
+		title, rest, _ := strings.Cut(intro, "\n")
+		p.Title, intro = strings.TrimSpace(title[2:]), rest
+	}
+	p.Intro = markdown(intro, resolve)
+	for _, para := range strings.Split(intro, "\n\n") {
+		if t := plainText(para); t != "" && !strings.HasPrefix(strings.TrimSpace(para), "```") {
+			p.Summary = t
+			break
+		}
+	}
+	for _, sh := range ex.Shaders {
+		if p.Summary == "" && sh.Language == "glsl" {
+			p.Summary = sh.Notes
+		}
+	}
+	if len(p.Summary) > maxSummary {
+		cut := strings.LastIndexByte(p.Summary[:maxSummary], ' ')
+		if cut < 0 {
+			cut = maxSummary
+		}
+		p.Summary = p.Summary[:cut] + " …"
+	}
+
+	byPath := map[string]*catalog.Shader{}
+	for _, sh := range ex.Shaders {
+		byPath[sh.Path] = sh
+	}
+	shown := map[string]bool{}
+	for _, part := range parts[1:] {
+		heading, body, _ := strings.Cut(part, "\n")
+		file := strings.Fields(heading + " ")[0]
+		sh := byPath[ex.Path+"/"+file]
+		sec := &section{ID: file, Heading: heading}
+		if sh == nil {
+			sec.Before = markdown(body, resolve)
+			p.Sections = append(p.Sections, sec)
+			continue
+		}
+		before, after := body, ""
+		if i := strings.Index(body, "```glsl"); i >= 0 {
+			before = body[:i]
+			if j := strings.Index(body[i+7:], "\n```"); j >= 0 {
+				after = body[i+7+j+4:]
+			}
+		}
+		// The full source is shown, so the note on the minified snippet
+		// does not apply.
+		after = minifiedRE.ReplaceAllString(after, "")
+		sec.Before, sec.After = markdown(before, resolve), markdown(after, resolve)
+		if err := s.addShaders(sec, sh, byPath, shown); err != nil {
+			return nil, err
+		}
+		p.Sections = append(p.Sections, sec)
+	}
+	for _, sh := range ex.Shaders {
+		if shown[sh.Path] {
+			continue
+		}
+		file := path.Base(sh.Path)
+		sec := &section{ID: file, Heading: file}
+		if sh.Title != "" {
+			sec.Before = markdown(sh.Title, resolve)
+		}
+		if sh.Thumbnail != "" {
+			sec.Before += markdown(fmt.Sprintf("![%v](%v)", file, strings.TrimPrefix(sh.Thumbnail, ex.Path+"/")), resolve)
+		}
+		if err := s.addShaders(sec, sh, byPath, shown); err != nil {
+			return nil, err
+		}
+		p.Sections = append(p.Sections, sec)
+	}
+
+	for _, f := range ex.Files {
+		p.Files = append(p.Files, &download{Name: path.Base(f.Path), Href: s.href(f.Path, ex.Name), Size: f.Size})
+	}
+
+	seen := map[string]bool{}
+	addTag := func(kind, value string) {
+		if value != "" && !seen[kind+":"+value] {
+			seen[kind+":"+value] = true
+			p.Tags = append(p.Tags, tag{Kind: kind, Value: value})
+		}
+	}
+	for _, sh := range ex.Shaders {
+		for _, m := range sh.Materials {
+			addTag("material", m)
+		}
+	}
+	for _, sh := range ex.Shaders {
+		addTag("units", sh.Units)
+	}
+	for _, lang := range []string{"glsl", "wgsl"} {
+		for _, sh := range ex.Shaders {
+			if sh.Language == lang {
+				addTag("language", lang)
+			}
+		}
+	}
+	return p, nil
+}
+
+// addShaders adds the tabs and downloads of the shader and its twin to
+// the section.
+func (s *site) addShaders(sec *section, sh *catalog.Shader, byPath map[string]*catalog.Shader, shown map[string]bool) error {
+	shaders := []*catalog.Shader{sh}
+	if twin := byPath[sh.Twin]; twin != nil {
+		shaders = append(shaders, twin)
+		if twin.Language == "glsl" {
+			shaders[0], shaders[1] = twin, sh
+		}
+	}
+	pageDir := path.Base(path.Dir(sh.Path))
+	for _, sh := range shaders {
+		shown[sh.Path] = true
+		t, err := s.tab(sh)
+		if err != nil {
+			return err
+		}
+		sec.Tabs = append(sec.Tabs, t)
+		sec.Downloads = append(sec.Downloads, &download{Name: path.Base(sh.Path), Href: s.href(sh.Path, pageDir), Size: sh.Size})
+		for _, f := range sh.Artifacts {
+			sec.Downloads = append(sec.Downloads, &download{Name: path.Base(f.Path), Href: s.href(f.Path, pageDir), Size: f.Size})
+		}
+	}
+	return nil
+}
+
+func (s *site) tab(sh *catalog.Shader) (*tab, error) {
+	m, err := irmf.ReadFile(filepath.Join(s.root, sh.Path))
+	if err != nil {
+		return nil, err
+	}
+	// Encoded shaders are shown decoded.
+	src := "/*" + m.Header + "*/\n" + m.Shader
+	t := &tab{Label: strings.ToUpper(sh.Language), Size: len(src), File: path.Base(sh.Path)}
+	if max := s.opts.MaxSource; max > 0 && len(src) > max {
+		if i := strings.LastIndexByte(src[:max], '\n'); i > 0 {
+			max = i + 1
+		}
+		src, t.Shown = src[:max], max
+	}
+	t.Code = highlight(sh.Language, src)
+	return t, nil
+}
+
+// highlight returns the HTML of the syntax-highlighted source.
+func highlight(lang, src string) template.HTML {
+	if lang != "glsl" && lang != "wgsl" {
+		return template.HTML(html.EscapeString(src))
+	}
+	var b strings.Builder
+	for _, span := range shader.Highlight(lang, src) {
+		if span.Class == "" {
+			b.WriteString(html.EscapeString(span.Text))
+			continue
+		}
+		fmt.Fprintf(&b, `<span class="hl-%v">%v</span>`, span.Class, html.EscapeString(span.Text))
+	}
+	return template.HTML(b.String())
+}
@@ -0,0 +1,212 @@
+package gallery
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+var (
+	commentRE  = regexp.MustCompile(`(?s)<!--.*?-->`)
+	headingRE  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	listItemRE = regexp.MustCompile(`^(\s*)[*-]\s+(.*)$`)
+	ruleRE     = regexp.MustCompile(`^-{3,}\s*$`)
+	imageMDRE  = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	linkMDRE   = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+)
+
+// resolver maps the targets of the links and images in the Markdown of
+// one directory to URLs in the site.
+type resolver struct {
+	// link returns the URL of a target.
+	link func(target string) string
+	// placeholder is the URL of the image shown instead of images that
+	// are not in the site (see offlineImage).
+	placeholder string
+	// inLink is set while rendering the text of a link.
+	inLink bool
+}
+
+// image returns the HTML of an image: a local copy, or the placeholder
+// linking to the original if the image is elsewhere (so that the site
+// loads nothing from other sites).
+func (r *resolver) image(target, alt string) string {
+	src := r.link(target)
+	if !strings.Contains(src, "://") {
+		return fmt.Sprintf(`<img src="%v" alt="%v" loading="lazy">`, html.EscapeString(src), html.EscapeString(alt))
+	}
+	img := fmt.Sprintf(`<img src="%v" alt="%v" title="%v" class="offline">`,
+		html.EscapeString(r.placeholder), html.EscapeString(alt), html.EscapeString("Not included in the gallery: "+src))
+	if r.inLink {
+		return img
+	}
+	return fmt.Sprintf(`<a href="%v">%v</a>`, html.EscapeString(src), img)
+}
+
+// markdown renders the subset of Markdown used by the example READMEs:
+// headings, paragraphs, "*" and "-" lists (nested by indentation),
+// fenced code blocks, rules, images, links, inline code, and emphasis.
+// HTML comments are dropped. The targets of links and images are passed
+// through resolve.
+func markdown(md string, resolve *resolver) template.HTML {
+	var b strings.Builder
+	var para []string
+	type item struct{ indent int }
+	var open []item // the indentation of each open list
+
+	flushPara := func() {
+		if len(para) > 0 {
+			fmt.Fprintf(&b, "<p>%v</p>\n", inline(strings.Join(para, "\n"), resolve))
+			para = nil
+		}
+	}
+	closeLists := func(indent int) {
+		for len(open) > 0 && open[len(open)-1].indent >= indent {
+			b.WriteString("</li></ul>\n")
+			open = open[:len(open)-1]
+		}
+	}
+
+	lines := strings.Split(commentRE.ReplaceAllString(md, ""), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flushPara()
+			closeLists(0)
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			fmt.Fprintf(&b, "<pre class=\"code\"><code>%v</code></pre>\n", highlight(lang, strings.Join(code, "\n")))
+		case trimmed == "":
+			flushPara()
+			// A blank line ends a list unless the list continues after it.
+			if len(open) > 0 && (i+1 >= len(lines) || !listItemRE.MatchString(lines[i+1])) {
+				closeLists(0)
+			}
+		case ruleRE.MatchString(trimmed) && len(para) == 0:
+			closeLists(0)
+			b.WriteString("<hr>\n")
+		case headingRE.MatchString(line):
+			flushPara()
+			closeLists(0)
+			m := headingRE.FindStringSubmatch(line)
+			fmt.Fprintf(&b, "<h%[1]v>%[2]v</h%[1]v>\n", len(m[1])+1, inline(m[2], resolve))
+		case listItemRE.MatchString(line):
+			flushPara()
+			m := listItemRE.FindStringSubmatch(line)
+			indent := len(m[1])
+			if len(open) > 0 && open[len(open)-1].indent > indent {
+				closeLists(indent + 1)
+			}
+			if len(open) > 0 && open[len(open)-1].indent == indent {
+				b.WriteString("</li>\n<li>")
+			} else {
+				b.WriteString("<ul>\n<li>")
+				open = append(open, item{indent: indent})
+			}
+			// Continuation lines belong to the item.
+			text := m[2]
+			for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" && !listItemRE.MatchString(lines[i+1]) &&
+				(lines[i+1][0] == ' ' || lines[i+1][0] == '\t') {
+				i++
+				text += "\n" + strings.TrimSpace(lines[i])
+			}
+			b.WriteString(string(inline(text, resolve)))
+		default:
+			if len(open) > 0 && len(para) == 0 {
+				closeLists(0)
+			}
+			para = append(para, trimmed)
+		}
+	}
+	flushPara()
+	closeLists(0)
+	return template.HTML(b.String())
+}
+
+// inline renders the inline Markdown of s.
+func inline(s string, resolve *resolver) template.HTML {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end >= 0 {
+				fmt.Fprintf(&b, "<code>%v</code>", html.EscapeString(rest[1:end+1]))
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(rest, "!["):
+			if text, target, n := linkAt(rest[1:]); n > 0 {
+				b.WriteString(resolve.image(target, text))
+				i += n + 1
+				continue
+			}
+		case rest[0] == '[':
+			if text, target, n := linkAt(rest); n > 0 {
+				nested := *resolve
+				nested.inLink = true
+				fmt.Fprintf(&b, `<a href="%v">%v</a>`, html.EscapeString(resolve.link(target)), inline(text, &nested))
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "**"):
+			if end := strings.Index(rest[2:], "**"); end > 0 {
+				fmt.Fprintf(&b, "<strong>%v</strong>", inline(rest[2:end+2], resolve))
+				i += end + 4
+				continue
+			}
+		case rest[0] == '*' && len(rest) > 1 && rest[1] != ' ':
+			if end := strings.IndexByte(rest[1:], '*'); end > 0 && rest[end] != ' ' && !strings.Contains(rest[1:end+1], "\n") {
+				fmt.Fprintf(&b, "<em>%v</em>", inline(rest[1:end+1], resolve))
+				i += end + 2
+				continue
+			}
+		}
+		b.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+	return template.HTML(b.String())
+}
+
+// linkAt parses "[text](target)" at the start of s (where the text may
+// itself contain brackets, as in "[![alt](src)](target)") and returns
+// its length, or 0.
+func linkAt(s string) (text, target string, n int) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth > 0 {
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return "", "", 0
+			}
+			end := strings.IndexByte(s[i+2:], ')')
+			if end < 0 {
+				return "", "", 0
+			}
+			return s[1:i], strings.TrimSpace(s[i+2 : i+2+end]), i + 3 + end
+		}
+	}
+	return "", "", 0
+}
+
+// plainText returns the text of the inline Markdown of s, such as for
+// the summary of an example.
+func plainText(s string) string {
+	s = commentRE.ReplaceAllString(s, "")
+	s = imageMDRE.ReplaceAllString(s, "")
+	s = linkMDRE.ReplaceAllString(s, "$1")
+	s = strings.NewReplacer("**", "", "*", "", "`", "").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,227 @@
+package gallery
+
+import (
+	"fmt"
+	"html/template"
+)
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"size": func(n int64) string {
+		switch {
+		case n >= 1<<20:
+			return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+		case n >= 1<<10:
+			return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+		}
+		return fmt.Sprintf("%v bytes", n)
+	},
+	"int64":     func(n int) int64 { return int64(n) },
+	"generator": func() template.HTML { return generator },
+}).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{generator}}
+<title>{{.}}</title>
+{{end}}
+
+{{define "tags"}}<ul class="tags">{{range .}}<li class="tag tag-{{.Kind}}">{{.Value}}</li>{{end}}</ul>{{end}}
+
+{{define "index"}}{{template "head" "IRMF Examples"}}<link rel="stylesheet" href="gallery.css">
+<script src="gallery.js" defer></script>
+</head>
+<body>
+<header>
+<h1>IRMF Examples</h1>
+<p>Models written as <a href="https://irmf.io">IRMF</a> shaders, from
+<a href="https://github.com/gmlewis/irmf-examples">github.com/gmlewis/irmf-examples</a>.</p>
+<form class="filters" role="search">
+<input type="search" id="search" placeholder="Search examples" aria-label="Search examples">
+<select id="material" aria-label="Material"><option value="">All materials</option>{{range .Materials}}<option>{{.}}</option>{{end}}</select>
+<select id="units" aria-label="Units"><option value="">All units</option>{{range .Units}}<option>{{.}}</option>{{end}}</select>
+<select id="language" aria-label="Language"><option value="">All languages</option>{{range .Languages}}<option>{{.}}</option>{{end}}</select>
+</form>
+</header>
+<main>
+<p id="count" aria-live="polite"></p>
+<ul class="cards">
+{{range .Cards}}<li class="card" data-search="{{.Search}}" data-material="{{.Materials}}" data-units="{{.Units}}" data-language="{{.Languages}}">
+<a href="{{.Name}}/">{{if .Thumbnail}}<img src="{{.Thumbnail}}" alt="" loading="lazy">{{else}}<span class="no-image"></span>{{end}}
+<h2>{{.Name}}</h2></a>
+{{if .Title}}<p class="title">{{.Title}}</p>{{end}}
+{{if .Summary}}<p class="summary">{{.Summary}}</p>{{end}}
+{{template "tags" .Tags}}
+</li>
+{{end}}</ul>
+</main>
+</body>
+</html>
+{{end}}
+
+{{define "example"}}{{template "head" (printf "%v - IRMF Examples" .Title)}}<link rel="stylesheet" href="../gallery.css">
+<script src="../gallery.js" defer></script>
+</head>
+<body>
+<header>
+<nav><a href="../">IRMF Examples</a> / {{.Example.Name}}</nav>
+<h1>{{.Title}}</h1>
+{{template "tags" .Tags}}
+</header>
+<main>
+<div class="readme">{{.Intro}}</div>
+{{range .Sections}}<section id="{{.ID}}">
+<h2><a href="#{{.ID}}">{{.Heading}}</a></h2>
+<div class="readme">{{.Before}}</div>
+{{if .Tabs}}<div class="tabs">
+<div class="tab-buttons" role="tablist">{{range $i, $t := .Tabs}}<button type="button" role="tab"{{if eq $i 0}} class="active"{{end}}>{{$t.Label}}</button>{{end}}</div>
+{{range $i, $t := .Tabs}}<div class="tab-panel" role="tabpanel"{{if ne $i 0}} hidden{{end}}>
+<pre class="code"><code>{{$t.Code}}</code></pre>
+{{if $t.Shown}}<p class="cut">Only the first {{size (int64 $t.Shown)}} of {{size (int64 $t.Size)}} are shown; download <a href="{{$t.File}}">{{$t.File}}</a> for the full source.</p>{{end}}
+</div>
+{{end}}</div>
+{{end}}
+<div class="readme">{{.After}}</div>
+{{if .Downloads}}<h3>Downloads</h3>
+<ul class="downloads">{{range .Downloads}}<li><a href="{{.Href}}" download>{{.Name}}</a> ({{size .Size}})</li>{{end}}</ul>
+{{end}}</section>
+{{end}}
+{{if .Files}}<section id="files">
+<h2>Other files</h2>
+<ul class="downloads">{{range .Files}}<li><a href="{{.Href}}" download>{{.Name}}</a> ({{size .Size}})</li>{{end}}</ul>
+</section>
+{{end}}
+</main>
+<footer><a href="{{.Source}}">{{.Example.Path}} on GitHub</a></footer>
+</body>
+</html>
+{{end}}
+`))
+
+const css = `:root {
+  --fg: #1f2328; --bg: #fff; --muted: #59636e; --border: #d1d9e0;
+  --code-bg: #f6f8fa; --accent: #0969da;
+  --comment: #6e7781; --string: #0a3069; --number: #0550ae; --keyword: #cf222e;
+  --type: #8250df; --builtin: #953800; --preproc: #116329; --attr: #116329;
+}
+@media (prefers-color-scheme: dark) {
+  :root {
+    --fg: #e6edf3; --bg: #0d1117; --muted: #9198a1; --border: #3d444d;
+    --code-bg: #151b23; --accent: #4493f8;
+    --comment: #9198a1; --string: #a5d6ff; --number: #79c0ff; --keyword: #ff7b72;
+    --type: #d2a8ff; --builtin: #ffa657; --preproc: #7ee787; --attr: #7ee787;
+  }
+}
+* { box-sizing: border-box; }
+body { margin: 0 auto; max-width: 72rem; padding: 0 1rem 2rem; color: var(--fg); background: var(--bg);
+  font: 16px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; }
+a { color: var(--accent); }
+header { border-bottom: 1px solid var(--border); padding: 1rem 0; }
+h1 { margin: 0.25rem 0; }
+nav, footer, .summary, #count { color: var(--muted); }
+footer { border-top: 1px solid var(--border); margin-top: 2rem; padding-top: 1rem; }
+img { max-width: 100%; height: auto; }
+.filters { display: flex; flex-wrap: wrap; gap: 0.5rem; }
+.filters input { flex: 1 1 16rem; }
+.filters input, .filters select { font: inherit; padding: 0.35rem 0.5rem; color: inherit; background: var(--bg);
+  border: 1px solid var(--border); border-radius: 6px; }
+.cards { list-style: none; padding: 0; display: grid; gap: 1rem; grid-template-columns: repeat(auto-fill, minmax(16rem, 1fr)); }
+.card { border: 1px solid var(--border); border-radius: 8px; padding: 0.75rem; }
+.card > a { text-decoration: none; }
+.card img, .card .no-image { display: block; width: 100%; aspect-ratio: 4 / 3; object-fit: contain; background: var(--code-bg); border-radius: 4px; }
+.card h2 { font-size: 1.1rem; margin: 0.5rem 0 0; }
+.card p { margin: 0.25rem 0; }
+.tags { list-style: none; padding: 0; margin: 0.5rem 0; display: flex; flex-wrap: wrap; gap: 0.25rem; }
+.tag { font-size: 0.8rem; padding: 0 0.5rem; border: 1px solid var(--border); border-radius: 1rem; }
+.tag-units { border-color: var(--number); }
+.tag-language { border-color: var(--type); }
+section { margin-top: 2rem; }
+section h2 a { color: inherit; text-decoration: none; }
+pre.code { background: var(--code-bg); border-radius: 6px; padding: 0.75rem; overflow: auto; max-height: 40rem;
+  font: 13px/1.45 ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; }
+.tab-buttons { display: flex; gap: 0.25rem; }
+.tab-buttons button { font: inherit; color: inherit; background: none; border: 1px solid var(--border);
+  border-bottom: none; border-radius: 6px 6px 0 0; padding: 0.25rem 0.75rem; cursor: pointer; }
+.tab-buttons button.active { background: var(--code-bg); font-weight: 600; }
+.tabs pre.code { margin-top: 0; border-top-left-radius: 0; }
+.cut { color: var(--muted); font-size: 0.9rem; }
+.hl-comment { color: var(--comment); font-style: italic; }
+.hl-string { color: var(--string); }
+.hl-number { color: var(--number); }
+.hl-keyword { color: var(--keyword); }
+.hl-type { color: var(--type); }
+.hl-builtin { color: var(--builtin); }
+.hl-preproc, .hl-attr { color: var(--preproc); }
+img.offline { max-width: 24rem; }
+`
+
+// offlineImageName is the file holding offlineImage in the site.
+const offlineImageName = "offline-image.svg"
+
+// offlineImage is shown instead of the images that the READMEs load from
+// other sites.
+const offlineImage = `<svg xmlns="http://www.w3.org/2000/svg" width="320" height="240" viewBox="0 0 320 240">
+<rect width="320" height="240" fill="#8c959f" fill-opacity="0.15"/>
+<g fill="none" stroke="#8c959f" stroke-width="6" stroke-linejoin="round">
+<rect x="110" y="60" width="100" height="80" rx="6"/>
+<path d="M116 132l30-34 22 22 14-14 22 26"/>
+</g>
+<circle cx="186" cy="84" r="9" fill="#8c959f"/>
+<text x="160" y="184" fill="#8c959f" font-family="sans-serif" font-size="16" text-anchor="middle">Image not available offline</text>
+</svg>
+`
+
+const js = `// Tabs on the example pages.
+document.querySelectorAll(".tabs").forEach(function (tabs) {
+  var buttons = tabs.querySelectorAll(".tab-buttons button");
+  var panels = tabs.querySelectorAll(".tab-panel");
+  buttons.forEach(function (button, i) {
+    button.addEventListener("click", function () {
+      buttons.forEach(function (b, j) { b.classList.toggle("active", i === j); });
+      panels.forEach(function (p, j) { p.hidden = i !== j; });
+    });
+  });
+});
+
+// Search and filters on the index page, kept in the URL's query so that
+// filtered views can be bookmarked.
+(function () {
+  var search = document.getElementById("search");
+  if (!search) {
+    return;
+  }
+  var filters = ["material", "units", "language"].map(function (id) { return document.getElementById(id); });
+  var cards = document.querySelectorAll(".card");
+  var count = document.getElementById("count");
+  var params = new URLSearchParams(location.search);
+  search.value = params.get("q") || "";
+  filters.forEach(function (f) { f.value = params.get(f.id) || ""; });
+
+  function update() {
+    var words = search.value.toLowerCase().split(/\s+/).filter(Boolean);
+    var shown = 0;
+    cards.forEach(function (card) {
+      var ok = words.every(function (w) { return card.dataset.search.indexOf(w) >= 0; }) &&
+        filters.every(function (f) { return !f.value || card.dataset[f.id].split("|").indexOf(f.value) >= 0; });
+      card.hidden = !ok;
+      if (ok) {
+        shown++;
+      }
+    });
+    count.textContent = shown === cards.length ? cards.length + " examples" : shown + " of " + cards.length + " examples";
+    var q = new URLSearchParams();
+    if (search.value) {
+      q.set("q", search.value);
+    }
+    filters.forEach(function (f) { if (f.value) { q.set(f.id, f.value); } });
+    history.replaceState(null, "", q.toString() ? "?" + q : location.pathname);
+  }
+
+  search.addEventListener("input", update);
+  filters.forEach(function (f) { f.addEventListener("change", update); });
+  document.querySelector(".filters").addEventListener("submit", function (e) { e.preventDefault(); });
+  update();
+})();
+`
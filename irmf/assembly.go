@@ -0,0 +1,432 @@
+package irmf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+// Assembly describes a model made of other IRMF models (see Compose),
+// as read from a JSON file such as:
+//
+//	{
+//	  "title": "Sphere on a cube",
+//	  "materials": ["PLA", "copper"],
+//	  "parts": [
+//	    {"file": "../002-cube/cube-1.irmf"},
+//	    {"file": "../001-sphere/sphere-1.irmf", "translate": [0, 0, 10],
+//	     "materials": {"AISI 1018 steel": "copper"}, "priority": 1}
+//	  ]
+//	}
+type Assembly struct {
+	Title string `json:"title,omitempty"`
+	// Language is "glsl" or "wgsl"; all parts must be written in it. The
+	// default is the language of the first part.
+	Language string `json:"language,omitempty"`
+	// Units defaults to the units of the first part; parts in other units
+	// are converted.
+	Units string `json:"units,omitempty"`
+	// Materials lists the assembly's materials in channel order. The
+	// default is every material of the parts in order of priority.
+	Materials []string `json:"materials,omitempty"`
+	// Overflow says what to do when the parts need more than the 4
+	// material channels of mainModel4: "error" (the default) rejects the
+	// assembly and "priority" keeps the materials of the parts with the
+	// highest priority (in the order of Materials, if given), leaving the
+	// other materials out.
+	Overflow string `json:"overflow,omitempty"`
+	Parts    []Part `json:"parts"`
+}
+
+// Part is one model of an Assembly. It is scaled, then rotated (by
+// Euler angles, an axis and angle, or a matrix), then translated.
+type Part struct {
+	// File is relative to the directory of the assembly, unless absolute.
+	File string `json:"file"`
+	// Materials maps the part's material names to the assembly's; names
+	// that are not listed are kept and names mapped to "" are left out.
+	Materials map[string]string `json:"materials,omitempty"`
+	// Priority decides which part's materials fill a point where parts
+	// overlap (higher first, then in order of listing).
+	Priority int `json:"priority,omitempty"`
+
+	Scale     []float64 `json:"scale,omitempty"`  // one factor or one per axis
+	Rotate    []float64 `json:"rotate,omitempty"` // degrees about X, then Y, then Z
+	Axis      []float64 `json:"axis,omitempty"`   // with Angle
+	Angle     float64   `json:"angle,omitempty"`  // degrees
+	Matrix    []float64 `json:"matrix,omitempty"` // row-major 3x3
+	Translate []float64 `json:"translate,omitempty"`
+}
+
+// ReadAssembly reads an assembly description.
+func ReadAssembly(filename string) (*Assembly, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	a := &Assembly{}
+	if err := json.Unmarshal(buf, a); err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	if len(a.Parts) == 0 {
+		return nil, fmt.Errorf("%v: no parts", filename)
+	}
+	return a, nil
+}
+
+// Transform returns the part's transform.
+func (p *Part) Transform() (Affine, error) {
+	a := Identity
+	vector := func(name string, v []float64, n int) error {
+		if len(v) != n {
+			return fmt.Errorf("%v needs %v values, got %v", name, n, len(v))
+		}
+		return nil
+	}
+	switch len(p.Scale) {
+	case 0:
+	case 1:
+		a = Scaling([3]float64{p.Scale[0], p.Scale[0], p.Scale[0]})
+	default:
+		if err := vector("scale", p.Scale, 3); err != nil {
+			return a, err
+		}
+		a = Scaling([3]float64(p.Scale))
+	}
+	rotations := 0
+	if len(p.Rotate) > 0 {
+		rotations++
+		if err := vector("rotate", p.Rotate, 3); err != nil {
+			return a, err
+		}
+		a = a.Then(EulerRotation(p.Rotate[0], p.Rotate[1], p.Rotate[2]))
+	}
+	if len(p.Axis) > 0 {
+		rotations++
+		if err := vector("axis", p.Axis, 3); err != nil {
+			return a, err
+		}
+		r, err := Rotation([3]float64(p.Axis), p.Angle)
+		if err != nil {
+			return a, err
+		}
+		a = a.Then(r)
+	} else if p.Angle != 0 {
+		return a, errors.New("angle needs an axis")
+	}
+	if len(p.Matrix) > 0 {
+		rotations++
+		if err := vector("matrix", p.Matrix, 9); err != nil {
+			return a, err
+		}
+		var r Affine
+		for i := range r.M {
+			r.M[i] = [3]float64(p.Matrix[3*i : 3*i+3])
+		}
+		a = a.Then(r)
+	}
+	if rotations > 1 {
+		return a, errors.New("only one of rotate, axis, and matrix may be used")
+	}
+	if len(p.Translate) > 0 {
+		if err := vector("translate", p.Translate, 3); err != nil {
+			return a, err
+		}
+		a = a.Then(Translation([3]float64(p.Translate)))
+	}
+	if _, err := a.Inverse(); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+// assemblyPart is a part ready to be composed.
+type assemblyPart struct {
+	*Part
+	index    int // 1-based, in order of listing
+	model    *Model
+	affine   Affine
+	channels []int // assembly channel of each material, or -1
+}
+
+// Compose returns the IRMF source of the assembly a, whose part files are
+// relative to dir, and warnings about materials left out. Each part's
+// #includes are expanded (using fetch, if not nil, for network includes)
+// and its top-level names are prefixed with "pN_", where N is its
+// position in the list. The new mainModel4 evaluates the parts in order
+// of priority; each part fills only what the parts before it left empty.
+// The bounding box is the union of the parts' transformed boxes. The
+// result is in canonical form (see Format).
+func Compose(a *Assembly, dir string, fetch func(url string) ([]byte, error)) ([]byte, []string, error) {
+	var parts []*assemblyPart
+	for i := range a.Parts {
+		p := &assemblyPart{Part: &a.Parts[i], index: i + 1}
+		filename := p.File
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(dir, filename)
+		}
+		m, err := ReadFile(filename)
+		if err == nil {
+			err = m.ExpandIncludes(filename, fetch)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(m.Materials) > 4 {
+			return nil, nil, fmt.Errorf("part %v (%v): only parts with up to 4 materials are supported", p.index, p.File)
+		}
+		p.model = m
+		if p.affine, err = p.Part.Transform(); err != nil {
+			return nil, nil, fmt.Errorf("part %v (%v): %v", p.index, p.File, err)
+		}
+		parts = append(parts, p)
+	}
+
+	lang := a.Language
+	if lang == "" {
+		lang = parts[0].model.Lang()
+	}
+	units := a.Units
+	if units == "" {
+		units = parts[0].model.Units
+	}
+	to, err := UnitLength(units)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, p := range parts {
+		if p.model.Lang() != lang {
+			return nil, nil, fmt.Errorf("part %v (%v) is written in %v, not %v", p.index, p.File, p.model.Lang(), lang)
+		}
+		from, err := UnitLength(p.model.Units)
+		if err != nil {
+			return nil, nil, fmt.Errorf("part %v (%v): %v", p.index, p.File, err)
+		}
+		if from != to {
+			s := from / to
+			p.affine = Scaling([3]float64{s, s, s}).Then(p.affine)
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].Priority > parts[j].Priority })
+
+	materials, warnings, err := a.assignChannels(parts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	min := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	max := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	var body strings.Builder
+	for _, p := range listingOrder(parts) {
+		pmin, pmax := p.affine.Box(p.model)
+		for i := range min {
+			min[i] = math.Min(min[i], pmin[i])
+			max[i] = math.Max(max[i], pmax[i])
+		}
+		prefix := fmt.Sprintf("p%v_", p.index)
+		src, err := shader.RenameGlobals(lang, p.model.Shader, func(name string) string { return prefix + name })
+		if err != nil {
+			return nil, nil, fmt.Errorf("part %v (%v): %v", p.index, p.File, err)
+		}
+		fmt.Fprintf(&body, "\n// Part %v: %v\n%v\n", p.index, filepath.ToSlash(p.File), strings.Trim(src, "\n"))
+	}
+	body.WriteString(composeMain(lang, parts))
+
+	header := []string{`  "irmf": "1.0"`}
+	if lang != "glsl" {
+		header = append(header, `  "language": `+quote(lang))
+	}
+	var names []string
+	for _, name := range materials {
+		names = append(names, quote(name))
+	}
+	header = append(header,
+		`  "materials": [`+strings.Join(names, ",")+`]`,
+		`  "max": `+formatVector(max),
+		`  "min": `+formatVector(min),
+		`  "notes": "Assembled by irmf-assemble."`)
+	if a.Title != "" {
+		header = append(header, `  "title": `+quote(a.Title))
+	}
+	header = append(header, `  "units": `+quote(units))
+	out, err := Format([]byte("/*{\n" + strings.Join(header, ",\n") + "\n}*/\n" + body.String()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("assembled file is invalid: %v", err)
+	}
+	m, err := Parse(out)
+	if err != nil {
+		return nil, nil, fmt.Errorf("assembled file is invalid: %v", err)
+	}
+	if _, err := m.Compile(); err != nil {
+		return nil, nil, fmt.Errorf("assembled shader: %v", err)
+	}
+	return out, warnings, nil
+}
+
+// assignChannels maps each part's materials to assembly channels and
+// returns the assembly's materials.
+func (a *Assembly) assignChannels(parts []*assemblyPart) ([]string, []string, error) {
+	// Every material needed, in order of priority.
+	var needed []string
+	seen := map[string]bool{}
+	for _, p := range parts {
+		own := map[string]bool{}
+		for _, name := range p.model.Materials {
+			own[name] = true
+		}
+		var unknown []string
+		for name := range p.Materials {
+			if !own[name] {
+				unknown = append(unknown, strconv.Quote(name))
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return nil, nil, fmt.Errorf("part %v (%v): cannot map %v: the part's materials are %q",
+				p.index, p.File, strings.Join(unknown, ", "), p.model.Materials)
+		}
+		for _, name := range p.model.Materials {
+			if mapped, ok := p.Materials[name]; ok {
+				name = mapped
+			}
+			if name != "" && !seen[name] {
+				seen[name] = true
+				needed = append(needed, name)
+			}
+		}
+	}
+
+	materials := a.Materials
+	if materials == nil {
+		materials = needed
+	} else {
+		listed := map[string]bool{}
+		for _, name := range materials {
+			listed[name] = true
+		}
+		for _, name := range needed {
+			if !listed[name] {
+				return nil, nil, fmt.Errorf("material %q is not listed in the assembly's materials", name)
+			}
+		}
+	}
+	var warnings []string
+	if len(materials) > 4 {
+		if a.Overflow != "priority" {
+			return nil, nil, fmt.Errorf("assembly needs %v material channels but mainModel4 has only 4 (%v); map some materials to others or set \"overflow\" to \"priority\"",
+				len(materials), strings.Join(materials, ", "))
+		}
+		// Keep the materials of the parts with the highest priority (in
+		// the order listed), then any listed materials no part uses.
+		rank := map[string]int{}
+		for i, name := range needed {
+			rank[name] = i
+		}
+		ranked := append([]string(nil), materials...)
+		sort.SliceStable(ranked, func(i, j int) bool {
+			ri, ok := rank[ranked[i]]
+			if !ok {
+				ri = len(needed)
+			}
+			rj, ok := rank[ranked[j]]
+			if !ok {
+				rj = len(needed)
+			}
+			return ri < rj
+		})
+		keep := map[string]bool{}
+		for _, name := range ranked[:4] {
+			keep[name] = true
+		}
+		var kept, dropped []string
+		for _, name := range materials {
+			if keep[name] {
+				kept = append(kept, name)
+			} else {
+				dropped = append(dropped, name)
+			}
+		}
+		warnings = append(warnings, fmt.Sprintf("leaving out materials %v, which do not fit in mainModel4", strings.Join(dropped, ", ")))
+		materials = kept
+	}
+
+	channel := map[string]int{}
+	for i, name := range materials {
+		channel[name] = i
+	}
+	for _, p := range parts {
+		p.channels = make([]int, len(p.model.Materials))
+		for i, name := range p.model.Materials {
+			if mapped, ok := p.Materials[name]; ok {
+				name = mapped
+			}
+			c, ok := channel[name]
+			if !ok {
+				c = -1
+			}
+			p.channels[i] = c
+		}
+	}
+	return materials, warnings, nil
+}
+
+// composeMain returns the assembly's entry point, which evaluates the
+// parts (in order of priority) at their untransformed positions when
+// those are within the parts' bounding boxes.
+func composeMain(lang string, parts []*assemblyPart) string {
+	var sb strings.Builder
+	vec3 := "vec3"
+	if lang == "wgsl" {
+		vec3 = "vec3f"
+		sb.WriteString("\nfn mainModel4(xyz: vec3f) -> vec4f {\n  var materials = vec4f(0.0);\n  var occupied = 0.0;\n  var m = vec4f(0.0);\n  var pos = vec3f(0.0);\n")
+	} else {
+		sb.WriteString("\nvoid mainModel4(out vec4 materials, in vec3 xyz) {\n  materials = vec4(0.0);\n  float occupied = 0.0;\n  vec4 m;\n  vec3 pos;\n")
+	}
+	for _, p := range parts {
+		inv, _ := p.affine.Inverse() // checked by Part.Transform
+		fmt.Fprintf(&sb, "\n  // Part %v (priority %v): %v\n", p.index, p.Priority, filepath.ToSlash(p.File))
+		fmt.Fprintf(&sb, "  pos = %v;\n", p.affine.undoExpr(inv, lang))
+		// Each part is only defined within its own bounding box.
+		lo := fmt.Sprintf("%v(%v, %v, %v)", vec3, shaderFloat(p.model.Min[0]), shaderFloat(p.model.Min[1]), shaderFloat(p.model.Min[2]))
+		hi := fmt.Sprintf("%v(%v, %v, %v)", vec3, shaderFloat(p.model.Max[0]), shaderFloat(p.model.Max[1]), shaderFloat(p.model.Max[2]))
+		if lang == "wgsl" {
+			fmt.Fprintf(&sb, "  if (all(pos >= %v) && all(pos <= %v)) {\n", lo, hi)
+			fmt.Fprintf(&sb, "    m = clamp(p%v_%v(pos), vec4f(0.0), vec4f(1.0)) * (1.0 - occupied);\n", p.index, p.model.MainFunc())
+		} else {
+			fmt.Fprintf(&sb, "  if (all(greaterThanEqual(pos, %v)) && all(lessThanEqual(pos, %v))) {\n", lo, hi)
+			fmt.Fprintf(&sb, "    p%v_%v(m, pos);\n", p.index, p.model.MainFunc())
+			sb.WriteString("    m = clamp(m, 0.0, 1.0) * (1.0 - occupied);\n")
+		}
+		var used []string
+		for i, c := range p.channels {
+			if c >= 0 {
+				fmt.Fprintf(&sb, "    materials[%v] += m[%v];\n", c, i)
+				used = append(used, fmt.Sprintf("m[%v]", i))
+			}
+		}
+		if len(used) > 0 {
+			fmt.Fprintf(&sb, "    occupied = min(1.0, occupied + %v);\n", strings.Join(used, " + "))
+		}
+		sb.WriteString("  }\n")
+	}
+	if lang == "wgsl" {
+		sb.WriteString("  return materials;\n")
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// listingOrder returns the parts in the order they were listed.
+func listingOrder(parts []*assemblyPart) []*assemblyPart {
+	sorted := append([]*assemblyPart(nil), parts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].index < sorted[j].index })
+	return sorted
+}
@@ -0,0 +1,102 @@
+package irmf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestComposeChannels(t *testing.T) {
+	const sphere = "../examples/001-sphere/sphere-1.irmf" // AISI 1018 steel
+	const cube = "../examples/002-cube/cube-1.irmf"       // PLA
+	// spheres returns parts mapping the sphere's material to each name,
+	// with decreasing priority.
+	spheres := func(names ...string) []Part {
+		var parts []Part
+		for i, name := range names {
+			parts = append(parts, Part{
+				File:      sphere,
+				Materials: map[string]string{"AISI 1018 steel": name},
+				Priority:  len(names) - i,
+				Translate: []float64{float64(20 * i), 0, 0},
+			})
+		}
+		return parts
+	}
+
+	tests := []struct {
+		name      string
+		a         Assembly
+		want      []string
+		wantWarn  string
+		wantError string
+	}{
+		{
+			name: "default order",
+			a:    Assembly{Parts: []Part{{File: cube}, {File: sphere, Priority: 1}}},
+			want: []string{"AISI 1018 steel", "PLA"},
+		},
+		{
+			name: "mapped",
+			a:    Assembly{Parts: []Part{{File: cube}, {File: sphere, Materials: map[string]string{"AISI 1018 steel": "PLA"}}}},
+			want: []string{"PLA"},
+		},
+		{
+			name:      "unknown material mapped",
+			a:         Assembly{Parts: []Part{{File: cube, Materials: map[string]string{"AISI 1018 steel": "PLA"}}}},
+			wantError: `part 1 (../examples/002-cube/cube-1.irmf): cannot map "AISI 1018 steel": the part's materials are ["PLA"]`,
+		},
+		{
+			name:      "not listed",
+			a:         Assembly{Materials: []string{"PLA"}, Parts: []Part{{File: cube}, {File: sphere}}},
+			wantError: `material "AISI 1018 steel" is not listed`,
+		},
+		{
+			name:      "overflow",
+			a:         Assembly{Parts: spheres("A", "B", "C", "D", "E")},
+			wantError: "assembly needs 5 material channels",
+		},
+		{
+			name:     "overflow by priority",
+			a:        Assembly{Overflow: "priority", Parts: spheres("A", "B", "C", "D", "E")},
+			want:     []string{"A", "B", "C", "D"},
+			wantWarn: "leaving out materials E,",
+		},
+		{
+			name:     "overflow by priority with a list",
+			a:        Assembly{Overflow: "priority", Materials: []string{"E", "D", "C", "B", "A"}, Parts: spheres("A", "B", "C", "D", "E")},
+			want:     []string{"D", "C", "B", "A"},
+			wantWarn: "leaving out materials E,",
+		},
+		{
+			name:     "overflow with unused listed materials",
+			a:        Assembly{Overflow: "priority", Materials: []string{"X", "C", "B", "Y", "A"}, Parts: spheres("A", "B", "C")},
+			want:     []string{"X", "C", "B", "A"},
+			wantWarn: "leaving out materials Y,",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, warnings, err := Compose(&tt.a, ".", nil)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Compose error = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compose: %v", err)
+			}
+			m, err := Parse(out)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if fmt.Sprint(m.Materials) != fmt.Sprint(tt.want) {
+				t.Errorf("materials = %q, want %q", m.Materials, tt.want)
+			}
+			if got := strings.Join(warnings, "\n"); tt.wantWarn == "" && got != "" || !strings.Contains(got, tt.wantWarn) {
+				t.Errorf("warnings = %q, want %q", got, tt.wantWarn)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package irmf
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+// Faces of a bounding box, in the order used by Bounds.Clipped.
+var Faces = [6]string{"-x", "+x", "-y", "+y", "-z", "+z"}
+
+// Bounds describes where a model actually puts material relative to the
+// bounding box declared in its header.
+type Bounds struct {
+	// Empty is true if no material was found at all.
+	Empty bool
+	// Min and Max enclose every lattice point holding material. The true
+	// surface may lie up to Step beyond them.
+	Min, Max [3]float64
+	// Step is the lattice spacing along each axis.
+	Step [3]float64
+	// Clipped reports material beyond each face of the declared box,
+	// which a slicer would cut off. See Faces for the order.
+	Clipped [6]bool
+	// Touching reports material covering part of a face (at least one
+	// lattice cell of the samples on the face itself) but not beyond it.
+	// This happens when the shader itself cuts the model off at the box,
+	// but also for boxes that fit flat sides exactly. A model that only
+	// grazes a face, like a sphere in a box that fits it exactly, is not
+	// reported.
+	Touching [6]bool
+	// DeclaredMin and DeclaredMax are the box declared in the header.
+	DeclaredMin, DeclaredMax [3]float64
+}
+
+// CheckBounds samples p on a lattice with n cells along the longest side
+// of m's box, extended by the fraction grow of the box size on every side
+// so that material outside the box can be found. The lattice planes fall
+// exactly on the declared faces. A point holds material if any channel
+// is at least iso. workers is as for Sample.
+func CheckBounds(p *shader.Program, m *Model, n int, grow, iso float64, workers int) (*Bounds, error) {
+	if n < 1 || grow < 0 {
+		return nil, fmt.Errorf("need at least 1 cell and a non-negative grow fraction, got %v and %v", n, grow)
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	b := &Bounds{}
+	var size [3]float64
+	longest := 0.0
+	for i := range size {
+		size[i] = m.Max[i] - m.Min[i]
+		b.DeclaredMin[i], b.DeclaredMax[i] = m.Min[i], m.Max[i]
+		longest = math.Max(longest, size[i])
+	}
+	var cells, extra, num [3]int
+	for i := range cells {
+		cells[i] = max(1, int(math.Round(float64(n)*size[i]/longest)))
+		extra[i] = int(math.Ceil(grow * float64(cells[i])))
+		num[i] = cells[i] + 2*extra[i] + 1
+		b.Step[i] = size[i] / float64(cells[i])
+	}
+	coord := func(axis, i int) float64 {
+		return m.Min[axis] + float64(i-extra[axis])*b.Step[axis]
+	}
+
+	// lo and hi are the occupied index ranges found in each z slab.
+	type slab struct {
+		found  bool
+		lo, hi [3]int
+	}
+	slabs := make([]slab, num[2])
+	numMaterials := len(m.Materials)
+	ks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e := p.NewEvaluator()
+			out := make([]float64, p.NumMaterials())
+			for k := range ks {
+				s := &slabs[k]
+				for j := 0; j < num[1]; j++ {
+					for i := 0; i < num[0]; i++ {
+						e.Eval(coord(0, i), coord(1, j), coord(2, k), out)
+						if !hasMaterial(out[:numMaterials], iso) {
+							continue
+						}
+						idx := [3]int{i, j, k}
+						if !s.found {
+							s.found, s.lo, s.hi = true, idx, idx
+							continue
+						}
+						for a := range idx {
+							s.lo[a] = min(s.lo[a], idx[a])
+							s.hi[a] = max(s.hi[a], idx[a])
+						}
+					}
+				}
+			}
+		}()
+	}
+	for k := 0; k < num[2]; k++ {
+		ks <- k
+	}
+	close(ks)
+	wg.Wait()
+
+	var lo, hi [3]int
+	b.Empty = true
+	for _, s := range slabs {
+		if !s.found {
+			continue
+		}
+		if b.Empty {
+			b.Empty, lo, hi = false, s.lo, s.hi
+			continue
+		}
+		for a := range lo {
+			lo[a] = min(lo[a], s.lo[a])
+			hi[a] = max(hi[a], s.hi[a])
+		}
+	}
+	if b.Empty {
+		return b, nil
+	}
+	// faceCovered reports whether the samples in the plane where the
+	// given axis has index k hold material at all four corners of at
+	// least one lattice cell.
+	e := p.NewEvaluator()
+	out := make([]float64, p.NumMaterials())
+	faceCovered := func(axis, k int) bool {
+		u, v := (axis+1)%3, (axis+2)%3
+		prev := make([]bool, num[u])
+		row := make([]bool, num[u])
+		for j := 0; j < num[v]; j++ {
+			for i := 0; i < num[u]; i++ {
+				var idx [3]int
+				idx[axis], idx[u], idx[v] = k, i, j
+				e.Eval(coord(0, idx[0]), coord(1, idx[1]), coord(2, idx[2]), out)
+				row[i] = hasMaterial(out[:numMaterials], iso)
+				if i > 0 && j > 0 && row[i] && row[i-1] && prev[i] && prev[i-1] {
+					return true
+				}
+			}
+			prev, row = row, prev
+		}
+		return false
+	}
+
+	for a := range lo {
+		b.Min[a], b.Max[a] = coord(a, lo[a]), coord(a, hi[a])
+		b.Clipped[2*a] = lo[a] < extra[a]
+		b.Clipped[2*a+1] = hi[a] > extra[a]+cells[a]
+		b.Touching[2*a] = lo[a] == extra[a] && faceCovered(a, lo[a])
+		b.Touching[2*a+1] = hi[a] == extra[a]+cells[a] && faceCovered(a, hi[a])
+	}
+	return b, nil
+}
+
+func hasMaterial(values []float64, iso float64) bool {
+	for _, v := range values {
+		if v >= iso {
+			return true
+		}
+	}
+	return false
+}
+
+// Tight returns a bounding box around the material found, grown by one
+// lattice step (where the true surface may lie) plus margin and rounded
+// outward to a tenth of the lattice step's order of magnitude. Unless
+// the declared box clips the material, the material stops at its faces,
+// so no side is grown more than margin past them: where the material
+// reaches a declared face, that face is kept (plus margin).
+func (b *Bounds) Tight(margin float64) (min, max [3]float64) {
+	for a := range min {
+		unit := math.Pow(10, math.Floor(math.Log10(b.Step[a]))-1)
+		min[a] = math.Floor((b.Min[a]-b.Step[a]-margin)/unit) * unit
+		max[a] = math.Ceil((b.Max[a]+b.Step[a]+margin)/unit) * unit
+		if !b.Clipped[2*a] {
+			min[a] = math.Max(min[a], b.DeclaredMin[a]-margin)
+		}
+		if !b.Clipped[2*a+1] {
+			max[a] = math.Min(max[a], b.DeclaredMax[a]+margin)
+		}
+		// Strip floating point noise such as 1.2000000000000002.
+		min[a], _ = strconv.ParseFloat(strconv.FormatFloat(min[a], 'g', 12, 64), 64)
+		max[a], _ = strconv.ParseFloat(strconv.FormatFloat(max[a], 'g', 12, 64), 64)
+	}
+	return min, max
+}
+
+// BoundConstant is a bounding box constant declared in a shader body,
+// such as "const MIN_BOUND = vec3f(...);".
+type BoundConstant struct {
+	Name string
+	// Line is the line number in the IRMF file (or in the decoded shader
+	// if it is encoded).
+	Line  int
+	IsMax bool
+	Value [3]float64
+}
+
+var boundConstantRE = regexp.MustCompile(`(?m)^[ \t]*(?:#define[ \t]+|(?:const|let|var)[ \t]+(?:vec3[ \t]+)?)` +
+	`(\w*(?:MIN|MAX)_?(?:BOUNDS?|BBOX|BOX)\w*)[ \t]*(?::[ \t]*vec3\w*(?:<f32>)?[ \t]*)?=?[ \t]*` +
+	`vec3f?(?:<f32>)?\(([^()]*)\)`)
+
+// BoundConstants returns the bounding box constants declared in the
+// shader whose three components are numeric literals.
+func (m *Model) BoundConstants() []BoundConstant {
+	var result []BoundConstant
+	offset := 0
+	if m.Encoding == "" {
+		offset = strings.Count(m.Header, "\n") + 1
+	}
+	for _, match := range boundConstantRE.FindAllStringSubmatchIndex(m.Shader, -1) {
+		name := m.Shader[match[2]:match[3]]
+		args := strings.Split(m.Shader[match[4]:match[5]], ",")
+		c := BoundConstant{
+			Name:  name,
+			Line:  offset + strings.Count(m.Shader[:match[0]], "\n") + 1,
+			IsMax: strings.Contains(strings.ToUpper(name), "MAX"),
+		}
+		ok := len(args) == 1 || len(args) == 3
+		for i := 0; ok && i < len(c.Value); i++ {
+			arg := args[min(i, len(args)-1)] // vec3(x) broadcasts
+			v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(arg), "f"), 64)
+			c.Value[i], ok = v, err == nil
+		}
+		if ok {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// SetBounds returns the IRMF source src with the "min" and "max" values
+// of its header replaced and the header in canonical form (see Format),
+// leaving the shader untouched.
+func SetBounds(src []byte, min, max [3]float64) ([]byte, error) {
+	return setHeader(src, map[string]string{"min": formatVector(min), "max": formatVector(max)})
+}
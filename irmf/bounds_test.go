@@ -0,0 +1,78 @@
+package irmf
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testModel returns a model in the box [lo,hi]³ whose material is where
+// the GLSL expression cond holds.
+func testModel(t *testing.T, lo, hi float64, cond string) *Model {
+	t.Helper()
+	src := fmt.Sprintf(`/*{
+  "irmf": "1.0",
+  "language": "glsl",
+  "materials": ["PLA"],
+  "max": [%[2]v,%[2]v,%[2]v],
+  "min": [%[1]v,%[1]v,%[1]v],
+  "units": "mm"
+}*/
+
+void mainModel4(out vec4 materials, in vec3 xyz) {
+  materials[0] = %[3]v ? 1.0 : 0.0;
+}
+`, lo, hi, cond)
+	m, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return m
+}
+
+func TestCheckBounds(t *testing.T) {
+	all := [6]bool{true, true, true, true, true, true}
+	tests := []struct {
+		name     string
+		lo, hi   float64
+		cond     string
+		margin   float64
+		clipped  [6]bool
+		touching [6]bool
+		min, max float64 // of Tight on every axis
+	}{
+		{name: "sphere that fits exactly", lo: -5, hi: 5, cond: "length(xyz) <= 5.0", min: -5, max: 5},
+		{name: "sphere with margin", lo: -5, hi: 5, cond: "length(xyz) <= 5.0", margin: 0.5, min: -5.5, max: 5.5},
+		{name: "loose box", lo: -8, hi: 8, cond: "length(xyz) <= 5.0", min: -5.5, max: 5.5},
+		{name: "cube cut off by the shader", lo: -5, hi: 5, cond: "all(lessThanEqual(abs(xyz), vec3(5.0)))", touching: all, min: -5, max: 5},
+		{name: "clipped", lo: -5, hi: 5, cond: "length(xyz) <= 6.0", clipped: all, min: -6.25, max: 6.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testModel(t, tt.lo, tt.hi, tt.cond)
+			p, err := m.Compile()
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			b, err := CheckBounds(p, m, 32, 0.25, 0.5, 1)
+			if err != nil {
+				t.Fatalf("CheckBounds: %v", err)
+			}
+			if b.Empty {
+				t.Fatal("no material found")
+			}
+			if b.Clipped != tt.clipped {
+				t.Errorf("Clipped = %v, want %v", b.Clipped, tt.clipped)
+			}
+			if b.Touching != tt.touching {
+				t.Errorf("Touching = %v, want %v", b.Touching, tt.touching)
+			}
+			min, max := b.Tight(tt.margin)
+			for a := range min {
+				if min[a] != tt.min || max[a] != tt.max {
+					t.Errorf("Tight(%v) = %v, %v, want %v, %v on every axis", tt.margin, min, max, tt.min, tt.max)
+					break
+				}
+			}
+		})
+	}
+}
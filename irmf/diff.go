@@ -0,0 +1,101 @@
+package irmf
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+// Diff describes where two models disagree, sampled on a lattice that
+// covers the union of their bounding boxes. Each model is empty outside
+// its own box, as when it is sliced.
+//
+// For each material n (by position in the headers), Added[n] is the
+// field that exceeds 0.5 where b has the material and a does not,
+// Removed[n] where a has it and b does not, and Both[n] where both do.
+// The fields are continuous so that their surfaces can be extracted
+// (see mesh.Extract) as smoothly as the models' own.
+type Diff struct {
+	Grid                 Grid
+	Added, Removed, Both [][]float32
+}
+
+// Compare samples models a and b (compiled as pa and pb) with the given
+// lattice spacing. They must use the same units.
+func Compare(pa *shader.Program, a *Model, pb *shader.Program, b *Model, step float64, workers int) (*Diff, error) {
+	if a.Units != b.Units {
+		return nil, fmt.Errorf("models use different units: %q and %q", a.Units, b.Units)
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("lattice spacing must be positive, got %v", step)
+	}
+	g := Grid{Step: step}
+	for i := range g.N {
+		g.Min[i] = math.Min(a.Min[i], b.Min[i])
+		g.N[i] = int(math.Ceil((math.Max(a.Max[i], b.Max[i])-g.Min[i])/step-1e-9)) + 1
+	}
+	fa := clipToBox(Sample(pa, g, len(a.Materials), workers), g, a)
+	fb := clipToBox(Sample(pb, g, len(b.Materials), workers), g, b)
+
+	numMaterials := max(len(fa), len(fb))
+	d := &Diff{
+		Grid:    g,
+		Added:   make([][]float32, numMaterials),
+		Removed: make([][]float32, numMaterials),
+		Both:    make([][]float32, numMaterials),
+	}
+	empty := make([]float32, g.Len())
+	for n := 0; n < numMaterials; n++ {
+		va, vb := empty, empty
+		if n < len(fa) {
+			va = fa[n]
+		}
+		if n < len(fb) {
+			vb = fb[n]
+		}
+		d.Added[n] = make([]float32, g.Len())
+		d.Removed[n] = make([]float32, g.Len())
+		d.Both[n] = make([]float32, g.Len())
+		for i := range va {
+			d.Added[n][i] = min(vb[i], 1-va[i])
+			d.Removed[n][i] = min(va[i], 1-vb[i])
+			d.Both[n][i] = min(va[i], vb[i])
+		}
+	}
+	return d, nil
+}
+
+// clipToBox zeroes the sampled fields outside the model's bounding box.
+func clipToBox(fields [][]float32, g Grid, m *Model) [][]float32 {
+	for k := 0; k < g.N[2]; k++ {
+		for j := 0; j < g.N[1]; j++ {
+			for i := 0; i < g.N[0]; i++ {
+				x, y, z := g.Point(i, j, k)
+				if x >= m.Min[0] && x <= m.Max[0] && y >= m.Min[1] && y <= m.Max[1] && z >= m.Min[2] && z <= m.Max[2] {
+					continue
+				}
+				for _, f := range fields {
+					f[g.Index(i, j, k)] = 0
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// Volumes returns the volumes (in cubic model units) added, removed, and
+// kept for material n, counting each lattice point inside as one cell.
+func (d *Diff) Volumes(n int) (added, removed, both float64) {
+	cell := d.Grid.Step * d.Grid.Step * d.Grid.Step
+	count := func(f []float32) float64 {
+		var c int
+		for _, v := range f {
+			if v > 0.5 {
+				c++
+			}
+		}
+		return float64(c) * cell
+	}
+	return count(d.Added[n]), count(d.Removed[n]), count(d.Both[n])
+}
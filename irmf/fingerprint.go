@@ -0,0 +1,144 @@
+package irmf
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+// Fingerprint summarizes how a model evaluates: its material values,
+// quantized, at a fixed set of pseudo-random points in its bounding box.
+// Edits that do not change the model (such as reformatting, renaming,
+// or minifying its shader) keep its fingerprint.
+type Fingerprint struct {
+	// Hash is the hex SHA-256 of the quantized values, shortened to 16
+	// digits.
+	Hash string
+
+	numMaterials int
+	values       []uint16 // point-major
+}
+
+// fingerprintChunk is the number of points drawn from each random
+// stream so that the points do not depend on the number of workers.
+const fingerprintChunk = 256
+
+// ComputeFingerprint evaluates the model at n points, which depend only
+// on n and the bounding box, and quantizes each material value (clamped
+// to [0,1]) to a multiple of quantum. Values within quantum/2 of a
+// rounding boundary can flip between shaders that differ only in
+// rounding, so quantum should be coarse compared to that noise.
+func ComputeFingerprint(p *shader.Program, m *Model, n int, quantum float64, workers int) (*Fingerprint, error) {
+	if n < 1 || quantum <= 0 || quantum > 1 {
+		return nil, fmt.Errorf("need at least 1 point and 0 < quantum <= 1, got %v and %v", n, quantum)
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	numMaterials := len(m.Materials)
+	values := make([]uint16, n*numMaterials)
+	chunks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e := p.NewEvaluator()
+			out := make([]float64, p.NumMaterials())
+			for c := range chunks {
+				rng := rand.New(rand.NewPCG(0x1e3f, uint64(c)))
+				for i := c * fingerprintChunk; i < min(n, (c+1)*fingerprintChunk); i++ {
+					var pt [3]float64
+					for a := range pt {
+						pt[a] = m.Min[a] + rng.Float64()*(m.Max[a]-m.Min[a])
+					}
+					e.Eval(pt[0], pt[1], pt[2], out)
+					for j := 0; j < numMaterials; j++ {
+						values[i*numMaterials+j] = quantize(out[j], quantum)
+					}
+				}
+			}
+		}()
+	}
+	for c := 0; c*fingerprintChunk < n; c++ {
+		chunks <- c
+	}
+	close(chunks)
+	wg.Wait()
+
+	h := sha256.New()
+	binary.Write(h, binary.LittleEndian, uint32(numMaterials))
+	binary.Write(h, binary.LittleEndian, values)
+	return &Fingerprint{
+		Hash:         hex.EncodeToString(h.Sum(nil))[:16],
+		numMaterials: numMaterials,
+		values:       values,
+	}, nil
+}
+
+// quantize maps v in [0,1] to a multiple of quantum; NaN maps to the
+// largest value.
+func quantize(v, quantum float64) uint16 {
+	if math.IsNaN(v) {
+		return math.MaxUint16
+	}
+	return uint16(math.Round(math.Max(0, math.Min(1, v)) / quantum))
+}
+
+// Differences returns the number of points at which the fingerprints
+// differ, which is meaningful only if both were computed with the same
+// points and quantum. Fingerprints of models with different numbers of
+// materials differ everywhere.
+func (f *Fingerprint) Differences(g *Fingerprint) int {
+	if f.numMaterials != g.numMaterials || len(f.values) != len(g.values) {
+		return max(len(f.values), len(g.values)) / max(1, f.numMaterials, g.numMaterials)
+	}
+	diffs := 0
+	for i := 0; i < len(f.values); i += f.numMaterials {
+		for j := 0; j < f.numMaterials; j++ {
+			if f.values[i+j] != g.values[i+j] {
+				diffs++
+				break
+			}
+		}
+	}
+	return diffs
+}
+
+// ReadFingerprints reads a file of fingerprint hashes by path, as written
+// by cmd/irmf-fingerprint: lines of "hash  path", ignoring blank lines
+// and "#" comments. A missing file is empty.
+func ReadFingerprints(filename string) (map[string]string, error) {
+	recorded := map[string]string{}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return recorded, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%v:%v: want \"hash  path\", got %q", filename, n, line)
+		}
+		recorded[fields[1]] = fields[0]
+	}
+	return recorded, s.Err()
+}
@@ -0,0 +1,405 @@
+package irmf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// headerKeyOrder is the canonical order of the header keys, as used by
+// most of the examples. Other keys follow in alphabetical order.
+var headerKeyOrder = []string{
+	"author", "copyright", "license", "date", "encoding", "irmf", "language",
+	"materials", "max", "min", "notes", "options", "title", "units", "version",
+}
+
+// Format returns the IRMF source src in canonical form:
+//
+//   - The JSON header has its keys in canonical order, one per line,
+//     quoted, and without trailing commas. Arrays of numbers or strings
+//     are written on one line as "[1,2,3]"; objects (such as "options")
+//     keep their key order and are written one key per line. Numbers are
+//     written exactly as in the source.
+//   - The header is followed by one blank line.
+//   - The (unencoded) shader body is indented by two spaces per level of
+//     braces, parentheses, and brackets, trailing whitespace is removed,
+//     runs of blank lines are collapsed to one, and the file ends with a
+//     single newline. Preprocessor directives start in column 0. Lines
+//     inside block comments, continuation lines of macros, and copies of
+//     libraries between //irmf:inline and //irmf:end are left untouched.
+//
+// Format is idempotent and changes nothing but whitespace in the body.
+func Format(src []byte) ([]byte, error) {
+	m, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	header, err := formatHeader(m.Header, nil)
+	if err != nil {
+		return nil, fmt.Errorf("header: %v", err)
+	}
+
+	endJSON := bytes.Index(src, []byte("\n}*/"))
+	body := string(src[endJSON+4:])
+	if m.Encoding == "" {
+		body = formatBody(body)
+	} else {
+		body = strings.TrimPrefix(body, "\n")
+	}
+	return []byte("/*" + header + "*/\n" + body), nil
+}
+
+// node is a JSON value that remembers the order of object keys.
+type node struct {
+	keys   []string // for objects
+	values []*node  // for objects and arrays
+	object bool
+	array  bool
+	scalar string // JSON text of a string, number, bool, or null
+}
+
+// formatHeader returns the JSON header in canonical form (see Format)
+// with the top-level keys in set given the JSON values in set, adding
+// any keys that are missing.
+func formatHeader(header string, set map[string]string) (string, error) {
+	root, err := parseNode(header)
+	if err != nil {
+		// Retry with the fixes that Parse accepts (see parseHeader).
+		header = trailingCommaRE.ReplaceAllString(header, "$1")
+		header = unquotedKeyRE.ReplaceAllString(header, `$1"$2":`)
+		if root, err = parseNode(header); err != nil {
+			return "", err
+		}
+	}
+	if !root.object {
+		return "", errors.New("not a JSON object")
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, err := parseNode(set[k])
+		if err != nil {
+			return "", fmt.Errorf("%q: %v", k, err)
+		}
+		if i := slices.Index(root.keys, k); i >= 0 {
+			root.values[i] = v
+		} else {
+			root.keys = append(root.keys, k)
+			root.values = append(root.values, v)
+		}
+	}
+
+	rank := map[string]int{}
+	for i, k := range headerKeyOrder {
+		rank[k] = i
+	}
+	order := make([]int, len(root.keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ka, kb := root.keys[order[a]], root.keys[order[b]]
+		ra, oka := rank[ka]
+		rb, okb := rank[kb]
+		switch {
+		case oka && okb:
+			return ra < rb
+		case oka != okb:
+			return oka
+		default:
+			return ka < kb
+		}
+	})
+
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for n, i := range order {
+		sb.WriteString("  " + quote(root.keys[i]) + ": ")
+		root.values[i].write(&sb, "  ")
+		if n < len(order)-1 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("}")
+	return sb.String(), nil
+}
+
+// setHeader returns the IRMF source src with the top-level header keys
+// in set given the JSON values in set and the header rewritten in
+// canonical form (see Format), leaving the shader body untouched.
+func setHeader(src []byte, set map[string]string) ([]byte, error) {
+	m, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	header, err := formatHeader(m.Header, set)
+	if err != nil {
+		return nil, fmt.Errorf("header: %v", err)
+	}
+	endJSON := bytes.Index(src, []byte("\n}*/"))
+	out := append([]byte("/*"+header+"*/"), src[endJSON+4:]...)
+
+	// Make sure the result is still a valid model with the same shader.
+	m2, err := Parse(out)
+	if err != nil {
+		return nil, err
+	}
+	if m2.Shader != m.Shader {
+		return nil, errors.New("rewriting the header changed the shader")
+	}
+	return out, nil
+}
+
+// formatVector formats a header vector like "[1,2,3]".
+func formatVector(v [3]float64) string {
+	s := make([]string, len(v))
+	for i, f := range v {
+		s[i] = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return "[" + strings.Join(s, ",") + "]"
+}
+
+func parseNode(s string) (*node, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	n, err := decodeNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the header object")
+	}
+	return n, nil
+}
+
+func decodeNode(dec *json.Decoder) (*node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		n := &node{object: v == '{', array: v == '['}
+		for dec.More() {
+			if n.object {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, k.(string))
+			}
+			child, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, child)
+		}
+		if _, err := dec.Token(); err != nil { // closing delimiter
+			return nil, err
+		}
+		return n, nil
+	case string:
+		return &node{scalar: quote(v)}, nil
+	case json.Number:
+		return &node{scalar: v.String()}, nil
+	case bool:
+		return &node{scalar: fmt.Sprint(v)}, nil
+	case nil:
+		return &node{scalar: "null"}, nil
+	}
+	return nil, fmt.Errorf("unexpected token %v", tok)
+}
+
+func (n *node) write(sb *strings.Builder, indent string) {
+	switch {
+	case n.object && len(n.keys) == 0:
+		sb.WriteString("{}")
+	case n.object:
+		sb.WriteString("{\n")
+		for i, k := range n.keys {
+			sb.WriteString(indent + "  " + quote(k) + ": ")
+			n.values[i].write(sb, indent+"  ")
+			if i < len(n.keys)-1 {
+				sb.WriteString(",")
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString(indent + "}")
+	case n.array && n.isFlat():
+		sb.WriteString("[")
+		for i, v := range n.values {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString(v.scalar)
+		}
+		sb.WriteString("]")
+	case n.array:
+		sb.WriteString("[\n")
+		for i, v := range n.values {
+			sb.WriteString(indent + "  ")
+			v.write(sb, indent+"  ")
+			if i < len(n.values)-1 {
+				sb.WriteString(",")
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString(indent + "]")
+	default:
+		sb.WriteString(n.scalar)
+	}
+}
+
+// isFlat reports whether an array holds only scalars.
+func (n *node) isFlat() bool {
+	for _, v := range n.values {
+		if v.object || v.array {
+			return false
+		}
+	}
+	return true
+}
+
+// quote returns s as a JSON string without escaping HTML characters.
+func quote(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func formatBody(body string) string {
+	lines := strings.Split(body, "\n")
+	var out []string
+	// extra indents the continuation lines of an expression split after
+	// an operator until the depth returns to base.
+	depth, extra, base := 0, 0, 0
+	inComment, inLibrary, continued := false, false, false
+	for _, line := range lines {
+		if inLibrary {
+			// Copies of libraries must match them exactly (see Inline).
+			inLibrary = strings.TrimSpace(line) != inlineEnd
+			out = append(out, line)
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case continued || inComment:
+			// Leave as is.
+		case trimmed == "":
+			line = ""
+		case strings.HasPrefix(trimmed, "#"):
+			line = trimmed
+		default:
+			d := depth - leadingClosers(trimmed) + extra
+			if extra == 0 && startsWithOperator(trimmed) {
+				extra, base = 1, depth
+				d++
+			}
+			line = strings.Repeat("  ", max(0, d)) + trimmed
+		}
+		inLibrary = !inComment && inlineRE.MatchString(trimmed)
+		wasComment := inComment
+		continued = strings.HasSuffix(line, "\\")
+
+		var delta int
+		delta, inComment = nesting(line, inComment)
+		code, _, _ := strings.Cut(trimmed, "//")
+		if code = strings.TrimSpace(code); !wasComment && code != "" && !strings.HasPrefix(code, "#") {
+			switch {
+			case endsWithOperator(code):
+				if extra == 0 {
+					extra, base = 1, depth
+				}
+			case depth+delta <= base:
+				extra = 0
+			}
+		}
+		depth = max(0, depth+delta)
+		if line == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue // collapse blank lines
+		}
+		out = append(out, line)
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return "\n" + strings.Join(out, "\n") + "\n"
+}
+
+// endsWithOperator reports whether a line of code is continued on the
+// next line because it ends with an assignment or a binary operator.
+func endsWithOperator(code string) bool {
+	if strings.HasSuffix(code, "++") || strings.HasSuffix(code, "--") {
+		return false
+	}
+	for _, op := range []string{"=", "+", "-", "*", "/", "%", "&&", "||", "?", ":", "<", "|", "&", "^"} {
+		if strings.HasSuffix(code, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// startsWithOperator reports whether a line continues the expression of
+// the previous line with a binary operator.
+func startsWithOperator(code string) bool {
+	if strings.HasPrefix(code, "//") || strings.HasPrefix(code, "/*") || strings.HasPrefix(code, "->") {
+		return false
+	}
+	return strings.ContainsAny(code[:1], "+-*/%?:|&^")
+}
+
+// leadingClosers counts the closing brackets at the start of a line.
+func leadingClosers(s string) int {
+	n := 0
+	for _, c := range s {
+		switch c {
+		case '}', ')', ']':
+			n++
+		case ' ', '\t':
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// nesting returns the change in bracket depth over a line, ignoring
+// comments, and whether the line ends inside a block comment.
+func nesting(line string, inComment bool) (int, bool) {
+	delta := 0
+	for i := 0; i < len(line); i++ {
+		if inComment {
+			if strings.HasPrefix(line[i:], "*/") {
+				inComment = false
+				i++
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line[i:], "//"):
+			return delta, false
+		case strings.HasPrefix(line[i:], "/*"):
+			inComment = true
+			i++
+		case line[i] == '{' || line[i] == '(' || line[i] == '[':
+			delta++
+		case line[i] == '}' || line[i] == ')' || line[i] == ']':
+			delta--
+		}
+	}
+	return delta, inComment
+}
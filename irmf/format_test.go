@@ -0,0 +1,288 @@
+package irmf
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// fingerprint returns the hash of the model's fingerprint.
+func fingerprint(t *testing.T, src []byte) string {
+	t.Helper()
+	m, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	p, err := m.Compile()
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	fp, err := ComputeFingerprint(p, m, 512, 1.0/64, 1)
+	if err != nil {
+		t.Fatalf("ComputeFingerprint: %v", err)
+	}
+	return fp.Hash
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "min before max",
+			src: `/*{
+  "irmf": "1.0",
+  "language": "wgsl",
+  "materials": ["Material"],
+  "min": [-1, -2, -3.50],
+  "max": [1, 2, 3.50],
+  "notes": "Fourier Approximation",
+  "units": "mm"
+}*/
+
+fn mainModel4(xyz: vec3f) -> vec4f {
+return vec4f(select(0.0, 1.0, length(xyz) <= 1.0), 0.0, 0.0, 0.0);
+}
+`,
+			want: `/*{
+  "irmf": "1.0",
+  "language": "wgsl",
+  "materials": ["Material"],
+  "max": [1,2,3.50],
+  "min": [-1,-2,-3.50],
+  "notes": "Fourier Approximation",
+  "units": "mm"
+}*/
+
+fn mainModel4(xyz: vec3f) -> vec4f {
+  return vec4f(select(0.0, 1.0, length(xyz) <= 1.0), 0.0, 0.0, 0.0);
+}
+`,
+		},
+		{
+			name: "trailing comma",
+			src: `/*{
+  "irmf": "1.0",
+  "language": "glsl",
+  "materials": ["material0"],
+  "max": [5,5,5],
+  "min": [-5,-5,-5],
+  "units": "mm",
+}*/
+
+void mainModel4(out vec4 materials, in vec3 xyz){
+  materials[0]=length(xyz)<=5.0?1.0:0.0;
+}
+`,
+			want: `/*{
+  "irmf": "1.0",
+  "language": "glsl",
+  "materials": ["material0"],
+  "max": [5,5,5],
+  "min": [-5,-5,-5],
+  "units": "mm"
+}*/
+
+void mainModel4(out vec4 materials, in vec3 xyz){
+  materials[0]=length(xyz)<=5.0?1.0:0.0;
+}
+`,
+		},
+		{
+			name: "unquoted keys, options, and blank lines",
+			src: `/*{
+  units: "mm",
+  irmf: "1.0",
+  options: {"radius": 4, "hollow": false},
+  materials: ["PLA1", "PLA2"], "min": [-4,-4,-4], "max": [4,4,4],
+  title: "a <b>"
+}*/
+
+
+
+void mainModel4(out vec4 materials, in vec3 xyz) {
+    float r = length(xyz);
+
+
+    if (r <= 4.0) {
+    materials[0] = 1.0;
+    } else {
+    materials[1] = 0.0;
+    }
+}
+
+
+`,
+			want: `/*{
+  "irmf": "1.0",
+  "materials": ["PLA1","PLA2"],
+  "max": [4,4,4],
+  "min": [-4,-4,-4],
+  "options": {
+    "radius": 4,
+    "hollow": false
+  },
+  "title": "a <b>",
+  "units": "mm"
+}*/
+
+void mainModel4(out vec4 materials, in vec3 xyz) {
+  float r = length(xyz);
+
+  if (r <= 4.0) {
+    materials[0] = 1.0;
+  } else {
+    materials[1] = 0.0;
+  }
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Format: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Format =\n%v\nwant:\n%v", string(got), tt.want)
+			}
+			again, err := Format(got)
+			if err != nil {
+				t.Fatalf("Format(Format(src)): %v", err)
+			}
+			if string(again) != string(got) {
+				t.Errorf("Format(Format(src)) =\n%v\nwant:\n%v", string(again), string(got))
+			}
+			if a, b := fingerprint(t, []byte(tt.src)), fingerprint(t, got); a != b {
+				t.Errorf("Format changed the fingerprint from %v to %v", a, b)
+			}
+		})
+	}
+}
+
+func TestFormatExamples(t *testing.T) {
+	for _, filename := range []string{
+		"../examples/002-cube/cube-1.irmf",
+		"../examples/011-bifilar-coil/bifilar-coil-1-wgsl.irmf",
+		"../examples/029-gsdf-bolt/bolt.irmf",       // "units": "mm",
+		"../examples/037-stanford-bunny/bunny.irmf", // min before max
+	} {
+		t.Run(filename, func(t *testing.T) {
+			src, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Format(src)
+			if err != nil {
+				t.Fatalf("Format: %v", err)
+			}
+			again, err := Format(got)
+			if err != nil {
+				t.Fatalf("Format(Format(src)): %v", err)
+			}
+			if string(again) != string(got) {
+				t.Errorf("Format is not idempotent:\n%v\nthen:\n%v", string(got), string(again))
+			}
+			if a, b := fingerprint(t, src), fingerprint(t, got); a != b {
+				t.Errorf("Format changed the fingerprint from %v to %v", a, b)
+			}
+		})
+	}
+}
+
+// TestHeaderWriters checks that the functions that rewrite headers leave
+// formatted sources formatted.
+func TestHeaderWriters(t *testing.T) {
+	const cube = "../examples/002-cube/cube-1.irmf"
+	src, err := os.ReadFile(cube)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src, err = Format(src); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		fn   func() ([]byte, error)
+		want string // in the header
+	}{
+		{
+			name: "SetBounds",
+			fn:   func() ([]byte, error) { return SetBounds(src, [3]float64{-1, -2.5, 0}, [3]float64{6, 30, 40}) },
+			want: `"max": [6,30,40],
+  "min": [-1,-2.5,0],`,
+		},
+		{
+			name: "ConvertUnits",
+			fn:   func() ([]byte, error) { return ConvertUnits(src, "cm") },
+			want: `"units": "cm"`,
+		},
+		{
+			name: "Transform",
+			fn:   func() ([]byte, error) { return Transform(src, Translation([3]float64{10, 0, 0})) },
+			want: `"max": [15,5,5],
+  "min": [5,-5,-5],`,
+		},
+		{
+			name: "Compose",
+			fn: func() ([]byte, error) {
+				out, _, err := Compose(&Assembly{Title: "two", Parts: []Part{
+					{File: cube},
+					{File: "../examples/001-sphere/sphere-1.irmf", Translate: []float64{20, 0, 0}},
+				}}, ".", nil)
+				return out, err
+			},
+			want: `"notes": "Assembled by irmf-assemble.",
+  "title": "two",`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.fn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			formatted, err := Format(out)
+			if err != nil {
+				t.Fatalf("Format: %v", err)
+			}
+			if string(formatted) != string(out) {
+				t.Errorf("output is not formatted:\n%v\nwant:\n%v", string(out), string(formatted))
+			}
+			if header, _, _ := strings.Cut(string(out), "*/"); !strings.Contains(header, tt.want) {
+				t.Errorf("header =\n%v\nwant it to contain:\n%v", header, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetBoundsKeepsShader(t *testing.T) {
+	const bunny = "../examples/037-stanford-bunny/bunny.irmf"
+	src, err := os.ReadFile(bunny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := SetBounds(src, [3]float64{-30, -47, -1}, [3]float64{90, 51, 119})
+	if err != nil {
+		t.Fatalf("SetBounds: %v", err)
+	}
+	_, srcBody, _ := strings.Cut(string(src), "}*/")
+	header, outBody, _ := strings.Cut(string(out), "}*/")
+	if outBody != srcBody {
+		t.Error("SetBounds changed the shader")
+	}
+	want := `/*{
+  "irmf": "1.0",
+  "language": "wgsl",
+  "materials": ["Material"],
+  "max": [90,51,119],
+  "min": [-30,-47,-1],
+  "notes": "Fourier Approximation",
+  "units": "mm"
+`
+	if header != want {
+		t.Errorf("header =\n%v\nwant:\n%v", header, want)
+	}
+}
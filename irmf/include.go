@@ -0,0 +1,286 @@
+package irmf
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	includeRE   = regexp.MustCompile(`^\s*#include\s+"([^"]+)"`)
+	directiveRE = regexp.MustCompile(`^\s*#\s*(\w+)\s*(\w*)`)
+)
+
+const (
+	// repoPrefix identifies includes that live in this repository and can
+	// therefore be read from disk instead of from GitHub.
+	repoPrefix = "github.com/gmlewis/irmf-examples/blob/master/"
+
+	githubRawPrefix = "https://raw.githubusercontent.com/"
+	lygiaBaseURL    = "https://lygia.xyz"
+
+	// vendorDir is searched for in the directory of each file and its
+	// parents, so that a copy of lygia checked out (or vendored) as
+	// third_party/lygia is used instead of the network.
+	vendorDir = "third_party"
+
+	// IncludePathEnv names the environment variable that lists extra
+	// include directories (separated as in $PATH).
+	IncludePathEnv = "IRMF_INCLUDE_PATH"
+)
+
+// Includer resolves #include directives.
+type Includer struct {
+	// Dir is the directory of the file being processed. Includes of files
+	// in this repository are looked up relative to Dir and its parents.
+	Dir string
+	// Path lists directories searched for all other includes before they
+	// are fetched, e.g. a directory holding a "lygia" checkout or the
+	// lygia checkout itself. Any third_party directories in Dir or its
+	// parents are searched after Path.
+	Path []string
+	// Fetch retrieves any other include from its URL. If nil, such
+	// includes are an error.
+	Fetch func(url string) ([]byte, error)
+
+	// Included lists the files included by the last call to Expand in
+	// the order they were first included.
+	Included []Include
+
+	defined map[string]bool
+}
+
+// Include records where an #include directive was resolved.
+type Include struct {
+	Path   string // as written in the directive
+	Source string // the local file or URL that was read
+}
+
+// HTTPFetch retrieves url over HTTP.
+func HTTPFetch(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v: %v", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Expand replaces every #include line in src with the contents of the
+// included file (recursively). Each file is included at most once.
+//
+// Includes are resolved relative to the including file first (as lygia
+// does with includes like "../math/saturate.glsl"). Include guards are
+// followed: a block of the form "#ifndef X / #define X ... #endif" is
+// dropped if X was already defined unconditionally, which is how lygia
+// lets a shader supply its own version of a function (for example by
+// defining FNC_SATURATE before including lygia). Includes inside such
+// blocks are not resolved.
+func (inc *Includer) Expand(src string) (string, error) {
+	inc.Included = nil
+	inc.defined = map[string]bool{}
+	return inc.expand(src, "", map[string]bool{}, 0)
+}
+
+// expand expands src, which was read from the local file or URL from
+// ("" for the top-level source), whose text starts at conditional
+// nesting depth.
+func (inc *Includer) expand(src, from string, seen map[string]bool, depth int) (string, error) {
+	lines := strings.Split(src, "\n")
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if d := directiveRE.FindStringSubmatch(line); d != nil {
+			switch d[1] {
+			case "if", "ifdef":
+				depth++
+			case "ifndef":
+				if inc.defined[d[2]] && i+1 < len(lines) && isDefine(lines[i+1], d[2]) {
+					i = skipConditional(lines, i)
+					continue
+				}
+				depth++
+			case "endif":
+				depth--
+			case "define":
+				if depth == 0 {
+					inc.defined[d[2]] = true
+				}
+			case "undef":
+				delete(inc.defined, d[2])
+			}
+		}
+
+		m := includeRE.FindStringSubmatch(line)
+		if m == nil {
+			out = append(out, line)
+			continue
+		}
+		name := m[1]
+		buf, source, err := inc.read(name, from)
+		if err != nil {
+			return "", fmt.Errorf("line %v: #include %q: %v", i+1, name, err)
+		}
+		if seen[source] {
+			continue
+		}
+		seen[source] = true
+		inc.Included = append(inc.Included, Include{Path: name, Source: source})
+		expanded, err := inc.expand(string(buf), source, seen, depth)
+		if err != nil {
+			return "", fmt.Errorf("%v: %v", name, err)
+		}
+		out = append(out, strings.TrimRight(expanded, "\n"))
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// isDefine reports whether line is "#define name" (with no value).
+func isDefine(line, name string) bool {
+	d := directiveRE.FindStringSubmatch(line)
+	return d != nil && d[1] == "define" && d[2] == name
+}
+
+// skipConditional returns the index of the #endif that closes the
+// conditional starting at lines[start].
+func skipConditional(lines []string, start int) int {
+	depth := 0
+	for i := start; i < len(lines); i++ {
+		if d := directiveRE.FindStringSubmatch(lines[i]); d != nil {
+			switch d[1] {
+			case "if", "ifdef", "ifndef":
+				depth++
+			case "endif":
+				if depth--; depth == 0 {
+					return i
+				}
+			}
+		}
+	}
+	return len(lines)
+}
+
+// read returns the contents of the include name found in the file or
+// URL from, and where they were read from.
+func (inc *Includer) read(name, from string) ([]byte, string, error) {
+	var candidates []string
+	if rel, ok := strings.CutPrefix(name, repoPrefix); ok {
+		for dir := inc.Dir; ; dir = filepath.Dir(dir) {
+			candidates = append(candidates, filepath.Join(dir, rel))
+			if parent := filepath.Dir(dir); parent == dir {
+				break
+			}
+		}
+	}
+	switch {
+	case strings.Contains(from, "://"):
+		// Relative includes of a fetched file are fetched too (below).
+	case from != "":
+		candidates = append(candidates, filepath.Join(filepath.Dir(from), name))
+	default:
+		candidates = append(candidates, filepath.Join(inc.Dir, name))
+	}
+	for _, dir := range inc.searchPath() {
+		candidates = append(candidates, filepath.Join(dir, name))
+		if rest, ok := lygiaRelative(name); ok {
+			candidates = append(candidates, filepath.Join(dir, "lygia", rest), filepath.Join(dir, rest))
+		}
+	}
+	for _, filename := range candidates {
+		if buf, err := os.ReadFile(filename); err == nil {
+			return buf, filename, nil
+		}
+	}
+
+	url := IncludeURL(name)
+	if url == "" && strings.Contains(from, "://") {
+		url = resolveURL(from, name)
+	}
+	if url == "" {
+		return nil, "", fmt.Errorf("not found locally and not a recognized include path")
+	}
+	if inc.Fetch == nil {
+		return nil, "", fmt.Errorf("not found locally and fetching %v is disabled", url)
+	}
+	buf, err := inc.Fetch(url)
+	return buf, url, err
+}
+
+// searchPath returns Path followed by any vendor directories in Dir and
+// its parents.
+func (inc *Includer) searchPath() []string {
+	dirs := append([]string(nil), inc.Path...)
+	for dir := inc.Dir; ; dir = filepath.Dir(dir) {
+		if fi, err := os.Stat(filepath.Join(dir, vendorDir)); err == nil && fi.IsDir() {
+			dirs = append(dirs, filepath.Join(dir, vendorDir))
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	return dirs
+}
+
+// lygiaRelative returns an include path relative to the root of lygia.
+func lygiaRelative(name string) (string, bool) {
+	if rest, ok := strings.CutPrefix(name, "lygia.xyz/"); ok {
+		return rest, true
+	}
+	return strings.CutPrefix(name, "lygia/")
+}
+
+// resolveURL resolves a relative include found in the file at base.
+func resolveURL(base, name string) string {
+	i := strings.Index(base, "://") + 3
+	j := strings.Index(base[i:], "/")
+	if j < 0 {
+		return ""
+	}
+	host, p := base[:i+j], base[i+j:]
+	return host + path.Join(path.Dir(p), name)
+}
+
+// IncludeURL returns the URL of an include path with a recognized prefix
+// ("lygia.xyz/", "lygia/", or "github.com/"), or "" if it has none.
+func IncludeURL(path string) string {
+	if !strings.HasSuffix(path, ".glsl") && !strings.HasSuffix(path, ".wgsl") {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(path, "lygia.xyz/"):
+		return lygiaBaseURL + "/" + strings.TrimPrefix(path, "lygia.xyz/")
+	case strings.HasPrefix(path, "lygia/"):
+		return lygiaBaseURL + "/" + strings.TrimPrefix(path, "lygia/")
+	case strings.HasPrefix(path, "github.com/"):
+		location := strings.Replace(strings.TrimPrefix(path, "github.com/"), "/blob/", "/", 1)
+		return githubRawPrefix + location
+	default:
+		return ""
+	}
+}
+
+// DefaultIncludePath returns the directories listed in $IRMF_INCLUDE_PATH.
+func DefaultIncludePath() []string {
+	return filepath.SplitList(os.Getenv(IncludePathEnv))
+}
+
+// ExpandIncludes expands the model's shader in place, resolving includes
+// relative to the directory of the model's file and then in the default
+// include path (see DefaultIncludePath).
+func (m *Model) ExpandIncludes(filename string, fetch func(url string) ([]byte, error)) error {
+	inc := &Includer{Dir: filepath.Dir(filename), Path: DefaultIncludePath(), Fetch: fetch}
+	src, err := inc.Expand(m.Shader)
+	if err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	m.Shader = src
+	return nil
+}
@@ -0,0 +1,190 @@
+package irmf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testdata/include holds a small tree of includes. Each file starts with
+// a "// <name> from <dir>" comment so tests can tell which copy was used:
+//
+//	third_party/lygia/  a vendored lygia (math/saturate.glsl, sdf/sphereSDF.glsl)
+//	path1/lygia/        a directory holding a lygia checkout
+//	path2/              a lygia checkout itself
+//	env/lygia/          a directory listed in $IRMF_INCLUDE_PATH
+//	common/, models/    includes that live in the repo
+func TestExpand(t *testing.T) {
+	root, err := filepath.Abs(filepath.Join("testdata", "include"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "models")
+	path1, path2 := filepath.Join(root, "path1"), filepath.Join(root, "path2")
+	fetchErr := errors.New("offline")
+
+	tests := []struct {
+		name    string
+		path    []string
+		src     string
+		want    []string // in order
+		notWant []string
+		sources []string // relative to root, or URLs
+		wantErr string
+	}{
+		{
+			name:    "relative to the file",
+			src:     `#include "local.glsl"`,
+			want:    []string{"// local from models", "// util from common"},
+			sources: []string{"models/local.glsl", "common/util.glsl"},
+		},
+		{
+			name:    "repo path",
+			src:     `#include "github.com/gmlewis/irmf-examples/blob/master/irmf/testdata/include/common/util.glsl"`,
+			want:    []string{"// util from common"},
+			sources: []string{"common/util.glsl"},
+		},
+		{
+			name:    "third_party in a parent directory",
+			src:     `#include "lygia/math/saturate.glsl"`,
+			want:    []string{"// saturate from third_party"},
+			sources: []string{"third_party/lygia/math/saturate.glsl"},
+		},
+		{
+			name:    "path before third_party",
+			path:    []string{path1},
+			src:     `#include "lygia/math/saturate.glsl"`,
+			want:    []string{"// saturate from path1"},
+			sources: []string{"path1/lygia/math/saturate.glsl"},
+		},
+		{
+			name:    "path in order",
+			path:    []string{path2, path1},
+			src:     `#include "lygia.xyz/math/saturate.glsl"`,
+			want:    []string{"// saturate from path2"},
+			sources: []string{"path2/math/saturate.glsl"},
+		},
+		{
+			name:    "relative includes of a lygia file",
+			path:    []string{path1},
+			src:     `#include "lygia/sdf/sphereSDF.glsl"`,
+			want:    []string{"// sphereSDF from third_party", "// saturate from third_party", "float sphereSDF"},
+			sources: []string{"third_party/lygia/sdf/sphereSDF.glsl", "third_party/lygia/math/saturate.glsl"},
+		},
+		{
+			name: "each file once",
+			src: `#include "lygia/sdf/sphereSDF.glsl"
+#include "lygia/math/saturate.glsl"`,
+			want:    []string{"// sphereSDF from third_party", "// saturate from third_party"},
+			sources: []string{"third_party/lygia/sdf/sphereSDF.glsl", "third_party/lygia/math/saturate.glsl"},
+		},
+		{
+			name: "guard defined by the shader",
+			src: `#define FNC_SATURATE
+#define saturate(x) min(max(x, 0.0), 1.0)
+#include "lygia/math/saturate.glsl"`,
+			want:    []string{"#define saturate(x) min(", "// saturate from third_party"},
+			notWant: []string{"clamp(x, 0.0, 1.0)"},
+			sources: []string{"third_party/lygia/math/saturate.glsl"},
+		},
+		{
+			name: "guard defined conditionally",
+			src: `#ifdef SOMETHING
+#define FNC_SATURATE
+#endif
+#include "lygia/math/saturate.glsl"`,
+			want:    []string{"clamp(x, 0.0, 1.0)"},
+			sources: []string{"third_party/lygia/math/saturate.glsl"},
+		},
+		{
+			name:    "fetched when not found",
+			src:     `#include "lygia/math/missing.glsl"`,
+			wantErr: `line 1: #include "lygia/math/missing.glsl": offline`,
+		},
+		{
+			name:    "unrecognized path",
+			src:     `#include "missing.glsl"`,
+			wantErr: "not found locally and not a recognized include path",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetched []string
+			inc := &Includer{Dir: dir, Path: tt.path, Fetch: func(url string) ([]byte, error) {
+				fetched = append(fetched, url)
+				return nil, fetchErr
+			}}
+			got, err := inc.Expand(tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expand error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expand: %v", err)
+			}
+			if len(fetched) > 0 {
+				t.Errorf("fetched %v", fetched)
+			}
+			last := -1
+			for _, w := range tt.want {
+				i := strings.Index(got, w)
+				if i < 0 || i < last {
+					t.Errorf("Expand = %q, want %q after the previous wanted text", got, w)
+				}
+				last = i
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(got, w) {
+					t.Errorf("Expand = %q, want no %q", got, w)
+				}
+			}
+			var sources []string
+			for _, in := range inc.Included {
+				rel, err := filepath.Rel(root, in.Source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sources = append(sources, filepath.ToSlash(rel))
+			}
+			if strings.Join(sources, " ") != strings.Join(tt.sources, " ") {
+				t.Errorf("Included = %v, want %v", sources, tt.sources)
+			}
+		})
+	}
+}
+
+func TestExpandIncludes(t *testing.T) {
+	root, err := filepath.Abs(filepath.Join("testdata", "include"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(IncludePathEnv, strings.Join([]string{filepath.Join(root, "missing"), filepath.Join(root, "env")}, string(os.PathListSeparator)))
+	m := &Model{Shader: "#include \"lygia/math/saturate.glsl\"\n"}
+	if err := m.ExpandIncludes(filepath.Join(root, "models", "model.irmf"), nil); err != nil {
+		t.Fatalf("ExpandIncludes: %v", err)
+	}
+	if !strings.Contains(m.Shader, "// saturate from env") {
+		t.Errorf("ExpandIncludes = %q, want the copy in $%v", m.Shader, IncludePathEnv)
+	}
+}
+
+func TestIncludeURL(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"lygia/math/saturate.glsl", "https://lygia.xyz/math/saturate.glsl"},
+		{"lygia.xyz/sdf/boxSDF.wgsl", "https://lygia.xyz/sdf/boxSDF.wgsl"},
+		{"github.com/gmlewis/irmf-examples/blob/master/examples/common/a.glsl", "https://raw.githubusercontent.com/gmlewis/irmf-examples/master/examples/common/a.glsl"},
+		{"lygia/README.md", ""},
+		{"local.glsl", ""},
+	}
+	for _, tt := range tests {
+		if got := IncludeURL(tt.path); got != tt.want {
+			t.Errorf("IncludeURL(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
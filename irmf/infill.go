@@ -0,0 +1,236 @@
+package irmf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Lattices lists the lattices supported by AddInfill.
+var Lattices = []string{"gyroid", "schwarz-p", "cubic", "spheres"}
+
+// Infill describes the inside of a model rewritten by AddInfill.
+type Infill struct {
+	// Lattice is one of Lattices: a gyroid or Schwarz P surface, the
+	// struts along the edges of cubic cells, or hollow spheres (one per
+	// cell, touching their neighbors).
+	Lattice string
+	Shell   float64 // thickness of the solid shell; 0 for no shell
+	Cell    float64 // size of the lattice's cubic cells
+	Wall    float64 // thickness of the lattice's walls or struts
+}
+
+// AddInfill returns the IRMF source src with its model hollowed out,
+// keeping a solid shell of thickness f.Shell, and filled with the
+// lattice f describes. The lattice's cells are aligned with the origin.
+//
+// The shell is found by probing the model rather than relying on its
+// shader returning a distance, so it works with shaders that return
+// only 0 or 1: a point is inside the shell when the model is solid at
+// it and at 28 points around it, along the axes and diagonals at
+// distances of f.Shell and f.Shell/2, and nothing outside the bounding
+// box is solid. Features smaller than the probes' spacing may be missed.
+//
+// The entry point is renamed (for example, to mainModel4_solid) and the
+// rest of the shader is left untouched. Only models with up to 4
+// materials are supported, and encoded shaders must be decoded first
+// (see cmd/irmf-flatten).
+func AddInfill(src []byte, f Infill) ([]byte, error) {
+	m, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if m.Encoding != "" {
+		return nil, fmt.Errorf("cannot add infill to a shader with %q encoding", m.Encoding)
+	}
+	if m.MainFunc() != "mainModel4" {
+		return nil, fmt.Errorf("only models with up to 4 materials are supported, not %v", len(m.Materials))
+	}
+	if f.Shell < 0 || f.Cell <= 0 || f.Wall <= 0 || f.Wall >= f.Cell {
+		return nil, fmt.Errorf("invalid infill: shell %v, cell %v, wall %v (want shell >= 0 and 0 < wall < cell)", f.Shell, f.Cell, f.Wall)
+	}
+	lattice, ok := latticeBodies[f.Lattice]
+	if !ok {
+		return nil, fmt.Errorf("unknown lattice %q (want one of %v)", f.Lattice, strings.Join(Lattices, ", "))
+	}
+
+	end := bytes.Index(src, []byte("\n}*/"))
+	body, solid, _, err := renameEntry(m, string(src[end:]), "_solid")
+	if err != nil {
+		return nil, err
+	}
+	unique := func(name string) string {
+		s := name
+		for n := 2; regexp.MustCompile(`\b` + s + `\b`).MatchString(body); n++ {
+			s = fmt.Sprintf("%v%v", name, n)
+		}
+		return s
+	}
+	names := infillNames{
+		solid:    solid,
+		occupied: unique("infillOccupied"),
+		interior: unique("infillInterior"),
+		lattice:  unique("infillLattice"),
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n// Infill: keep a %v %v solid shell and fill the inside with a %v lattice\n// of %v %v cells with %v %v walls.\n",
+		f.Shell, m.Units, f.Lattice, f.Cell, m.Units, f.Wall, m.Units)
+	lang := m.Lang()
+	sb.WriteString(names.occupiedFunc(lang, m))
+	sb.WriteString(names.interiorFunc(lang, f.Shell))
+	sb.WriteString(names.latticeFunc(lang, lattice, f))
+	sb.WriteString(names.mainFunc(lang))
+
+	out := append(src[:end:end], strings.TrimRight(body, "\n")+"\n"...)
+	out = append(out, sb.String()...)
+	if _, err := Parse(out); err != nil {
+		return nil, fmt.Errorf("infilled file is invalid: %v", err)
+	}
+	return out, nil
+}
+
+// infillNames are the names of the functions written by AddInfill.
+type infillNames struct {
+	solid, occupied, interior, lattice string
+}
+
+// occupiedFunc returns the function that sums the model's materials,
+// which are 0 outside its bounding box.
+func (n infillNames) occupiedFunc(lang string, m *Model) string {
+	var sum []string
+	for i := range m.Materials {
+		sum = append(sum, fmt.Sprintf("m[%v]", i))
+	}
+	if lang == "wgsl" {
+		return fmt.Sprintf(`
+fn %v(xyz: vec3f) -> f32 {
+  if (any(xyz < %v) || any(xyz > %v)) {
+    return 0.0;
+  }
+  let m = %v(xyz);
+  return clamp(%v, 0.0, 1.0);
+}
+`, n.occupied, vec3Literal(lang, [3]float64(m.Min)), vec3Literal(lang, [3]float64(m.Max)), n.solid, strings.Join(sum, " + "))
+	}
+	return fmt.Sprintf(`
+float %v(in vec3 xyz) {
+  if (any(lessThan(xyz, %v)) || any(greaterThan(xyz, %v))) {
+    return 0.0;
+  }
+  vec4 m;
+  %v(m, xyz);
+  return clamp(%v, 0.0, 1.0);
+}
+`, n.occupied, vec3Literal(lang, [3]float64(m.Min)), vec3Literal(lang, [3]float64(m.Max)), n.solid, strings.Join(sum, " + "))
+}
+
+// interiorFunc returns the function that is 1 inside the shell.
+func (n infillNames) interiorFunc(lang string, shell float64) string {
+	var sb strings.Builder
+	if lang == "wgsl" {
+		fmt.Fprintf(&sb, "\nfn %v(xyz: vec3f) -> f32 {\n  var s = %v(xyz);\n", n.interior, n.occupied)
+	} else {
+		fmt.Fprintf(&sb, "\nfloat %v(in vec3 xyz) {\n  float s = %v(xyz);\n", n.interior, n.occupied)
+	}
+	if shell > 0 {
+		d := 1 / math.Sqrt(3)
+		dirs := [][3]float64{
+			{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1},
+			{d, d, d}, {d, d, -d}, {d, -d, d}, {d, -d, -d}, {-d, d, d}, {-d, d, -d}, {-d, -d, d}, {-d, -d, -d},
+		}
+		for _, r := range []float64{shell, shell / 2} {
+			for _, dir := range dirs {
+				v := [3]float64{roundNoise(r * dir[0]), roundNoise(r * dir[1]), roundNoise(r * dir[2])}
+				fmt.Fprintf(&sb, "  s = min(s, %v(xyz + %v));\n", n.occupied, vec3Literal(lang, v))
+			}
+		}
+	}
+	sb.WriteString("  return s;\n}\n")
+	return sb.String()
+}
+
+// latticeBodies are the bodies of the lattice functions in GLSL and
+// WGSL in terms of the cell size {C}, half the wall thickness {H}, and
+// {K} = 2*pi/{C}.
+var latticeBodies = map[string][2]string{
+	// The distance to the surface is estimated as |v|/|grad v|.
+	"gyroid": {`  vec3 s = sin({K} * xyz);
+  vec3 c = cos({K} * xyz);
+  float v = s.x * c.y + s.y * c.z + s.z * c.x;
+  vec3 g = {K} * vec3(c.x * c.y - s.z * s.x, c.y * c.z - s.x * s.y, c.z * c.x - s.y * s.z);
+  return abs(v) <= {H} * length(g) ? 1.0 : 0.0;
+`, `  let s = sin({K} * xyz);
+  let c = cos({K} * xyz);
+  let v = s.x * c.y + s.y * c.z + s.z * c.x;
+  let g = {K} * vec3f(c.x * c.y - s.z * s.x, c.y * c.z - s.x * s.y, c.z * c.x - s.y * s.z);
+  return select(0.0, 1.0, abs(v) <= {H} * length(g));
+`},
+	"schwarz-p": {`  vec3 p = {K} * xyz;
+  float v = cos(p.x) + cos(p.y) + cos(p.z);
+  return abs(v) <= {H} * {K} * length(sin(p)) ? 1.0 : 0.0;
+`, `  let p = {K} * xyz;
+  let v = cos(p.x) + cos(p.y) + cos(p.z);
+  return select(0.0, 1.0, abs(v) <= {H} * {K} * length(sin(p)));
+`},
+	// A point is on a strut when it is near the cell's faces along two
+	// of the axes.
+	"cubic": {`  vec3 p = xyz - {C} * floor(xyz / {C});
+  vec3 near = step(min(p, {C} - p), vec3({H}));
+  return near.x + near.y + near.z >= 2.0 ? 1.0 : 0.0;
+`, `  let p = xyz - {C} * floor(xyz / {C});
+  let near = step(min(p, {C} - p), vec3f({H}));
+  return select(0.0, 1.0, near.x + near.y + near.z >= 2.0);
+`},
+	"spheres": {`  vec3 p = xyz - {C} * floor(xyz / {C}) - vec3(0.5 * {C});
+  return abs(length(p) - 0.5 * {C}) <= {H} ? 1.0 : 0.0;
+`, `  let p = xyz - {C} * floor(xyz / {C}) - vec3f(0.5 * {C});
+  return select(0.0, 1.0, abs(length(p) - 0.5 * {C}) <= {H});
+`},
+}
+
+// latticeFunc returns the function that is 1 on the lattice's walls.
+func (n infillNames) latticeFunc(lang string, bodies [2]string, f Infill) string {
+	r := strings.NewReplacer(
+		"{C}", shaderFloat(f.Cell),
+		"{H}", shaderFloat(f.Wall/2),
+		"{K}", shaderFloat(2*math.Pi/f.Cell),
+	)
+	if lang == "wgsl" {
+		return fmt.Sprintf("\nfn %v(xyz: vec3f) -> f32 {\n%v}\n", n.lattice, r.Replace(bodies[1]))
+	}
+	return fmt.Sprintf("\nfloat %v(in vec3 xyz) {\n%v}\n", n.lattice, r.Replace(bodies[0]))
+}
+
+// mainFunc returns the new entry point.
+func (n infillNames) mainFunc(lang string) string {
+	if lang == "wgsl" {
+		return fmt.Sprintf(`
+fn mainModel4(xyz: vec3f) -> vec4f {
+  if (%v(xyz) >= 0.5 && %v(xyz) < 0.5) {
+    return vec4f(0.0);
+  }
+  return %v(xyz);
+}
+`, n.interior, n.lattice, n.solid)
+	}
+	return fmt.Sprintf(`
+void mainModel4(out vec4 materials, in vec3 xyz) {
+  %v(materials, xyz);
+  if (%v(xyz) >= 0.5 && %v(xyz) < 0.5) {
+    materials = vec4(0.0);
+  }
+}
+`, n.solid, n.interior, n.lattice)
+}
+
+// vec3Literal formats v as a vector literal in lang.
+func vec3Literal(lang string, v [3]float64) string {
+	vec3 := "vec3"
+	if lang == "wgsl" {
+		vec3 = "vec3f"
+	}
+	return fmt.Sprintf("%v(%v, %v, %v)", vec3, shaderFloat(v[0]), shaderFloat(v[1]), shaderFloat(v[2]))
+}
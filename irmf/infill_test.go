@@ -0,0 +1,122 @@
+package irmf
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAddInfill(t *testing.T) {
+	// The cube fills [-5,5]³ with 1.0 everywhere, so its shell can only
+	// be found by probing. With 4mm cells, the cubic lattice's struts run
+	// along the lines where two coordinates are multiples of 4.
+	cubic := Infill{Lattice: "cubic", Shell: 1, Cell: 4, Wall: 0.5}
+	tests := []struct {
+		file   string
+		f      Infill
+		points map[[3]float64]float64
+	}{
+		{
+			file: "../examples/002-cube/cube-1.irmf",
+			f:    cubic,
+			points: map[[3]float64]float64{
+				{4.5, 0.3, 0.3}:   1, // in the shell
+				{-0.3, -4.7, 1}:   1, // in the shell
+				{0.1, 0.1, 1.5}:   1, // on a strut along Z
+				{4.1, 1.5, -0.1}:  1, // in the shell
+				{1, 1, 1}:         0, // off the lattice
+				{2, -2, 3.9}:      0, // off the lattice
+				{-3.9, 0.1, 1.5}:  1, // near a strut along Z at x=-4
+				{-1.5, 0.2, -2.5}: 0, // near only one face
+			},
+		},
+		{
+			file: "../examples/002-cube/cube-1.irmf",
+			f:    Infill{Lattice: "cubic", Cell: 4, Wall: 0.5},
+			points: map[[3]float64]float64{
+				{4.5, 0.3, 0.3}: 0, // no shell
+				{4.1, 0.1, 0.1}: 1, // on a strut along X
+			},
+		},
+		{
+			file: "../examples/002-cube/cube-1-wgsl.irmf",
+			f:    cubic,
+			points: map[[3]float64]float64{
+				{4.5, 0.3, 0.3}: 1,
+				{0.1, 0.1, 1.5}: 1,
+				{1, 1, 1}:       0,
+			},
+		},
+		{
+			// The sphere has a radius of 5.
+			file: "../examples/001-sphere/sphere-1.irmf",
+			f:    Infill{Lattice: "spheres", Shell: 1, Cell: 4, Wall: 0.5},
+			points: map[[3]float64]float64{
+				{0, 4.5, 0}:   1, // in the shell
+				{3.5, 3.5, 0}: 1, // in the shell
+				{2, 2, 0.1}:   1, // on the hollow sphere of the cell [0,4]³ centered at (2,2,2)
+				{2, 2, 2}:     0, // at the center of that hollow sphere
+				{0, 0, 0}:     0, // where eight cells meet, outside their spheres
+				{0, 0, 5.5}:   0, // outside the model
+			},
+		},
+		{
+			file: "../examples/001-sphere/sphere-1.irmf",
+			f:    Infill{Lattice: "gyroid", Shell: 0.5, Cell: 4, Wall: 0.8},
+			points: map[[3]float64]float64{
+				{0, 0, 4.8}: 1, // in the shell
+				{0, 0, 0}:   1, // on the gyroid, which passes through the origin
+				{1, 1, 0}:   0, // off the gyroid
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file+" "+tt.f.Lattice, func(t *testing.T) {
+			src, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := AddInfill(src, tt.f)
+			if err != nil {
+				t.Fatalf("AddInfill: %v", err)
+			}
+			m, err := Parse(out)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			p, err := m.Compile()
+			if err != nil {
+				t.Fatalf("Compile: %v\n%v", err, m.Shader)
+			}
+			e := p.NewEvaluator()
+			values := make([]float64, p.NumMaterials())
+			for pt, want := range tt.points {
+				e.Eval(pt[0], pt[1], pt[2], values)
+				if values[0] != want {
+					t.Errorf("at %v: material = %v, want %v", pt, values[0], want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddInfillErrors(t *testing.T) {
+	src, err := os.ReadFile("../examples/002-cube/cube-1.irmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		f       Infill
+		wantErr string
+	}{
+		{Infill{Lattice: "cubic", Shell: -1, Cell: 4, Wall: 1}, "invalid infill"},
+		{Infill{Lattice: "cubic", Shell: 1, Cell: 4, Wall: 4}, "invalid infill"},
+		{Infill{Lattice: "cubic", Shell: 1, Cell: 0, Wall: 1}, "invalid infill"},
+		{Infill{Lattice: "honeycomb", Shell: 1, Cell: 4, Wall: 1}, `unknown lattice "honeycomb"`},
+	}
+	for _, tt := range tests {
+		if _, err := AddInfill(src, tt.f); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("AddInfill(%+v) error = %v, want %q", tt.f, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package irmf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Inline directives keep a copy of a shared library file inside an IRMF
+// file for languages (such as WGSL) or tools that cannot #include it:
+//
+//	//irmf:inline rotation.wgsl
+//	... the contents of rotation.wgsl ...
+//	//irmf:end
+//
+// The library is found relative to the directory of the IRMF file.
+var inlineRE = regexp.MustCompile(`^//irmf:inline\s+(\S+)\s*$`)
+
+const inlineEnd = "//irmf:end"
+
+// Inline returns the IRMF source src with the lines between each inline
+// directive and its end marker replaced by the current contents of the
+// library file in dir, and the names of the libraries used.
+func Inline(src []byte, dir string) ([]byte, []string, error) {
+	lines := strings.Split(string(src), "\n")
+	var out, libs []string
+	for i := 0; i < len(lines); i++ {
+		out = append(out, lines[i])
+		m := inlineRE.FindStringSubmatch(strings.TrimRight(lines[i], "\r"))
+		if m == nil {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && strings.TrimSpace(lines[end]) != inlineEnd {
+			if inlineRE.MatchString(lines[end]) {
+				return nil, nil, fmt.Errorf("line %v: nested //irmf:inline", end+1)
+			}
+			end++
+		}
+		if end == len(lines) {
+			return nil, nil, fmt.Errorf("line %v: missing %v for %v", i+1, inlineEnd, m[1])
+		}
+		buf, err := os.ReadFile(filepath.Join(dir, m[1]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %v: %v", i+1, err)
+		}
+		out = append(out, strings.TrimRight(string(buf), "\n"), lines[end])
+		libs = append(libs, m[1])
+		i = end
+	}
+	return []byte(strings.Join(out, "\n")), libs, nil
+}
+
+// InlineFile is like Inline for the named IRMF file.
+func InlineFile(filename string) (got, want []byte, libs []string, err error) {
+	got, err = os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	want, libs, err = Inline(got, filepath.Dir(filename))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return got, want, libs, nil
+}
@@ -0,0 +1,206 @@
+// Package irmf reads IRMF shader files: the JSON header, the (optionally
+// compressed) shader source, and its #include directives.
+//
+// It is a dependency-free (no OpenGL) counterpart to the irmf package of
+// https://github.com/gmlewis/irmf-slicer so that IRMF files can be
+// processed on machines without a GPU.
+package irmf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Model represents an IRMF shader file.
+type Model struct {
+	Author    string          `json:"author,omitempty"`
+	Copyright string          `json:"copyright,omitempty"`
+	Date      string          `json:"date,omitempty"`
+	Encoding  string          `json:"encoding,omitempty"`
+	IRMF      string          `json:"irmf"`
+	Language  string          `json:"language,omitempty"`
+	License   string          `json:"license,omitempty"`
+	Materials []string        `json:"materials"`
+	Max       []float64       `json:"max"`
+	Min       []float64       `json:"min"`
+	Notes     string          `json:"notes,omitempty"`
+	Options   json.RawMessage `json:"options,omitempty"`
+	Title     string          `json:"title,omitempty"`
+	Units     string          `json:"units"`
+	Version   string          `json:"version,omitempty"`
+
+	// Header is the raw JSON header (without the surrounding "/*" and "*/").
+	Header string `json:"-"`
+	// Shader is the decoded shader source (with #includes left untouched).
+	Shader string `json:"-"`
+}
+
+var (
+	trailingCommaRE = regexp.MustCompile(`,(\s*[}\]])`)
+	unquotedKeyRE   = regexp.MustCompile(`(?m)^(\s*)([A-Za-z_][A-Za-z0-9_]*)\s*:`)
+)
+
+// ReadFile reads and parses the named IRMF file.
+func ReadFile(filename string) (*Model, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return m, nil
+}
+
+// Parse parses the IRMF source and validates its header.
+func Parse(src []byte) (*Model, error) {
+	if !bytes.HasPrefix(src, []byte("/*{")) {
+		return nil, errors.New(`unable to find leading "/*{"`)
+	}
+	endJSON := bytes.Index(src, []byte("\n}*/"))
+	if endJSON < 0 {
+		return nil, errors.New(`unable to find trailing "}*/"`)
+	}
+
+	header := string(src[2 : endJSON+2])
+	m, err := parseHeader(header)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON header: %v", err)
+	}
+	m.Header = header
+
+	body := src[endJSON+4:]
+	if len(body) > 0 && body[0] == '\n' {
+		body = body[1:]
+	}
+	switch m.Encoding {
+	case "":
+		m.Shader = string(body)
+	case "gzip":
+		if m.Shader, err = gunzip(body); err != nil {
+			return nil, fmt.Errorf("gzip: %v", err)
+		}
+	case "gzip+base64":
+		data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(strings.Join(strings.Fields(string(body)), ""), "="))
+		if err != nil {
+			return nil, fmt.Errorf("base64: %v", err)
+		}
+		if m.Shader, err = gunzip(data); err != nil {
+			return nil, fmt.Errorf("gzip: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q; possible values are 'gzip' or 'gzip+base64'", m.Encoding)
+	}
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseHeader parses the JSON header, allowing JavaScript-style
+// unquoted keys and trailing commas.
+func parseHeader(s string) (*Model, error) {
+	m := &Model{}
+	if err := json.Unmarshal([]byte(s), m); err == nil {
+		return m, nil
+	}
+	s = trailingCommaRE.ReplaceAllString(s, "$1")
+	s = unquotedKeyRE.ReplaceAllString(s, `$1"$2":`)
+	if err := json.Unmarshal([]byte(s), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func gunzip(data []byte) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	buf, err := io.ReadAll(zr)
+	if err != nil {
+		return "", err
+	}
+	if err := zr.Close(); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func (m *Model) validate() error {
+	if m.IRMF != "1.0" {
+		return fmt.Errorf("unsupported IRMF version: %q", m.IRMF)
+	}
+	if len(m.Materials) < 1 {
+		return errors.New("must list at least one material name")
+	}
+	if len(m.Materials) > 16 {
+		return fmt.Errorf("IRMF 1.0 only supports up to 16 materials, found %v", len(m.Materials))
+	}
+	if len(m.Min) != 3 {
+		return fmt.Errorf("min must have 3 values, found %v", len(m.Min))
+	}
+	if len(m.Max) != 3 {
+		return fmt.Errorf("max must have 3 values, found %v", len(m.Max))
+	}
+	for i, axis := range "xyz" {
+		if m.Min[i] >= m.Max[i] {
+			return fmt.Errorf("min.%c (%v) must be strictly less than max.%c (%v)", axis, m.Min[i], axis, m.Max[i])
+		}
+	}
+	if m.Units == "" {
+		return errors.New("units are required by IRMF 1.0")
+	}
+	switch m.Lang() {
+	case "glsl", "wgsl":
+	default:
+		return fmt.Errorf("unsupported language %q", m.Language)
+	}
+	if fn := m.MainFunc(); !strings.Contains(m.Shader, fn) {
+		return fmt.Errorf("found %v materials, but missing %q function", len(m.Materials), fn)
+	}
+	return nil
+}
+
+// Lang returns the shader language, "glsl" (the default) or "wgsl".
+func (m *Model) Lang() string {
+	if m.Language == "" {
+		return "glsl"
+	}
+	return strings.ToLower(m.Language)
+}
+
+// MainFunc returns the name of the entry point required by the number
+// of materials: mainModel4, mainModel9, or mainModel16.
+func (m *Model) MainFunc() string {
+	switch n := len(m.Materials); {
+	case n <= 4:
+		return "mainModel4"
+	case n <= 9:
+		return "mainModel9"
+	default:
+		return "mainModel16"
+	}
+}
+
+// MaterialName returns the 1-based material name with spaces replaced
+// by dashes, as used in output filenames.
+func (m *Model) MaterialName(materialNum int) string {
+	return strings.ReplaceAll(m.Materials[materialNum-1], " ", "-")
+}
+
+// OutputName returns the conventional name of a per-material output
+// file such as "base-mat01-PLA.stl".
+func (m *Model) OutputName(baseFilename string, materialNum int, ext string) string {
+	return fmt.Sprintf("%v-mat%02d-%v%v", baseFilename, materialNum, m.MaterialName(materialNum), ext)
+}
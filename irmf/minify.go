@@ -0,0 +1,113 @@
+package irmf
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+// Minify returns the model's shader minified by shader.Minify, with
+// lines of about width columns. Any #include directives must already
+// have been expanded (see ExpandIncludes).
+//
+// To guarantee that the minified shader evaluates identically, both
+// shaders are compiled and compared at the points of a lattice with n
+// cells along the longest side of the bounding box plus one random point
+// per cell; every material value must match exactly.
+func (m *Model) Minify(n, width, workers int) (string, error) {
+	p1, err := m.Compile()
+	if err != nil {
+		return "", err
+	}
+	small, err := shader.Minify(m.Lang(), m.Shader, m.MainFunc(), width)
+	if err != nil {
+		return "", fmt.Errorf("minifying shader: %v", err)
+	}
+	p2, err := shader.Compile(m.Lang(), small, m.MainFunc())
+	if err != nil {
+		return "", fmt.Errorf("compiling minified shader: %v", err)
+	}
+	if x, y, z, ok := sameOutputs(p1, p2, m, n, workers, nil); !ok {
+		return "", fmt.Errorf("minified shader differs at (%v,%v,%v)", x, y, z)
+	}
+	return small, nil
+}
+
+// sameOutputs compares two programs at the corners of the cells and at
+// one random point per cell of m's bounding box, returning the first
+// point that differs. If to is not nil, it maps the points to the
+// coordinates of p2.
+func sameOutputs(p1, p2 *shader.Program, m *Model, n, workers int, to func(x, y, z float64) (float64, float64, float64)) (x, y, z float64, ok bool) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	longest := 0.0
+	for i := range m.Min {
+		longest = math.Max(longest, m.Max[i]-m.Min[i])
+	}
+	g := m.Grid(longest / float64(max(1, n)))
+
+	var mu sync.Mutex
+	ok = true
+	slabs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e1, e2 := p1.NewEvaluator(), p2.NewEvaluator()
+			out1 := make([]float64, p1.NumMaterials())
+			out2 := make([]float64, p2.NumMaterials())
+			for k := range slabs {
+				rng := rand.New(rand.NewPCG(1, uint64(k)))
+				for j := 0; j < g.N[1]; j++ {
+					for i := 0; i < g.N[0]; i++ {
+						px, py, pz := g.Point(i, j, k)
+						for pass := 0; pass < 2; pass++ {
+							qx, qy, qz := px, py, pz
+							if to != nil {
+								qx, qy, qz = to(px, py, pz)
+							}
+							e1.Eval(px, py, pz, out1)
+							e2.Eval(qx, qy, qz, out2)
+							if !sameValues(out1, out2) {
+								mu.Lock()
+								if ok {
+									x, y, z, ok = px, py, pz, false
+								}
+								mu.Unlock()
+							}
+							px += rng.Float64() * g.Step
+							py += rng.Float64() * g.Step
+							pz += rng.Float64() * g.Step
+						}
+					}
+				}
+			}
+		}()
+	}
+	for k := 0; k < g.N[2]; k++ {
+		slabs <- k
+	}
+	close(slabs)
+	wg.Wait()
+	return x, y, z, ok
+}
+
+// sameValues reports whether a and b hold the same values, bit for bit
+// (treating all NaNs as equal).
+func sameValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Float64bits(a[i]) != math.Float64bits(b[i]) && !(math.IsNaN(a[i]) && math.IsNaN(b[i])) {
+			return false
+		}
+	}
+	return true
+}
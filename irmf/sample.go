@@ -0,0 +1,95 @@
+package irmf
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+// Compile compiles the model's shader for CPU evaluation. Any #include
+// directives must already have been expanded (see ExpandIncludes).
+func (m *Model) Compile() (*shader.Program, error) {
+	p, err := shader.Compile(m.Lang(), m.Shader, m.MainFunc())
+	if err != nil {
+		return nil, fmt.Errorf("compiling shader: %v", err)
+	}
+	if p.NumMaterials() < len(m.Materials) {
+		return nil, fmt.Errorf("%v produces %v materials but the header lists %v", m.MainFunc(), p.NumMaterials(), len(m.Materials))
+	}
+	return p, nil
+}
+
+// Grid is a regular lattice of sample points: point (i,j,k) is at
+// Min + (i,j,k)*Step for 0 <= i < N[0], etc.
+type Grid struct {
+	Min  [3]float64
+	Step float64
+	N    [3]int
+}
+
+// Grid returns the lattice covering the model's bounding box with the
+// given spacing between samples.
+func (m *Model) Grid(step float64) Grid {
+	g := Grid{Step: step}
+	for i := range g.N {
+		g.Min[i] = m.Min[i]
+		g.N[i] = int(math.Ceil((m.Max[i]-m.Min[i])/step-1e-9)) + 1
+	}
+	return g
+}
+
+// Point returns the position of lattice point (i,j,k).
+func (g Grid) Point(i, j, k int) (x, y, z float64) {
+	return g.Min[0] + float64(i)*g.Step, g.Min[1] + float64(j)*g.Step, g.Min[2] + float64(k)*g.Step
+}
+
+// Len returns the number of lattice points.
+func (g Grid) Len() int { return g.N[0] * g.N[1] * g.N[2] }
+
+// Index returns the offset of lattice point (i,j,k) in a sampled field.
+func (g Grid) Index(i, j, k int) int { return (k*g.N[1]+j)*g.N[0] + i }
+
+// Sample evaluates p at every point of g using the given number of
+// goroutines (0 means one per CPU). It returns one field per material
+// with values clamped to [0,1], as the GPU does when rendering.
+func Sample(p *shader.Program, g Grid, numMaterials, workers int) [][]float32 {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	fields := make([][]float32, numMaterials)
+	for i := range fields {
+		fields[i] = make([]float32, g.Len())
+	}
+
+	slices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e := p.NewEvaluator()
+			out := make([]float64, p.NumMaterials())
+			for k := range slices {
+				for j := 0; j < g.N[1]; j++ {
+					for i := 0; i < g.N[0]; i++ {
+						x, y, z := g.Point(i, j, k)
+						e.Eval(x, y, z, out)
+						idx := g.Index(i, j, k)
+						for n, f := range fields {
+							f[idx] = float32(math.Max(0, math.Min(1, out[n])))
+						}
+					}
+				}
+			}
+		}()
+	}
+	for k := 0; k < g.N[2]; k++ {
+		slices <- k
+	}
+	close(slices)
+	wg.Wait()
+	return fields
+}
@@ -0,0 +1,2 @@
+// util from common
+float util(float x) { return x; }
@@ -0,0 +1,2 @@
+// local from models
+#include "../common/util.glsl"
@@ -0,0 +1,5 @@
+// saturate from path2
+#ifndef FNC_SATURATE
+#define FNC_SATURATE
+#define saturate(x) clamp(x, 0.0, 1.0)
+#endif
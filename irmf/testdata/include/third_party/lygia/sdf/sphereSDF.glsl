@@ -0,0 +1,6 @@
+// sphereSDF from third_party
+#include "../math/saturate.glsl"
+#ifndef FNC_SPHERESDF
+#define FNC_SPHERESDF
+float sphereSDF(vec3 p, float s) { return length(p) - s; }
+#endif
@@ -0,0 +1,257 @@
+package irmf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Affine is the transform that moves point p to M*p + T.
+type Affine struct {
+	M [3][3]float64 // row-major
+	T [3]float64
+}
+
+// Identity is the transform that leaves every point in place.
+var Identity = Affine{M: [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}}
+
+// Rotation returns the rotation by the given angle (in degrees) about
+// the axis through the origin, counterclockwise when looking down the
+// axis towards the origin.
+func Rotation(axis [3]float64, degrees float64) (Affine, error) {
+	n := math.Sqrt(axis[0]*axis[0] + axis[1]*axis[1] + axis[2]*axis[2])
+	if n == 0 {
+		return Affine{}, errors.New("rotation axis must not be zero")
+	}
+	x, y, z := axis[0]/n, axis[1]/n, axis[2]/n
+	s, c := sincos(degrees)
+	t := 1 - c
+	return Affine{M: [3][3]float64{
+		{t*x*x + c, t*x*y - s*z, t*x*z + s*y},
+		{t*x*y + s*z, t*y*y + c, t*y*z - s*x},
+		{t*x*z - s*y, t*y*z + s*x, t*z*z + c},
+	}}, nil
+}
+
+// EulerRotation returns the rotation about the X axis by x degrees,
+// followed by the rotation about the Y axis by y degrees, followed by
+// the rotation about the Z axis by z degrees.
+func EulerRotation(x, y, z float64) Affine {
+	rx, _ := Rotation([3]float64{1, 0, 0}, x)
+	ry, _ := Rotation([3]float64{0, 1, 0}, y)
+	rz, _ := Rotation([3]float64{0, 0, 1}, z)
+	return rx.Then(ry).Then(rz)
+}
+
+// sincos returns the sine and cosine of an angle in degrees, exactly for
+// multiples of 90 degrees.
+func sincos(degrees float64) (s, c float64) {
+	if q := degrees / 90; q == math.Trunc(q) {
+		switch int(math.Mod(math.Mod(q, 4)+4, 4)) {
+		case 0:
+			return 0, 1
+		case 1:
+			return 1, 0
+		case 2:
+			return 0, -1
+		default:
+			return -1, 0
+		}
+	}
+	return math.Sincos(degrees * math.Pi / 180)
+}
+
+// Scaling returns the transform that scales each axis about the origin.
+func Scaling(s [3]float64) Affine {
+	return Affine{M: [3][3]float64{{s[0], 0, 0}, {0, s[1], 0}, {0, 0, s[2]}}}
+}
+
+// Translation returns the transform that moves every point by t.
+func Translation(t [3]float64) Affine {
+	a := Identity
+	a.T = t
+	return a
+}
+
+// Then returns the transform that applies a and then b.
+func (a Affine) Then(b Affine) Affine {
+	var r Affine
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				r.M[i][j] += b.M[i][k] * a.M[k][j]
+			}
+		}
+		r.T[i] = b.T[i]
+		for k := 0; k < 3; k++ {
+			r.T[i] += b.M[i][k] * a.T[k]
+		}
+	}
+	return r
+}
+
+// Apply returns the transformed point p.
+func (a Affine) Apply(p [3]float64) [3]float64 {
+	var r [3]float64
+	for i := range r {
+		r[i] = a.M[i][0]*p[0] + a.M[i][1]*p[1] + a.M[i][2]*p[2] + a.T[i]
+	}
+	return r
+}
+
+// Inverse returns the transform that undoes a.
+func (a Affine) Inverse() (Affine, error) {
+	m := a.M
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if det == 0 || math.IsNaN(det) {
+		return Affine{}, errors.New("transform is not invertible")
+	}
+	var r Affine
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// The inverse is the transposed matrix of cofactors over det.
+			i1, i2 := (j+1)%3, (j+2)%3
+			j1, j2 := (i+1)%3, (i+2)%3
+			r.M[i][j] = (m[i1][j1]*m[i2][j2] - m[i1][j2]*m[i2][j1]) / det
+			if r.M[i][j] == 0 {
+				r.M[i][j] = 0 // not -0
+			}
+		}
+	}
+	for i := range r.T {
+		r.T[i] = -(r.M[i][0]*a.T[0] + r.M[i][1]*a.T[1] + r.M[i][2]*a.T[2])
+	}
+	return r, nil
+}
+
+// undo maps a transformed point back to the original model, computing
+// inv.M * (p - T) exactly as the wrapper written by Transform does.
+func (a Affine) undo(inv Affine, p [3]float64) [3]float64 {
+	var d, r [3]float64
+	for i := range d {
+		d[i] = p[i] - a.T[i]
+	}
+	for i := range r {
+		var sum float64
+		for k := 0; k < 3; k++ {
+			sum += inv.M[i][k] * d[k]
+		}
+		r[i] = sum
+	}
+	return r
+}
+
+// Box returns the bounding box of m's bounding box moved by a.
+func (a Affine) Box(m *Model) (min, max [3]float64) {
+	min = [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	max = [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for c := 0; c < 8; c++ {
+		var corner [3]float64
+		for i := range corner {
+			corner[i] = m.Min[i]
+			if c&(1<<i) != 0 {
+				corner[i] = m.Max[i]
+			}
+		}
+		p := a.Apply(corner)
+		for i := range p {
+			min[i] = math.Min(min[i], roundNoise(p[i]))
+			max[i] = math.Max(max[i], roundNoise(p[i]))
+		}
+	}
+	return min, max
+}
+
+// undoExpr returns the shader expression in lang of the position xyz
+// mapped back by inv, the inverse of a (see undo).
+func (a Affine) undoExpr(inv Affine, lang string) string {
+	vec3, mat3 := "vec3", "mat3"
+	if lang == "wgsl" {
+		vec3, mat3 = "vec3f", "mat3x3f"
+	}
+	expr := "xyz"
+	if a.T != [3]float64{} {
+		expr = fmt.Sprintf("(xyz - %v(%v, %v, %v))", vec3, shaderFloat(a.T[0]), shaderFloat(a.T[1]), shaderFloat(a.T[2]))
+	}
+	if inv.M != Identity.M {
+		// Both languages take the matrix column by column.
+		var cols []string
+		for j := 0; j < 3; j++ {
+			for i := 0; i < 3; i++ {
+				cols = append(cols, shaderFloat(inv.M[i][j]))
+			}
+		}
+		expr = fmt.Sprintf("%v(%v) * %v", mat3, strings.Join(cols, ", "), expr)
+	}
+	return expr
+}
+
+// Transform returns the IRMF source src with its model moved by a: the
+// entry point is renamed (for example, to mainModel4_untransformed) and
+// called from a new entry point with the inverse-transformed position,
+// and the header's "min" and "max" are replaced by the bounding box of
+// the transformed box (see SetBounds). The rest of the shader is left
+// untouched. Encoded shaders must be decoded first (see
+// cmd/irmf-flatten).
+func Transform(src []byte, a Affine) ([]byte, error) {
+	m, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if m.Encoding != "" {
+		return nil, fmt.Errorf("cannot transform a shader with %q encoding", m.Encoding)
+	}
+	inv, err := a.Inverse()
+	if err != nil {
+		return nil, err
+	}
+
+	min, max := a.Box(m)
+	out, err := SetBounds(src, min, max)
+	if err != nil {
+		return nil, err
+	}
+	end := bytes.Index(out, []byte("\n}*/"))
+	expr := a.undoExpr(inv, m.Lang())
+	body, err := wrapEntry(m, string(out[end:]), "_untransformed", "Transformed: move the position back to the untransformed model.", expr)
+	if err != nil {
+		return nil, err
+	}
+
+	out = append(out[:end:end], body...)
+	if _, err := Parse(out); err != nil {
+		return nil, fmt.Errorf("transformed file is invalid: %v", err)
+	}
+	return out, nil
+}
+
+// CheckTransform compares a model transformed by a with the original at
+// the points of a lattice with n cells along the longest side of the
+// transformed model's box plus one random point per cell (as in Minify),
+// and returns an error unless every material value matches exactly.
+func CheckTransform(transformed, original *Model, a Affine, n, workers int) error {
+	p1, err := transformed.Compile()
+	if err != nil {
+		return err
+	}
+	p2, err := original.Compile()
+	if err != nil {
+		return err
+	}
+	inv, err := a.Inverse()
+	if err != nil {
+		return err
+	}
+	x, y, z, ok := sameOutputs(p1, p2, transformed, n, workers, func(x, y, z float64) (float64, float64, float64) {
+		p := a.undo(inv, [3]float64{x, y, z})
+		return p[0], p[1], p[2]
+	})
+	if !ok {
+		return fmt.Errorf("transformed model differs at (%v,%v,%v)", x, y, z)
+	}
+	return nil
+}
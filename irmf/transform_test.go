@@ -0,0 +1,231 @@
+package irmf
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func near(a, b [3]float64) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-12 {
+			return false
+		}
+	}
+	return true
+}
+
+func mustRotation(t *testing.T, axis [3]float64, degrees float64) Affine {
+	t.Helper()
+	r, err := Rotation(axis, degrees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRotation(t *testing.T) {
+	tests := []struct {
+		axis    [3]float64
+		degrees float64
+		p, want [3]float64
+	}{
+		{axis: [3]float64{0, 0, 1}, degrees: 90, p: [3]float64{1, 0, 0}, want: [3]float64{0, 1, 0}},
+		{axis: [3]float64{0, 0, 2}, degrees: -90, p: [3]float64{1, 0, 0}, want: [3]float64{0, -1, 0}},
+		{axis: [3]float64{1, 0, 0}, degrees: 90, p: [3]float64{0, 1, 0}, want: [3]float64{0, 0, 1}},
+		{axis: [3]float64{0, 1, 0}, degrees: 90, p: [3]float64{0, 0, 1}, want: [3]float64{1, 0, 0}},
+		{axis: [3]float64{0, 1, 0}, degrees: 450, p: [3]float64{0, 0, 1}, want: [3]float64{1, 0, 0}},
+		{axis: [3]float64{1, 1, 1}, degrees: 120, p: [3]float64{1, 0, 0}, want: [3]float64{0, 1, 0}},
+		{axis: [3]float64{0, 0, 1}, degrees: 45, p: [3]float64{1, 1, 5}, want: [3]float64{0, math.Sqrt2, 5}},
+	}
+	for _, tt := range tests {
+		if got := mustRotation(t, tt.axis, tt.degrees).Apply(tt.p); !near(got, tt.want) {
+			t.Errorf("Rotation(%v, %v).Apply(%v) = %v, want %v", tt.axis, tt.degrees, tt.p, got, tt.want)
+		}
+	}
+	if _, err := Rotation([3]float64{}, 90); err == nil {
+		t.Error("Rotation about a zero axis succeeded")
+	}
+}
+
+func TestCompositionOrder(t *testing.T) {
+	rotZ := mustRotation(t, [3]float64{0, 0, 1}, 90)
+	move := Translation([3]float64{1, 0, 0})
+	tests := []struct {
+		name    string
+		a       Affine
+		p, want [3]float64
+	}{
+		// X first takes +Y to +Z, which Z leaves alone; Z first would
+		// take +Y to -X, which X leaves alone.
+		{name: "EulerRotation(90,0,90)", a: EulerRotation(90, 0, 90), p: [3]float64{0, 1, 0}, want: [3]float64{0, 0, 1}},
+		// X first takes +Z to -Y, which Y leaves alone.
+		{name: "EulerRotation(90,90,0)", a: EulerRotation(90, 90, 0), p: [3]float64{0, 0, 1}, want: [3]float64{0, -1, 0}},
+		// Y first takes +Z to +X, then Z takes it to +Y.
+		{name: "EulerRotation(0,90,90)", a: EulerRotation(0, 90, 90), p: [3]float64{0, 0, 1}, want: [3]float64{0, 1, 0}},
+		{name: "move then rotate", a: move.Then(rotZ), p: [3]float64{}, want: [3]float64{0, 1, 0}},
+		{name: "rotate then move", a: rotZ.Then(move), p: [3]float64{}, want: [3]float64{1, 0, 0}},
+		{name: "scale then move", a: Scaling([3]float64{2, 3, 4}).Then(move), p: [3]float64{1, 1, 1}, want: [3]float64{3, 3, 4}},
+		{name: "move then scale", a: move.Then(Scaling([3]float64{2, 3, 4})), p: [3]float64{1, 1, 1}, want: [3]float64{4, 3, 4}},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Apply(tt.p); !near(got, tt.want) {
+			t.Errorf("%v: Apply(%v) = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestInverse(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       Affine
+		want    *Affine // if known exactly
+		wantErr bool
+	}{
+		{name: "identity", a: Identity, want: &Identity},
+		{
+			name: "scaled and moved",
+			a:    Scaling([3]float64{2, 4, 0.5}).Then(Translation([3]float64{1, 2, 3})),
+			want: &Affine{M: [3][3]float64{{0.5, 0, 0}, {0, 0.25, 0}, {0, 0, 2}}, T: [3]float64{-0.5, -0.5, -6}},
+		},
+		{name: "mirrored", a: Scaling([3]float64{-1, 1, 1})},
+		{name: "rotated, scaled, and moved", a: EulerRotation(30, 45, 60).Then(Scaling([3]float64{3, 3, 3})).Then(Translation([3]float64{-7, 0, 2}))},
+		{name: "flattened", a: Scaling([3]float64{1, 0, 1}), wantErr: true},
+		{name: "dependent rows", a: Affine{M: [3][3]float64{{1, 2, 3}, {2, 4, 6}, {0, 0, 1}}}, wantErr: true},
+		{name: "zero", a: Affine{}, wantErr: true},
+		{name: "NaN", a: Scaling([3]float64{math.NaN(), 1, 1}), wantErr: true},
+	}
+	points := [][3]float64{{0, 0, 0}, {1, 2, 3}, {-4, 0.5, 9}}
+	for _, tt := range tests {
+		inv, err := tt.a.Inverse()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%v: Inverse = %v, want an error", tt.name, inv)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: Inverse: %v", tt.name, err)
+			continue
+		}
+		if tt.want != nil && inv != *tt.want {
+			t.Errorf("%v: Inverse = %v, want %v", tt.name, inv, *tt.want)
+		}
+		for _, p := range points {
+			if got := inv.Apply(tt.a.Apply(p)); !near(got, p) {
+				t.Errorf("%v: Inverse undoes %v as %v", tt.name, p, got)
+			}
+			if got := tt.a.undo(inv, tt.a.Apply(p)); !near(got, p) {
+				t.Errorf("%v: undo of %v = %v", tt.name, p, got)
+			}
+		}
+	}
+}
+
+func TestBox(t *testing.T) {
+	m := &Model{Min: []float64{-1, -2, -3}, Max: []float64{1, 2, 3}}
+	tests := []struct {
+		name     string
+		a        Affine
+		min, max [3]float64
+	}{
+		{name: "identity", a: Identity, min: [3]float64{-1, -2, -3}, max: [3]float64{1, 2, 3}},
+		{name: "rotated 90 about Z", a: mustRotation(t, [3]float64{0, 0, 1}, 90), min: [3]float64{-2, -1, -3}, max: [3]float64{2, 1, 3}},
+		{name: "rotated 90 about X", a: mustRotation(t, [3]float64{1, 0, 0}, 90), min: [3]float64{-1, -3, -2}, max: [3]float64{1, 3, 2}},
+		{
+			name: "rotated 45 about Z",
+			a:    mustRotation(t, [3]float64{0, 0, 1}, 45),
+			min:  [3]float64{-1.5 * math.Sqrt2, -1.5 * math.Sqrt2, -3},
+			max:  [3]float64{1.5 * math.Sqrt2, 1.5 * math.Sqrt2, 3},
+		},
+		{name: "mirrored and moved", a: Scaling([3]float64{-2, 1, 1}).Then(Translation([3]float64{10, 0, 0})), min: [3]float64{8, -2, -3}, max: [3]float64{12, 2, 3}},
+	}
+	for _, tt := range tests {
+		min, max := tt.a.Box(m)
+		if !near(min, tt.min) || !near(max, tt.max) {
+			t.Errorf("%v: Box = %v, %v, want %v, %v", tt.name, min, max, tt.min, tt.max)
+		}
+	}
+}
+
+// asymmetricModel has material only where x > 2 and y > 0, so that a
+// transform in the wrong direction moves it.
+const asymmetricModel = `/*{
+  "irmf": "1.0",
+  "materials": ["PLA"],
+  "max": [5,5,5],
+  "min": [-5,-5,-5],
+  "units": "mm"
+}*/
+
+void mainModel4(out vec4 materials, in vec3 xyz) {
+  materials[0] = xyz.x > 2.0 && xyz.y > 0.0 ? 1.0 : 0.0;
+}
+`
+
+func TestTransformAndConvertUnits(t *testing.T) {
+	rotZ := mustRotation(t, [3]float64{0, 0, 1}, 90)
+	tests := []struct {
+		name     string
+		fn       func(src []byte) ([]byte, error)
+		units    string
+		min, max [3]float64
+		points   map[[3]float64]float64 // in the new model
+	}{
+		{
+			name:  "rotated and moved",
+			fn:    func(src []byte) ([]byte, error) { return Transform(src, rotZ.Then(Translation([3]float64{10, 0, 0}))) },
+			units: "mm",
+			min:   [3]float64{5, -5, -5},
+			max:   [3]float64{15, 5, 5},
+			// (3,1,0) is moved to (9,3,0) and (3,-1,0) to (11,3,0).
+			points: map[[3]float64]float64{{9, 3, 0}: 1, {11, 3, 0}: 0, {13, 1, 0}: 0},
+		},
+		{
+			name:   "scaled",
+			fn:     func(src []byte) ([]byte, error) { return Transform(src, Scaling([3]float64{2, 1, 1})) },
+			units:  "mm",
+			min:    [3]float64{-10, -5, -5},
+			max:    [3]float64{10, 5, 5},
+			points: map[[3]float64]float64{{4.5, 1, 0}: 1, {3.5, 1, 0}: 0, {8, -1, 0}: 0},
+		},
+		{
+			name:   "converted to cm",
+			fn:     func(src []byte) ([]byte, error) { return ConvertUnits(src, "cm") },
+			units:  "cm",
+			min:    [3]float64{-0.5, -0.5, -0.5},
+			max:    [3]float64{0.5, 0.5, 0.5},
+			points: map[[3]float64]float64{{0.3, 0.1, 0}: 1, {0.1, 0.1, 0}: 0, {0.3, -0.1, 0}: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.fn([]byte(asymmetricModel))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := Parse(out)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if m.Units != tt.units || !near([3]float64(m.Min), tt.min) || !near([3]float64(m.Max), tt.max) {
+				t.Errorf("header = %v %v %v, want %v %v %v", m.Min, m.Max, m.Units, tt.min, tt.max, tt.units)
+			}
+			p, err := m.Compile()
+			if err != nil {
+				t.Fatalf("Compile: %v\n%v", err, m.Shader)
+			}
+			e := p.NewEvaluator()
+			values := make([]float64, p.NumMaterials())
+			for pt, want := range tt.points {
+				e.Eval(pt[0], pt[1], pt[2], values)
+				if values[0] != want {
+					t.Errorf("at %v: material = %v, want %v", pt, values[0], want)
+				}
+			}
+			if !strings.Contains(m.Shader, "mainModel4_") {
+				t.Errorf("shader does not call the renamed entry point:\n%v", m.Shader)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package irmf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// unitLengths maps the supported header "units" to millimeters.
+var unitLengths = map[string]float64{
+	"um":     0.001,
+	"micron": 0.001,
+	"mm":     1,
+	"cm":     10,
+	"m":      1000,
+	"in":     25.4,
+	"inch":   25.4,
+	"ft":     304.8,
+}
+
+// UnitLength returns the length in millimeters of one of the given units
+// (such as "mm", "cm", "m", or "in").
+func UnitLength(units string) (float64, error) {
+	if mm, ok := unitLengths[strings.ToLower(strings.TrimSpace(units))]; ok {
+		return mm, nil
+	}
+	return 0, fmt.Errorf("unknown units %q", units)
+}
+
+// ConvertUnits returns the IRMF source src converted to the given units:
+// the header's "min" and "max" are scaled and its "units" replaced (with
+// the header in canonical form, as in SetBounds), and the entry point is
+// renamed (for example, to mainModel4_mm) and called from a new entry
+// point that scales its coordinates back to the original units. The rest
+// of the shader is left untouched. Encoded shaders must be decoded first
+// (see cmd/irmf-flatten).
+func ConvertUnits(src []byte, units string) ([]byte, error) {
+	m, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if m.Encoding != "" {
+		return nil, fmt.Errorf("cannot convert a shader with %q encoding", m.Encoding)
+	}
+	from, err := UnitLength(m.Units)
+	if err != nil {
+		return nil, err
+	}
+	to, err := UnitLength(units)
+	if err != nil {
+		return nil, err
+	}
+
+	var min, max [3]float64
+	for i := range min {
+		min[i] = roundNoise(m.Min[i] * from / to)
+		max[i] = roundNoise(m.Max[i] * from / to)
+	}
+	out, err := setHeader(src, map[string]string{
+		"min":   formatVector(min),
+		"max":   formatVector(max),
+		"units": quote(units),
+	})
+	if err != nil {
+		return nil, err
+	}
+	end := bytes.Index(out, []byte("\n}*/"))
+	header := out[:end]
+	body := string(out[end:])
+
+	body, err = wrapEntry(m, body, "_"+strings.ToLower(strings.TrimSpace(m.Units)),
+		fmt.Sprintf("Converted from %v to %v: scale the coordinates back to %v.", m.Units, units, m.Units),
+		"xyz * "+shaderFloat(to/from))
+	if err != nil {
+		return nil, err
+	}
+
+	out = append(header, body...)
+	if _, err := Parse(out); err != nil {
+		return nil, fmt.Errorf("converted file is invalid: %v", err)
+	}
+	return out, nil
+}
+
+// roundNoise rounds away the floating-point noise left by converting
+// units or transforming a point.
+func roundNoise(v float64) float64 {
+	v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', 12, 64), 64)
+	return v
+}
+
+// CheckConversion compares a converted model with the original at the
+// points of a lattice with n cells along the longest side of the
+// converted model's box plus one random point per cell (as in Minify),
+// and returns an error unless every material value matches exactly.
+func CheckConversion(converted, original *Model, n, workers int) error {
+	p1, err := converted.Compile()
+	if err != nil {
+		return err
+	}
+	p2, err := original.Compile()
+	if err != nil {
+		return err
+	}
+	from, err := UnitLength(converted.Units)
+	if err != nil {
+		return err
+	}
+	to, err := UnitLength(original.Units)
+	if err != nil {
+		return err
+	}
+	scale := from / to
+	x, y, z, ok := sameOutputs(p1, p2, converted, n, workers, func(x, y, z float64) (float64, float64, float64) {
+		return x * scale, y * scale, z * scale
+	})
+	if !ok {
+		return fmt.Errorf("converted model differs at (%v,%v,%v)", x, y, z)
+	}
+	return nil
+}
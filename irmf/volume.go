@@ -0,0 +1,160 @@
+package irmf
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+
+	"github.com/gmlewis/irmf-examples/materials"
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+// VolumeEstimate is a Monte Carlo estimate of the volume of one material
+// in cubic model units.
+type VolumeEstimate struct {
+	Volume float64
+	// StdErr is the standard error of Volume (one sigma).
+	StdErr float64
+}
+
+// EstimateVolumes integrates each material channel (clamped to [0,1])
+// over the model's bounding box by jittered (stratified) sampling: the
+// box is divided into cells (n along its longest side) and each of the
+// given number of passes (at least 2) evaluates one random point per
+// cell. The estimate is the mean of the passes and its standard error
+// comes from their spread. The result is the same for the same seed
+// regardless of the number of workers (0 means one per CPU).
+func EstimateVolumes(p *shader.Program, m *Model, n, passes int, seed uint64, workers int) ([]VolumeEstimate, error) {
+	if n < 1 || passes < 2 {
+		return nil, fmt.Errorf("need at least 1 cell and 2 passes, got %v and %v", n, passes)
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	var size [3]float64
+	longest := 0.0
+	for i := range size {
+		size[i] = m.Max[i] - m.Min[i]
+		longest = math.Max(longest, size[i])
+	}
+	var cells [3]int
+	boxVolume := 1.0
+	for i := range cells {
+		cells[i] = max(1, int(math.Round(float64(n)*size[i]/longest)))
+		boxVolume *= size[i]
+	}
+	numMaterials := len(m.Materials)
+
+	// sums[pass][k][material] holds the sum over the cells of slab k so
+	// that the total does not depend on the order the slabs finish in.
+	type job struct{ pass, k int }
+	sums := make([][][]float64, passes)
+	for i := range sums {
+		sums[i] = make([][]float64, cells[2])
+		for k := range sums[i] {
+			sums[i][k] = make([]float64, numMaterials)
+		}
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e := p.NewEvaluator()
+			out := make([]float64, p.NumMaterials())
+			for jb := range jobs {
+				rng := rand.New(rand.NewPCG(seed, uint64(jb.pass*cells[2]+jb.k)))
+				sum := sums[jb.pass][jb.k]
+				for j := 0; j < cells[1]; j++ {
+					for i := 0; i < cells[0]; i++ {
+						x := m.Min[0] + (float64(i)+rng.Float64())*size[0]/float64(cells[0])
+						y := m.Min[1] + (float64(j)+rng.Float64())*size[1]/float64(cells[1])
+						z := m.Min[2] + (float64(jb.k)+rng.Float64())*size[2]/float64(cells[2])
+						e.Eval(x, y, z, out)
+						for n := range sum {
+							sum[n] += math.Max(0, math.Min(1, out[n]))
+						}
+					}
+				}
+			}
+		}()
+	}
+	for pass := 0; pass < passes; pass++ {
+		for k := 0; k < cells[2]; k++ {
+			jobs <- job{pass, k}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	numCells := float64(cells[0] * cells[1] * cells[2])
+	result := make([]VolumeEstimate, numMaterials)
+	for n := range result {
+		est := make([]float64, passes)
+		var mean float64
+		for pass := range est {
+			for _, sum := range sums[pass] {
+				est[pass] += sum[n]
+			}
+			est[pass] *= boxVolume / numCells
+			mean += est[pass] / float64(passes)
+		}
+		var variance float64
+		for _, v := range est {
+			variance += (v - mean) * (v - mean) / float64(passes-1)
+		}
+		result[n] = VolumeEstimate{Volume: mean, StdErr: math.Sqrt(variance / float64(passes))}
+	}
+	return result, nil
+}
+
+// Usage is the estimated amount of one material used by a model.
+type Usage struct {
+	Name string // as listed in the header
+	// Material is nil if the name is not in the material registry.
+	Material *materials.Material
+	Units    string
+	VolumeEstimate
+	// Mass and MassErr are in grams (0 if Material is nil).
+	Mass, MassErr float64
+}
+
+// Usage combines volume estimates with the densities in reg.
+func (m *Model) Usage(est []VolumeEstimate, reg *materials.Registry) ([]Usage, error) {
+	mm, err := UnitLength(m.Units)
+	if err != nil {
+		return nil, err
+	}
+	cm3 := math.Pow(mm/10, 3) // cubic centimeters per cubic unit
+	usage := make([]Usage, len(est))
+	for i, e := range est {
+		u := Usage{Name: m.Materials[i], Units: m.Units, VolumeEstimate: e}
+		if mat, ok := reg.Lookup(u.Name); ok {
+			u.Material = mat
+			u.Mass = e.Volume * cm3 * mat.Density
+			u.MassErr = e.StdErr * cm3 * mat.Density
+		}
+		usage[i] = u
+	}
+	return usage, nil
+}
+
+func (u Usage) String() string {
+	s := fmt.Sprintf("%v: %v %v³", u.Name, withError(u.Volume, u.StdErr), u.Units)
+	if u.Material == nil {
+		return s + " (unknown material; mass not estimated)"
+	}
+	return s + fmt.Sprintf(", %v g (%v at %v g/cm³)", withError(u.Mass, u.MassErr), u.Material.Name, u.Material.Density)
+}
+
+// withError formats v ± err with two significant digits of err.
+func withError(v, err float64) string {
+	if err <= 0 || math.IsNaN(err) {
+		return fmt.Sprintf("%.4g", v)
+	}
+	decimals := max(0, 1-int(math.Floor(math.Log10(err))))
+	return fmt.Sprintf("%.*f ± %.*f", decimals, v, decimals, err)
+}
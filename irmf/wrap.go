@@ -0,0 +1,70 @@
+package irmf
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// glslEntryRE and wgslEntryRE match the declaration of an entry
+	// point, capturing its name and the parts needed to redeclare it.
+	glslEntryRE = regexp.MustCompile(`\bvoid\s+(mainModel\d+)\s*\(\s*out\s+(\w+)\s+\w+\s*(\[\s*\d+\s*\])?\s*,\s*(?:in\s+)?vec3\s+\w+\s*\)`)
+	wgslEntryRE = regexp.MustCompile(`\bfn\s+(mainModel\d+)\s*\(\s*\w+\s*:\s*vec3(?:f|<f32>)\s*\)\s*->\s*([^{]*?)\s*\{`)
+)
+
+// wrapEntry renames the entry point declared in body, the shader of m,
+// by adding suffix to its name (and a number if the name is taken), and
+// appends a new entry point, preceded by the given comment, that calls
+// it with the position given by the expression expr of "xyz". Nothing
+// else in body changes.
+func wrapEntry(m *Model, body, suffix, comment, expr string) (string, error) {
+	body, renamed, materials, err := renameEntry(m, body, suffix)
+	if err != nil {
+		return "", err
+	}
+	wrapper := "\n// " + comment + "\n"
+	if m.Lang() == "wgsl" {
+		wrapper += fmt.Sprintf("fn %v(xyz: vec3f) -> %v {\n  return %v(%v);\n}\n", m.MainFunc(), materials, renamed, expr)
+	} else {
+		wrapper += fmt.Sprintf("void %v(out %v, in vec3 xyz) {\n  %v(materials, %v);\n}\n", m.MainFunc(), materials, renamed, expr)
+	}
+	return strings.TrimRight(body, "\n") + "\n" + wrapper, nil
+}
+
+// renameEntry renames the entry point declared in body as wrapEntry does
+// and returns the new body, the new name, and the declaration of the
+// materials: the parameter (such as "vec4 materials") in GLSL or the
+// return type in WGSL.
+func renameEntry(m *Model, body, suffix string) (string, string, string, error) {
+	main := m.MainFunc()
+	renamed := main + suffix
+	for n := 2; regexp.MustCompile(`\b` + renamed + `\b`).MatchString(body); n++ {
+		renamed = fmt.Sprintf("%v%v%v", main, suffix, n)
+	}
+	re := glslEntryRE
+	if m.Lang() == "wgsl" {
+		re = wgslEntryRE
+	}
+	for _, d := range re.FindAllStringSubmatchIndex(body, -1) {
+		if body[d[2]:d[3]] == main {
+			parts := re.FindStringSubmatch(body[d[0]:d[1]])
+			body = body[:d[2]] + renamed + body[d[3]:]
+			if m.Lang() == "wgsl" {
+				return body, renamed, parts[2], nil
+			}
+			return body, renamed, parts[2] + " materials" + parts[3], nil
+		}
+	}
+	return "", "", "", fmt.Errorf("unable to find the declaration of %v", main)
+}
+
+// shaderFloat formats v as a float literal for GLSL or WGSL.
+func shaderFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,221 @@
+// Package materials maps the free-form material names used in IRMF
+// headers (such as "AISI 1018 steel", "PLA1", or "copper") to physical
+// properties shared by the tools in this repo: density for mass
+// estimates, electrical resistivity for electromagnet calculations, and
+// a display color for renderers.
+//
+// Names are matched case-insensitively ignoring spaces and punctuation,
+// so "AISI1018steel" finds "AISI 1018 steel". A trailing instance number
+// ("PLA1", "PLA2") or a channel suffix ("PLA.H") refers to the base
+// material. The built-in Default registry can be extended with Add or
+// LoadFile.
+//
+// Some examples name placeholders instead of materials (see
+// IsPlaceholder), leaving the choice to whoever prints them.
+package materials
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Material describes a printable material.
+type Material struct {
+	// Name is the canonical spelling.
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	// Density is in g/cm³.
+	Density float64 `json:"density"`
+	// Resistivity is the electrical resistivity in Ω·m at 20°C
+	// (approximate for insulators).
+	Resistivity float64 `json:"resistivity"`
+	// Color is the display color as "#rrggbb".
+	Color string `json:"color"`
+}
+
+// RGBA returns the display color (gray if it cannot be parsed).
+func (m *Material) RGBA() color.RGBA {
+	if v, err := strconv.ParseUint(strings.TrimPrefix(m.Color, "#"), 16, 32); err == nil && len(m.Color) == 7 {
+		return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+	}
+	return color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff}
+}
+
+// IsConductor reports whether the material conducts electricity.
+func (m *Material) IsConductor() bool { return m.Resistivity > 0 && m.Resistivity < 1e-3 }
+
+// builtin lists the materials used by the examples plus a few common
+// alternatives. Densities and resistivities are typical values.
+var builtin = []Material{
+	{Name: "PLA", Aliases: []string{"polylactic acid"}, Density: 1.24, Resistivity: 1e14, Color: "#f0f0f0"},
+	{Name: "ABS", Density: 1.04, Resistivity: 1e14, Color: "#e8e0d0"},
+	{Name: "PETG", Aliases: []string{"PET-G"}, Density: 1.27, Resistivity: 1e14, Color: "#d0e8f0"},
+	{Name: "resin", Aliases: []string{"photopolymer", "UV resin"}, Density: 1.15, Resistivity: 1e13, Color: "#c0a060"},
+	{Name: "dielectric", Aliases: []string{"insulator"}, Density: 1.15, Resistivity: 1e13, Color: "#80b0e0"},
+	{Name: "copper", Aliases: []string{"Cu"}, Density: 8.96, Resistivity: 1.68e-8, Color: "#b87333"},
+	{Name: "silver", Aliases: []string{"Ag"}, Density: 10.49, Resistivity: 1.59e-8, Color: "#c0c0c0"},
+	{Name: "gold", Aliases: []string{"Au"}, Density: 19.3, Resistivity: 2.44e-8, Color: "#ffd700"},
+	{Name: "aluminum", Aliases: []string{"aluminium", "Al"}, Density: 2.70, Resistivity: 2.65e-8, Color: "#a8a9ad"},
+	{Name: "AISI 1018 steel", Aliases: []string{"1018 steel", "mild steel"}, Density: 7.87, Resistivity: 1.59e-7, Color: "#71797e"},
+	{Name: "stainless steel", Aliases: []string{"AISI 316 steel", "316L"}, Density: 8.00, Resistivity: 7.4e-7, Color: "#8a9597"},
+	{Name: "titanium", Aliases: []string{"Ti"}, Density: 4.51, Resistivity: 4.2e-7, Color: "#878681"},
+	{Name: "porcelain", Density: 2.40, Resistivity: 1e12, Color: "#f4f1ea"},
+	{Name: "agate", Density: 2.60, Resistivity: 1e12, Color: "#c9ae5d"},
+	{Name: "jasper", Density: 2.65, Resistivity: 1e12, Color: "#d73b3e"},
+	{Name: "sapphire", Density: 3.98, Resistivity: 1e14, Color: "#0f52ba"},
+	{Name: "emerald", Density: 2.76, Resistivity: 1e12, Color: "#50c878"},
+}
+
+// placeholders are the normalized names that stand for "any material":
+// "Material" (or "material0") in models converted from other formats,
+// and the display colors that multi-material examples use to tell their
+// materials apart.
+var placeholders = map[string]bool{
+	"material": true,
+	"red":      true,
+	"green":    true,
+	"blue":     true,
+	"yellow":   true,
+	"cyan":     true,
+	"magenta":  true,
+	"white":    true,
+	"black":    true,
+}
+
+// IsPlaceholder reports whether a header material name (with an optional
+// instance number, as in "material0") is a placeholder rather than the
+// name of a material. Placeholders have no physical properties.
+func IsPlaceholder(name string) bool {
+	return placeholders[key(strings.TrimRightFunc(strings.TrimSpace(name), unicode.IsDigit))]
+}
+
+// Registry is a set of materials indexed by normalized name.
+type Registry struct {
+	materials []*Material
+	byKey     map[string]*Material
+}
+
+// Default is the built-in registry.
+var Default = NewRegistry()
+
+// NewRegistry returns a registry holding the built-in materials.
+func NewRegistry() *Registry {
+	r := &Registry{byKey: map[string]*Material{}}
+	for _, m := range builtin {
+		if err := r.Add(m); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// key normalizes a name for matching.
+func key(name string) string {
+	var sb strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// Add adds a material, replacing any built-in material of the same name.
+func (r *Registry) Add(m Material) error {
+	if key(m.Name) == "" {
+		return fmt.Errorf("material %q has no name", m.Name)
+	}
+	if m.Density <= 0 {
+		return fmt.Errorf("material %q: density must be positive", m.Name)
+	}
+	// Only a material with the same name is replaced; a name that is
+	// another material's alias is a collision like any other.
+	old := r.byKey[key(m.Name)]
+	if old != nil && key(old.Name) != key(m.Name) {
+		return fmt.Errorf("material %q: name %q is already used by %q", m.Name, m.Name, old.Name)
+	}
+	for _, name := range m.Aliases {
+		if other, ok := r.byKey[key(name)]; ok && other != old {
+			return fmt.Errorf("material %q: name %q is already used by %q", m.Name, name, other.Name)
+		}
+	}
+	if old != nil {
+		for i, v := range r.materials {
+			if v == old {
+				r.materials = append(r.materials[:i], r.materials[i+1:]...)
+				break
+			}
+		}
+		for k, v := range r.byKey {
+			if v == old {
+				delete(r.byKey, k)
+			}
+		}
+	}
+	mat := &m
+	for _, name := range append([]string{m.Name}, m.Aliases...) {
+		r.byKey[key(name)] = mat
+	}
+	r.materials = append(r.materials, mat)
+	return nil
+}
+
+// LoadFile adds the materials in a JSON file holding an array of
+// materials (in the format of the Material struct).
+func (r *Registry) LoadFile(filename string) error {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var ms []Material
+	if err := json.Unmarshal(buf, &ms); err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	for _, m := range ms {
+		if err := r.Add(m); err != nil {
+			return fmt.Errorf("%v: %v", filename, err)
+		}
+	}
+	return nil
+}
+
+// Materials returns all materials sorted by name.
+func (r *Registry) Materials() []*Material {
+	ms := append([]*Material(nil), r.materials...)
+	sort.Slice(ms, func(i, j int) bool { return strings.ToLower(ms[i].Name) < strings.ToLower(ms[j].Name) })
+	return ms
+}
+
+// Lookup returns the material named by a header material name, which
+// may have an instance number or channel suffix.
+func (r *Registry) Lookup(name string) (*Material, bool) {
+	m, _, ok := r.Resolve(name)
+	return m, ok
+}
+
+// Resolve is like Lookup but also returns the base spelling of name:
+// name without any instance number ("PLA1") or channel suffix ("PLA.H").
+func (r *Registry) Resolve(name string) (m *Material, base string, ok bool) {
+	name = strings.TrimSpace(name)
+	if m, ok := r.byKey[key(name)]; ok {
+		return m, name, true
+	}
+	if i := strings.LastIndex(name, "."); i > 0 {
+		if m, ok := r.byKey[key(name[:i])]; ok {
+			return m, name[:i], true
+		}
+	}
+	if b := strings.TrimRightFunc(name, unicode.IsDigit); b != name && b != "" {
+		b = strings.TrimRight(b, " -_#")
+		if m, ok := r.byKey[key(b)]; ok {
+			return m, b, true
+		}
+	}
+	return nil, name, false
+}
@@ -0,0 +1,187 @@
+package materials
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		want     string // canonical name, or "" if not found
+		wantBase string
+	}{
+		{name: "AISI 1018 steel", want: "AISI 1018 steel", wantBase: "AISI 1018 steel"},
+		{name: "AISI1018steel", want: "AISI 1018 steel", wantBase: "AISI1018steel"},
+		{name: "PLA1", want: "PLA", wantBase: "PLA"},
+		{name: "PLA2", want: "PLA", wantBase: "PLA"},
+		{name: "PLA.H", want: "PLA", wantBase: "PLA"},
+		{name: " Cu ", want: "copper", wantBase: "Cu"},
+		{name: "copper-2", want: "copper", wantBase: "copper"},
+		{name: "316L", want: "stainless steel", wantBase: "316L"},
+		{name: "unobtainium", wantBase: "unobtainium"},
+		{name: "red", wantBase: "red"},
+	}
+	for _, tt := range tests {
+		m, base, ok := Default.Resolve(tt.name)
+		if got := ""; ok != (tt.want != "") || ok && m.Name != tt.want {
+			if ok {
+				got = m.Name
+			}
+			t.Errorf("Resolve(%q) = %q, %v, want %q", tt.name, got, ok, tt.want)
+		}
+		if base != tt.wantBase {
+			t.Errorf("Resolve(%q) base = %q, want %q", tt.name, base, tt.wantBase)
+		}
+	}
+}
+
+func TestIsPlaceholder(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Material", true},
+		{"material0", true},
+		{"Red", true},
+		{"blue2", true},
+		{" white ", true},
+		{"PLA", false},
+		{"copper", false},
+		{"dielectric", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsPlaceholder(tt.name); got != tt.want {
+			t.Errorf("IsPlaceholder(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Material
+		wantErr string
+		lookups map[string]string // name -> canonical name, or "" if not found
+	}{
+		{
+			name:    "new material",
+			m:       Material{Name: "bronze", Aliases: []string{"CuSn"}, Density: 8.8},
+			lookups: map[string]string{"bronze": "bronze", "cusn": "bronze", "copper": "copper"},
+		},
+		{
+			name:    "replaces the same name",
+			m:       Material{Name: "Copper", Density: 8.9},
+			lookups: map[string]string{"copper": "Copper", "Cu": ""},
+		},
+		{
+			name:    "name is another material's alias",
+			m:       Material{Name: "Cu", Density: 8.9},
+			wantErr: `material "Cu": name "Cu" is already used by "copper"`,
+			lookups: map[string]string{"copper": "copper", "Cu": "copper"},
+		},
+		{
+			name:    "alias is another material's name",
+			m:       Material{Name: "bronze", Aliases: []string{"copper"}, Density: 8.8},
+			wantErr: `material "bronze": name "copper" is already used by "copper"`,
+			lookups: map[string]string{"bronze": "", "copper": "copper"},
+		},
+		{
+			name:    "no name",
+			m:       Material{Name: " - ", Density: 1},
+			wantErr: "has no name",
+		},
+		{
+			name:    "no density",
+			m:       Material{Name: "air"},
+			wantErr: "density must be positive",
+			lookups: map[string]string{"air": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			n := len(r.Materials())
+			err := r.Add(tt.m)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Add error = %v, want %q", err, tt.wantErr)
+				}
+				if got := len(r.Materials()); got != n {
+					t.Errorf("after a failed Add, %v materials, want %v", got, n)
+				}
+			} else if err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			for name, want := range tt.lookups {
+				m, ok := r.Lookup(name)
+				if got := ""; ok != (want != "") || ok && m.Name != want {
+					if ok {
+						got = m.Name
+					}
+					t.Errorf("Lookup(%q) = %q, %v, want %q", name, got, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+		lookups map[string]string
+	}{
+		{
+			name:    "adds and replaces",
+			json:    `[{"name": "bronze", "aliases": ["CuSn"], "density": 8.8}, {"name": "PLA", "density": 1.25, "color": "#ff0000"}]`,
+			lookups: map[string]string{"CuSn": "bronze", "PLA1": "PLA"},
+		},
+		{
+			name:    "collides with an alias",
+			json:    `[{"name": "bronze", "density": 8.8}, {"name": "Al", "density": 2.7}]`,
+			wantErr: `materials.json: material "Al": name "Al" is already used by "aluminum"`,
+		},
+		{
+			name:    "collides with an earlier entry",
+			json:    `[{"name": "bronze", "density": 8.8}, {"name": "brass", "aliases": ["Bronze"], "density": 8.5}]`,
+			wantErr: `materials.json: material "brass": name "Bronze" is already used by "bronze"`,
+		},
+		{
+			name:    "not an array",
+			json:    `{"name": "bronze"}`,
+			wantErr: "materials.json: json: cannot unmarshal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "materials.json")
+			if err := os.WriteFile(filename, []byte(tt.json), 0644); err != nil {
+				t.Fatal(err)
+			}
+			r := NewRegistry()
+			err := r.LoadFile(filename)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadFile error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFile: %v", err)
+			}
+			for name, want := range tt.lookups {
+				if m, ok := r.Lookup(name); !ok || m.Name != want {
+					t.Errorf("Lookup(%q) = %v, %v, want %q", name, m, ok, want)
+				}
+			}
+			if m, _ := r.Lookup("PLA"); m.Density != 1.25 || m.RGBA().R != 0xff {
+				t.Errorf("PLA = %+v, want the loaded density and color", m)
+			}
+		})
+	}
+}
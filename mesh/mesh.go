@@ -0,0 +1,276 @@
+// Package mesh extracts watertight triangle meshes from sampled scalar
+// fields using marching tetrahedra.
+//
+// Each cube of the sampling lattice is split into six tetrahedra that
+// share its main diagonal (the Kuhn triangulation). Neighboring cubes
+// split their shared faces identically, so the extracted surface is a
+// closed 2-manifold as long as the field is padded with an outside
+// layer, which Extract does implicitly.
+package mesh
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/gmlewis/irmf-slicer/v3/stl"
+)
+
+// Field is a scalar field sampled on a regular lattice: the value at
+// lattice point (i,j,k) is Values[(k*N[1]+j)*N[0]+i] and its position is
+// Min + (i,j,k)*Step. Points outside the lattice are treated as 0.
+type Field struct {
+	Min    [3]float64
+	Step   float64
+	N      [3]int
+	Values []float32
+}
+
+// Mesh is an indexed triangle mesh. Triangles are wound counterclockwise
+// when viewed from outside.
+type Mesh struct {
+	Verts [][3]float32
+	Tris  [][3]int32
+}
+
+// kuhn lists the six tetrahedra of a cube by corner number, where corner
+// c is at offset (c&1, c>>1&1, c>>2&1).
+var kuhn = [6][4]int{
+	{0, 1, 3, 7},
+	{0, 3, 2, 7},
+	{0, 2, 6, 7},
+	{0, 6, 4, 7},
+	{0, 4, 5, 7},
+	{0, 5, 1, 7},
+}
+
+// Extract returns the surface separating the points whose value exceeds
+// iso (inside) from the rest, using the given number of goroutines
+// (0 means one per CPU).
+func Extract(f *Field, iso float32, workers int) *Mesh {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	// Cube (i,j,k) spans lattice points (i..i+1, j..j+1, k..k+1) for
+	// -1 <= i < N[0], so the outermost cubes straddle the padding.
+	nz := f.N[2] + 1
+	slabs := make([]*slab, nz)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range next {
+				slabs[k] = f.extractSlab(k-1, iso)
+			}
+		}()
+	}
+	for k := 0; k < nz; k++ {
+		next <- k
+	}
+	close(next)
+	wg.Wait()
+
+	// Merge the slabs in order so that the output is deterministic.
+	m := &Mesh{}
+	index := map[uint64]int32{}
+	for _, s := range slabs {
+		remap := make([]int32, len(s.keys))
+		for i, key := range s.keys {
+			v, ok := index[key]
+			if !ok {
+				v = int32(len(m.Verts))
+				index[key] = v
+				m.Verts = append(m.Verts, s.verts[i])
+			}
+			remap[i] = v
+		}
+		for _, t := range s.tris {
+			m.Tris = append(m.Tris, [3]int32{remap[t[0]], remap[t[1]], remap[t[2]]})
+		}
+	}
+	return m
+}
+
+// slab holds the triangles of one layer of cubes, indexing vertices
+// local to the slab. keys identifies each vertex by its lattice edge.
+type slab struct {
+	keys  []uint64
+	verts [][3]float32
+	tris  [][3]int32
+	index map[uint64]int32
+}
+
+func (f *Field) value(i, j, k int) float32 {
+	if i < 0 || j < 0 || k < 0 || i >= f.N[0] || j >= f.N[1] || k >= f.N[2] {
+		return 0
+	}
+	return f.Values[(k*f.N[1]+j)*f.N[0]+i]
+}
+
+func (f *Field) extractSlab(k int, iso float32) *slab {
+	s := &slab{index: map[uint64]int32{}}
+	var corner [8][3]int
+	var val [8]float32
+	for j := -1; j < f.N[1]; j++ {
+		for i := -1; i < f.N[0]; i++ {
+			inside := 0
+			for c := range corner {
+				corner[c] = [3]int{i + c&1, j + c>>1&1, k + c>>2&1}
+				val[c] = f.value(corner[c][0], corner[c][1], corner[c][2])
+				if val[c] > iso {
+					inside++
+				}
+			}
+			if inside == 0 || inside == 8 {
+				continue
+			}
+			for _, tet := range kuhn {
+				s.tetrahedron(f, iso, tet, &corner, &val)
+			}
+		}
+	}
+	s.index = nil
+	return s
+}
+
+// tetrahedron adds the triangles of one tetrahedron.
+func (s *slab) tetrahedron(f *Field, iso float32, tet [4]int, corner *[8][3]int, val *[8]float32) {
+	var buf [8]int
+	in, out := buf[:0:4], buf[4:4]
+	for _, c := range tet {
+		if val[c] > iso {
+			in = append(in, c)
+		} else {
+			out = append(out, c)
+		}
+	}
+	switch len(in) {
+	case 1:
+		a := in[0]
+		s.triangle(corner, in, out,
+			s.vertex(f, iso, corner, val, a, out[0]),
+			s.vertex(f, iso, corner, val, a, out[1]),
+			s.vertex(f, iso, corner, val, a, out[2]))
+	case 3:
+		b := out[0]
+		s.triangle(corner, in, out,
+			s.vertex(f, iso, corner, val, in[0], b),
+			s.vertex(f, iso, corner, val, in[1], b),
+			s.vertex(f, iso, corner, val, in[2], b))
+	case 2:
+		// The quad ac-ad-bd-bc is split into two triangles.
+		ac := s.vertex(f, iso, corner, val, in[0], out[0])
+		ad := s.vertex(f, iso, corner, val, in[0], out[1])
+		bd := s.vertex(f, iso, corner, val, in[1], out[1])
+		bc := s.vertex(f, iso, corner, val, in[1], out[0])
+		s.triangle(corner, in, out, ac, ad, bd)
+		s.triangle(corner, in, out, ac, bd, bc)
+	}
+}
+
+// vertex returns the index of the surface vertex on the lattice edge
+// between corners a (inside) and b (outside), creating it if needed.
+func (s *slab) vertex(f *Field, iso float32, corner *[8][3]int, val *[8]float32, a, b int) int32 {
+	// Every edge of a Kuhn tetrahedron joins a corner to one that is
+	// greater or equal in every coordinate, so an edge is identified by
+	// its lower corner and the offset to the upper one.
+	lo, hi := a, b
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	p := corner[lo]
+	// Padding coordinates start at -1, so shift them to be non-negative.
+	nx, ny := uint64(f.N[0]+2), uint64(f.N[1]+2)
+	key := ((uint64(p[2]+1)*ny+uint64(p[1]+1))*nx+uint64(p[0]+1))*8 + uint64(hi^lo)
+	if v, ok := s.index[key]; ok {
+		return v
+	}
+
+	t := (iso - val[a]) / (val[b] - val[a])
+	// Keep vertices off the lattice points so that no triangle is degenerate.
+	t = min(max(t, 0.001), 0.999)
+	var pos [3]float32
+	for i := range pos {
+		pa := float32(f.Min[i] + float64(corner[a][i])*f.Step)
+		pb := float32(f.Min[i] + float64(corner[b][i])*f.Step)
+		pos[i] = pa + t*(pb-pa)
+	}
+	v := int32(len(s.verts))
+	s.index[key] = v
+	s.keys = append(s.keys, key)
+	s.verts = append(s.verts, pos)
+	return v
+}
+
+// triangle adds triangle (v0,v1,v2) wound so that its normal points from
+// the inside corners toward the outside ones.
+func (s *slab) triangle(corner *[8][3]int, in, out []int, v0, v1, v2 int32) {
+	p0, p1, p2 := s.verts[v0], s.verts[v1], s.verts[v2]
+	n := cross(sub(p1, p0), sub(p2, p0))
+	var dir [3]float32
+	for _, c := range out {
+		for i := range dir {
+			dir[i] += float32(corner[c][i]) / float32(len(out))
+		}
+	}
+	for _, c := range in {
+		for i := range dir {
+			dir[i] -= float32(corner[c][i]) / float32(len(in))
+		}
+	}
+	if dot(n, dir) < 0 {
+		v1, v2 = v2, v1
+	}
+	s.tris = append(s.tris, [3]int32{v0, v1, v2})
+}
+
+func sub(a, b [3]float32) [3]float32 { return [3]float32{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+
+func dot(a, b [3]float32) float32 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+
+func cross(a, b [3]float32) [3]float32 {
+	return [3]float32{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+// Check verifies that the mesh is closed and consistently oriented:
+// every directed edge appears exactly once and its reverse exactly once.
+func (m *Mesh) Check() error {
+	edges := make(map[[2]int32]int, 3*len(m.Tris))
+	for _, t := range m.Tris {
+		for i := 0; i < 3; i++ {
+			edges[[2]int32{t[i], t[(i+1)%3]}]++
+		}
+	}
+	for e, n := range edges {
+		if n != 1 {
+			return fmt.Errorf("edge %v-%v is used by %v triangles with the same orientation", e[0], e[1], n)
+		}
+		if edges[[2]int32{e[1], e[0]}] != 1 {
+			return fmt.Errorf("edge %v-%v is not shared by exactly two triangles", e[0], e[1])
+		}
+	}
+	return nil
+}
+
+// WriteSTL writes the mesh as a binary STL file.
+func (m *Mesh) WriteSTL(filename string) error {
+	w, err := stl.New(filename)
+	if err != nil {
+		return err
+	}
+	for _, t := range m.Tris {
+		v1, v2, v3 := m.Verts[t[0]], m.Verts[t[1]], m.Verts[t[2]]
+		n := cross(sub(v2, v1), sub(v3, v1))
+		if l := float32(math.Sqrt(float64(dot(n, n)))); l > 0 {
+			n = [3]float32{n[0] / l, n[1] / l, n[2] / l}
+		}
+		if err := w.Write(&stl.Tri{N: n, V1: v1, V2: v2, V3: v3}); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
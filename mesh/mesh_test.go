@@ -0,0 +1,77 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+)
+
+// sampleField samples fn on an n*n*n lattice spanning [lo,hi] on each axis.
+func sampleField(lo, hi float64, n int, fn func(x, y, z float64) float32) *Field {
+	step := (hi - lo) / float64(n-1)
+	f := &Field{Min: [3]float64{lo, lo, lo}, Step: step, N: [3]int{n, n, n}, Values: make([]float32, n*n*n)}
+	for k := 0; k < n; k++ {
+		for j := 0; j < n; j++ {
+			for i := 0; i < n; i++ {
+				f.Values[(k*n+j)*n+i] = fn(lo+float64(i)*step, lo+float64(j)*step, lo+float64(k)*step)
+			}
+		}
+	}
+	return f
+}
+
+// volume returns the signed volume enclosed by m, which is positive
+// when its triangles are wound counterclockwise viewed from outside.
+func volume(m *Mesh) float64 {
+	var v float64
+	for _, t := range m.Tris {
+		a, b, c := m.Verts[t[0]], m.Verts[t[1]], m.Verts[t[2]]
+		v += float64(dot(a, cross(b, c))) / 6
+	}
+	return v
+}
+
+func TestExtract(t *testing.T) {
+	const r = 5.0
+	sphere := func(x, y, z float64) float32 { return float32(r - math.Sqrt(x*x+y*y+z*z)) }
+	// cube fills the lattice, so its faces lie halfway into the implicit
+	// padding: a 5x5x5 box.
+	cube := func(x, y, z float64) float32 { return 1 }
+
+	tests := []struct {
+		name    string
+		field   *Field
+		iso     float32
+		workers int
+		want    float64
+		tol     float64 // relative
+	}{
+		{"sphere", sampleField(-6, 6, 49, sphere), 0, 0, 4.0 / 3 * math.Pi * r * r * r, 0.01},
+		{"sphere one worker", sampleField(-6, 6, 25, sphere), 0, 1, 4.0 / 3 * math.Pi * r * r * r, 0.03},
+		{"cube touching the lattice", sampleField(0, 4, 5, cube), 0.5, 0, 125, 0.05},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Extract(tt.field, tt.iso, tt.workers)
+			if len(m.Tris) == 0 {
+				t.Fatal("Extract returned no triangles")
+			}
+			if err := m.Check(); err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			got := volume(m)
+			if got <= 0 {
+				t.Fatalf("volume = %v, want > 0 (triangles wound inside out?)", got)
+			}
+			if tt.want > 0 && math.Abs(got-tt.want) > tt.tol*tt.want {
+				t.Errorf("volume = %v, want %v within %v%%", got, tt.want, 100*tt.tol)
+			}
+		})
+	}
+}
+
+func TestExtractEmpty(t *testing.T) {
+	f := sampleField(0, 1, 4, func(x, y, z float64) float32 { return 0 })
+	if m := Extract(f, 0.5, 0); len(m.Tris) != 0 || len(m.Verts) != 0 {
+		t.Errorf("Extract of an empty field = %v triangles, %v vertices, want none", len(m.Tris), len(m.Verts))
+	}
+}
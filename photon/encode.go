@@ -0,0 +1,135 @@
+package photon
+
+import (
+	"image"
+	"math"
+)
+
+// This is based on: github.com/Andoryuuta/photon
+// LICENSE: Apache-2.0
+// https://github.com/Andoryuuta/photon/blob/master/LICENSE
+// by way of github.com/gmlewis/irmf-slicer/v3/photon.
+
+// maxRun is the longest run of set or unset pixels in one byte of layer
+// data (ChiTuBox itself never writes runs longer than this).
+const maxRun = 0x7f - 2
+
+// EncodeLayer run-length encodes img centered on a screen of the given
+// size. A pixel is exposed if its gray value is non-zero. Pixels are
+// stored in columns: x advances along the screen width and y along the
+// screen height.
+func EncodeLayer(img *image.Gray, screenWidth, screenHeight int) []byte {
+	const flagSetPixels = 0x80
+	var output []byte
+
+	// center the original image in the resin basin.
+	b := img.Bounds()
+	xOffset := b.Min.X - (screenWidth-b.Dx())>>1
+	yOffset := b.Min.Y - (screenHeight-b.Dy())>>1
+
+	var unsetCount, setCount uint8
+	for x := 0; x < screenWidth; x++ {
+		for y := 0; y < screenHeight; y++ {
+			px, py := x+xOffset, y+yOffset
+			if !image.Pt(px, py).In(b) || img.Pix[img.PixOffset(px, py)] == 0 {
+				if setCount != 0 {
+					// Previous pixels were set, this was not.
+					output = append(output, setCount|flagSetPixels)
+					setCount = 0
+				}
+				unsetCount++
+				if unsetCount >= maxRun {
+					output = append(output, unsetCount)
+					unsetCount = 0
+				}
+				continue
+			}
+
+			if unsetCount != 0 {
+				// Previous pixels were unset, this was not.
+				output = append(output, unsetCount)
+				unsetCount = 0
+			}
+			setCount++
+			if setCount >= maxRun {
+				output = append(output, setCount|flagSetPixels)
+				setCount = 0
+			}
+		}
+	}
+
+	// Set any leftover data
+	if setCount != 0 {
+		output = append(output, setCount|flagSetPixels)
+	}
+	if unsetCount != 0 {
+		output = append(output, unsetCount)
+	}
+	return output
+}
+
+func changeRange(fromMin, fromMax, toMin, toMax, number uint32) uint32 {
+	return uint32(math.Round(float64(number-fromMin)*float64(toMax-toMin)/float64(fromMax-fromMin) + float64(toMin)))
+}
+
+func combineRGB5515(r, g, b uint8, isFill bool) uint16 {
+	// Scale colors from the range of 0-255 to 0-31
+	rBits := uint16(changeRange(0, 255, 0, 31, uint32(r)))
+	gBits := uint16(changeRange(0, 255, 0, 31, uint32(g)))
+	bBits := uint16(changeRange(0, 255, 0, 31, uint32(b)))
+
+	var fillBit uint16
+	if isFill {
+		fillBit = 1
+	}
+
+	var x uint16
+	x |= (rBits & 0x1F) << 0
+	x |= (fillBit & 0x1) << 5
+	x |= (gBits & 0x1F) << 6
+	x |= (bBits & 0x1F) << 11
+	return x
+}
+
+// encodePreview scales the grayscale img to the given size and encodes
+// it as run-length encoded RGB 5-5-1-5 pixels.
+func encodePreview(imageWidth, imageHeight int, img *image.Gray) []byte {
+	var output []byte
+
+	b := img.Bounds()
+	xScale := float32(b.Dx()) / float32(imageWidth)
+	yScale := float32(b.Dy()) / float32(imageHeight)
+	maxPixelIndex := imageHeight * imageWidth
+
+	pixelAt := func(pi int) uint8 {
+		if pi >= maxPixelIndex {
+			pi = maxPixelIndex - 1
+		}
+		x := pi % imageWidth
+		y := pi / imageWidth
+		return img.GrayAt(b.Min.X+int(float32(x)*xScale), b.Min.Y+int(float32(y)*yScale)).Y
+	}
+
+	for pixelIndex := 0; pixelIndex < maxPixelIndex; pixelIndex++ {
+		p := pixelAt(pixelIndex)
+
+		if p != pixelAt(pixelIndex+1) || p != pixelAt(pixelIndex+2) || pixelIndex+2 >= maxPixelIndex {
+			v := combineRGB5515(p, p, p, false)
+			output = append(output, byte(v&0xFF), byte(v>>8))
+			continue
+		}
+
+		// Count skips
+		var skipCount uint16 = 3
+		for ; skipCount < 0xFFF && pixelIndex+int(skipCount) < maxPixelIndex && p == pixelAt(pixelIndex+int(skipCount)); skipCount++ {
+		}
+
+		v := combineRGB5515(p, p, p, true) | 0x20
+		output = append(output, byte(v&0xFF), byte(v>>8))
+		v = skipCount - 1 | 0x3000
+		output = append(output, byte(v&0xFF), byte(v>>8))
+
+		pixelIndex += int(skipCount - 1)
+	}
+	return output
+}
@@ -0,0 +1,210 @@
+// Package photon writes ChiTuBox .cbddlp files (which are identical to
+// AnyCubic .photon files) for DLP/MSLA resin printers.
+//
+// It is a GPU-free counterpart to the photon package of
+// https://github.com/gmlewis/irmf-slicer: instead of receiving slices
+// from an OpenGL renderer, the caller adds one grayscale bitmap per
+// layer (e.g. from a CPU evaluation of an IRMF shader). Layers are
+// stored run-length encoded, so only the compressed model is held in
+// memory until the file is written.
+package photon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+)
+
+const (
+	// Default values from ChiTuBox
+	previewWidth  = 0x190
+	previewHeight = 0x12c
+
+	thumbnailWidth  = 0xc8
+	thumbnailHeight = 0x7d
+)
+
+// Settings describes the printer and its exposure settings.
+type Settings struct {
+	ScreenWidth  int     // pixels (along the plate's long side)
+	ScreenHeight int     // pixels
+	PixelSize    float64 // millimeters
+	LayerHeight  float64 // millimeters
+	PlateZ       float64 // build height in millimeters
+
+	NormalExposure float64 // seconds
+	BottomExposure float64 // seconds
+	BottomLayers   int
+	OffTime        float64 // seconds between layers
+}
+
+// DefaultSettings returns the ChiTuBox defaults for an AnyCubic Photon
+// (2560x1440 pixels of 47.25 microns and 50 micron layers), which are
+// the same as those used by irmf-slicer.
+func DefaultSettings() Settings {
+	return Settings{
+		ScreenWidth:    0xa00,
+		ScreenHeight:   0x5a0,
+		PixelSize:      0.04725,
+		LayerHeight:    0.05,
+		PlateZ:         150,
+		NormalExposure: 6,
+		BottomExposure: 50,
+		BottomLayers:   8,
+	}
+}
+
+// Validate checks that the settings are usable.
+func (s Settings) Validate() error {
+	switch {
+	case s.ScreenWidth <= 0 || s.ScreenHeight <= 0:
+		return fmt.Errorf("invalid screen size %vx%v", s.ScreenWidth, s.ScreenHeight)
+	case s.PixelSize <= 0:
+		return fmt.Errorf("pixel size (%v) must be positive", s.PixelSize)
+	case s.LayerHeight <= 0:
+		return fmt.Errorf("layer height (%v) must be positive", s.LayerHeight)
+	case s.NormalExposure <= 0 || s.BottomExposure <= 0:
+		return fmt.Errorf("exposure times (%v, %v) must be positive", s.NormalExposure, s.BottomExposure)
+	case s.BottomLayers < 0 || s.OffTime < 0:
+		return errors.New("bottom layers and off time must not be negative")
+	}
+	return nil
+}
+
+// File is a .cbddlp file being built in memory.
+type File struct {
+	s      Settings
+	layers [][]byte
+	// preview is the union of all layers, as seen from above.
+	preview *image.Gray
+}
+
+// New returns an empty File with the given settings.
+func New(s Settings) *File {
+	return &File{s: s}
+}
+
+// NumLayers returns the number of layers added so far.
+func (f *File) NumLayers() int { return len(f.layers) }
+
+// AddLayer adds the next layer (from the bottom up). The image is
+// centered on the screen and every layer must have the same bounds.
+func (f *File) AddLayer(img *image.Gray) error {
+	b := img.Bounds()
+	if b.Dx() > f.s.ScreenWidth || b.Dy() > f.s.ScreenHeight {
+		return fmt.Errorf("layer of %vx%v pixels does not fit on the %vx%v screen", b.Dx(), b.Dy(), f.s.ScreenWidth, f.s.ScreenHeight)
+	}
+	if f.preview == nil {
+		f.preview = image.NewGray(b)
+	} else if f.preview.Bounds() != b {
+		return fmt.Errorf("layer %v bounds %v differ from layer 0 bounds %v", len(f.layers), b, f.preview.Bounds())
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.Pix[img.PixOffset(x, y)] != 0 {
+				f.preview.Pix[f.preview.PixOffset(x, y)] = 0xff
+			}
+		}
+	}
+	f.layers = append(f.layers, EncodeLayer(img, f.s.ScreenWidth, f.s.ScreenHeight))
+	return nil
+}
+
+// WriteFile writes the .cbddlp file.
+func (f *File) WriteFile(filename string) error {
+	if len(f.layers) == 0 {
+		return errors.New("no layers to write")
+	}
+	previewData := encodePreview(previewWidth, previewHeight, f.preview)
+	thumbnailData := encodePreview(thumbnailWidth, thumbnailHeight, f.preview)
+
+	pos := binary.Size(binCompatFileHeader{})
+	previewHeaderOffset := pos
+	pos += binary.Size(binCompatPreviewHeader{})
+	previewDataOffset := pos
+	pos += len(previewData)
+
+	thumbnailHeaderOffset := pos
+	pos += binary.Size(binCompatPreviewHeader{})
+	thumbnailDataOffset := pos
+	pos += len(thumbnailData)
+
+	layerHeadersOffset := pos
+	pos += len(f.layers) * binary.Size(binCompatLayerHeader{})
+
+	s := f.s
+	header := binCompatFileHeader{
+		Magic1:                       0x12FD0019,
+		Magic2:                       0x01,
+		PlateX:                       float32(float64(s.ScreenHeight) * s.PixelSize),
+		PlateY:                       float32(float64(s.ScreenWidth) * s.PixelSize),
+		PlateZ:                       float32(s.PlateZ),
+		LayerThickness:               float32(s.LayerHeight),
+		NormalExposureTime:           float32(s.NormalExposure),
+		BottomExposureTime:           float32(s.BottomExposure),
+		OffTime:                      float32(s.OffTime),
+		BottomLayers:                 uint32(s.BottomLayers),
+		ScreenHeight:                 uint32(s.ScreenHeight),
+		ScreenWidth:                  uint32(s.ScreenWidth),
+		PreviewHeaderOffset:          uint32(previewHeaderOffset),
+		LayerHeadersOffset:           uint32(layerHeadersOffset),
+		TotalLayers:                  uint32(len(f.layers)),
+		PreviewThumbnailHeaderOffset: uint32(thumbnailHeaderOffset),
+		LightCuringType:              1, // default
+	}
+
+	previewHeader := binCompatPreviewHeader{
+		Width:             previewWidth,
+		Height:            previewHeight,
+		PreviewDataOffset: uint32(previewDataOffset),
+		PreviewDataSize:   uint32(len(previewData)),
+	}
+	thumbnailHeader := binCompatPreviewHeader{
+		Width:             thumbnailWidth,
+		Height:            thumbnailHeight,
+		PreviewDataOffset: uint32(thumbnailDataOffset),
+		PreviewDataSize:   uint32(len(thumbnailData)),
+	}
+
+	layerHeaders := make([]binCompatLayerHeader, len(f.layers))
+	for i, layer := range f.layers {
+		expTime := s.NormalExposure
+		if i < s.BottomLayers {
+			expTime = s.BottomExposure
+		}
+		layerHeaders[i] = binCompatLayerHeader{
+			AbsoluteHeight:  float32(float64(i) * s.LayerHeight),
+			ExposureTime:    float32(expTime),
+			PerLayerOffTime: float32(s.OffTime),
+			ImageDataOffset: uint32(pos),
+			ImageDataSize:   uint32(len(layer)),
+		}
+		pos += len(layer)
+	}
+
+	fh, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(fh)
+	for _, v := range []any{header, previewHeader, previewData, thumbnailHeader, thumbnailData, layerHeaders} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			fh.Close()
+			return err
+		}
+	}
+	for _, layer := range f.layers {
+		if _, err := w.Write(layer); err != nil {
+			fh.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
@@ -0,0 +1,128 @@
+package photon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// decodeLayer expands the run-length encoded data written by EncodeLayer
+// into a screenWidth x screenHeight bitmap.
+func decodeLayer(t *testing.T, data []byte, screenWidth, screenHeight int) *image.Gray {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, screenWidth, screenHeight))
+	n := 0
+	for _, b := range data {
+		run := int(b & 0x7f)
+		for ; run > 0; run-- {
+			if n >= screenWidth*screenHeight {
+				t.Fatalf("layer data overflows the %vx%v screen", screenWidth, screenHeight)
+			}
+			if b&0x80 != 0 {
+				// Pixels are stored in columns.
+				img.Pix[img.PixOffset(n/screenHeight, n%screenHeight)] = 0xff
+			}
+			n++
+		}
+	}
+	if n != screenWidth*screenHeight {
+		t.Fatalf("layer data has %v pixels, want %v", n, screenWidth*screenHeight)
+	}
+	return img
+}
+
+func TestWriteFile(t *testing.T) {
+	s := DefaultSettings()
+	s.ScreenWidth, s.ScreenHeight = 300, 20 // long enough to need split runs
+	s.BottomLayers = 1
+
+	// A 260x10 rectangle that shrinks by one pixel on each side per layer.
+	const nx, ny, nz = 260, 10, 3
+	f := New(s)
+	var layers []*image.Gray
+	for k := 0; k < nz; k++ {
+		img := image.NewGray(image.Rect(0, 0, nx, ny))
+		for y := k; y < ny-k; y++ {
+			for x := k; x < nx-k; x++ {
+				img.Pix[img.PixOffset(x, y)] = 0xff
+			}
+		}
+		if err := f.AddLayer(img); err != nil {
+			t.Fatalf("AddLayer(%v): %v", k, err)
+		}
+		layers = append(layers, img)
+	}
+	if got := f.NumLayers(); got != nz {
+		t.Errorf("NumLayers = %v, want %v", got, nz)
+	}
+	if err := f.AddLayer(image.NewGray(image.Rect(0, 0, nx, ny+1))); err == nil {
+		t.Error("AddLayer with different bounds succeeded")
+	}
+
+	filename := filepath.Join(t.TempDir(), "test.cbddlp")
+	if err := f.WriteFile(filename); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var h binCompatFileHeader
+	if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, &h); err != nil {
+		t.Fatalf("reading header: %v", err)
+	}
+	if h.Magic1 != 0x12FD0019 || h.Magic2 != 1 {
+		t.Errorf("magic = %#x, %#x, want 0x12fd0019, 0x1", h.Magic1, h.Magic2)
+	}
+	if h.ScreenWidth != uint32(s.ScreenWidth) || h.ScreenHeight != uint32(s.ScreenHeight) {
+		t.Errorf("screen = %vx%v, want %vx%v", h.ScreenWidth, h.ScreenHeight, s.ScreenWidth, s.ScreenHeight)
+	}
+	if h.TotalLayers != nz {
+		t.Errorf("TotalLayers = %v, want %v", h.TotalLayers, nz)
+	}
+	if h.LayerThickness != float32(s.LayerHeight) || h.PlateZ != float32(s.PlateZ) || h.BottomLayers != 1 {
+		t.Errorf("header = %+v, want settings %+v", h, s)
+	}
+
+	lh := make([]binCompatLayerHeader, h.TotalLayers)
+	if err := binary.Read(bytes.NewReader(buf[h.LayerHeadersOffset:]), binary.LittleEndian, lh); err != nil {
+		t.Fatalf("reading layer headers: %v", err)
+	}
+	for k, l := range lh {
+		if want := float32(float64(k) * s.LayerHeight); l.AbsoluteHeight != want {
+			t.Errorf("layer %v height = %v, want %v", k, l.AbsoluteHeight, want)
+		}
+		wantExp := s.NormalExposure
+		if k < s.BottomLayers {
+			wantExp = s.BottomExposure
+		}
+		if l.ExposureTime != float32(wantExp) {
+			t.Errorf("layer %v exposure = %v, want %v", k, l.ExposureTime, wantExp)
+		}
+		end := int(l.ImageDataOffset + l.ImageDataSize)
+		if end > len(buf) {
+			t.Fatalf("layer %v data ends at %v, past the end of the file (%v bytes)", k, end, len(buf))
+		}
+		got := decodeLayer(t, buf[l.ImageDataOffset:end], s.ScreenWidth, s.ScreenHeight)
+		// The layer is centered on the screen.
+		x0, y0 := (s.ScreenWidth-nx)/2, (s.ScreenHeight-ny)/2
+		for y := 0; y < s.ScreenHeight; y++ {
+			for x := 0; x < s.ScreenWidth; x++ {
+				var want uint8
+				if p := image.Pt(x-x0, y-y0); p.In(layers[k].Bounds()) {
+					want = layers[k].Pix[layers[k].PixOffset(p.X, p.Y)]
+				}
+				if g := got.Pix[got.PixOffset(x, y)]; g != want {
+					t.Fatalf("layer %v pixel (%v,%v) = %#x, want %#x", k, x, y, g, want)
+				}
+			}
+		}
+	}
+	if last := lh[nz-1]; int(last.ImageDataOffset+last.ImageDataSize) != len(buf) {
+		t.Errorf("file is %v bytes, want %v", len(buf), last.ImageDataOffset+last.ImageDataSize)
+	}
+}
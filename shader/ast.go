@@ -0,0 +1,195 @@
+package shader
+
+// The GLSL and WGSL front ends both produce this AST, which is then
+// compiled into closures for evaluation.
+
+type expr interface{ exprLine() int }
+
+type (
+	identExpr struct {
+		line int
+		name string
+	}
+	numberExpr struct {
+		line  int
+		text  string
+		val   float64
+		isInt bool // an integer literal (possibly converted to float by context)
+	}
+	boolExpr struct {
+		line int
+		val  bool
+	}
+	unaryExpr struct {
+		line int
+		op   string
+		x    expr
+	}
+	binaryExpr struct {
+		line int
+		op   string
+		x, y expr
+	}
+	condExpr struct {
+		line          int
+		cond, yes, no expr
+	}
+	// callExpr is a function call or, if typ is non-nil, a constructor
+	// or conversion such as vec3(1), float(i), or array<f32, 2>(a, b).
+	callExpr struct {
+		line int
+		fn   string
+		typ  *typ
+		args []expr
+	}
+	indexExpr struct {
+		line   int
+		x, idx expr
+	}
+	fieldExpr struct {
+		line int
+		x    expr
+		name string
+	}
+	// lengthExpr is the GLSL array method a.length().
+	lengthExpr struct {
+		line int
+		x    expr
+	}
+	assignExpr struct {
+		line     int
+		op       string // "=", "+=", ...
+		lhs, rhs expr
+	}
+	incDecExpr struct {
+		line   int
+		op     string // "++" or "--"
+		x      expr
+		prefix bool
+	}
+	commaExpr struct {
+		line int
+		list []expr
+	}
+)
+
+func (e *identExpr) exprLine() int  { return e.line }
+func (e *numberExpr) exprLine() int { return e.line }
+func (e *boolExpr) exprLine() int   { return e.line }
+func (e *unaryExpr) exprLine() int  { return e.line }
+func (e *binaryExpr) exprLine() int { return e.line }
+func (e *condExpr) exprLine() int   { return e.line }
+func (e *callExpr) exprLine() int   { return e.line }
+func (e *indexExpr) exprLine() int  { return e.line }
+func (e *fieldExpr) exprLine() int  { return e.line }
+func (e *lengthExpr) exprLine() int { return e.line }
+func (e *assignExpr) exprLine() int { return e.line }
+func (e *incDecExpr) exprLine() int { return e.line }
+func (e *commaExpr) exprLine() int  { return e.line }
+
+type stmt interface{ stmtLine() int }
+
+type (
+	blockStmt struct {
+		line  int
+		stmts []stmt
+	}
+	// varDecl declares one variable. A nil typ means that the type is
+	// inferred from init.
+	varDecl struct {
+		line    int
+		name    string
+		typ     *typ
+		init    expr
+		isConst bool
+	}
+	declStmt struct {
+		line int
+		vars []*varDecl
+	}
+	exprStmt struct {
+		line int
+		x    expr
+	}
+	ifStmt struct {
+		line     int
+		cond     expr
+		then     stmt
+		elseStmt stmt // may be nil
+	}
+	forStmt struct {
+		line int
+		init stmt // may be nil
+		cond expr // may be nil
+		post expr // may be nil
+		body stmt
+	}
+	whileStmt struct {
+		line int
+		cond expr
+		body stmt
+		isDo bool
+	}
+	// loopStmt is the WGSL loop statement with an optional continuing block.
+	loopStmt struct {
+		line       int
+		body       *blockStmt
+		continuing *blockStmt
+		breakIf    expr
+	}
+	returnStmt struct {
+		line int
+		x    expr // may be nil
+	}
+	breakStmt struct {
+		line int
+		cond expr // WGSL "break if"
+	}
+	continueStmt struct{ line int }
+	discardStmt  struct{ line int }
+	switchStmt   struct {
+		line  int
+		tag   expr
+		cases []*caseClause
+	}
+	caseClause struct {
+		line      int
+		vals      []expr
+		isDefault bool
+		body      []stmt
+	}
+)
+
+func (s *blockStmt) stmtLine() int    { return s.line }
+func (s *declStmt) stmtLine() int     { return s.line }
+func (s *exprStmt) stmtLine() int     { return s.line }
+func (s *ifStmt) stmtLine() int       { return s.line }
+func (s *forStmt) stmtLine() int      { return s.line }
+func (s *whileStmt) stmtLine() int    { return s.line }
+func (s *loopStmt) stmtLine() int     { return s.line }
+func (s *returnStmt) stmtLine() int   { return s.line }
+func (s *breakStmt) stmtLine() int    { return s.line }
+func (s *continueStmt) stmtLine() int { return s.line }
+func (s *discardStmt) stmtLine() int  { return s.line }
+func (s *switchStmt) stmtLine() int   { return s.line }
+
+type param struct {
+	name string
+	typ  *typ
+	out  bool // out or inout
+	in   bool // in or inout (or unqualified)
+}
+
+type funcDecl struct {
+	line   int
+	name   string
+	ret    *typ
+	params []*param
+	body   *blockStmt // nil for a prototype
+}
+
+// file is a parsed shader: global declarations and functions in source order.
+type file struct {
+	globals []*varDecl
+	funcs   []*funcDecl
+}
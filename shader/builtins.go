@@ -0,0 +1,456 @@
+package shader
+
+import "math"
+
+// Built-in functions shared by GLSL and WGSL.
+
+var unaryBuiltins = map[string]func(float64) float64{
+	"sin":         math.Sin,
+	"cos":         math.Cos,
+	"tan":         math.Tan,
+	"asin":        math.Asin,
+	"acos":        math.Acos,
+	"atan":        math.Atan,
+	"sinh":        math.Sinh,
+	"cosh":        math.Cosh,
+	"tanh":        math.Tanh,
+	"asinh":       math.Asinh,
+	"acosh":       math.Acosh,
+	"atanh":       math.Atanh,
+	"exp":         math.Exp,
+	"exp2":        math.Exp2,
+	"log":         math.Log,
+	"log2":        math.Log2,
+	"sqrt":        math.Sqrt,
+	"inversesqrt": func(x float64) float64 { return 1 / math.Sqrt(x) },
+	"inverseSqrt": func(x float64) float64 { return 1 / math.Sqrt(x) },
+	"floor":       math.Floor,
+	"ceil":        math.Ceil,
+	"trunc":       math.Trunc,
+	"round":       math.RoundToEven,
+	"roundEven":   math.RoundToEven,
+	"fract":       func(x float64) float64 { return x - math.Floor(x) },
+	"radians":     func(x float64) float64 { return x * math.Pi / 180 },
+	"degrees":     func(x float64) float64 { return x * 180 / math.Pi },
+	"saturate":    func(x float64) float64 { return math.Max(0, math.Min(1, x)) },
+}
+
+// Unary functions whose result has the kind of their argument.
+var unaryKindBuiltins = map[string]func(float64) float64{
+	"abs": math.Abs,
+	"sign": func(x float64) float64 {
+		switch {
+		case x > 0:
+			return 1
+		case x < 0:
+			return -1
+		}
+		return x
+	},
+}
+
+var binaryBuiltins = map[string]func(a, b float64) float64{
+	"pow":   math.Pow,
+	"atan":  math.Atan2,
+	"atan2": math.Atan2,
+	"mod":   func(x, y float64) float64 { return x - y*math.Floor(x/y) },
+	"step":  func(edge, x float64) float64 { return boolFloat(x >= edge) },
+	"min":   math.Min,
+	"max":   math.Max,
+}
+
+var ternaryBuiltins = map[string]func(a, b, c float64) float64{
+	"clamp": func(x, lo, hi float64) float64 { return math.Min(math.Max(x, lo), hi) },
+	"mix":   func(x, y, a float64) float64 { return x*(1-a) + y*a },
+	"smoothstep": func(e0, e1, x float64) float64 {
+		t := math.Max(0, math.Min(1, (x-e0)/(e1-e0)))
+		return t * t * (3 - 2*t)
+	},
+	"fma": func(a, b, c float64) float64 { return a*b + c },
+}
+
+var relationalBuiltins = map[string]string{
+	"lessThan":         "<",
+	"lessThanEqual":    "<=",
+	"greaterThan":      ">",
+	"greaterThanEqual": ">=",
+	"equal":            "==",
+	"notEqual":         "!=",
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// builtin compiles a call of a built-in function. It returns nil if name
+// is not a built-in function.
+func (c *compiler) builtin(line int, name string, args []evalFn, types []*typ) (evalFn, *typ) {
+	for _, t := range types {
+		if t.kind == kArray || t.kind == kVoid {
+			c.errorf(line, "invalid argument of type %v to %v", t, name)
+		}
+	}
+	vectorArgs := func() {
+		for _, t := range types {
+			if t.isMatrix() {
+				c.errorf(line, "invalid argument of type %v to %v", t, name)
+			}
+		}
+	}
+	nargs := func(n int) {
+		if len(args) != n {
+			c.errorf(line, "%v expects %v arguments, found %v", name, n, len(args))
+		}
+	}
+
+	switch name {
+	case "length", "normalize", "distance", "dot", "cross", "reflect":
+		vectorArgs()
+		return c.geometric(line, name, args, types)
+	case "all", "any", "not":
+		nargs(1)
+		t := types[0]
+		if t.kind != kBool || t.isMatrix() {
+			c.errorf(line, "%v requires a boolean vector, found %v", name, t)
+		}
+		x, n := args[0], t.size()
+		switch name {
+		case "all":
+			return func(m *machine) value {
+				v := x(m)
+				for i := 0; i < n; i++ {
+					if v.v[i] == 0 {
+						return value{}
+					}
+				}
+				return scalar(1)
+			}, tBool
+		case "any":
+			return func(m *machine) value {
+				v := x(m)
+				for i := 0; i < n; i++ {
+					if v.v[i] != 0 {
+						return scalar(1)
+					}
+				}
+				return value{}
+			}, tBool
+		}
+		return func(m *machine) value {
+			v := x(m)
+			for i := 0; i < n; i++ {
+				v.v[i] = 1 - v.v[i]
+			}
+			return v
+		}, t
+	case "select":
+		// WGSL select(f, t, cond)
+		nargs(3)
+		vectorArgs()
+		n := c.componentCount(line, name, types[0], types[1])
+		rt := vecType(c.promote(types[0], types[1]).kind, n)
+		if types[2].kind != kBool || (types[2].size() != 1 && types[2].size() != n) {
+			c.errorf(line, "invalid select condition of type %v", types[2])
+		}
+		f, t, cond := args[0], args[1], args[2]
+		sf, st, sc := types[0].size() == 1, types[1].size() == 1, types[2].size() == 1
+		if sc {
+			return func(m *machine) value {
+				if cond(m).v[0] != 0 {
+					return broadcast(t(m), st, n)
+				}
+				return broadcast(f(m), sf, n)
+			}, rt
+		}
+		return func(m *machine) value {
+			a, b, k := broadcast(f(m), sf, n), broadcast(t(m), st, n), cond(m)
+			for i := 0; i < n; i++ {
+				if k.v[i] != 0 {
+					a.v[i] = b.v[i]
+				}
+			}
+			return a
+		}, rt
+	case "transpose":
+		nargs(1)
+		t := types[0]
+		if !t.isMatrix() {
+			c.errorf(line, "transpose requires a matrix, found %v", t)
+		}
+		x, cols, rows := args[0], t.cols, t.rows
+		return func(m *machine) value {
+			v := x(m)
+			var r value
+			for j := 0; j < cols; j++ {
+				for i := 0; i < rows; i++ {
+					r.v[i*cols+j] = v.v[j*rows+i]
+				}
+			}
+			return r
+		}, matType(rows, cols)
+	case "determinant":
+		nargs(1)
+		t := types[0]
+		if !t.isMatrix() || t.cols != t.rows {
+			c.errorf(line, "determinant requires a square matrix, found %v", t)
+		}
+		x, n := args[0], t.cols
+		return func(m *machine) value {
+			v := x(m)
+			return scalar(determinant(v.v[:n*n], n))
+		}, tFloat
+	}
+
+	if name == "mix" && len(types) == 3 && types[2].kind == kBool {
+		// GLSL mix(x, y, bvec) selects components.
+		vectorArgs()
+		return c.componentwise3(line, name, args, types, func(x, y, a float64) float64 {
+			if a != 0 {
+				return y
+			}
+			return x
+		}, false)
+	}
+	if r, ok := relationalBuiltins[name]; ok {
+		nargs(2)
+		vectorArgs()
+		if !types[0].equal(types[1]) && !(types[0].size() == types[1].size() && types[0].isNumeric() && types[1].isNumeric()) {
+			c.errorf(line, "mismatched arguments %v and %v to %v", types[0], types[1], name)
+		}
+		cmp := comparison(r)
+		x, y, n := args[0], args[1], types[0].size()
+		return func(m *machine) value {
+			a, b := x(m), y(m)
+			var v value
+			for i := 0; i < n; i++ {
+				v.v[i] = boolFloat(cmp(a.v[i], b.v[i]))
+			}
+			return v
+		}, vecType(kBool, n)
+	}
+
+	switch len(args) {
+	case 1:
+		if f, ok := unaryBuiltins[name]; ok {
+			vectorArgs()
+			return c.componentwise1(args[0], types[0].withKind(kFloat), f)
+		}
+		if f, ok := unaryKindBuiltins[name]; ok {
+			vectorArgs()
+			return c.componentwise1(args[0], types[0], f)
+		}
+	case 2:
+		if f, ok := binaryBuiltins[name]; ok {
+			vectorArgs()
+			floatOnly := name != "min" && name != "max"
+			return c.componentwise2(line, name, args, types, f, floatOnly)
+		}
+	case 3:
+		if f, ok := ternaryBuiltins[name]; ok {
+			vectorArgs()
+			return c.componentwise3(line, name, args, types, f, name != "clamp")
+		}
+	}
+	if _, ok := unaryBuiltins[name]; ok {
+		c.errorf(line, "wrong number of arguments to %v", name)
+	}
+	if _, ok := binaryBuiltins[name]; ok {
+		c.errorf(line, "wrong number of arguments to %v", name)
+	}
+	if _, ok := ternaryBuiltins[name]; ok {
+		c.errorf(line, "wrong number of arguments to %v", name)
+	}
+	return nil, nil
+}
+
+// promote returns the type of a component-wise operation on x and y.
+func (c *compiler) promote(xt, yt *typ) *typ {
+	k := xt.kind
+	if xt.kind != yt.kind {
+		switch {
+		case xt.kind == kFloat || yt.kind == kFloat:
+			k = kFloat
+		case xt.kind == kUint || yt.kind == kUint:
+			k = kUint
+		}
+	}
+	return vecType(k, max(xt.size(), yt.size()))
+}
+
+// broadcast returns v with its first component repeated n times if it is
+// a scalar.
+func broadcast(v value, isScalar bool, n int) value {
+	if isScalar {
+		for i := 1; i < n; i++ {
+			v.v[i] = v.v[0]
+		}
+	}
+	return v
+}
+
+func (c *compiler) componentwise1(x evalFn, t *typ, f func(float64) float64) (evalFn, *typ) {
+	n := t.size()
+	if n == 1 {
+		return func(m *machine) value { return scalar(f(x(m).v[0])) }, t
+	}
+	return func(m *machine) value {
+		v := x(m)
+		for i := 0; i < n; i++ {
+			v.v[i] = f(v.v[i])
+		}
+		return v
+	}, t
+}
+
+func (c *compiler) componentwise2(line int, name string, args []evalFn, types []*typ, f func(a, b float64) float64, floatOnly bool) (evalFn, *typ) {
+	n := c.componentCount(line, name, types[0], types[1])
+	rt := c.promote(types[0], types[1])
+	if floatOnly {
+		rt = rt.withKind(kFloat)
+	}
+	x, y := args[0], args[1]
+	if n == 1 {
+		return func(m *machine) value { return scalar(f(x(m).v[0], y(m).v[0])) }, rt
+	}
+	sx, sy := types[0].size() == 1, types[1].size() == 1
+	return func(m *machine) value {
+		a, b := broadcast(x(m), sx, n), broadcast(y(m), sy, n)
+		for i := 0; i < n; i++ {
+			a.v[i] = f(a.v[i], b.v[i])
+		}
+		return a
+	}, rt
+}
+
+func (c *compiler) componentwise3(line int, name string, args []evalFn, types []*typ, f func(a, b, c float64) float64, floatOnly bool) (evalFn, *typ) {
+	n := c.componentCount(line, name, types[0], types[1])
+	n = c.componentCount(line, name, vecType(kFloat, n), types[2])
+	rt := c.promote(c.promote(types[0], types[1]), types[2].withKind(kInt))
+	if types[2].kind != kBool {
+		rt = c.promote(c.promote(types[0], types[1]), types[2])
+	}
+	rt = vecType(rt.kind, n)
+	if floatOnly {
+		rt = rt.withKind(kFloat)
+	}
+	x, y, z := args[0], args[1], args[2]
+	if n == 1 {
+		return func(m *machine) value { return scalar(f(x(m).v[0], y(m).v[0], z(m).v[0])) }, rt
+	}
+	sx, sy, sz := types[0].size() == 1, types[1].size() == 1, types[2].size() == 1
+	return func(m *machine) value {
+		a, b, d := broadcast(x(m), sx, n), broadcast(y(m), sy, n), broadcast(z(m), sz, n)
+		for i := 0; i < n; i++ {
+			a.v[i] = f(a.v[i], b.v[i], d.v[i])
+		}
+		return a
+	}, rt
+}
+
+func (c *compiler) geometric(line int, name string, args []evalFn, types []*typ) (evalFn, *typ) {
+	want := map[string]int{"length": 1, "normalize": 1, "distance": 2, "dot": 2, "cross": 2, "reflect": 2}[name]
+	if len(args) != want {
+		c.errorf(line, "%v expects %v arguments, found %v", name, want, len(args))
+	}
+	n := types[0].size()
+	if want == 2 && types[1].size() != n {
+		c.errorf(line, "mismatched arguments %v and %v to %v", types[0], types[1], name)
+	}
+	x := args[0]
+	switch name {
+	case "length":
+		return func(m *machine) value {
+			v := x(m)
+			var sum float64
+			for i := 0; i < n; i++ {
+				sum += v.v[i] * v.v[i]
+			}
+			return scalar(math.Sqrt(sum))
+		}, tFloat
+	case "normalize":
+		return func(m *machine) value {
+			v := x(m)
+			var sum float64
+			for i := 0; i < n; i++ {
+				sum += v.v[i] * v.v[i]
+			}
+			l := math.Sqrt(sum)
+			for i := 0; i < n; i++ {
+				v.v[i] /= l
+			}
+			return v
+		}, types[0].withKind(kFloat)
+	}
+	y := args[1]
+	switch name {
+	case "distance":
+		return func(m *machine) value {
+			a, b := x(m), y(m)
+			var sum float64
+			for i := 0; i < n; i++ {
+				d := a.v[i] - b.v[i]
+				sum += d * d
+			}
+			return scalar(math.Sqrt(sum))
+		}, tFloat
+	case "dot":
+		rt := c.promote(types[0], types[1])
+		return func(m *machine) value {
+			a, b := x(m), y(m)
+			var sum float64
+			for i := 0; i < n; i++ {
+				sum += a.v[i] * b.v[i]
+			}
+			return scalar(sum)
+		}, vecType(rt.kind, 1)
+	case "cross":
+		if n != 3 {
+			c.errorf(line, "cross requires vec3 arguments, found %v", types[0])
+		}
+		return func(m *machine) value {
+			a, b := x(m), y(m)
+			var r value
+			r.v[0] = a.v[1]*b.v[2] - a.v[2]*b.v[1]
+			r.v[1] = a.v[2]*b.v[0] - a.v[0]*b.v[2]
+			r.v[2] = a.v[0]*b.v[1] - a.v[1]*b.v[0]
+			return r
+		}, vecType(kFloat, 3)
+	}
+	// reflect(I, N) = I - 2*dot(N, I)*N
+	return func(m *machine) value {
+		a, b := x(m), y(m)
+		var d float64
+		for i := 0; i < n; i++ {
+			d += a.v[i] * b.v[i]
+		}
+		for i := 0; i < n; i++ {
+			a.v[i] -= 2 * d * b.v[i]
+		}
+		return a
+	}, types[0].withKind(kFloat)
+}
+
+// determinant returns the determinant of the n×n column-major matrix a.
+func determinant(a []float64, n int) float64 {
+	if n == 1 {
+		return a[0]
+	}
+	var det float64
+	sign := 1.0
+	minor := make([]float64, 0, (n-1)*(n-1))
+	for j := 0; j < n; j++ {
+		minor = minor[:0]
+		for col := 0; col < n; col++ {
+			if col == j {
+				continue
+			}
+			minor = append(minor, a[col*n+1:col*n+n]...)
+		}
+		det += sign * a[j*n] * determinant(minor, n-1)
+		sign = -sign
+	}
+	return det
+}
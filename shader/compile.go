@@ -0,0 +1,739 @@
+package shader
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// machine is the state of one evaluator. Every variable (global, local,
+// or parameter) and every call-site argument buffer has its own fixed
+// address in mem. This is possible because neither GLSL nor WGSL allows
+// recursion.
+type machine struct {
+	mem []value
+	ret value
+}
+
+type evalFn func(m *machine) value
+
+// ctl is the control-flow outcome of executing a statement.
+type ctl int
+
+const (
+	ctlNone ctl = iota
+	ctlBreak
+	ctlContinue
+	ctlReturn
+	ctlDiscard
+)
+
+type execFn func(m *machine) ctl
+
+type variable struct {
+	name    string
+	typ     *typ
+	addr    int
+	isConst bool
+}
+
+type function struct {
+	decl   *funcDecl
+	params []*variable
+	ret    *typ
+	body   execFn
+}
+
+type compiler struct {
+	lang    string
+	funcs   map[string][]*function
+	scopes  []map[string]*variable
+	memSize int
+	cur     *function
+
+	// proto holds the global values as they are initialized.
+	proto *machine
+	// callsUser is set while compiling an expression that calls a user function.
+	callsUser bool
+}
+
+func (c *compiler) errorf(line int, format string, args ...any) {
+	panic(&parseError{line: line, msg: fmt.Sprintf(format, args...)})
+}
+
+func (c *compiler) alloc() int {
+	c.memSize++
+	if len(c.proto.mem) < c.memSize {
+		c.proto.mem = append(c.proto.mem, make([]value, c.memSize-len(c.proto.mem)+64)...)
+	}
+	return c.memSize - 1
+}
+
+func (c *compiler) pushScope() { c.scopes = append(c.scopes, map[string]*variable{}) }
+func (c *compiler) popScope()  { c.scopes = c.scopes[:len(c.scopes)-1] }
+
+func (c *compiler) declare(line int, name string, t *typ, isConst bool) *variable {
+	scope := c.scopes[len(c.scopes)-1]
+	if _, ok := scope[name]; ok {
+		c.errorf(line, "%v redeclared in this scope", name)
+	}
+	v := &variable{name: name, typ: t, addr: c.alloc(), isConst: isConst}
+	scope[name] = v
+	return v
+}
+
+func (c *compiler) lookup(name string) *variable {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if v, ok := c.scopes[i][name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// compileFile compiles f and initializes its globals.
+func compileFile(lang string, f *file) (c *compiler, err error) {
+	c = &compiler{lang: lang, funcs: map[string][]*function{}, proto: &machine{}}
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(*parseError)
+			if !ok {
+				panic(r)
+			}
+			c, err = nil, pe
+		}
+	}()
+	c.pushScope()
+
+	// Register every function signature so that calls can be compiled
+	// in any order. Prototypes are merged with their definitions.
+	for _, fd := range f.funcs {
+		c.registerFunc(fd)
+	}
+
+	// Compile the globals in order, running their initializers immediately
+	// unless they call user functions (whose bodies are not compiled yet).
+	type deferredInit struct {
+		v    *variable
+		init evalFn
+	}
+	var deferred []deferredInit
+	for _, g := range f.globals {
+		c.callsUser = false
+		v, init := c.compileVarDecl(g)
+		if init == nil {
+			continue
+		}
+		if c.callsUser {
+			deferred = append(deferred, deferredInit{v, init})
+			continue
+		}
+		c.proto.mem[v.addr] = init(c.proto).clone()
+	}
+
+	for _, fns := range c.funcs {
+		for _, fn := range fns {
+			if fn.decl.body == nil {
+				c.errorf(fn.decl.line, "function %v is declared but never defined", fn.decl.name)
+			}
+			c.compileFuncBody(fn)
+		}
+	}
+
+	for _, d := range deferred {
+		c.proto.mem[d.v.addr] = d.init(c.proto).clone()
+	}
+	return c, nil
+}
+
+func (c *compiler) registerFunc(fd *funcDecl) {
+	for _, fn := range c.funcs[fd.name] {
+		if sameParams(fn.decl.params, fd.params) {
+			if fn.decl.body != nil && fd.body != nil {
+				c.errorf(fd.line, "function %v redefined", fd.name)
+			}
+			if fd.body != nil {
+				fn.decl = fd
+			}
+			return
+		}
+	}
+	fn := &function{decl: fd, ret: fd.ret}
+	for _, prm := range fd.params {
+		t := c.resolveType(fd.line, prm.typ)
+		fn.params = append(fn.params, &variable{name: prm.name, typ: t, addr: c.alloc()})
+	}
+	c.funcs[fd.name] = append(c.funcs[fd.name], fn)
+}
+
+func sameParams(a, b []*param) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].typ.kind != kArray && !a[i].typ.equal(b[i].typ) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *compiler) compileFuncBody(fn *function) {
+	c.cur = fn
+	c.pushScope()
+	for _, v := range fn.params {
+		if v.name != "" {
+			c.scopes[len(c.scopes)-1][v.name] = v
+		}
+	}
+	body := c.compileBlock(fn.decl.body, false)
+	c.popScope()
+	c.cur = nil
+	fn.body = body
+}
+
+// resolveType resolves any array lengths given by constant expressions.
+func (c *compiler) resolveType(line int, t *typ) *typ {
+	if t == nil || t.kind != kArray {
+		return t
+	}
+	elem := c.resolveType(line, t.elem)
+	if t.lenExpr == nil && elem == t.elem {
+		return t
+	}
+	length := t.length
+	if t.lenExpr != nil {
+		fn, lt := c.compileExpr(t.lenExpr)
+		if !lt.isScalar() || !lt.isIntegral() {
+			c.errorf(line, "array length must be an integer constant")
+		}
+		length = int(fn(c.proto).v[0])
+	}
+	return &typ{kind: kArray, elem: elem, length: length}
+}
+
+// compileVarDecl declares a variable and returns its initializer (or nil).
+func (c *compiler) compileVarDecl(d *varDecl) (*variable, evalFn) {
+	t := c.resolveType(d.line, d.typ)
+	var init evalFn
+	if d.init != nil {
+		fn, it := c.compileExpr(d.init)
+		switch {
+		case t == nil:
+			t = it
+		case t.kind == kArray && t.length < 0:
+			if it.kind != kArray {
+				c.errorf(d.line, "cannot initialize array %v with %v", d.name, it)
+			}
+			elem := t.elem
+			if elem == nil {
+				elem = it.elem
+			}
+			t = &typ{kind: kArray, elem: elem, length: it.length}
+		}
+		init = c.convert(d.line, fn, it, t)
+	}
+	if t == tVoid || t.kind == kVoid {
+		c.errorf(d.line, "variable %v has no type", d.name)
+	}
+	v := c.declare(d.line, d.name, t, d.isConst)
+	return v, init
+}
+
+// Statements.
+
+func (c *compiler) compileBlock(b *blockStmt, newScope bool) execFn {
+	if newScope {
+		c.pushScope()
+		defer c.popScope()
+	}
+	var list []execFn
+	for _, s := range b.stmts {
+		if fn := c.compileStmt(s); fn != nil {
+			list = append(list, fn)
+		}
+	}
+	switch len(list) {
+	case 0:
+		return func(m *machine) ctl { return ctlNone }
+	case 1:
+		return list[0]
+	}
+	return func(m *machine) ctl {
+		for _, s := range list {
+			if r := s(m); r != ctlNone {
+				return r
+			}
+		}
+		return ctlNone
+	}
+}
+
+func (c *compiler) compileStmt(s stmt) execFn {
+	switch s := s.(type) {
+	case *blockStmt:
+		return c.compileBlock(s, true)
+	case *declStmt:
+		var list []execFn
+		for _, d := range s.vars {
+			v, init := c.compileVarDecl(d)
+			addr, t := v.addr, v.typ
+			if init == nil {
+				list = append(list, func(m *machine) ctl {
+					m.mem[addr] = zeroValue(t)
+					return ctlNone
+				})
+				continue
+			}
+			if t.kind == kArray {
+				list = append(list, func(m *machine) ctl {
+					m.mem[addr] = init(m).clone()
+					return ctlNone
+				})
+				continue
+			}
+			list = append(list, func(m *machine) ctl {
+				m.mem[addr] = init(m)
+				return ctlNone
+			})
+		}
+		if len(list) == 1 {
+			return list[0]
+		}
+		return func(m *machine) ctl {
+			for _, s := range list {
+				s(m)
+			}
+			return ctlNone
+		}
+	case *exprStmt:
+		fn, _ := c.compileExpr(s.x)
+		return func(m *machine) ctl {
+			fn(m)
+			return ctlNone
+		}
+	case *ifStmt:
+		cond := c.compileCond(s.cond)
+		then := c.compileScoped(s.then)
+		if s.elseStmt == nil {
+			return func(m *machine) ctl {
+				if cond(m) {
+					return then(m)
+				}
+				return ctlNone
+			}
+		}
+		els := c.compileScoped(s.elseStmt)
+		return func(m *machine) ctl {
+			if cond(m) {
+				return then(m)
+			}
+			return els(m)
+		}
+	case *forStmt:
+		c.pushScope()
+		defer c.popScope()
+		var init execFn
+		if s.init != nil {
+			init = c.compileStmt(s.init)
+		}
+		cond := func(m *machine) bool { return true }
+		if s.cond != nil {
+			cond = c.compileCond(s.cond)
+		}
+		var post evalFn
+		if s.post != nil {
+			post, _ = c.compileExpr(s.post)
+		}
+		body := c.compileScoped(s.body)
+		return func(m *machine) ctl {
+			if init != nil {
+				init(m)
+			}
+			for cond(m) {
+				switch r := body(m); r {
+				case ctlBreak:
+					return ctlNone
+				case ctlReturn, ctlDiscard:
+					return r
+				}
+				if post != nil {
+					post(m)
+				}
+			}
+			return ctlNone
+		}
+	case *whileStmt:
+		cond := c.compileCond(s.cond)
+		body := c.compileScoped(s.body)
+		isDo := s.isDo
+		return func(m *machine) ctl {
+			for first := true; (first && isDo) || cond(m); first = false {
+				switch r := body(m); r {
+				case ctlBreak:
+					return ctlNone
+				case ctlReturn, ctlDiscard:
+					return r
+				}
+			}
+			return ctlNone
+		}
+	case *loopStmt:
+		c.pushScope()
+		defer c.popScope()
+		body := c.compileBlock(s.body, false)
+		continuing := func(m *machine) ctl { return ctlNone }
+		if s.continuing != nil {
+			continuing = c.compileBlock(s.continuing, false)
+		}
+		breakIf := func(m *machine) bool { return false }
+		if s.breakIf != nil {
+			breakIf = c.compileCond(s.breakIf)
+		}
+		return func(m *machine) ctl {
+			for {
+				switch r := body(m); r {
+				case ctlBreak:
+					return ctlNone
+				case ctlReturn, ctlDiscard:
+					return r
+				}
+				if r := continuing(m); r == ctlReturn || r == ctlDiscard {
+					return r
+				}
+				if breakIf(m) {
+					return ctlNone
+				}
+			}
+		}
+	case *returnStmt:
+		if c.cur == nil {
+			c.errorf(s.line, "return outside of a function")
+		}
+		if s.x == nil {
+			return func(m *machine) ctl { return ctlReturn }
+		}
+		fn, t := c.compileExpr(s.x)
+		fn = c.convert(s.line, fn, t, c.cur.ret)
+		return func(m *machine) ctl {
+			m.ret = fn(m)
+			return ctlReturn
+		}
+	case *breakStmt:
+		return func(m *machine) ctl { return ctlBreak }
+	case *continueStmt:
+		return func(m *machine) ctl { return ctlContinue }
+	case *discardStmt:
+		return func(m *machine) ctl { return ctlDiscard }
+	case *switchStmt:
+		return c.compileSwitch(s)
+	}
+	c.errorf(s.stmtLine(), "unsupported statement %T", s)
+	return nil
+}
+
+// compileScoped compiles a statement in its own scope.
+func (c *compiler) compileScoped(s stmt) execFn {
+	c.pushScope()
+	defer c.popScope()
+	return c.compileStmt(s)
+}
+
+func (c *compiler) compileCond(e expr) func(m *machine) bool {
+	fn, t := c.compileExpr(e)
+	if !t.isScalar() {
+		c.errorf(e.exprLine(), "condition must be a scalar, found %v", t)
+	}
+	return func(m *machine) bool { return fn(m).v[0] != 0 }
+}
+
+func (c *compiler) compileSwitch(s *switchStmt) execFn {
+	tag, tt := c.compileExpr(s.tag)
+	if !tt.isScalar() || !tt.isIntegral() {
+		c.errorf(s.line, "switch requires an integer, found %v", tt)
+	}
+	c.pushScope()
+	defer c.popScope()
+
+	caseIndex := map[float64]int{}
+	defaultIndex := -1
+	bodies := make([]execFn, len(s.cases))
+	for i, cc := range s.cases {
+		for _, v := range cc.vals {
+			fn, vt := c.compileExpr(v)
+			if !vt.isScalar() || !vt.isIntegral() {
+				c.errorf(cc.line, "case value must be an integer constant")
+			}
+			caseIndex[fn(c.proto).v[0]] = i
+		}
+		if cc.isDefault {
+			defaultIndex = i
+		}
+		bodies[i] = c.compileBlock(&blockStmt{line: cc.line, stmts: cc.body}, c.lang == "wgsl")
+	}
+	// GLSL cases fall through to the next one unless they break.
+	fallthrough_ := c.lang == "glsl"
+	return func(m *machine) ctl {
+		i, ok := caseIndex[tag(m).v[0]]
+		if !ok {
+			if defaultIndex < 0 {
+				return ctlNone
+			}
+			i = defaultIndex
+		}
+		for ; i < len(bodies); i++ {
+			switch r := bodies[i](m); r {
+			case ctlBreak:
+				return ctlNone
+			case ctlNone:
+				if !fallthrough_ {
+					return ctlNone
+				}
+			default:
+				return r
+			}
+		}
+		return ctlNone
+	}
+}
+
+// Conversions.
+
+// canConvert reports whether a value of type from may be implicitly
+// converted to type to.
+func canConvert(from, to *typ) bool {
+	if from.equal(to) {
+		return true
+	}
+	if from.kind == kArray || to.kind == kArray {
+		return from.kind == kArray && to.kind == kArray &&
+			(from.length == to.length || to.length < 0) && canConvert(from.elem, to.elem)
+	}
+	return from.cols == to.cols && from.rows == to.rows && from.isIntegral() && to.kind == kFloat
+}
+
+// convert converts fn from one type to another for an assignment,
+// initialization, argument, or return value.
+func (c *compiler) convert(line int, fn evalFn, from, to *typ) evalFn {
+	if from.equal(to) || canConvert(from, to) {
+		// Integers are already held as float64s.
+		return fn
+	}
+	if from.isScalar() && to.kind != kArray && to.kind != kVoid && to.size() > 1 {
+		return c.construct(line, to, []evalFn{fn}, []*typ{from})
+	}
+	if to.kind != kArray && from.kind != kArray && from.size() == to.size() {
+		return c.construct(line, to, []evalFn{fn}, []*typ{from})
+	}
+	c.errorf(line, "cannot use %v as %v", from, to)
+	return nil
+}
+
+// castComponent converts a component to the given kind.
+func castComponent(k kind, f float64) float64 {
+	switch k {
+	case kInt:
+		if math.IsNaN(f) {
+			return 0
+		}
+		return float64(int32(math.Max(math.MinInt32, math.Min(math.MaxInt32, math.Trunc(f)))))
+	case kUint:
+		if math.IsNaN(f) || f < 0 {
+			return 0
+		}
+		return float64(uint32(math.Min(math.MaxUint32, math.Trunc(f))))
+	case kBool:
+		if f != 0 {
+			return 1
+		}
+		return 0
+	}
+	return f
+}
+
+// construct compiles a constructor or conversion call.
+func (c *compiler) construct(line int, t *typ, args []evalFn, types []*typ) evalFn {
+	if t.kind == kArray {
+		return c.constructArray(line, t, args, types)
+	}
+	n := t.size()
+	k := t.kind
+	needCast := false
+	total := 0
+	for _, at := range types {
+		if at.kind == kArray {
+			c.errorf(line, "cannot construct %v from an array", t)
+		}
+		total += at.size()
+		// Every kind is already held as a float64 (bools as 0 or 1).
+		if at.kind != k && k != kFloat {
+			needCast = true
+		}
+	}
+	cast := func(v *value) {
+		if needCast {
+			for i := 0; i < n; i++ {
+				v.v[i] = castComponent(k, v.v[i])
+			}
+		}
+	}
+
+	switch {
+	case len(args) == 0:
+		return func(m *machine) value { return value{} }
+	case len(args) == 1 && types[0].isScalar():
+		a := args[0]
+		if t.isMatrix() {
+			// A diagonal matrix.
+			cols, rows := t.cols, t.rows
+			return func(m *machine) value {
+				s := a(m).v[0]
+				var r value
+				for i := 0; i < cols && i < rows; i++ {
+					r.v[i*rows+i] = s
+				}
+				return r
+			}
+		}
+		return func(m *machine) value {
+			s := a(m).v[0]
+			if needCast {
+				s = castComponent(k, s)
+			}
+			var r value
+			for i := 0; i < n; i++ {
+				r.v[i] = s
+			}
+			return r
+		}
+	case len(args) == 1 && types[0].isMatrix() && t.isMatrix():
+		// Resize a matrix, filling in from the identity.
+		a, fc, fr := args[0], types[0].cols, types[0].rows
+		cols, rows := t.cols, t.rows
+		return func(m *machine) value {
+			src := a(m)
+			var r value
+			for i := 0; i < cols; i++ {
+				for j := 0; j < rows; j++ {
+					switch {
+					case i < fc && j < fr:
+						r.v[i*rows+j] = src.v[i*fr+j]
+					case i == j:
+						r.v[i*rows+j] = 1
+					}
+				}
+			}
+			return r
+		}
+	case len(args) == 1:
+		if total < n {
+			c.errorf(line, "not enough components to construct %v from %v", t, types[0])
+		}
+		a := args[0]
+		return func(m *machine) value {
+			r := a(m)
+			for i := n; i < 16; i++ {
+				r.v[i] = 0
+			}
+			cast(&r)
+			return r
+		}
+	}
+
+	if total < n {
+		c.errorf(line, "not enough components to construct %v", t)
+	}
+	sizes := make([]int, len(types))
+	for i, at := range types {
+		sizes[i] = at.size()
+	}
+	return func(m *machine) value {
+		var r value
+		j := 0
+		for i, a := range args {
+			v := a(m)
+			for k := 0; k < sizes[i] && j < n; k++ {
+				r.v[j] = v.v[k]
+				j++
+			}
+		}
+		cast(&r)
+		return r
+	}
+}
+
+func (c *compiler) constructArray(line int, t *typ, args []evalFn, types []*typ) evalFn {
+	elem := t.elem
+	if elem == nil {
+		if len(args) == 0 {
+			c.errorf(line, "cannot infer the type of an empty array")
+		}
+		elem = types[0]
+		for _, at := range types {
+			if at.kind == kFloat {
+				elem = elem.withKind(kFloat)
+			}
+		}
+	}
+	if t.length >= 0 && len(args) != t.length && len(args) != 0 {
+		c.errorf(line, "array of length %v constructed with %v elements", t.length, len(args))
+	}
+	if len(args) == 0 {
+		at := &typ{kind: kArray, elem: elem, length: t.length}
+		return func(m *machine) value { return zeroValue(at) }
+	}
+	conv := make([]evalFn, len(args))
+	for i, a := range args {
+		conv[i] = c.convert(line, a, types[i], elem)
+	}
+	return func(m *machine) value {
+		r := value{arr: make([]value, len(conv))}
+		for i, a := range conv {
+			r.arr[i] = a(m).clone()
+		}
+		return r
+	}
+}
+
+// constructedType returns the type produced by a constructor call,
+// inferring array lengths and element types from the arguments.
+func constructedType(t *typ, types []*typ) *typ {
+	if t.kind != kArray {
+		return t
+	}
+	elem := t.elem
+	if elem == nil && len(types) > 0 {
+		elem = types[0]
+		for _, at := range types {
+			if at.kind == kFloat {
+				elem = elem.withKind(kFloat)
+			}
+		}
+	}
+	length := t.length
+	if length < 0 {
+		length = len(types)
+	}
+	return &typ{kind: kArray, elem: elem, length: length}
+}
+
+func swizzleIndices(name string) ([]int, bool) {
+	if len(name) > 4 {
+		return nil, false
+	}
+	var idx []int
+	for _, set := range []string{"xyzw", "rgba", "stpq"} {
+		idx = idx[:0]
+		for _, ch := range name {
+			i := strings.IndexRune(set, ch)
+			if i < 0 {
+				break
+			}
+			idx = append(idx, i)
+		}
+		if len(idx) == len(name) {
+			return idx, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,766 @@
+package shader
+
+import (
+	"math"
+)
+
+// compileExpr compiles an expression into a closure and returns its type.
+func (c *compiler) compileExpr(e expr) (evalFn, *typ) {
+	switch e := e.(type) {
+	case *numberExpr:
+		v := scalar(e.val)
+		if e.isInt {
+			if u := e.text[len(e.text)-1]; u == 'u' || u == 'U' {
+				return func(m *machine) value { return v }, tUint
+			}
+			return func(m *machine) value { return v }, tInt
+		}
+		return func(m *machine) value { return v }, tFloat
+	case *boolExpr:
+		v := boolValue(e.val)
+		return func(m *machine) value { return v }, tBool
+	case *identExpr:
+		v := c.lookup(e.name)
+		if v == nil {
+			c.errorf(e.line, "undefined: %v", e.name)
+		}
+		addr := v.addr
+		return func(m *machine) value { return m.mem[addr] }, v.typ
+	case *unaryExpr:
+		return c.compileUnary(e)
+	case *binaryExpr:
+		return c.compileBinary(e)
+	case *condExpr:
+		cond := c.compileCond(e.cond)
+		yes, yt := c.compileExpr(e.yes)
+		no, nt := c.compileExpr(e.no)
+		t := yt
+		if !yt.equal(nt) {
+			switch {
+			case canConvert(nt, yt):
+			case canConvert(yt, nt):
+				t = nt
+			default:
+				c.errorf(e.line, "mismatched types %v and %v in ?:", yt, nt)
+			}
+		}
+		return func(m *machine) value {
+			if cond(m) {
+				return yes(m)
+			}
+			return no(m)
+		}, t
+	case *callExpr:
+		return c.compileCall(e)
+	case *indexExpr:
+		return c.compileIndex(e)
+	case *fieldExpr:
+		x, xt := c.compileExpr(e.x)
+		idx, ok := swizzleIndices(e.name)
+		if !ok || xt.kind == kArray || xt.isMatrix() {
+			c.errorf(e.line, "invalid field %q of %v", e.name, xt)
+		}
+		for _, i := range idx {
+			if i >= xt.rows {
+				c.errorf(e.line, "swizzle %q out of range for %v", e.name, xt)
+			}
+		}
+		t := vecType(xt.kind, len(idx))
+		if len(idx) == 1 {
+			i := idx[0]
+			return func(m *machine) value { return scalar(x(m).v[i]) }, t
+		}
+		return func(m *machine) value {
+			v := x(m)
+			var r value
+			for j, i := range idx {
+				r.v[j] = v.v[i]
+			}
+			return r
+		}, t
+	case *lengthExpr:
+		_, xt := c.compileExpr(e.x)
+		var n int
+		switch {
+		case xt.kind == kArray:
+			n = xt.length
+		case xt.isMatrix():
+			n = xt.cols
+		default:
+			n = xt.rows
+		}
+		v := scalar(float64(n))
+		return func(m *machine) value { return v }, tInt
+	case *assignExpr:
+		return c.compileAssign(e)
+	case *incDecExpr:
+		lv := c.compileLvalue(e.x)
+		if !lv.typ.isNumeric() || lv.typ.kind == kArray {
+			c.errorf(e.line, "invalid operation %v on %v", e.op, lv.typ)
+		}
+		delta := 1.0
+		if e.op == "--" {
+			delta = -1
+		}
+		n, prefix := lv.typ.size(), e.prefix
+		return func(m *machine) value {
+			old := lv.load(m)
+			nv := old
+			for i := 0; i < n; i++ {
+				nv.v[i] += delta
+			}
+			lv.store(m, nv)
+			if prefix {
+				return nv
+			}
+			return old
+		}, lv.typ
+	case *commaExpr:
+		var list []evalFn
+		var t *typ
+		for _, x := range e.list {
+			var fn evalFn
+			fn, t = c.compileExpr(x)
+			list = append(list, fn)
+		}
+		return func(m *machine) value {
+			var r value
+			for _, fn := range list {
+				r = fn(m)
+			}
+			return r
+		}, t
+	}
+	c.errorf(e.exprLine(), "unsupported expression %T", e)
+	return nil, nil
+}
+
+func (c *compiler) compileUnary(e *unaryExpr) (evalFn, *typ) {
+	x, t := c.compileExpr(e.x)
+	if t.kind == kArray {
+		c.errorf(e.line, "invalid operation %v on an array", e.op)
+	}
+	n := t.size()
+	switch e.op {
+	case "+":
+		return x, t
+	case "-":
+		if n == 1 {
+			return func(m *machine) value { return scalar(-x(m).v[0]) }, t
+		}
+		return func(m *machine) value {
+			v := x(m)
+			for i := 0; i < n; i++ {
+				v.v[i] = -v.v[i]
+			}
+			return v
+		}, t
+	case "!":
+		if t.kind != kBool {
+			c.errorf(e.line, "operator ! requires a bool, found %v", t)
+		}
+		return func(m *machine) value {
+			v := x(m)
+			for i := 0; i < n; i++ {
+				v.v[i] = 1 - v.v[i]
+			}
+			return v
+		}, t
+	case "~":
+		if !t.isIntegral() {
+			c.errorf(e.line, "operator ~ requires an integer, found %v", t)
+		}
+		k := t.kind
+		return func(m *machine) value {
+			v := x(m)
+			for i := 0; i < n; i++ {
+				v.v[i] = castComponent(k, float64(^int64(v.v[i])))
+			}
+			return v
+		}, t
+	}
+	c.errorf(e.line, "unknown operator %v", e.op)
+	return nil, nil
+}
+
+func (c *compiler) compileBinary(e *binaryExpr) (evalFn, *typ) {
+	x, xt := c.compileExpr(e.x)
+	y, yt := c.compileExpr(e.y)
+	return c.binaryOp(e.line, e.op, x, xt, y, yt)
+}
+
+// binaryOp compiles x op y.
+func (c *compiler) binaryOp(line int, op string, x evalFn, xt *typ, y evalFn, yt *typ) (evalFn, *typ) {
+	if xt.kind == kArray || yt.kind == kArray || xt.kind == kVoid || yt.kind == kVoid {
+		c.errorf(line, "invalid operation: %v %v %v", xt, op, yt)
+	}
+
+	switch op {
+	case "&&", "||", "^^":
+		if !xt.isScalar() || !yt.isScalar() {
+			c.errorf(line, "operator %v requires scalars, found %v and %v", op, xt, yt)
+		}
+		switch op {
+		case "&&":
+			return func(m *machine) value { return boolValue(x(m).v[0] != 0 && y(m).v[0] != 0) }, tBool
+		case "||":
+			return func(m *machine) value { return boolValue(x(m).v[0] != 0 || y(m).v[0] != 0) }, tBool
+		}
+		return func(m *machine) value { return boolValue((x(m).v[0] != 0) != (y(m).v[0] != 0)) }, tBool
+
+	case "==", "!=":
+		if c.lang == "glsl" || (xt.isScalar() && yt.isScalar()) {
+			// GLSL compares whole values.
+			n := max(xt.size(), yt.size())
+			eq := op == "=="
+			return func(m *machine) value {
+				a, b := x(m), y(m)
+				same := true
+				for i := 0; i < n; i++ {
+					if a.v[i] != b.v[i] {
+						same = false
+						break
+					}
+				}
+				return boolValue(same == eq)
+			}, tBool
+		}
+		fallthrough
+	case "<", ">", "<=", ">=":
+		n := c.componentCount(line, op, xt, yt)
+		if n > 1 && c.lang == "glsl" {
+			c.errorf(line, "operator %v requires scalars in GLSL; use lessThan() and friends", op)
+		}
+		cmp := comparison(op)
+		if n == 1 {
+			return func(m *machine) value { return boolValue(cmp(x(m).v[0], y(m).v[0])) }, tBool
+		}
+		bx, by := xt.size() == 1, yt.size() == 1
+		return func(m *machine) value {
+			a, b := x(m), y(m)
+			var r value
+			for i := 0; i < n; i++ {
+				ai, bi := a.v[i], b.v[i]
+				if bx {
+					ai = a.v[0]
+				}
+				if by {
+					bi = b.v[0]
+				}
+				if cmp(ai, bi) {
+					r.v[i] = 1
+				}
+			}
+			return r
+		}, vecType(kBool, n)
+	}
+
+	if op == "*" && (xt.isMatrix() || yt.isMatrix()) && !xt.isScalar() && !yt.isScalar() {
+		return c.matrixMultiply(line, x, xt, y, yt)
+	}
+
+	// Component-wise arithmetic (with scalar broadcasting).
+	var rt *typ
+	switch {
+	case xt.isMatrix() || yt.isMatrix():
+		rt = xt
+		if xt.isScalar() {
+			rt = yt
+		}
+		if !xt.isScalar() && !yt.isScalar() && (xt.cols != yt.cols || xt.rows != yt.rows) {
+			c.errorf(line, "mismatched matrices %v %v %v", xt, op, yt)
+		}
+	default:
+		n := c.componentCount(line, op, xt, yt)
+		k := xt.kind
+		if xt.kind != yt.kind {
+			switch {
+			case xt.kind == kFloat || yt.kind == kFloat:
+				k = kFloat
+			case xt.kind == kUint || yt.kind == kUint:
+				k = kUint
+			}
+		}
+		if k == kBool {
+			switch op {
+			case "&", "|", "^":
+			default:
+				c.errorf(line, "invalid operation: %v %v %v", xt, op, yt)
+			}
+		}
+		rt = vecType(k, n)
+	}
+
+	f := arithmetic(line, op, rt.kind, c)
+	n := rt.size()
+	bx, by := xt.size() == 1 && n > 1, yt.size() == 1 && n > 1
+	switch {
+	case n == 1:
+		if rt.isIntegral() && (op == "+" || op == "-" || op == "*") {
+			return func(m *machine) value { return scalar(f(x(m).v[0], y(m).v[0])) }, rt
+		}
+		switch op {
+		case "+":
+			return func(m *machine) value { return scalar(x(m).v[0] + y(m).v[0]) }, rt
+		case "-":
+			return func(m *machine) value { return scalar(x(m).v[0] - y(m).v[0]) }, rt
+		case "*":
+			return func(m *machine) value { return scalar(x(m).v[0] * y(m).v[0]) }, rt
+		case "/":
+			if rt.kind == kFloat {
+				return func(m *machine) value { return scalar(x(m).v[0] / y(m).v[0]) }, rt
+			}
+		}
+		return func(m *machine) value { return scalar(f(x(m).v[0], y(m).v[0])) }, rt
+	case bx:
+		return func(m *machine) value {
+			a, b := x(m).v[0], y(m)
+			for i := 0; i < n; i++ {
+				b.v[i] = f(a, b.v[i])
+			}
+			return b
+		}, rt
+	case by:
+		return func(m *machine) value {
+			a, b := x(m), y(m).v[0]
+			for i := 0; i < n; i++ {
+				a.v[i] = f(a.v[i], b)
+			}
+			return a
+		}, rt
+	}
+	return func(m *machine) value {
+		a, b := x(m), y(m)
+		for i := 0; i < n; i++ {
+			a.v[i] = f(a.v[i], b.v[i])
+		}
+		return a
+	}, rt
+}
+
+// componentCount returns the number of components of a component-wise
+// operation between xt and yt (where scalars are broadcast).
+func (c *compiler) componentCount(line int, op string, xt, yt *typ) int {
+	nx, ny := xt.size(), yt.size()
+	switch {
+	case nx == ny:
+		return nx
+	case nx == 1:
+		return ny
+	case ny == 1:
+		return nx
+	}
+	c.errorf(line, "mismatched types %v %v %v", xt, op, yt)
+	return 0
+}
+
+func comparison(op string) func(a, b float64) bool {
+	switch op {
+	case "<":
+		return func(a, b float64) bool { return a < b }
+	case ">":
+		return func(a, b float64) bool { return a > b }
+	case "<=":
+		return func(a, b float64) bool { return a <= b }
+	case ">=":
+		return func(a, b float64) bool { return a >= b }
+	case "==":
+		return func(a, b float64) bool { return a == b }
+	}
+	return func(a, b float64) bool { return a != b }
+}
+
+// arithmetic returns the component operation for op on kind k.
+func arithmetic(line int, op string, k kind, c *compiler) func(a, b float64) float64 {
+	integral := k == kInt || k == kUint
+	wrap := func(f float64) float64 {
+		if k == kUint {
+			return float64(uint32(int64(f)))
+		}
+		return float64(int32(int64(f)))
+	}
+	switch op {
+	case "+":
+		if integral {
+			return func(a, b float64) float64 { return wrap(a + b) }
+		}
+		return func(a, b float64) float64 { return a + b }
+	case "-":
+		if integral {
+			return func(a, b float64) float64 { return wrap(a - b) }
+		}
+		return func(a, b float64) float64 { return a - b }
+	case "*":
+		if integral {
+			return func(a, b float64) float64 { return wrap(a * b) }
+		}
+		return func(a, b float64) float64 { return a * b }
+	case "/":
+		if integral {
+			return func(a, b float64) float64 {
+				if b == 0 {
+					return 0
+				}
+				return math.Trunc(a / b)
+			}
+		}
+		return func(a, b float64) float64 { return a / b }
+	case "%":
+		if integral {
+			return func(a, b float64) float64 {
+				if b == 0 {
+					return 0
+				}
+				return math.Mod(a, b)
+			}
+		}
+		// WGSL's floating-point remainder truncates like C's fmod.
+		return math.Mod
+	case "&", "|", "^", "<<", ">>":
+		if !integral && k != kBool {
+			c.errorf(line, "operator %v requires integers", op)
+		}
+		bitwise := map[string]func(a, b int64) int64{
+			"&":  func(a, b int64) int64 { return a & b },
+			"|":  func(a, b int64) int64 { return a | b },
+			"^":  func(a, b int64) int64 { return a ^ b },
+			"<<": func(a, b int64) int64 { return a << uint(b&31) },
+			">>": func(a, b int64) int64 { return a >> uint(b&31) },
+		}[op]
+		if k == kBool {
+			return func(a, b float64) float64 { return float64(bitwise(int64(a), int64(b))) }
+		}
+		return func(a, b float64) float64 { return wrap(float64(bitwise(int64(a), int64(b)))) }
+	}
+	c.errorf(line, "unknown operator %v", op)
+	return nil
+}
+
+// matrixMultiply compiles the linear-algebraic product of matrices and
+// vectors (matrices are column-major).
+func (c *compiler) matrixMultiply(line int, x evalFn, xt *typ, y evalFn, yt *typ) (evalFn, *typ) {
+	switch {
+	case xt.isMatrix() && yt.isMatrix():
+		if xt.cols != yt.rows {
+			c.errorf(line, "mismatched matrices %v * %v", xt, yt)
+		}
+		rows, inner, cols := xt.rows, xt.cols, yt.cols
+		return func(m *machine) value {
+			a, b := x(m), y(m)
+			var r value
+			for j := 0; j < cols; j++ {
+				for i := 0; i < rows; i++ {
+					var sum float64
+					for k := 0; k < inner; k++ {
+						sum += a.v[k*rows+i] * b.v[j*inner+k]
+					}
+					r.v[j*rows+i] = sum
+				}
+			}
+			return r
+		}, matType(cols, rows)
+	case xt.isMatrix():
+		// matrix * column vector
+		if xt.cols != yt.rows {
+			c.errorf(line, "mismatched types %v * %v", xt, yt)
+		}
+		rows, cols := xt.rows, xt.cols
+		return func(m *machine) value {
+			a, b := x(m), y(m)
+			var r value
+			for i := 0; i < rows; i++ {
+				var sum float64
+				for k := 0; k < cols; k++ {
+					sum += a.v[k*rows+i] * b.v[k]
+				}
+				r.v[i] = sum
+			}
+			return r
+		}, vecType(kFloat, rows)
+	default:
+		// row vector * matrix
+		if xt.rows != yt.rows {
+			c.errorf(line, "mismatched types %v * %v", xt, yt)
+		}
+		rows, cols := yt.rows, yt.cols
+		return func(m *machine) value {
+			a, b := x(m), y(m)
+			var r value
+			for j := 0; j < cols; j++ {
+				var sum float64
+				for k := 0; k < rows; k++ {
+					sum += a.v[k] * b.v[j*rows+k]
+				}
+				r.v[j] = sum
+			}
+			return r
+		}, vecType(kFloat, cols)
+	}
+}
+
+func (c *compiler) compileIndex(e *indexExpr) (evalFn, *typ) {
+	x, xt := c.compileExpr(e.x)
+	idx, it := c.compileExpr(e.idx)
+	if !it.isScalar() || !it.isIntegral() {
+		c.errorf(e.line, "index must be an integer, found %v", it)
+	}
+	switch {
+	case xt.kind == kArray:
+		n := xt.length
+		return func(m *machine) value {
+			return x(m).arr[clampIndex(idx(m).v[0], n)]
+		}, xt.elem
+	case xt.isMatrix():
+		rows, cols := xt.rows, xt.cols
+		return func(m *machine) value {
+			i := clampIndex(idx(m).v[0], cols)
+			v := x(m)
+			var r value
+			copy(r.v[:rows], v.v[i*rows:(i+1)*rows])
+			return r
+		}, vecType(kFloat, rows)
+	case xt.isVector():
+		n := xt.rows
+		return func(m *machine) value { return scalar(x(m).v[clampIndex(idx(m).v[0], n)]) }, vecType(xt.kind, 1)
+	}
+	c.errorf(e.line, "cannot index %v", xt)
+	return nil, nil
+}
+
+// clampIndex clamps out-of-range indices (as WGSL does) instead of panicking.
+func clampIndex(f float64, n int) int {
+	i := int(f)
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+func (c *compiler) compileAssign(e *assignExpr) (evalFn, *typ) {
+	lv := c.compileLvalue(e.lhs)
+	rhs, rt := c.compileExpr(e.rhs)
+	if e.op != "=" {
+		cur := lv.load
+		var t *typ
+		rhs, t = c.binaryOp(e.line, e.op[:len(e.op)-1], cur, lv.typ, rhs, rt)
+		rt = t
+	}
+	rhs = c.convert(e.line, rhs, rt, lv.typ)
+	isArray := lv.typ.kind == kArray
+	return func(m *machine) value {
+		v := rhs(m)
+		if isArray {
+			v = v.clone()
+		}
+		lv.store(m, v)
+		return v
+	}, lv.typ
+}
+
+// lvalue is an assignable location: a variable, an array element, a
+// matrix column, or some components of a vector.
+type lvalue struct {
+	typ *typ
+	// ptr returns the value holding the location.
+	ptr func(m *machine) *value
+	// off returns the offset of the first component (nil means 0).
+	off func(m *machine) int
+	// comps lists the components (relative to off); nil means the whole value.
+	comps []int
+}
+
+func (lv *lvalue) offset(m *machine) int {
+	if lv.off == nil {
+		return 0
+	}
+	return lv.off(m)
+}
+
+func (lv *lvalue) load(m *machine) value {
+	p := lv.ptr(m)
+	if lv.comps == nil {
+		return *p
+	}
+	o := lv.offset(m)
+	var r value
+	for i, c := range lv.comps {
+		r.v[i] = p.v[o+c]
+	}
+	return r
+}
+
+func (lv *lvalue) store(m *machine, v value) {
+	p := lv.ptr(m)
+	if lv.comps == nil {
+		*p = v
+		return
+	}
+	o := lv.offset(m)
+	for i, c := range lv.comps {
+		p.v[o+c] = v.v[i]
+	}
+}
+
+var componentLists = [...][]int{{0}, {0, 1}, {0, 1, 2}, {0, 1, 2, 3}}
+
+func (c *compiler) compileLvalue(e expr) *lvalue {
+	switch e := e.(type) {
+	case *identExpr:
+		v := c.lookup(e.name)
+		if v == nil {
+			c.errorf(e.line, "undefined: %v", e.name)
+		}
+		if v.isConst {
+			c.errorf(e.line, "cannot assign to constant %v", e.name)
+		}
+		addr := v.addr
+		return &lvalue{typ: v.typ, ptr: func(m *machine) *value { return &m.mem[addr] }}
+	case *indexExpr:
+		base := c.compileLvalue(e.x)
+		idx, it := c.compileExpr(e.idx)
+		if !it.isScalar() || !it.isIntegral() {
+			c.errorf(e.line, "index must be an integer, found %v", it)
+		}
+		bt := base.typ
+		switch {
+		case bt.kind == kArray:
+			if base.comps != nil {
+				c.errorf(e.line, "invalid array assignment")
+			}
+			n, ptr := bt.length, base.ptr
+			return &lvalue{typ: bt.elem, ptr: func(m *machine) *value {
+				return &ptr(m).arr[clampIndex(idx(m).v[0], n)]
+			}}
+		case bt.isMatrix():
+			cols, rows := bt.cols, bt.rows
+			return &lvalue{typ: vecType(kFloat, rows), ptr: base.ptr, comps: componentLists[rows-1],
+				off: func(m *machine) int { return base.offset(m) + clampIndex(idx(m).v[0], cols)*rows }}
+		case bt.isVector():
+			n := bt.rows
+			if base.comps != nil {
+				comps := base.comps
+				return &lvalue{typ: vecType(bt.kind, 1), ptr: base.ptr, off: func(m *machine) int {
+					return base.offset(m) + comps[clampIndex(idx(m).v[0], n)]
+				}, comps: componentLists[0]}
+			}
+			return &lvalue{typ: vecType(bt.kind, 1), ptr: base.ptr, comps: componentLists[0],
+				off: func(m *machine) int { return base.offset(m) + clampIndex(idx(m).v[0], n) }}
+		}
+		c.errorf(e.line, "cannot index %v", bt)
+	case *fieldExpr:
+		base := c.compileLvalue(e.x)
+		idx, ok := swizzleIndices(e.name)
+		bt := base.typ
+		if !ok || bt.kind == kArray || bt.isMatrix() {
+			c.errorf(e.line, "invalid field %q of %v", e.name, bt)
+		}
+		comps := make([]int, len(idx))
+		for j, i := range idx {
+			if i >= bt.rows {
+				c.errorf(e.line, "swizzle %q out of range for %v", e.name, bt)
+			}
+			comps[j] = i
+			if base.comps != nil {
+				comps[j] = base.comps[i]
+			}
+		}
+		return &lvalue{typ: vecType(bt.kind, len(idx)), ptr: base.ptr, off: base.off, comps: comps}
+	}
+	c.errorf(e.exprLine(), "cannot assign to this expression")
+	return nil
+}
+
+func (c *compiler) compileCall(e *callExpr) (evalFn, *typ) {
+	args := make([]evalFn, len(e.args))
+	types := make([]*typ, len(e.args))
+	for i, a := range e.args {
+		args[i], types[i] = c.compileExpr(a)
+	}
+	if e.typ != nil {
+		t := constructedType(c.resolveType(e.line, e.typ), types)
+		return c.construct(e.line, t, args, types), t
+	}
+	if fns, ok := c.funcs[e.fn]; ok {
+		return c.compileUserCall(e, fns, args, types)
+	}
+	if fn, t := c.builtin(e.line, e.fn, args, types); fn != nil {
+		return fn, t
+	}
+	c.errorf(e.line, "undefined function: %v", e.fn)
+	return nil, nil
+}
+
+func (c *compiler) compileUserCall(e *callExpr, fns []*function, args []evalFn, types []*typ) (evalFn, *typ) {
+	// Choose the overload that needs the fewest implicit conversions.
+	var fn *function
+	best := -1
+	for _, f := range fns {
+		if len(f.params) != len(args) {
+			continue
+		}
+		cost := 0
+		for i, p := range f.params {
+			switch {
+			case p.typ.equal(types[i]):
+			case canConvert(types[i], p.typ):
+				cost++
+			default:
+				cost = -1
+			}
+			if cost < 0 {
+				break
+			}
+		}
+		if cost >= 0 && (best < 0 || cost < best) {
+			fn, best = f, cost
+		}
+	}
+	if fn == nil {
+		c.errorf(e.line, "no matching overload of %v for arguments %v", e.fn, types)
+	}
+	c.callsUser = true
+
+	n := len(args)
+	scratch := c.alloc()
+	for i := 1; i < n; i++ {
+		c.alloc()
+	}
+	addrs := make([]int, n)
+	isArray := make([]bool, n)
+	var outs []*lvalue
+	var outIdx []int
+	for i, p := range fn.params {
+		addrs[i] = p.addr
+		isArray[i] = p.typ.kind == kArray
+		args[i] = c.convert(e.line, args[i], types[i], p.typ)
+		if fn.decl.params[i].out {
+			outs = append(outs, c.compileLvalue(e.args[i]))
+			outIdx = append(outIdx, i)
+		}
+	}
+	hasRet := fn.ret.kind != kVoid
+	return func(m *machine) value {
+		for i, a := range args {
+			m.mem[scratch+i] = a(m)
+		}
+		for i, addr := range addrs {
+			if isArray[i] {
+				m.mem[addr] = m.mem[scratch+i].clone()
+			} else {
+				m.mem[addr] = m.mem[scratch+i]
+			}
+		}
+		fn.body(m)
+		var r value
+		if hasRet {
+			r = m.ret
+		}
+		for j, lv := range outs {
+			lv.store(m, m.mem[addrs[outIdx[j]]].clone())
+		}
+		return r
+	}, fn.ret
+}
@@ -0,0 +1,127 @@
+package shader
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Span is a run of shader source with the syntax class used to
+// highlight it: "comment", "string", "number", "keyword", "type",
+// "builtin", "preproc" (GLSL directives), "attr" (WGSL attributes), or
+// "" for everything else.
+type Span struct {
+	Class string
+	Text  string
+}
+
+var (
+	highlightKeywords = map[string]map[string]bool{
+		"glsl": wordSet(`break case const continue default discard do else false for highp if in inout lowp mediump out precision return struct switch true uniform while`),
+		"wgsl": wordSet(`alias break case const const_assert continue continuing default diagnostic discard else enable false fn for if let loop override requires return struct switch true var while`),
+	}
+	highlightTypes = map[string]map[string]bool{
+		"glsl": wordSet(`bool float int uint void`),
+		"wgsl": wordSet(`array atomic bool f16 f32 i32 ptr u32 function private workgroup uniform storage`),
+	}
+	glslVectorTypeRE = regexp.MustCompile(`^([biud]?vec[234]|d?mat[234](x[234])?)$`)
+	wgslVectorTypeRE = regexp.MustCompile(`^(vec[234][fhiu]?|mat[234]x[234][fh]?)$`)
+
+	highlightBuiltins = wordSet(`all any cross determinant distance dot faceForward faceforward length normalize not reflect select transpose`)
+)
+
+func wordSet(words string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		m[w] = true
+	}
+	return m
+}
+
+// Highlight splits the shader src written in lang into spans for syntax
+// highlighting. Unlike the compiler, it accepts any input: the spans
+// always concatenate back to src.
+func Highlight(lang, src string) []Span {
+	var spans []Span
+	add := func(class, text string) {
+		if n := len(spans); n > 0 && spans[n-1].Class == class {
+			spans[n-1].Text += text
+			return
+		}
+		spans = append(spans, Span{Class: class, Text: text})
+	}
+	lineStart := true
+	for i := 0; i < len(src); {
+		c := src[i]
+		j := i + 1
+		class := ""
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			if j = strings.IndexByte(src[i:], '\n'); j < 0 {
+				j = len(src)
+			} else {
+				j += i
+			}
+			class = "comment"
+		case strings.HasPrefix(src[i:], "/*"):
+			if j = strings.Index(src[i+2:], "*/"); j < 0 {
+				j = len(src)
+			} else {
+				j += i + 4
+			}
+			class = "comment"
+		case c == '#' && lineStart && lang == "glsl":
+			// Directives run to the end of the line, including
+			// backslash continuations.
+			for j = i; j < len(src) && (src[j] != '\n' || src[j-1] == '\\'); j++ {
+			}
+			class = "preproc"
+		case c == '"':
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				j++
+			}
+			if j < len(src) && src[j] == '"' {
+				j++
+			}
+			class = "string"
+		case c == '@' && lang == "wgsl":
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			class = "attr"
+		case isIdentStart(c):
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			class = wordClass(lang, src[i:j])
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			if j = scanNumber(src, i); j <= i {
+				j = i + 1
+			}
+			class = "number"
+		}
+		add(class, src[i:j])
+		if c == '\n' {
+			lineStart = true
+		} else if c != ' ' && c != '\t' {
+			lineStart = false
+		}
+		i = j
+	}
+	return spans
+}
+
+func wordClass(lang, word string) string {
+	switch {
+	case highlightKeywords[lang][word]:
+		return "keyword"
+	case highlightTypes[lang][word],
+		lang == "glsl" && glslVectorTypeRE.MatchString(word),
+		lang == "wgsl" && wgslVectorTypeRE.MatchString(word):
+		return "type"
+	case unaryBuiltins[word] != nil, unaryKindBuiltins[word] != nil,
+		binaryBuiltins[word] != nil, ternaryBuiltins[word] != nil,
+		relationalBuiltins[word] != "", highlightBuiltins[word]:
+		return "builtin"
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package shader_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gmlewis/irmf-examples/irmf"
+	"github.com/gmlewis/irmf-examples/shader"
+)
+
+// TestInclude compiles a shader whose #includes are expanded as the
+// tools do before compiling.
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		t.Helper()
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("lygia/math/saturate.glsl", `#ifndef FNC_SATURATE
+#define FNC_SATURATE
+#define saturate(x) clamp(x, 0.0, 1.0)
+#endif
+`)
+	write("lygia/sdf/sphereSDF.glsl", `#include "../math/saturate.glsl"
+#ifndef FNC_SPHERESDF
+#define FNC_SPHERESDF
+float sphereSDF(vec3 p, float s) { return length(p) - s; }
+#endif
+`)
+
+	src := `#include "lygia/sdf/sphereSDF.glsl"
+#include "lygia/math/saturate.glsl"
+void mainModel4(out vec4 materials, in vec3 xyz) {
+  materials = vec4(sphereSDF(xyz, 2.0) <= 0.0 ? 1.0 : 0.0, saturate(xyz.x), 0.0, 0.0);
+}
+`
+	inc := &irmf.Includer{Dir: dir}
+	expanded, err := inc.Expand(src)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if got := len(inc.Included); got != 2 {
+		t.Errorf("Included %v files, want 2", got)
+	}
+	p, err := shader.Compile("glsl", expanded, "mainModel4")
+	if err != nil {
+		t.Fatalf("Compile: %v\n%v", err, expanded)
+	}
+	e := p.NewEvaluator()
+	out := make([]float64, p.NumMaterials())
+	for _, tt := range []struct {
+		xyz  [3]float64
+		want [2]float64
+	}{
+		{[3]float64{0.5, 0, 0}, [2]float64{1, 0.5}},
+		{[3]float64{3, 0, 0}, [2]float64{0, 1}},
+		{[3]float64{-1, 0, 0}, [2]float64{1, 0}},
+	} {
+		e.Eval(tt.xyz[0], tt.xyz[1], tt.xyz[2], out)
+		if out[0] != tt.want[0] || out[1] != tt.want[1] {
+			t.Errorf("at %v: materials = %v, want %v", tt.xyz, out[:2], tt.want)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package shader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Minify returns a smaller version of the shader src written in lang
+// whose entry point is entry (see Compile). It removes comments and
+// whitespace, expands GLSL macros, drops functions that the entry point
+// does not use, gives the parameters and local variables of the
+// remaining functions and the functions and global variables other than
+// the entry point short names, and shortens float literals such as
+// "0.50" to ".5". The output wraps lines at about width columns.
+//
+// The transformations do not change how the shader evaluates, but
+// callers that need a guarantee should also compare the compiled
+// programs (see irmf.Model.Minify).
+func Minify(lang, src, entry string, width int) (string, error) {
+	if lang != "glsl" && lang != "wgsl" {
+		return "", fmt.Errorf("unsupported shader language %q", lang)
+	}
+	if lang == "glsl" {
+		var err error
+		if src, err = preprocess(src, nil); err != nil {
+			return "", err
+		}
+	}
+	f, err := parse(lang, src)
+	if err != nil {
+		return "", err
+	}
+	toks, err := lex(src)
+	if err != nil {
+		return "", err
+	}
+	toks = toks[:len(toks)-1] // EOF
+
+	items := splitItems(lang, toks)
+	var funcItems []*item
+	for _, it := range items {
+		if it.fn != "" {
+			funcItems = append(funcItems, it)
+		}
+	}
+	if len(funcItems) != len(f.funcs) {
+		return "", fmt.Errorf("found %v functions but parsed %v", len(funcItems), len(f.funcs))
+	}
+	for i, it := range funcItems {
+		if it.fn != f.funcs[i].name {
+			return "", fmt.Errorf("function %v does not match %v", it.fn, f.funcs[i].name)
+		}
+		it.decl = f.funcs[i]
+	}
+
+	markUsed(items, entry)
+
+	// Names that must not be reused: every identifier in the source.
+	taken := map[string]bool{}
+	globals := map[string]bool{}
+	for _, t := range toks {
+		if t.kind == tIdent {
+			taken[t.text] = true
+		}
+	}
+	for _, it := range items {
+		if it.fn != "" {
+			globals[it.fn] = true
+		}
+	}
+	for _, g := range f.globals {
+		globals[g.name] = true
+	}
+
+	var used []*item
+	for _, it := range items {
+		if it.used {
+			it.toks = append([]token(nil), it.toks...)
+			used = append(used, it)
+		}
+	}
+	// Locals are renamed first since they are used most; the globals
+	// then avoid all of their new names.
+	localNames := map[string]bool{}
+	for _, it := range used {
+		if it.decl != nil {
+			for name := range renameLocals(it.toks, it.decl, globals, taken) {
+				localNames[name] = true
+			}
+		}
+	}
+	for name := range localNames {
+		taken[name] = true
+	}
+	renameGlobals(used, globals, entry, taken)
+	var out []token
+	for _, it := range used {
+		out = append(out, it.toks...)
+	}
+	for i, t := range out {
+		if t.kind == tNumber {
+			out[i].text = shortenNumber(t.text)
+		}
+	}
+	return join(out, width), nil
+}
+
+// item is a top-level declaration: a function or a global variable.
+type item struct {
+	toks []token
+	fn   string // the function name, or "" for a variable
+	decl *funcDecl
+	used bool
+}
+
+// splitItems splits the tokens into top-level declarations.
+func splitItems(lang string, toks []token) []*item {
+	var items []*item
+	start, depth := 0, 0
+	for i, t := range toks {
+		switch t.text {
+		case "(", "[", "{":
+			depth++
+			continue
+		case ")", "]":
+			depth--
+			continue
+		case "}":
+			depth--
+			// A function body ends the item unless a ";" follows.
+			if depth > 0 || (i+1 < len(toks) && toks[i+1].text == ";") {
+				continue
+			}
+		case ";":
+			if depth > 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		items = append(items, newItem(lang, toks[start:i+1]))
+		start = i + 1
+	}
+	if start < len(toks) {
+		items = append(items, newItem(lang, toks[start:]))
+	}
+	return items
+}
+
+func newItem(lang string, toks []token) *item {
+	it := &item{toks: toks}
+	if lang == "wgsl" {
+		for i, t := range toks {
+			if t.text == "fn" && i+1 < len(toks) {
+				it.fn = toks[i+1].text
+				break
+			}
+		}
+		return it
+	}
+	// GLSL: "type name(" with no "=" before the "(".
+	for i, t := range toks {
+		if t.text == "=" || t.text == "{" || t.text == "precision" {
+			break
+		}
+		if t.text == "(" {
+			if i >= 2 && toks[i-1].kind == tIdent {
+				it.fn = toks[i-1].text
+			}
+			break
+		}
+	}
+	return it
+}
+
+// markUsed marks the variables and the functions reachable from them
+// or from the entry point.
+func markUsed(items []*item, entry string) {
+	byName := map[string][]*item{}
+	var queue []*item
+	for _, it := range items {
+		if it.fn == "" || it.fn == entry {
+			it.used = true
+			queue = append(queue, it)
+		} else {
+			byName[it.fn] = append(byName[it.fn], it)
+		}
+	}
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+		for i, t := range it.toks {
+			if t.kind != tIdent || (i > 0 && it.toks[i-1].text == ".") {
+				continue
+			}
+			for _, other := range byName[t.text] {
+				if !other.used {
+					other.used = true
+					queue = append(queue, other)
+				}
+			}
+		}
+	}
+}
+
+// renameLocals gives the parameters and local variables of a function
+// short names that are not used anywhere else in the shader and returns
+// the new names.
+func renameLocals(toks []token, fn *funcDecl, globals, taken map[string]bool) map[string]bool {
+	locals := map[string]bool{}
+	for _, prm := range fn.params {
+		locals[prm.name] = true
+	}
+	if fn.body != nil {
+		collectLocals(fn.body, locals)
+	}
+	// Keep names that shadow globals or builtins (called as functions).
+	for i, t := range toks {
+		if globals[t.text] || (i+1 < len(toks) && toks[i+1].text == "(") {
+			delete(locals, t.text)
+		}
+	}
+
+	names := map[string]string{}
+	gen := nameGenerator(taken)
+	for i, t := range toks {
+		if t.kind != tIdent || !locals[t.text] || (i > 0 && toks[i-1].text == ".") {
+			continue
+		}
+		name, ok := names[t.text]
+		if !ok {
+			name = gen()
+			names[t.text] = name
+		}
+		toks[i].text = name
+	}
+	added := map[string]bool{}
+	for _, name := range names {
+		added[name] = true
+	}
+	return added
+}
+
+// renameGlobals gives the functions and global variables other than the
+// entry point short names, the shortest going to the most used. Names
+// that also appear after a "." (as fields or swizzles) are kept.
+func renameGlobals(items []*item, globals map[string]bool, entry string, taken map[string]bool) {
+	keep := map[string]bool{entry: true}
+	count := map[string]int{}
+	for _, it := range items {
+		for i, t := range it.toks {
+			switch {
+			case i > 0 && it.toks[i-1].text == ".":
+				keep[t.text] = true
+			case globals[t.text]:
+				count[t.text]++
+			}
+		}
+	}
+	var names []string
+	for name := range count {
+		if !keep[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(a, b int) bool {
+		ca, cb := count[names[a]], count[names[b]]
+		if ca != cb {
+			return ca > cb
+		}
+		return names[a] < names[b]
+	})
+	gen := nameGenerator(taken)
+	short := map[string]string{}
+	for _, name := range names {
+		if s := gen(); len(s) < len(name) {
+			short[name] = s
+		}
+	}
+	for _, it := range items {
+		for i, t := range it.toks {
+			if s, ok := short[t.text]; ok && (i == 0 || it.toks[i-1].text != ".") {
+				it.toks[i].text = s
+			}
+		}
+	}
+}
+
+func collectLocals(s stmt, locals map[string]bool) {
+	switch s := s.(type) {
+	case *blockStmt:
+		for _, s := range s.stmts {
+			collectLocals(s, locals)
+		}
+	case *declStmt:
+		for _, v := range s.vars {
+			locals[v.name] = true
+		}
+	case *ifStmt:
+		collectLocals(s.then, locals)
+		if s.elseStmt != nil {
+			collectLocals(s.elseStmt, locals)
+		}
+	case *forStmt:
+		if s.init != nil {
+			collectLocals(s.init, locals)
+		}
+		collectLocals(s.body, locals)
+	case *whileStmt:
+		collectLocals(s.body, locals)
+	case *loopStmt:
+		collectLocals(s.body, locals)
+		if s.continuing != nil {
+			collectLocals(s.continuing, locals)
+		}
+	case *switchStmt:
+		for _, c := range s.cases {
+			for _, s := range c.body {
+				collectLocals(s, locals)
+			}
+		}
+	}
+}
+
+// nameGenerator returns a function that yields short identifiers (a, b,
+// ..., z, a0, ...) that are not taken. Letters that begin WGSL type
+// suffixes (as in i32, u8, or f16) are not followed by digits.
+func nameGenerator(taken map[string]bool) func() string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	var names []string
+	for _, c := range letters {
+		names = append(names, string(c))
+	}
+	for _, c := range letters {
+		if strings.ContainsRune("fhiu", c) {
+			continue
+		}
+		for d := '0'; d <= '9'; d++ {
+			names = append(names, string(c)+string(d))
+		}
+		for _, c2 := range letters {
+			names = append(names, string(c)+"_"+string(c2))
+		}
+	}
+	next := 0
+	return func() string {
+		for next < len(names) && taken[names[next]] {
+			next++
+		}
+		if next == len(names) {
+			panic("minify: ran out of local names")
+		}
+		next++
+		return names[next-1]
+	}
+}
+
+// shortenNumber drops redundant zeros from a float literal without a
+// suffix or exponent: "0.50" becomes ".5" and "2.0" becomes "2.".
+func shortenNumber(s string) string {
+	if !strings.Contains(s, ".") || strings.ContainsAny(s, "eExXfFhHiuUlL") {
+		return s
+	}
+	s = strings.TrimRight(s, "0")
+	if strings.HasPrefix(s, "0.") && len(s) > 2 {
+		s = s[1:]
+	}
+	for strings.HasPrefix(s, "00") {
+		s = s[1:]
+	}
+	return s
+}
+
+// join writes the tokens with a space only where two tokens would
+// otherwise merge, starting a new line once a line reaches width.
+func join(toks []token, width int) string {
+	var sb strings.Builder
+	lineLen := 0
+	for i, t := range toks {
+		if i > 0 {
+			switch {
+			case lineLen >= width:
+				sb.WriteString("\n")
+				lineLen = 0
+			case needsSpace(toks[i-1], t):
+				sb.WriteString(" ")
+				lineLen++
+			}
+		}
+		sb.WriteString(t.text)
+		lineLen += len(t.text)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// needsSpace reports whether a and b lex differently when adjacent.
+func needsSpace(a, b token) bool {
+	toks, err := lex(a.text + b.text)
+	return err != nil || len(toks) != 3 || toks[0].text != a.text || toks[1].text != b.text
+}
@@ -0,0 +1,451 @@
+package shader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parser is shared by the GLSL and WGSL front ends. Expressions are
+// parsed by the same code; declarations and statements differ.
+type parser struct {
+	lang string // "glsl" or "wgsl"
+	toks []token
+	pos  int
+}
+
+type parseError struct {
+	line int
+	msg  string
+}
+
+func (e *parseError) Error() string { return fmt.Sprintf("line %v: %v", e.line, e.msg) }
+
+// parse parses preprocessed source in the given language.
+func parse(lang, src string) (f *file, err error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{lang: lang, toks: toks}
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(*parseError)
+			if !ok {
+				panic(r)
+			}
+			f, err = nil, pe
+		}
+	}()
+	if lang == "wgsl" {
+		return p.wgslFile(), nil
+	}
+	return p.glslFile(), nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+func (p *parser) peekN(n int) token {
+	if p.pos+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+n]
+}
+func (p *parser) line() int { return p.peek().line }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...any) {
+	panic(&parseError{line: p.line(), msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tPunct || t.kind == tIdent) && t.text == text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) {
+	if !p.accept(text) {
+		p.errorf("expected %q, found %v", text, p.peek())
+	}
+}
+
+// expectCloseAngle consumes a '>' that closes a WGSL template list,
+// splitting a '>>' or '>=' token if necessary.
+func (p *parser) expectCloseAngle() {
+	t := p.peek()
+	if t.kind == tPunct && len(t.text) > 1 && t.text[0] == '>' {
+		p.toks[p.pos].text = t.text[1:]
+		return
+	}
+	p.expect(">")
+}
+
+func (p *parser) ident() string {
+	t := p.next()
+	if t.kind != tIdent {
+		p.pos--
+		p.errorf("expected identifier, found %v", t)
+	}
+	return t.text
+}
+
+// Expressions.
+
+// expr parses a full (GLSL comma) expression.
+func (p *parser) expr() expr {
+	line := p.line()
+	x := p.assign()
+	if p.lang == "wgsl" || !p.is(",") {
+		return x
+	}
+	list := []expr{x}
+	for p.accept(",") {
+		list = append(list, p.assign())
+	}
+	return &commaExpr{line: line, list: list}
+}
+
+var assignOps = map[string]bool{
+	"=": true, "+=": true, "-=": true, "*=": true, "/=": true, "%=": true,
+	"&=": true, "|=": true, "^=": true, "<<=": true, ">>=": true,
+}
+
+// assign parses an assignment expression (which, in WGSL, is only
+// allowed as a statement).
+func (p *parser) assign() expr {
+	line := p.line()
+	x := p.ternary()
+	if t := p.peek(); t.kind == tPunct && assignOps[t.text] {
+		p.next()
+		return &assignExpr{line: line, op: t.text, lhs: x, rhs: p.assign()}
+	}
+	return x
+}
+
+func (p *parser) ternary() expr {
+	line := p.line()
+	c := p.binary(1)
+	if p.lang == "glsl" && p.accept("?") {
+		yes := p.assign()
+		p.expect(":")
+		no := p.assign()
+		return &condExpr{line: line, cond: c, yes: yes, no: no}
+	}
+	return c
+}
+
+var binaryPrec = map[string]int{
+	"||": 1, "^^": 2, "&&": 3, "|": 4, "^": 5, "&": 6,
+	"==": 7, "!=": 7, "<": 8, ">": 8, "<=": 8, ">=": 8,
+	"<<": 9, ">>": 9, "+": 10, "-": 10, "*": 11, "/": 11, "%": 11,
+}
+
+func (p *parser) binary(minPrec int) expr {
+	x := p.unary()
+	for {
+		t := p.peek()
+		prec, ok := binaryPrec[t.text]
+		if t.kind != tPunct || !ok || prec < minPrec {
+			return x
+		}
+		p.next()
+		y := p.binary(prec + 1)
+		x = &binaryExpr{line: t.line, op: t.text, x: x, y: y}
+	}
+}
+
+func (p *parser) unary() expr {
+	t := p.peek()
+	if t.kind == tPunct {
+		switch t.text {
+		case "-", "+", "!", "~":
+			p.next()
+			return &unaryExpr{line: t.line, op: t.text, x: p.unary()}
+		case "++", "--":
+			p.next()
+			return &incDecExpr{line: t.line, op: t.text, x: p.unary(), prefix: true}
+		case "&", "*":
+			// WGSL address-of and indirection: a pointer is the
+			// variable it points to.
+			if p.lang == "wgsl" {
+				p.next()
+				return p.unary()
+			}
+		}
+	}
+	return p.postfix(p.primary())
+}
+
+func (p *parser) postfix(x expr) expr {
+	for {
+		t := p.peek()
+		switch {
+		case t.text == "[" && t.kind == tPunct:
+			p.next()
+			idx := p.expr()
+			p.expect("]")
+			x = &indexExpr{line: t.line, x: x, idx: idx}
+		case t.text == "." && t.kind == tPunct:
+			p.next()
+			name := p.ident()
+			if name == "length" && p.is("(") {
+				p.next()
+				p.expect(")")
+				x = &lengthExpr{line: t.line, x: x}
+				continue
+			}
+			x = &fieldExpr{line: t.line, x: x, name: name}
+		case (t.text == "++" || t.text == "--") && t.kind == tPunct:
+			p.next()
+			x = &incDecExpr{line: t.line, op: t.text, x: x}
+		default:
+			return x
+		}
+	}
+}
+
+func (p *parser) primary() expr {
+	t := p.peek()
+	switch t.kind {
+	case tNumber:
+		p.next()
+		return parseNumber(t)
+	case tIdent:
+		switch t.text {
+		case "true", "false":
+			p.next()
+			return &boolExpr{line: t.line, val: t.text == "true"}
+		}
+		if p.isTypeName(t.text) {
+			ty := p.typeRef()
+			args := p.args()
+			return &callExpr{line: t.line, fn: t.text, typ: ty, args: args}
+		}
+		p.next()
+		if p.is("(") {
+			return &callExpr{line: t.line, fn: t.text, args: p.args()}
+		}
+		return &identExpr{line: t.line, name: t.text}
+	case tPunct:
+		if t.text == "(" {
+			p.next()
+			x := p.expr()
+			p.expect(")")
+			return x
+		}
+	}
+	p.errorf("unexpected %v", t)
+	return nil
+}
+
+func (p *parser) args() []expr {
+	p.expect("(")
+	var args []expr
+	for !p.is(")") {
+		args = append(args, p.assign())
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(")")
+	return args
+}
+
+func parseNumber(t token) expr {
+	s := t.text
+	lower := strings.ToLower(s)
+	isHex := strings.HasPrefix(lower, "0x")
+	isFloat := !isHex && (strings.ContainsAny(s, ".eE") || strings.HasSuffix(lower, "f") || strings.HasSuffix(lower, "h"))
+	s = strings.TrimRight(s, "fFhHiuUlL")
+	if isHex {
+		s = t.text
+		s = strings.TrimRight(s, "iuU")
+	}
+	n := &numberExpr{line: t.line, text: t.text, isInt: !isFloat}
+	if isFloat {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			panic(&parseError{line: t.line, msg: fmt.Sprintf("invalid number %q", t.text)})
+		}
+		n.val = v
+		return n
+	}
+	v, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		panic(&parseError{line: t.line, msg: fmt.Sprintf("invalid number %q", t.text)})
+	}
+	n.val = float64(v)
+	return n
+}
+
+// Types.
+
+var glslScalarKinds = map[string]kind{"float": kFloat, "double": kFloat, "int": kInt, "uint": kUint, "bool": kBool}
+var glslVecPrefixes = map[string]kind{"": kFloat, "d": kFloat, "i": kInt, "u": kUint, "b": kBool}
+var wgslScalarKinds = map[string]kind{"f32": kFloat, "f16": kFloat, "i32": kInt, "u32": kUint, "bool": kBool}
+var wgslSuffixKinds = map[string]kind{"f": kFloat, "h": kFloat, "i": kInt, "u": kUint}
+
+// simpleType returns the type named by a single identifier, or nil.
+func (p *parser) simpleType(name string) *typ {
+	if p.lang == "wgsl" {
+		if k, ok := wgslScalarKinds[name]; ok {
+			return vecType(k, 1)
+		}
+		if len(name) == 5 && strings.HasPrefix(name, "vec") {
+			if n := int(name[3] - '0'); n >= 2 && n <= 4 {
+				if k, ok := wgslSuffixKinds[name[4:]]; ok {
+					return vecType(k, n)
+				}
+			}
+		}
+		if len(name) == 7 && strings.HasPrefix(name, "mat") && name[4] == 'x' && (name[6] == 'f' || name[6] == 'h') {
+			c, r := int(name[3]-'0'), int(name[5]-'0')
+			if c >= 2 && c <= 4 && r >= 2 && r <= 4 {
+				return matType(c, r)
+			}
+		}
+		return nil
+	}
+
+	if name == "void" {
+		return tVoid
+	}
+	if k, ok := glslScalarKinds[name]; ok {
+		return vecType(k, 1)
+	}
+	if i := strings.Index(name, "vec"); i >= 0 && len(name) == i+4 {
+		if k, ok := glslVecPrefixes[name[:i]]; ok {
+			if n := int(name[i+3] - '0'); n >= 2 && n <= 4 {
+				return vecType(k, n)
+			}
+		}
+	}
+	name = strings.TrimPrefix(name, "d")
+	if strings.HasPrefix(name, "mat") {
+		switch len(name) {
+		case 4:
+			if n := int(name[3] - '0'); n >= 2 && n <= 4 {
+				return matType(n, n)
+			}
+		case 6:
+			c, r := int(name[3]-'0'), int(name[5]-'0')
+			if name[4] == 'x' && c >= 2 && c <= 4 && r >= 2 && r <= 4 {
+				return matType(c, r)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) isTypeName(name string) bool {
+	if p.simpleType(name) != nil {
+		return true
+	}
+	if p.lang == "wgsl" {
+		switch name {
+		case "vec2", "vec3", "vec4", "array":
+			return true
+		}
+		if len(name) == 6 && strings.HasPrefix(name, "mat") && name[4] == 'x' &&
+			isDigit(name[3]) && isDigit(name[5]) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeRef parses a type: a GLSL type with an optional array suffix
+// ("vec2[6]") or a WGSL type ("vec3<f32>", "array<f32, 4>").
+func (p *parser) typeRef() *typ {
+	line := p.line()
+	name := p.ident()
+	t := p.simpleType(name)
+	if p.lang == "wgsl" && t == nil {
+		switch {
+		case name == "array" && p.is("("):
+			// The element type and length are inferred from the constructor arguments.
+			return &typ{kind: kArray, length: -1}
+		case name == "array":
+			p.expect("<")
+			elem := p.typeRef()
+			length := -1
+			var lenExpr expr
+			if p.accept(",") {
+				length, lenExpr = p.arrayLength()
+			}
+			p.expectCloseAngle()
+			return &typ{kind: kArray, elem: elem, length: length, lenExpr: lenExpr}
+		case name == "ptr":
+			// Pointers are modeled as references to the pointed-to
+			// variable (see wgslFunc).
+			p.expect("<")
+			p.ident()
+			p.expect(",")
+			elem := p.typeRef()
+			if p.accept(",") {
+				p.ident()
+			}
+			p.expectCloseAngle()
+			return elem
+		case p.isTypeName(name):
+			var elem *typ
+			if p.accept("<") {
+				elem = p.typeRef()
+				p.expectCloseAngle()
+			}
+			k := kFloat
+			if elem != nil {
+				k = elem.kind
+			}
+			if name[0] == 'v' {
+				return vecType(k, int(name[3]-'0'))
+			}
+			return matType(int(name[3]-'0'), int(name[5]-'0'))
+		}
+	}
+	if t == nil {
+		panic(&parseError{line: line, msg: fmt.Sprintf("unknown type %q", name)})
+	}
+	if p.lang == "glsl" {
+		t = p.arraySuffix(t)
+	}
+	return t
+}
+
+// arraySuffix parses any GLSL array dimensions following a type or name.
+func (p *parser) arraySuffix(t *typ) *typ {
+	for p.is("[") {
+		p.next()
+		length := -1
+		var lenExpr expr
+		if !p.is("]") {
+			length, lenExpr = p.arrayLength()
+		}
+		p.expect("]")
+		t = &typ{kind: kArray, elem: t, length: length, lenExpr: lenExpr}
+	}
+	return t
+}
+
+func (p *parser) arrayLength() (int, expr) {
+	if t := p.peek(); t.kind == tNumber {
+		if n, ok := parseNumber(p.next()).(*numberExpr); ok && n.isInt {
+			return int(n.val), nil
+		}
+	}
+	return 0, p.binary(1)
+}
@@ -0,0 +1,262 @@
+package shader
+
+// GLSL declarations and statements.
+
+var glslQualifiers = map[string]bool{
+	"const": true, "highp": true, "mediump": true, "lowp": true, "precise": true,
+	"in": true, "out": true, "inout": true, "uniform": true, "flat": true, "smooth": true,
+}
+
+func (p *parser) glslFile() *file {
+	f := &file{}
+	for p.peek().kind != tEOF {
+		if p.accept(";") {
+			continue
+		}
+		if p.accept("precision") {
+			for !p.accept(";") {
+				p.next()
+			}
+			continue
+		}
+		if p.is("struct") {
+			p.errorf("structs are not supported")
+		}
+
+		line := p.line()
+		isConst := false
+		for glslQualifiers[p.peek().text] && p.peek().kind == tIdent {
+			if p.next().text == "const" {
+				isConst = true
+			}
+		}
+		t := p.typeRef()
+		name := p.ident()
+		if p.is("(") {
+			fn := &funcDecl{line: line, name: name, ret: t, params: p.glslParams()}
+			if !p.accept(";") {
+				fn.body = p.glslBlock()
+			}
+			f.funcs = append(f.funcs, fn)
+			continue
+		}
+		f.globals = append(f.globals, p.glslDeclRest(line, t, name, isConst).vars...)
+	}
+	return f
+}
+
+func (p *parser) glslParams() []*param {
+	p.expect("(")
+	var params []*param
+	if p.is("void") && p.peekN(1).text == ")" {
+		p.next()
+	}
+	for !p.is(")") {
+		prm := &param{in: true}
+		for glslQualifiers[p.peek().text] && p.peek().kind == tIdent {
+			switch p.next().text {
+			case "out":
+				prm.out, prm.in = true, false
+			case "inout":
+				prm.out = true
+			}
+		}
+		prm.typ = p.typeRef()
+		if p.peek().kind == tIdent {
+			prm.name = p.ident()
+			prm.typ = p.arraySuffix(prm.typ)
+		}
+		params = append(params, prm)
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(")")
+	return params
+}
+
+// glslDeclRest parses the rest of a declaration after its type and first
+// name: "[N] = init, name2 = init2;".
+func (p *parser) glslDeclRest(line int, t *typ, name string, isConst bool) *declStmt {
+	d := &declStmt{line: line}
+	for {
+		v := &varDecl{line: line, name: name, typ: p.arraySuffix(t), isConst: isConst}
+		if p.accept("=") {
+			v.init = p.assign()
+		}
+		d.vars = append(d.vars, v)
+		if !p.accept(",") {
+			break
+		}
+		name = p.ident()
+	}
+	p.expect(";")
+	return d
+}
+
+func (p *parser) glslBlock() *blockStmt {
+	b := &blockStmt{line: p.line()}
+	p.expect("{")
+	for !p.accept("}") {
+		if p.peek().kind == tEOF {
+			p.errorf("missing '}'")
+		}
+		b.stmts = append(b.stmts, p.glslStmt())
+	}
+	return b
+}
+
+// isGLSLDecl reports whether a declaration starts at the current token.
+func (p *parser) isGLSLDecl() bool {
+	t := p.peek()
+	if t.kind != tIdent {
+		return false
+	}
+	if glslQualifiers[t.text] {
+		return true
+	}
+	if !p.isTypeName(t.text) {
+		return false
+	}
+	// "vec3 v" or "vec2[6] v" but not "vec3(...)".
+	next := p.peekN(1)
+	if next.kind == tIdent {
+		return true
+	}
+	if next.text == "[" {
+		for i := 2; ; i++ {
+			if tk := p.peekN(i); tk.text == "]" {
+				return p.peekN(i+1).kind == tIdent
+			} else if tk.kind == tEOF {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+func (p *parser) glslDecl() *declStmt {
+	line := p.line()
+	isConst := false
+	for glslQualifiers[p.peek().text] && p.peek().kind == tIdent {
+		if p.next().text == "const" {
+			isConst = true
+		}
+	}
+	t := p.typeRef()
+	name := p.ident()
+	return p.glslDeclRest(line, t, name, isConst)
+}
+
+func (p *parser) glslStmt() stmt {
+	t := p.peek()
+	line := t.line
+	if t.kind == tPunct {
+		switch t.text {
+		case "{":
+			return p.glslBlock()
+		case ";":
+			p.next()
+			return &blockStmt{line: line}
+		}
+	}
+	if t.kind == tIdent {
+		switch t.text {
+		case "if":
+			p.next()
+			p.expect("(")
+			s := &ifStmt{line: line, cond: p.expr()}
+			p.expect(")")
+			s.then = p.glslStmt()
+			if p.accept("else") {
+				s.elseStmt = p.glslStmt()
+			}
+			return s
+		case "for":
+			p.next()
+			p.expect("(")
+			s := &forStmt{line: line}
+			if !p.accept(";") {
+				if p.isGLSLDecl() {
+					s.init = p.glslDecl()
+				} else {
+					s.init = &exprStmt{line: line, x: p.expr()}
+					p.expect(";")
+				}
+			}
+			if !p.is(";") {
+				s.cond = p.expr()
+			}
+			p.expect(";")
+			if !p.is(")") {
+				s.post = p.expr()
+			}
+			p.expect(")")
+			s.body = p.glslStmt()
+			return s
+		case "while":
+			p.next()
+			p.expect("(")
+			s := &whileStmt{line: line, cond: p.expr()}
+			p.expect(")")
+			s.body = p.glslStmt()
+			return s
+		case "do":
+			p.next()
+			s := &whileStmt{line: line, isDo: true, body: p.glslStmt()}
+			p.expect("while")
+			p.expect("(")
+			s.cond = p.expr()
+			p.expect(")")
+			p.expect(";")
+			return s
+		case "return":
+			p.next()
+			s := &returnStmt{line: line}
+			if !p.is(";") {
+				s.x = p.expr()
+			}
+			p.expect(";")
+			return s
+		case "break":
+			p.next()
+			p.expect(";")
+			return &breakStmt{line: line}
+		case "continue":
+			p.next()
+			p.expect(";")
+			return &continueStmt{line: line}
+		case "discard":
+			p.next()
+			p.expect(";")
+			return &discardStmt{line: line}
+		case "switch":
+			p.next()
+			p.expect("(")
+			s := &switchStmt{line: line, tag: p.expr()}
+			p.expect(")")
+			p.expect("{")
+			for !p.accept("}") {
+				c := &caseClause{line: p.line()}
+				if p.accept("default") {
+					c.isDefault = true
+				} else {
+					p.expect("case")
+					c.vals = []expr{p.ternary()}
+				}
+				p.expect(":")
+				for !p.is("case") && !p.is("default") && !p.is("}") {
+					c.body = append(c.body, p.glslStmt())
+				}
+				s.cases = append(s.cases, c)
+			}
+			return s
+		}
+		if p.isGLSLDecl() {
+			return p.glslDecl()
+		}
+	}
+	s := &exprStmt{line: line, x: p.expr()}
+	p.expect(";")
+	return s
+}
@@ -0,0 +1,258 @@
+package shader
+
+// WGSL declarations and statements.
+
+func (p *parser) wgslFile() *file {
+	f := &file{}
+	for p.peek().kind != tEOF {
+		if p.accept(";") {
+			continue
+		}
+		p.wgslAttributes()
+		switch t := p.peek(); t.text {
+		case "fn":
+			f.funcs = append(f.funcs, p.wgslFunc())
+		case "const", "let", "var", "override":
+			d := p.wgslDecl()
+			p.expect(";")
+			f.globals = append(f.globals, d.vars...)
+		case "enable", "requires", "diagnostic":
+			for !p.accept(";") {
+				p.next()
+			}
+		case "struct", "alias":
+			p.errorf("%v declarations are not supported", t.text)
+		default:
+			p.errorf("unexpected %v at top level", t)
+		}
+	}
+	return f
+}
+
+// wgslAttributes skips any attributes such as @must_use or @workgroup_size(1).
+func (p *parser) wgslAttributes() {
+	for p.accept("@") {
+		p.ident()
+		if p.is("(") {
+			p.args()
+		}
+	}
+}
+
+func (p *parser) wgslFunc() *funcDecl {
+	fn := &funcDecl{line: p.line(), ret: tVoid}
+	p.expect("fn")
+	fn.name = p.ident()
+	p.expect("(")
+	for !p.is(")") {
+		p.wgslAttributes()
+		prm := &param{in: true, name: p.ident()}
+		p.expect(":")
+		// A ptr<function, T> parameter behaves like a GLSL inout parameter.
+		prm.out = p.is("ptr")
+		prm.typ = p.typeRef()
+		fn.params = append(fn.params, prm)
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(")")
+	if p.accept("->") {
+		p.wgslAttributes()
+		fn.ret = p.typeRef()
+	}
+	fn.body = p.wgslBlock()
+	return fn
+}
+
+// wgslDecl parses "const|let|var[<...>]|override name[: type] [= init]"
+// without the trailing semicolon.
+func (p *parser) wgslDecl() *declStmt {
+	line := p.line()
+	kw := p.next().text
+	if kw == "var" && p.accept("<") {
+		for !p.is(">") {
+			p.next()
+		}
+		p.expectCloseAngle()
+	}
+	v := &varDecl{line: line, name: p.ident(), isConst: kw == "const" || kw == "let"}
+	if p.accept(":") {
+		v.typ = p.typeRef()
+	}
+	if p.accept("=") {
+		v.init = p.binary(1)
+	}
+	if v.typ == nil && v.init == nil {
+		p.errorf("declaration of %v needs a type or an initializer", v.name)
+	}
+	return &declStmt{line: line, vars: []*varDecl{v}}
+}
+
+func (p *parser) wgslBlock() *blockStmt {
+	b := &blockStmt{line: p.line()}
+	p.expect("{")
+	for !p.accept("}") {
+		if p.peek().kind == tEOF {
+			p.errorf("missing '}'")
+		}
+		if s := p.wgslStmt(); s != nil {
+			b.stmts = append(b.stmts, s)
+		}
+	}
+	return b
+}
+
+// wgslSimpleStmt parses an assignment, increment, call, or declaration
+// statement without the trailing semicolon (as used in for headers).
+func (p *parser) wgslSimpleStmt() stmt {
+	line := p.line()
+	switch p.peek().text {
+	case "const", "let", "var":
+		return p.wgslDecl()
+	}
+	if p.is("_") && p.peekN(1).text == "=" {
+		p.next()
+		p.next()
+		return &exprStmt{line: line, x: p.binary(1)}
+	}
+	x := p.unary()
+	if t := p.peek(); t.kind == tPunct && assignOps[t.text] {
+		p.next()
+		return &exprStmt{line: line, x: &assignExpr{line: line, op: t.text, lhs: x, rhs: p.binary(1)}}
+	}
+	return &exprStmt{line: line, x: x}
+}
+
+func (p *parser) wgslStmt() stmt {
+	p.wgslAttributes()
+	t := p.peek()
+	line := t.line
+	if t.kind == tPunct {
+		switch t.text {
+		case "{":
+			return p.wgslBlock()
+		case ";":
+			p.next()
+			return nil
+		}
+	}
+	switch t.text {
+	case "if":
+		return p.wgslIf()
+	case "for":
+		p.next()
+		p.expect("(")
+		s := &forStmt{line: line}
+		if !p.is(";") {
+			s.init = p.wgslSimpleStmt()
+		}
+		p.expect(";")
+		if !p.is(";") {
+			s.cond = p.binary(1)
+		}
+		p.expect(";")
+		if !p.is(")") {
+			s.post = p.wgslSimpleStmt().(*exprStmt).x
+		}
+		p.expect(")")
+		s.body = p.wgslBlock()
+		return s
+	case "while":
+		p.next()
+		s := &whileStmt{line: line, cond: p.binary(1)}
+		s.body = p.wgslBlock()
+		return s
+	case "loop":
+		p.next()
+		s := &loopStmt{line: line, body: &blockStmt{line: line}}
+		p.expect("{")
+		for !p.accept("}") {
+			if p.accept("continuing") {
+				s.continuing = &blockStmt{line: p.line()}
+				p.expect("{")
+				for !p.accept("}") {
+					if p.is("break") && p.peekN(1).text == "if" {
+						p.next()
+						p.next()
+						s.breakIf = p.binary(1)
+						p.expect(";")
+						continue
+					}
+					if st := p.wgslStmt(); st != nil {
+						s.continuing.stmts = append(s.continuing.stmts, st)
+					}
+				}
+				continue
+			}
+			if st := p.wgslStmt(); st != nil {
+				s.body.stmts = append(s.body.stmts, st)
+			}
+		}
+		return s
+	case "return":
+		p.next()
+		s := &returnStmt{line: line}
+		if !p.is(";") {
+			s.x = p.binary(1)
+		}
+		p.expect(";")
+		return s
+	case "break":
+		p.next()
+		p.expect(";")
+		return &breakStmt{line: line}
+	case "continue":
+		p.next()
+		p.expect(";")
+		return &continueStmt{line: line}
+	case "discard":
+		p.next()
+		p.expect(";")
+		return &discardStmt{line: line}
+	case "switch":
+		p.next()
+		s := &switchStmt{line: line, tag: p.binary(1)}
+		p.expect("{")
+		for !p.accept("}") {
+			c := &caseClause{line: p.line()}
+			if p.accept("default") {
+				c.isDefault = true
+			} else {
+				p.expect("case")
+				for !p.is(":") && !p.is("{") {
+					if p.accept("default") {
+						c.isDefault = true
+					} else {
+						c.vals = append(c.vals, p.binary(1))
+					}
+					if !p.accept(",") {
+						break
+					}
+				}
+			}
+			p.accept(":")
+			c.body = p.wgslBlock().stmts
+			s.cases = append(s.cases, c)
+		}
+		return s
+	}
+	s := p.wgslSimpleStmt()
+	p.expect(";")
+	return s
+}
+
+func (p *parser) wgslIf() stmt {
+	line := p.line()
+	p.expect("if")
+	s := &ifStmt{line: line, cond: p.binary(1)}
+	s.then = p.wgslBlock()
+	if p.accept("else") {
+		if p.is("if") {
+			s.elseStmt = p.wgslIf()
+		} else {
+			s.elseStmt = p.wgslBlock()
+		}
+	}
+	return s
+}
@@ -0,0 +1,518 @@
+package shader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// macro is a #define.
+type macro struct {
+	params []string // nil for object-like macros
+	isFunc bool
+	body   string
+}
+
+// preprocess runs the GLSL preprocessor over src: comments are removed,
+// #define/#undef macros are expanded, and #if/#ifdef/#ifndef/#elif/
+// #else/#endif conditionals are evaluated. #include directives must
+// already have been expanded (see the irmf package). Line numbers are
+// preserved.
+func preprocess(src string, predefined map[string]string) (string, error) {
+	p := &preprocessor{macros: map[string]*macro{}}
+	for k, v := range predefined {
+		p.macros[k] = &macro{body: v}
+	}
+
+	lines := strings.Split(stripComments(src), "\n")
+	var out []string
+	// active is a stack of conditional states.
+	type cond struct {
+		active, taken, parentActive bool
+	}
+	var conds []cond
+	active := true
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		// Join continuation lines, keeping the line count.
+		joined := 0
+		for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+			i++
+			joined++
+			line = strings.TrimSuffix(line, "\\") + " " + lines[i]
+		}
+		emit := func(s string) {
+			out = append(out, s)
+			for j := 0; j < joined; j++ {
+				out = append(out, "")
+			}
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "#") {
+			if !active {
+				emit("")
+				continue
+			}
+			expanded, err := p.expand(line, nil)
+			if err != nil {
+				return "", fmt.Errorf("line %v: %v", i+1, err)
+			}
+			emit(expanded)
+			continue
+		}
+
+		directive := strings.TrimSpace(trimmed[1:])
+		name, rest, _ := strings.Cut(directive, " ")
+		if j := strings.IndexAny(directive, " \t("); j >= 0 && directive[j] != ' ' {
+			name, rest = directive[:j], directive[j:]
+		}
+		rest = strings.TrimSpace(rest)
+
+		switch name {
+		case "if", "ifdef", "ifndef":
+			c := cond{parentActive: active}
+			if active {
+				v, err := p.condition(name, rest)
+				if err != nil {
+					return "", fmt.Errorf("line %v: #%v: %v", i+1, name, err)
+				}
+				c.active, c.taken = v, v
+			}
+			conds = append(conds, c)
+			active = c.active
+		case "elif":
+			if len(conds) == 0 {
+				return "", fmt.Errorf("line %v: #elif without #if", i+1)
+			}
+			c := &conds[len(conds)-1]
+			c.active = false
+			if c.parentActive && !c.taken {
+				v, err := p.condition("if", rest)
+				if err != nil {
+					return "", fmt.Errorf("line %v: #elif: %v", i+1, err)
+				}
+				c.active, c.taken = v, v
+			}
+			active = c.active
+		case "else":
+			if len(conds) == 0 {
+				return "", fmt.Errorf("line %v: #else without #if", i+1)
+			}
+			c := &conds[len(conds)-1]
+			c.active = c.parentActive && !c.taken
+			c.taken = true
+			active = c.active
+		case "endif":
+			if len(conds) == 0 {
+				return "", fmt.Errorf("line %v: #endif without #if", i+1)
+			}
+			active = conds[len(conds)-1].parentActive
+			conds = conds[:len(conds)-1]
+		case "define":
+			if active {
+				if err := p.define(rest); err != nil {
+					return "", fmt.Errorf("line %v: #define: %v", i+1, err)
+				}
+			}
+		case "undef":
+			if active {
+				delete(p.macros, rest)
+			}
+		case "include":
+			if active {
+				return "", fmt.Errorf("line %v: unresolved #include %v", i+1, rest)
+			}
+		case "version", "extension", "pragma", "line":
+		case "error":
+			if active {
+				return "", fmt.Errorf("line %v: #error %v", i+1, rest)
+			}
+		default:
+			if active {
+				return "", fmt.Errorf("line %v: unknown directive #%v", i+1, name)
+			}
+		}
+		emit("")
+	}
+	if len(conds) > 0 {
+		return "", fmt.Errorf("missing #endif")
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// stripComments replaces comments with spaces, keeping newlines.
+func stripComments(src string) string {
+	var b strings.Builder
+	for i := 0; i < len(src); {
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			} else {
+				end += 2
+			}
+			comment := src[i : i+2+end]
+			b.WriteString(" ")
+			b.WriteString(strings.Repeat("\n", strings.Count(comment, "\n")))
+			i += len(comment)
+			if i > len(src) {
+				i = len(src)
+			}
+		default:
+			b.WriteByte(src[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+type preprocessor struct {
+	macros map[string]*macro
+}
+
+func (p *preprocessor) define(s string) error {
+	i := 0
+	for i < len(s) && isIdentChar(s[i]) {
+		i++
+	}
+	name := s[:i]
+	if name == "" || !isIdentStart(name[0]) {
+		return fmt.Errorf("invalid macro name in %q", s)
+	}
+	m := &macro{}
+	if i < len(s) && s[i] == '(' {
+		end := strings.IndexByte(s[i:], ')')
+		if end < 0 {
+			return fmt.Errorf("missing ')' in %q", s)
+		}
+		m.isFunc = true
+		for _, param := range strings.Split(s[i+1:i+end], ",") {
+			if param = strings.TrimSpace(param); param != "" {
+				m.params = append(m.params, param)
+			}
+		}
+		i += end + 1
+	}
+	m.body = strings.TrimSpace(s[i:])
+	p.macros[name] = m
+	return nil
+}
+
+// expand expands the macros in s. Macros in disabled are not expanded
+// (to prevent infinite recursion).
+func (p *preprocessor) expand(s string, disabled map[string]bool) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		if isDigit(c) {
+			// Skip numbers so that suffixes and exponents are not taken as identifiers.
+			j := scanNumber(s, i)
+			b.WriteString(s[i:j])
+			i = j
+			continue
+		}
+		if !isIdentStart(c) {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(s) && isIdentChar(s[j]) {
+			j++
+		}
+		name := s[i:j]
+		m, ok := p.macros[name]
+		if !ok || disabled[name] {
+			b.WriteString(name)
+			i = j
+			continue
+		}
+
+		body := m.body
+		if m.isFunc {
+			k := j
+			for k < len(s) && (s[k] == ' ' || s[k] == '\t') {
+				k++
+			}
+			if k >= len(s) || s[k] != '(' {
+				// A function-like macro name without arguments is not expanded.
+				b.WriteString(name)
+				i = j
+				continue
+			}
+			args, end, err := splitMacroArgs(s, k)
+			if err != nil {
+				return "", fmt.Errorf("macro %v: %v", name, err)
+			}
+			if len(args) != len(m.params) && !(len(m.params) == 0 && len(args) == 1 && strings.TrimSpace(args[0]) == "") {
+				return "", fmt.Errorf("macro %v expects %v arguments, got %v", name, len(m.params), len(args))
+			}
+			subst := map[string]string{}
+			for n, param := range m.params {
+				arg, err := p.expand(strings.TrimSpace(args[n]), disabled)
+				if err != nil {
+					return "", err
+				}
+				subst[param] = arg
+			}
+			body = replaceIdents(body, subst)
+			j = end
+		}
+
+		inner := map[string]bool{name: true}
+		for k := range disabled {
+			inner[k] = true
+		}
+		expanded, err := p.expand(body, inner)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(expanded)
+		i = j
+	}
+	return b.String(), nil
+}
+
+// splitMacroArgs splits the parenthesized arguments starting at s[open]
+// and returns them along with the index just past the closing paren.
+func splitMacroArgs(s string, open int) ([]string, int, error) {
+	depth := 0
+	var args []string
+	start := open + 1
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return append(args, s[start:i]), i + 1, nil
+			}
+		case ',':
+			if depth == 1 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return nil, 0, fmt.Errorf("unterminated argument list")
+}
+
+// replaceIdents replaces whole identifiers in s.
+func replaceIdents(s string, subst map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if !isIdentStart(s[i]) {
+			if isDigit(s[i]) {
+				j := scanNumber(s, i)
+				b.WriteString(s[i:j])
+				i = j
+				continue
+			}
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(s) && isIdentChar(s[j]) {
+			j++
+		}
+		if r, ok := subst[s[i:j]]; ok {
+			b.WriteString(r)
+		} else {
+			b.WriteString(s[i:j])
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// condition evaluates the argument of an #if, #ifdef, or #ifndef.
+func (p *preprocessor) condition(directive, rest string) (bool, error) {
+	switch directive {
+	case "ifdef":
+		_, ok := p.macros[strings.TrimSpace(rest)]
+		return ok, nil
+	case "ifndef":
+		_, ok := p.macros[strings.TrimSpace(rest)]
+		return !ok, nil
+	}
+
+	// Replace defined(X) and defined X before expanding macros.
+	var b strings.Builder
+	for i := 0; i < len(rest); {
+		if strings.HasPrefix(rest[i:], "defined") && (i == 0 || !isIdentChar(rest[i-1])) &&
+			(i+7 == len(rest) || !isIdentChar(rest[i+7])) {
+			j := i + 7
+			for j < len(rest) && (rest[j] == ' ' || rest[j] == '(') {
+				j++
+			}
+			k := j
+			for k < len(rest) && isIdentChar(rest[k]) {
+				k++
+			}
+			name := rest[j:k]
+			for k < len(rest) && (rest[k] == ' ' || rest[k] == ')') {
+				k++
+			}
+			if _, ok := p.macros[name]; ok {
+				b.WriteString(" 1 ")
+			} else {
+				b.WriteString(" 0 ")
+			}
+			i = k
+			continue
+		}
+		b.WriteByte(rest[i])
+		i++
+	}
+	expanded, err := p.expand(b.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	toks, err := lex(expanded)
+	if err != nil {
+		return false, err
+	}
+	e := &condEval{toks: toks}
+	v, err := e.parse(0)
+	if err != nil {
+		return false, err
+	}
+	if e.toks[e.pos].kind != tEOF {
+		return false, fmt.Errorf("unexpected %v", e.toks[e.pos])
+	}
+	return v != 0, nil
+}
+
+// condEval evaluates integer #if expressions. Undefined identifiers are 0.
+type condEval struct {
+	toks []token
+	pos  int
+}
+
+var condPrec = map[string]int{
+	"||": 1, "&&": 2, "|": 3, "^": 4, "&": 5,
+	"==": 6, "!=": 6, "<": 7, ">": 7, "<=": 7, ">=": 7,
+	"<<": 8, ">>": 8, "+": 9, "-": 9, "*": 10, "/": 10, "%": 10,
+}
+
+func (e *condEval) parse(minPrec int) (int64, error) {
+	x, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		t := e.toks[e.pos]
+		prec, ok := condPrec[t.text]
+		if t.kind != tPunct || !ok || prec <= minPrec {
+			return x, nil
+		}
+		e.pos++
+		y, err := e.parse(prec)
+		if err != nil {
+			return 0, err
+		}
+		b2i := func(b bool) int64 {
+			if b {
+				return 1
+			}
+			return 0
+		}
+		switch t.text {
+		case "||":
+			x = b2i(x != 0 || y != 0)
+		case "&&":
+			x = b2i(x != 0 && y != 0)
+		case "|":
+			x |= y
+		case "^":
+			x ^= y
+		case "&":
+			x &= y
+		case "==":
+			x = b2i(x == y)
+		case "!=":
+			x = b2i(x != y)
+		case "<":
+			x = b2i(x < y)
+		case ">":
+			x = b2i(x > y)
+		case "<=":
+			x = b2i(x <= y)
+		case ">=":
+			x = b2i(x >= y)
+		case "<<":
+			x <<= uint(y)
+		case ">>":
+			x >>= uint(y)
+		case "+":
+			x += y
+		case "-":
+			x -= y
+		case "*":
+			x *= y
+		case "/", "%":
+			if y == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			if t.text == "/" {
+				x /= y
+			} else {
+				x %= y
+			}
+		}
+	}
+}
+
+func (e *condEval) unary() (int64, error) {
+	t := e.toks[e.pos]
+	e.pos++
+	switch {
+	case t.kind == tNumber:
+		s := strings.TrimRight(t.text, "uUlL")
+		v, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(s, 64)
+			if ferr != nil {
+				return 0, err
+			}
+			v = int64(f)
+		}
+		return v, nil
+	case t.kind == tIdent:
+		return 0, nil
+	case t.text == "(":
+		v, err := e.parse(0)
+		if err != nil {
+			return 0, err
+		}
+		if e.toks[e.pos].text != ")" {
+			return 0, fmt.Errorf("missing ')'")
+		}
+		e.pos++
+		return v, nil
+	case t.text == "!":
+		v, err := e.unary()
+		if v == 0 {
+			return 1, err
+		}
+		return 0, err
+	case t.text == "-":
+		v, err := e.unary()
+		return -v, err
+	case t.text == "+":
+		return e.unary()
+	case t.text == "~":
+		v, err := e.unary()
+		return ^v, err
+	}
+	return 0, fmt.Errorf("unexpected %v", t)
+}
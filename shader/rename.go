@@ -0,0 +1,108 @@
+package shader
+
+import (
+	"regexp"
+	"strings"
+)
+
+var defineRE = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*define[ \t]+(\w+)`)
+
+// Globals returns the names declared at the top level of the shader src
+// written in lang: its functions, global constants and variables, and,
+// in GLSL, its macros.
+func Globals(lang, src string) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	pre := src
+	if lang == "glsl" {
+		for _, m := range defineRE.FindAllStringSubmatch(src, -1) {
+			add(m[1])
+		}
+		var err error
+		if pre, err = preprocess(src, nil); err != nil {
+			return nil, err
+		}
+	}
+	f, err := parse(lang, pre)
+	if err != nil {
+		return nil, err
+	}
+	for _, fn := range f.funcs {
+		add(fn.name)
+	}
+	for _, v := range f.globals {
+		add(v.name)
+	}
+	return names, nil
+}
+
+// RenameGlobals returns src with every use of the top-level names it
+// declares (see Globals) replaced by rename(name). Comments and layout
+// are kept. Since the names are replaced wherever they appear, except
+// after a "." (as fields or swizzles), locals that shadow a global are
+// renamed consistently too.
+func RenameGlobals(lang, src string, rename func(name string) string) (string, error) {
+	names, err := Globals(lang, src)
+	if err != nil {
+		return "", err
+	}
+	global := map[string]bool{}
+	for _, name := range names {
+		global[name] = true
+	}
+
+	var sb strings.Builder
+	var last byte // the last character outside comments and whitespace
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			j := strings.IndexByte(src[i:], '\n')
+			if j < 0 {
+				j = len(src) - i
+			}
+			sb.WriteString(src[i : i+j])
+			i += j
+		case strings.HasPrefix(src[i:], "/*"):
+			j := strings.Index(src[i+2:], "*/")
+			if j < 0 {
+				j = len(src) - i - 4
+			}
+			sb.WriteString(src[i : i+j+4])
+			i += j + 4
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			name := src[i:j]
+			if global[name] && last != '.' {
+				name = rename(name)
+			}
+			sb.WriteString(name)
+			last, i = 'a', j
+		case isDigit(c):
+			// Skip numbers so that suffixes and exponents are not
+			// mistaken for names.
+			j := i + 1
+			for j < len(src) && (isIdentChar(src[j]) || src[j] == '.') {
+				j++
+			}
+			sb.WriteString(src[i:j])
+			last, i = '0', j
+		default:
+			sb.WriteByte(c)
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				last = c
+			}
+			i++
+		}
+	}
+	return sb.String(), nil
+}
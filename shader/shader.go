@@ -0,0 +1,124 @@
+// Package shader evaluates IRMF shaders on the CPU.
+//
+// It implements the subset of GLSL and WGSL used by IRMF models (no
+// structs, textures, or recursion) well enough to sample a model's
+// materials at arbitrary points without a GPU or an OpenGL context.
+// A Program is compiled once; each goroutine then uses its own
+// Evaluator.
+package shader
+
+import (
+	"fmt"
+)
+
+// Program is a compiled IRMF shader.
+type Program struct {
+	numMaterials int
+	entry        *function
+	// out is the address of the GLSL "out" materials parameter (WGSL
+	// returns the materials instead).
+	out   int
+	isOut bool
+	proto *machine
+}
+
+// Compile compiles the shader src written in lang ("glsl" or "wgsl")
+// whose entry point is the named mainModel4, mainModel9, or mainModel16
+// function. Any #include directives must already have been expanded.
+func Compile(lang, src, entry string) (*Program, error) {
+	if lang != "glsl" && lang != "wgsl" {
+		return nil, fmt.Errorf("unsupported shader language %q", lang)
+	}
+	if lang == "glsl" {
+		var err error
+		if src, err = preprocess(src, nil); err != nil {
+			return nil, err
+		}
+	}
+	f, err := parse(lang, src)
+	if err != nil {
+		return nil, err
+	}
+	c, err := compileFile(lang, f)
+	if err != nil {
+		return nil, err
+	}
+
+	fns := c.funcs[entry]
+	if len(fns) != 1 {
+		return nil, fmt.Errorf("shader must define exactly one %v function", entry)
+	}
+	fn := fns[0]
+	p := &Program{entry: fn, proto: c.proto}
+	vec3 := vecType(kFloat, 3)
+	switch lang {
+	case "glsl":
+		// void mainModelN(out vecN materials, in vec3 xyz)
+		if fn.ret.kind != kVoid || len(fn.params) != 2 || !fn.decl.params[0].out ||
+			!fn.params[1].typ.equal(vec3) {
+			return nil, fmt.Errorf("%v must be declared as: void %v(out vec4 materials, in vec3 xyz)", entry, entry)
+		}
+		p.out, p.isOut = fn.params[0].addr, true
+		p.numMaterials = fn.params[0].typ.size()
+		if fn.params[0].typ.kind == kArray {
+			p.numMaterials = fn.params[0].typ.length
+		}
+	default:
+		// fn mainModelN(xyz: vec3f) -> vecNf
+		if len(fn.params) != 1 || !fn.params[0].typ.equal(vec3) || fn.ret.kind == kVoid {
+			return nil, fmt.Errorf("%v must be declared as: fn %v(xyz: vec3f) -> vec4f", entry, entry)
+		}
+		p.numMaterials = fn.ret.size()
+		if fn.ret.kind == kArray {
+			p.numMaterials = fn.ret.length
+		}
+	}
+	return p, nil
+}
+
+// NumMaterials returns the number of material values the shader produces.
+func (p *Program) NumMaterials() int { return p.numMaterials }
+
+// Evaluator evaluates a Program. It is not safe for concurrent use.
+type Evaluator struct {
+	p *Program
+	m *machine
+	// xyz is the address of the entry point's position parameter.
+	xyz int
+}
+
+// NewEvaluator returns a new Evaluator with its own copy of the
+// program's globals.
+func (p *Program) NewEvaluator() *Evaluator {
+	m := &machine{mem: make([]value, len(p.proto.mem))}
+	for i, v := range p.proto.mem {
+		m.mem[i] = v.clone()
+	}
+	xyz := p.entry.params[len(p.entry.params)-1].addr
+	return &Evaluator{p: p, m: m, xyz: xyz}
+}
+
+// Eval evaluates the materials at (x,y,z) into out, which must have room
+// for NumMaterials values. Materials of discarded points are zero.
+func (e *Evaluator) Eval(x, y, z float64, out []float64) {
+	m := e.m
+	m.mem[e.xyz] = value{v: [16]float64{x, y, z}}
+	var result value
+	if e.p.isOut {
+		m.mem[e.p.out] = value{}
+	}
+	if e.p.entry.body(m) != ctlDiscard {
+		if e.p.isOut {
+			result = m.mem[e.p.out]
+		} else {
+			result = m.ret
+		}
+	}
+	if result.arr != nil {
+		for i := range out[:e.p.numMaterials] {
+			out[i] = result.arr[i].v[0]
+		}
+		return
+	}
+	copy(out[:e.p.numMaterials], result.v[:])
+}
@@ -0,0 +1,308 @@
+package shader
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// evalCase compiles a shader and checks its materials at fixed points.
+type evalCase struct {
+	name string
+	lang string
+	src  string
+	// at maps points to the wanted leading materials.
+	at map[[3]float64][]float64
+}
+
+func runEvalCases(t *testing.T, tests []evalCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compile(tt.lang, tt.src, "mainModel4")
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			e := p.NewEvaluator()
+			out := make([]float64, p.NumMaterials())
+			for xyz, want := range tt.at {
+				e.Eval(xyz[0], xyz[1], xyz[2], out)
+				for i, w := range want {
+					if math.Abs(out[i]-w) > 1e-9 {
+						t.Errorf("at %v: materials = %v, want %v", xyz, out[:len(want)], want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func glslMain(body string) string {
+	return "void mainModel4(out vec4 materials, in vec3 xyz) {\n" + body + "\n}\n"
+}
+
+func wgslMain(body string) string {
+	return "fn mainModel4(xyz: vec3f) -> vec4f {\n" + body + "\n}\n"
+}
+
+func TestGLSL(t *testing.T) {
+	runEvalCases(t, []evalCase{
+		{
+			name: "swizzle read",
+			lang: "glsl",
+			src:  glslMain(`vec3 p = xyz.zyx; materials = vec4(p.xy, xyz.x + xyz.y, xyz.xxx.z);`),
+			at:   map[[3]float64][]float64{{1, 2, 3}: {3, 2, 3, 1}},
+		},
+		{
+			name: "swizzle write",
+			lang: "glsl",
+			src:  glslMain(`vec4 m = vec4(0.0); m.yx = xyz.xy; m.w = 5.0; m.z += 1.0; materials = m;`),
+			at:   map[[3]float64][]float64{{1, 2, 3}: {2, 1, 1, 5}},
+		},
+		{
+			name: "out and inout parameters",
+			lang: "glsl",
+			src: `void f(inout float a, out float b, in float c) { a += 1.0; b = a * c; c = 100.0; }
+` + glslMain(`float a = xyz.x; float b; float c = 2.0; f(a, b, c); materials = vec4(a, b, c, 0.0);`),
+			at: map[[3]float64][]float64{{1, 0, 0}: {2, 4, 2, 0}},
+		},
+		{
+			name: "for loop with break and continue",
+			lang: "glsl",
+			src: glslMain(`float s = 0.0;
+for (int i = 0; i < 10; i++) {
+  if (i == 2) { continue; }
+  if (i == 5) { break; }
+  s += float(i);
+}
+int n = 0;
+while (true) { n++; if (n >= int(xyz.x)) break; }
+materials = vec4(s, float(n), 0.0, 0.0);`),
+			at: map[[3]float64][]float64{{3, 0, 0}: {8, 3}, {7, 0, 0}: {8, 7}},
+		},
+		{
+			name: "define",
+			lang: "glsl",
+			src: `#define R 5.0
+#define SQ(x) ((x)*(x))
+#ifdef R
+#define HAS_R 1.0
+#else
+#define HAS_R 0.0
+#endif
+#ifndef MISSING
+#define NOT_MISSING 1.0
+#endif
+` + glslMain(`materials = vec4(SQ(xyz.x + 1.0) + R, HAS_R, NOT_MISSING, 0.0);`),
+			at: map[[3]float64][]float64{{2, 0, 0}: {14, 1, 1}},
+		},
+		{
+			name: "ternary",
+			lang: "glsl",
+			src:  glslMain(`materials[0] = xyz.x > 0.0 ? 1.0 : 2.0; materials[1] = xyz.y < 0.0 ? (xyz.z > 0.0 ? 3.0 : 4.0) : 5.0;`),
+			at:   map[[3]float64][]float64{{1, -1, 1}: {1, 3}, {-1, -1, -1}: {2, 4}, {0, 1, 0}: {2, 5}},
+		},
+		{
+			name: "discard",
+			lang: "glsl",
+			src:  glslMain(`materials = vec4(1.0); if (xyz.x < 0.0) { discard; }`),
+			at:   map[[3]float64][]float64{{1, 0, 0}: {1, 1}, {-1, 0, 0}: {0, 0}},
+		},
+		{
+			name: "globals, constants, and functions",
+			lang: "glsl",
+			src: `const float k = 2.0;
+float twice(float v) { return k * v; }
+vec2 both(vec2 v) { return vec2(twice(v.x), v.y); }
+` + glslMain(`materials = vec4(both(xyz.xy), twice(twice(xyz.z)), 0.0);`),
+			at: map[[3]float64][]float64{{1, 2, 3}: {2, 2, 12}},
+		},
+		{
+			name: "matrices",
+			lang: "glsl",
+			src: glslMain(`float a = radians(90.0);
+mat3 rz = mat3(cos(a), sin(a), 0.0, -sin(a), cos(a), 0.0, 0.0, 0.0, 1.0);
+vec3 p = rz * xyz;
+materials = vec4(p, 0.0);`),
+			at: map[[3]float64][]float64{{1, 0, 0}: {0, 1, 0}},
+		},
+		{
+			name: "arrays and int arithmetic",
+			lang: "glsl",
+			src: glslMain(`float v[3] = float[3](1.0, 2.0, 4.0);
+float s = 0.0;
+for (int i = 0; i < 3; i++) { s += v[i]; }
+int q = 7 / 2;
+materials = vec4(s, float(q), float(7 % 3), 0.0);`),
+			at: map[[3]float64][]float64{{0, 0, 0}: {7, 3, 1}},
+		},
+	})
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"length(vec3(3.0, 4.0, 0.0))", 5},
+		{"distance(vec2(1.0, 1.0), vec2(4.0, 5.0))", 5},
+		{"dot(vec3(1.0, 2.0, 3.0), vec3(4.0, 5.0, 6.0))", 32},
+		{"cross(vec3(1.0, 0.0, 0.0), vec3(0.0, 1.0, 0.0)).z", 1},
+		{"normalize(vec3(0.0, 3.0, 4.0)).z", 0.8},
+		{"abs(-2.5)", 2.5},
+		{"sign(-2.0)", -1},
+		{"floor(-1.5)", -2},
+		{"ceil(1.2)", 2},
+		{"fract(2.75)", 0.75},
+		{"mod(7.5, 2.0)", 1.5},
+		{"mod(-1.0, 4.0)", 3},
+		{"min(2.0, 3.0)", 2},
+		{"max(vec2(2.0, 5.0), 3.0).y", 5},
+		{"clamp(5.0, 0.0, 1.0)", 1},
+		{"mix(0.0, 10.0, 0.25)", 2.5},
+		{"step(1.0, 0.5)", 0},
+		{"smoothstep(0.0, 1.0, 0.5)", 0.5},
+		{"pow(2.0, 10.0)", 1024},
+		{"sqrt(16.0)", 4},
+		{"inversesqrt(4.0)", 0.5},
+		{"exp(0.0)", 1},
+		{"log(1.0)", 0},
+		{"sin(0.0) + cos(0.0)", 1},
+		{"atan(1.0, 1.0)", math.Pi / 4},
+		{"atan(1.0)", math.Pi / 4},
+		{"degrees(3.14159265358979323846)", 180},
+		{"all(lessThan(vec2(1.0, 2.0), vec2(2.0, 3.0))) ? 1.0 : 0.0", 1},
+		{"any(greaterThan(vec2(1.0, 2.0), vec2(2.0, 3.0))) ? 1.0 : 0.0", 0},
+		{"float(int(3.7))", 3},
+	}
+	var cases []evalCase
+	for _, tt := range tests {
+		cases = append(cases, evalCase{
+			name: tt.expr,
+			lang: "glsl",
+			src:  glslMain("materials[0] = " + tt.expr + ";"),
+			at:   map[[3]float64][]float64{{0, 0, 0}: {tt.want}},
+		})
+	}
+	runEvalCases(t, cases)
+}
+
+func TestWGSL(t *testing.T) {
+	runEvalCases(t, []evalCase{
+		{
+			name: "swizzle read and write",
+			lang: "wgsl",
+			src:  wgslMain(`var m = vec4f(0.0); m.y = xyz.x; let p = xyz.zyx; m.x = p.x; m.z = p.y + xyz.z; return m;`),
+			at:   map[[3]float64][]float64{{1, 2, 3}: {3, 1, 5, 0}},
+		},
+		{
+			name: "ptr parameters",
+			lang: "wgsl",
+			src: `fn f(a: ptr<function, f32>, b: f32) { *a = *a + b; }
+` + wgslMain(`var a = xyz.x; f(&a, 2.0); return vec4f(a, 0.0, 0.0, 0.0);`),
+			at: map[[3]float64][]float64{{1, 0, 0}: {3}},
+		},
+		{
+			name: "loops with break and continue",
+			lang: "wgsl",
+			src: wgslMain(`var s = 0.0;
+for (var i = 0; i < 10; i++) {
+  if (i == 2) { continue; }
+  if (i == 5) { break; }
+  s += f32(i);
+}
+var n = 0;
+loop {
+  n++;
+  if (n >= i32(xyz.x)) { break; }
+}
+return vec4f(s, f32(n), 0.0, 0.0);`),
+			at: map[[3]float64][]float64{{3, 0, 0}: {8, 3}},
+		},
+		{
+			name: "select",
+			lang: "wgsl",
+			src:  wgslMain(`return vec4f(select(2.0, 1.0, xyz.x > 0.0), select(vec2f(1.0), vec2f(3.0, 4.0), xyz.y < 0.0), 0.0);`),
+			at:   map[[3]float64][]float64{{1, -1, 0}: {1, 3, 4}, {-1, 1, 0}: {2, 1, 1}},
+		},
+		{
+			name: "constants and functions",
+			lang: "wgsl",
+			src: `const k = 2.0;
+fn twice(v: f32) -> f32 { return k * v; }
+` + wgslMain(`let d = length(xyz); return vec4f(twice(d), clamp(d, 0.0, 1.0), 0.0, 0.0);`),
+			at: map[[3]float64][]float64{{3, 4, 0}: {10, 1}},
+		},
+	})
+}
+
+// TestTwins checks that the same model written in GLSL and WGSL
+// evaluates identically.
+func TestTwins(t *testing.T) {
+	glsl := `float sdTorus(vec3 p, vec2 t) {
+  vec2 q = vec2(length(p.xz) - t.x, p.y);
+  return length(q) - t.y;
+}
+` + glslMain(`materials = vec4(0.0);
+materials[0] = sdTorus(xyz, vec2(3.0, 1.0)) <= 0.0 ? 1.0 : 0.0;
+materials[1] = smoothstep(-1.0, 1.0, xyz.x);`)
+	wgsl := `fn sdTorus(p: vec3f, t: vec2f) -> f32 {
+  let q = vec2f(length(p.xz) - t.x, p.y);
+  return length(q) - t.y;
+}
+` + wgslMain(`var materials = vec4f(0.0);
+materials[0] = select(0.0, 1.0, sdTorus(xyz, vec2f(3.0, 1.0)) <= 0.0);
+materials[1] = smoothstep(-1.0, 1.0, xyz.x);
+return materials;`)
+	pg, err := Compile("glsl", glsl, "mainModel4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := Compile("wgsl", wgsl, "mainModel4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eg, ew := pg.NewEvaluator(), pw.NewEvaluator()
+	a, b := make([]float64, 4), make([]float64, 4)
+	var inside int
+	for x := -4.0; x <= 4; x += 0.5 {
+		for y := -2.0; y <= 2; y += 0.5 {
+			for z := -4.0; z <= 4; z += 0.5 {
+				eg.Eval(x, y, z, a)
+				ew.Eval(x, y, z, b)
+				for i := range a {
+					if a[i] != b[i] {
+						t.Fatalf("at (%v,%v,%v): glsl %v, wgsl %v", x, y, z, a, b)
+					}
+				}
+				if a[0] > 0 {
+					inside++
+				}
+			}
+		}
+	}
+	if inside == 0 {
+		t.Error("torus is empty")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name, lang, src, want string
+	}{
+		{"unresolved include", "glsl", "#include \"lygia/math/saturate.glsl\"\n" + glslMain(`materials = vec4(1.0);`), "unresolved #include"},
+		{"missing entry point", "glsl", "void f() {}\n", "exactly one mainModel4"},
+		{"wrong signature", "glsl", "void mainModel4(in vec3 xyz) {}\n", "must be declared as"},
+		{"undefined name", "glsl", glslMain(`materials = vec4(nope);`), "nope"},
+		{"unknown language", "hlsl", "", "unsupported shader language"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.lang, tt.src, "mainModel4")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Compile error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
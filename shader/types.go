@@ -0,0 +1,136 @@
+package shader
+
+import "fmt"
+
+type kind int
+
+const (
+	kVoid kind = iota
+	kFloat
+	kInt
+	kUint
+	kBool
+	kArray
+)
+
+// typ is the static type of a value. Scalars have cols == rows == 1,
+// vectors have cols == 1, and matrices are stored column-major.
+type typ struct {
+	kind       kind
+	cols, rows int
+
+	elem   *typ // array element type
+	length int  // array length (-1 if it is taken from the initializer)
+	// lenExpr is a non-literal array length, resolved by the compiler.
+	lenExpr expr
+}
+
+var (
+	tVoid  = &typ{kind: kVoid}
+	tFloat = vecType(kFloat, 1)
+	tInt   = vecType(kInt, 1)
+	tUint  = vecType(kUint, 1)
+	tBool  = vecType(kBool, 1)
+)
+
+func vecType(k kind, n int) *typ { return &typ{kind: k, cols: 1, rows: n} }
+
+func matType(cols, rows int) *typ { return &typ{kind: kFloat, cols: cols, rows: rows} }
+
+func arrayType(elem *typ, length int) *typ { return &typ{kind: kArray, elem: elem, length: length} }
+
+// size returns the number of scalar components.
+func (t *typ) size() int { return t.cols * t.rows }
+
+func (t *typ) isScalar() bool { return t.kind != kArray && t.kind != kVoid && t.size() == 1 }
+func (t *typ) isVector() bool { return t.kind != kArray && t.cols == 1 && t.rows > 1 }
+func (t *typ) isMatrix() bool { return t.kind != kArray && t.cols > 1 }
+func (t *typ) isNumeric() bool {
+	return t.kind == kFloat || t.kind == kInt || t.kind == kUint
+}
+
+// isIntegral reports whether arithmetic on t uses integer semantics.
+func (t *typ) isIntegral() bool { return t.kind == kInt || t.kind == kUint }
+
+// withKind returns the vector type of the same shape with kind k.
+func (t *typ) withKind(k kind) *typ {
+	if t.kind == k {
+		return t
+	}
+	return &typ{kind: k, cols: t.cols, rows: t.rows}
+}
+
+func (t *typ) equal(u *typ) bool {
+	if t.kind != u.kind {
+		return false
+	}
+	if t.kind == kArray {
+		return t.length == u.length && t.elem.equal(u.elem)
+	}
+	return t.cols == u.cols && t.rows == u.rows
+}
+
+func (t *typ) String() string {
+	switch {
+	case t.kind == kVoid:
+		return "void"
+	case t.kind == kArray:
+		return fmt.Sprintf("%v[%v]", t.elem, t.length)
+	case t.isMatrix():
+		if t.cols == t.rows {
+			return fmt.Sprintf("mat%v", t.cols)
+		}
+		return fmt.Sprintf("mat%vx%v", t.cols, t.rows)
+	}
+	prefix := map[kind]string{kFloat: "", kInt: "i", kUint: "u", kBool: "b"}[t.kind]
+	if t.rows == 1 {
+		return map[kind]string{kFloat: "float", kInt: "int", kUint: "uint", kBool: "bool"}[t.kind]
+	}
+	return fmt.Sprintf("%vvec%v", prefix, t.rows)
+}
+
+// value is a runtime value. Every scalar kind is held as a float64
+// (which represents all 32-bit integers exactly) so that the same
+// component-wise code can operate on all of them.
+type value struct {
+	v   [16]float64
+	arr []value
+}
+
+func scalar(f float64) value {
+	var r value
+	r.v[0] = f
+	return r
+}
+
+func boolValue(b bool) value {
+	if b {
+		return scalar(1)
+	}
+	return value{}
+}
+
+// zeroValue returns the zero value of t.
+func zeroValue(t *typ) value {
+	if t.kind != kArray {
+		return value{}
+	}
+	r := value{arr: make([]value, t.length)}
+	for i := range r.arr {
+		r.arr[i] = zeroValue(t.elem)
+	}
+	return r
+}
+
+// clone returns a deep copy of v so that arrays have value semantics.
+func (v value) clone() value {
+	if v.arr == nil {
+		return v
+	}
+	arr := make([]value, len(v.arr))
+	for i, e := range v.arr {
+		arr[i] = e.clone()
+	}
+	v.arr = arr
+	return v
+}
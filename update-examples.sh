@@ -1,4 +1,5 @@
 #!/bin/bash -ex
+go run ./cmd/irmf-inline -w
 go run cmd/update-examples/main.go
 pt -l '##' examples/*/README.md | sort | sed -e 's|/README.md||'
 